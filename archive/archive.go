@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	pruneInterval = time.Hour
+	keyTimeLayout = "2006/01/02/150405"
+)
+
+// Config defines where snapshots are archived. Any object store speaking the
+// S3 API works: AWS S3, Google Cloud Storage through its XML API and HMAC
+// keys, MinIO...
+type Config struct {
+	// Endpoint is the object store base URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or https://storage.googleapis.com
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Retention is how long snapshots are kept, 0 keeps them forever
+	Retention time.Duration
+}
+
+// Enabled tells whether archiving has been configured
+func (c Config) Enabled() bool {
+	return c.Endpoint != "" && c.Bucket != ""
+}
+
+// Archiver writes compressed JSON snapshots to an object store bucket
+type Archiver struct {
+	cfg    Config
+	client *http.Client
+	clock  common.Clock
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+// NewArchiver creates an Archiver
+func NewArchiver(cfg Config) *Archiver {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	return &Archiver{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Minute},
+		clock:  common.SystemClock,
+	}
+}
+
+func (a *Archiver) objectURL(key string) string {
+	return fmt.Sprintf("%s/%s/%s", a.cfg.Endpoint, a.cfg.Bucket, escapePath(key))
+}
+
+// key returns the object key of the snapshot taken at t
+func (a *Archiver) key(t time.Time) string {
+	name := t.UTC().Format(keyTimeLayout) + ".json.gz"
+	if a.cfg.Prefix == "" {
+		return name
+	}
+	return a.cfg.Prefix + "/" + name
+}
+
+// Archive stores v, taken at t, as gzipped JSON and prunes the snapshots
+// older than the retention
+func (a *Archiver) Archive(t time.Time, v interface{}) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(v); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", a.objectURL(a.key(t)), bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if _, err := a.do(req, buf.Bytes()); err != nil {
+		return err
+	}
+
+	now := a.clock.Now()
+	if a.cfg.Retention > 0 && a.shouldPrune(now) {
+		if err := a.prune(now.Add(-a.cfg.Retention)); err != nil {
+			log.Errorf("Error pruning archived snapshots: %v", err)
+		}
+	}
+	return nil
+}
+
+func (a *Archiver) shouldPrune(now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if now.Sub(a.lastPrune) < pruneInterval {
+		return false
+	}
+	a.lastPrune = now
+	return true
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// prune deletes the snapshots under the prefix last modified before cutoff
+func (a *Archiver) prune(cutoff time.Time) error {
+	token := ""
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		if a.cfg.Prefix != "" {
+			q.Set("prefix", a.cfg.Prefix+"/")
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s?%s", a.cfg.Endpoint, a.cfg.Bucket, q.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		data, err := a.do(req, nil)
+		if err != nil {
+			return err
+		}
+		var list listBucketResult
+		if err := xml.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		for _, obj := range list.Contents {
+			if !obj.LastModified.Before(cutoff) {
+				continue
+			}
+			req, err := http.NewRequest("DELETE", a.objectURL(obj.Key), nil)
+			if err != nil {
+				return err
+			}
+			if _, err := a.do(req, nil); err != nil {
+				return err
+			}
+		}
+		if !list.IsTruncated {
+			return nil
+		}
+		token = list.NextContinuationToken
+	}
+}
+
+// do signs and sends req, whose body is payload, returning the response body
+func (a *Archiver) do(req *http.Request, payload []byte) ([]byte, error) {
+	if a.cfg.AccessKey != "" {
+		signV4(req, payload, a.cfg.Region, a.cfg.AccessKey, a.cfg.SecretKey, a.clock.Now())
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: unexpected status code %d: %s", req.Method, req.URL.Path, resp.StatusCode, string(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,130 @@
+package cmdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+)
+
+// Config defines the CMDB the inventory of the account is pushed to
+type Config struct {
+	// URL the inventory is POSTed to, e.g. the ServiceNow import set API
+	// https://instance.service-now.com/api/now/import/u_cassandra_nodes/insertMultiple
+	URL string
+	// Header sent with every push, e.g. "Authorization: Basic ..."
+	Header string
+	// Fields maps the CMDB fields to the inventory ones, e.g. u_name to
+	// nodeId. Every inventory field is pushed under its own name when empty.
+	Fields map[string]string
+	// Interval is the least time between two pushes
+	Interval time.Duration
+}
+
+// Enabled tells whether pushing to a CMDB has been configured
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// ParseFields parses comma separated cmdbField=inventoryField pairs, e.g.
+// u_name=nodeId,u_cluster=clusterName
+func ParseFields(s string) (map[string]string, error) {
+	fields := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid CMDB field %q, expected cmdbField=inventoryField", pair)
+		}
+		fields[kv[0]] = kv[1]
+	}
+	return fields, nil
+}
+
+// Pusher posts the inventory of the account, one record per node, to a CMDB
+// as ServiceNow-style {"records": [...]} JSON
+type Pusher struct {
+	cfg    Config
+	client *http.Client
+	clock  common.Clock
+
+	// mu is held along pushes, so concurrent collections push once
+	mu       sync.Mutex
+	lastPush time.Time
+}
+
+// NewPusher creates a Pusher
+func NewPusher(cfg Config) *Pusher {
+	return &Pusher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Minute},
+		clock:  common.SystemClock,
+	}
+}
+
+// due tells whether the interval since the last successful push is over,
+// p.mu being held
+func (p *Pusher) due() bool {
+	return p.lastPush.IsZero() || p.clock.Now().Sub(p.lastPush) >= p.cfg.Interval
+}
+
+// mapFields renames the fields of the records after the CMDB ones
+func (p *Pusher) mapFields(records []map[string]string) []map[string]string {
+	if len(p.cfg.Fields) == 0 {
+		return records
+	}
+	mapped := make([]map[string]string, len(records))
+	for i, r := range records {
+		mapped[i] = make(map[string]string, len(p.cfg.Fields))
+		for field, source := range p.cfg.Fields {
+			mapped[i][field] = r[source]
+		}
+	}
+	return mapped
+}
+
+// Push posts records, the inventory fields of every node, unless the last
+// successful push is more recent than the interval. Nothing is pushed
+// without records, so a failed collection doesn't empty the CMDB.
+func (p *Pusher) Push(records []map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(records) == 0 || !p.due() {
+		return nil
+	}
+	payload, err := json.Marshal(struct {
+		Records []map[string]string `json:"records"`
+	}{p.mapFields(records)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", p.cfg.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.cfg.Header != "" {
+		name, value, err := instaclustr.ParseHeader(p.cfg.Header)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("POST %s: unexpected status code %d: %s", req.URL.Path, resp.StatusCode, string(data))
+	}
+	p.lastPush = p.clock.Now()
+	return nil
+}
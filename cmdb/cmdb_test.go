@@ -0,0 +1,123 @@
+package cmdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+func TestPush(t *testing.T) {
+	var pushed []map[string]string
+	var auth string
+	pushes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes++
+		auth = r.Header.Get("Authorization")
+		var body struct {
+			Records []map[string]string `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		pushed = body.Records
+	}))
+	defer srv.Close()
+
+	clock := common.NewFakeClock(time.Unix(1500000000, 0))
+	p := NewPusher(Config{
+		URL:      srv.URL,
+		Header:   "Authorization: Basic c2VjcmV0",
+		Fields:   map[string]string{"u_name": "nodeId", "u_cluster": "clusterName"},
+		Interval: time.Hour,
+	})
+	p.clock = clock
+	records := []map[string]string{{"nodeId": "n1", "clusterName": "cluster", "rack": "r1"}}
+
+	if err := p.Push(records); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []map[string]string{{"u_name": "n1", "u_cluster": "cluster"}}; !reflect.DeepEqual(pushed, expected) {
+		t.Errorf("Pushed %v, want %v", pushed, expected)
+	}
+	if auth != "Basic c2VjcmV0" {
+		t.Errorf("Authorization header %q", auth)
+	}
+
+	// Not due yet, then nothing to push
+	if err := p.Push(records); err != nil || pushes != 1 {
+		t.Errorf("Pushed %d times before the interval (%v), want once", pushes, err)
+	}
+	clock.Advance(time.Hour)
+	if err := p.Push(nil); err != nil || pushes != 1 {
+		t.Errorf("Pushed %d times without records (%v), want once", pushes, err)
+	}
+	if err := p.Push(records); err != nil || pushes != 2 {
+		t.Errorf("Pushed %d times after the interval (%v), want twice", pushes, err)
+	}
+}
+
+func TestPushError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "denied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	p := NewPusher(Config{URL: srv.URL})
+	records := []map[string]string{{"nodeId": "n1"}}
+	if err := p.Push(records); err == nil {
+		t.Fatal("Rejected push succeeded")
+	}
+	if !p.due() {
+		t.Error("Rejected push not retried on the next collection")
+	}
+}
+
+func TestConcurrentPushes(t *testing.T) {
+	var mu sync.Mutex
+	pushes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		pushes++
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	p := NewPusher(Config{URL: srv.URL, Interval: time.Hour})
+	records := []map[string]string{{"nodeId": "n1"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Push(records); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if pushes != 1 {
+		t.Errorf("Concurrent collections pushed %d times, want once", pushes)
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields("u_name=nodeId,u_dc=dataCentre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"u_name": "nodeId", "u_dc": "dataCentre"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("got %v, want %v", fields, expected)
+	}
+	for _, s := range []string{"u_name", "=nodeId", "u_name="} {
+		if _, err := ParseFields(s); err == nil {
+			t.Errorf("%q accepted", s)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Stats of the gauges aggregated across the nodes of a cluster
+var aggregateStats = []string{"min", "avg", "max", "p95"}
+
+// nodeAggregate is the cluster level metric a node metric is aggregated
+// into: gauges get a series per stat, counters are summed up along with the
+// last value of the nodes missing from the collection, see counterTotals
+type nodeAggregate struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+func newNodeAggregate(name string, valueType prometheus.ValueType) nodeAggregate {
+	if valueType == prometheus.CounterValue {
+		return nodeAggregate{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "cluster", name),
+				"Sum of "+prometheus.BuildFQName(namespace, "node", name)+" across the nodes of the cluster, the last value of the nodes that couldn't be fetched included.",
+				[]string{"clusterId"},
+				nil,
+			),
+			valueType: valueType,
+		}
+	}
+	return nodeAggregate{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cluster", name),
+			"Min, avg, max and 95th percentile of "+prometheus.BuildFQName(namespace, "node", name)+" across the nodes of the cluster.",
+			[]string{"clusterId", "stat"},
+			nil,
+		),
+		valueType: valueType,
+	}
+}
+
+// nodeAggregates maps the node metrics to their cluster level aggregate
+var nodeAggregates = map[*prometheus.Desc]nodeAggregate{
+	nodeCPUUtilizationPercentage:       newNodeAggregate("cpu_utilization_percentage", prometheus.GaugeValue),
+	nodeDiskUtilizationPercentage:      newNodeAggregate("disk_utilization_percentage", prometheus.GaugeValue),
+	nodeCPUUtilizationRatio:            newNodeAggregate("cpu_utilization_ratio", prometheus.GaugeValue),
+	nodeDiskUtilizationRatio:           newNodeAggregate("disk_utilization_ratio", prometheus.GaugeValue),
+	nodeCassandraReadsPerSecond:        newNodeAggregate("reads_per_second", prometheus.GaugeValue),
+	nodeCassandraWritesPerSecond:       newNodeAggregate("writes_per_second", prometheus.GaugeValue),
+	nodeCassandraReadsTotal:            newNodeAggregate("reads_total", prometheus.CounterValue),
+	nodeCassandraWritesTotal:           newNodeAggregate("writes_total", prometheus.CounterValue),
+	nodeLastSampleTimestamp:            newNodeAggregate("last_sample_timestamp_seconds", prometheus.GaugeValue),
+	nodeCassandraCompactions:           newNodeAggregate("compactions", prometheus.GaugeValue),
+	nodeCassandraRepairsPending:        newNodeAggregate("repairs_pending", prometheus.GaugeValue),
+	nodeCassandraRepairsActive:         newNodeAggregate("repairs_active", prometheus.GaugeValue),
+	nodeClientRequestReadLatency:       newNodeAggregate("client_request_read_latency", prometheus.GaugeValue),
+	nodeClientRequestWriteLatency:      newNodeAggregate("client_request_write_latency", prometheus.GaugeValue),
+	nodeClientRequestReadPercentile:    newNodeAggregate("client_request_read_percentile95", prometheus.GaugeValue),
+	nodeClientRequestWritePercentile:   newNodeAggregate("client_request_write_percentile95", prometheus.GaugeValue),
+	nodeClientRequestReadPercentile99:  newNodeAggregate("client_request_read_percentile99", prometheus.GaugeValue),
+	nodeClientRequestWritePercentile99: newNodeAggregate("client_request_write_percentile99", prometheus.GaugeValue),
+}
+
+// describeAggregates sends the descriptors of the cluster level aggregates to ch
+func describeAggregates(ch chan<- *prometheus.Desc) {
+	for _, a := range nodeAggregates {
+		ch <- a.desc
+	}
+}
+
+// counterTotals remembers the last value of the counters of every node, so
+// their cluster sums don't drop when a node couldn't be fetched, which rate()
+// would take for a counter reset. The nodes leaving the topology and the
+// clusters no longer listed are forgotten.
+type counterTotals struct {
+	mu sync.Mutex
+	// values by cluster, aggregated node counter then nodeId
+	values map[string]map[*prometheus.Desc]map[string]float64
+}
+
+func newCounterTotals() *counterTotals {
+	return &counterTotals{values: make(map[string]map[*prometheus.Desc]map[string]float64)}
+}
+
+// sum records the values of the desc counter of the nodes of a cluster,
+// by nodeId, returning their sum along with the last values of the nodes
+// not in values
+func (ct *counterTotals) sum(clusterID string, desc *prometheus.Desc, values map[string]float64) float64 {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.values[clusterID] == nil {
+		ct.values[clusterID] = make(map[*prometheus.Desc]map[string]float64)
+	}
+	last := ct.values[clusterID][desc]
+	if last == nil {
+		last = make(map[string]float64, len(values))
+		ct.values[clusterID][desc] = last
+	}
+	total := 0.0
+	for nodeID, v := range values {
+		last[nodeID] = v
+	}
+	for _, v := range last {
+		total += v
+	}
+	return total
+}
+
+// retain forgets the counters of the clusters no longer listed
+func (ct *counterTotals) retain(clusters []cluster) {
+	listed := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		listed[c.ID] = true
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for id := range ct.values {
+		if !listed[id] {
+			delete(ct.values, id)
+		}
+	}
+}
+
+// retainNodes forgets the counters of the nodes no longer in the topology of
+// clusterID, their cluster sums dropping once, like on a counter reset
+func (ct *counterTotals) retainNodes(clusterID string, dcs []datacentre) {
+	nodes := map[string]bool{}
+	for _, dc := range dcs {
+		for _, n := range dc.Nodes {
+			nodes[n.ID] = true
+		}
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	for _, last := range ct.values[clusterID] {
+		for nodeID := range last {
+			if !nodes[nodeID] {
+				delete(last, nodeID)
+			}
+		}
+	}
+}
+
+// nodeIDOf returns the nodeId label of a node metric
+func nodeIDOf(pb *dto.Metric) string {
+	for _, l := range pb.GetLabel() {
+		if l.GetName() == "nodeId" {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// aggregator exports cluster level aggregates instead of the per node
+// metrics of a cluster. Metrics without an aggregate are forwarded as they are.
+func aggregator(clusterID string, totals *counterTotals, ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	values := map[*prometheus.Desc][]float64{}
+	counters := map[*prometheus.Desc]map[string]float64{}
+	go func() {
+		for m := range in {
+			if _, ok := nodeAggregates[m.Desc()]; !ok {
+				ch <- m
+				continue
+			}
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				continue
+			}
+			v := pb.GetGauge().GetValue() + pb.GetCounter().GetValue()
+			if math.IsNaN(v) {
+				continue
+			}
+			if nodeAggregates[m.Desc()].valueType == prometheus.CounterValue {
+				if counters[m.Desc()] == nil {
+					counters[m.Desc()] = map[string]float64{}
+				}
+				counters[m.Desc()][nodeIDOf(pb)] = v
+				continue
+			}
+			values[m.Desc()] = append(values[m.Desc()], v)
+		}
+		close(done)
+	}()
+	return in, func() {
+		close(in)
+		<-done
+		for desc, vs := range counters {
+			a := nodeAggregates[desc]
+			ch <- prometheus.MustNewConstMetric(a.desc, a.valueType, totals.sum(clusterID, desc, vs), clusterID)
+		}
+		for desc, vs := range values {
+			a := nodeAggregates[desc]
+			for i, v := range summarize(vs) {
+				ch <- prometheus.MustNewConstMetric(a.desc, a.valueType, v, clusterID, aggregateStats[i])
+			}
+		}
+	}
+}
+
+func sum(vs []float64) float64 {
+	total := 0.0
+	for _, v := range vs {
+		total += v
+	}
+	return total
+}
+
+// summarize returns the aggregateStats of vs, which must not be empty
+func summarize(vs []float64) []float64 {
+	sorted := append([]float64{}, vs...)
+	sort.Float64s(sorted)
+	// Nearest rank 95th percentile
+	p95 := sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	return []float64{sorted[0], sum(sorted) / float64(len(sorted)), sorted[len(sorted)-1], p95}
+}
@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSummarize(t *testing.T) {
+	vs := []float64{}
+	for i := 20; i >= 1; i-- {
+		vs = append(vs, float64(i))
+	}
+	if got, expected := summarize(vs), []float64{1, 10.5, 20, 19}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+	if got, expected := summarize([]float64{3}), []float64{3, 3, 3, 3}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	out := make(chan prometheus.Metric, 100)
+	in, flush := aggregator("cluster-uuid-1", newCounterTotals(), out)
+	for i, v := range []float64{10, 30, math.NaN(), 20} {
+		nodeID := string(rune('a' + i))
+		in <- prometheus.MustNewConstMetric(nodeCPUUtilizationPercentage, prometheus.GaugeValue, v, nodeID)
+		in <- prometheus.MustNewConstMetric(nodeCassandraReadsTotal, prometheus.CounterValue, 100, nodeID)
+		in <- prometheus.MustNewConstMetric(nodeRunning, prometheus.GaugeValue, 1, nodeID)
+	}
+	flush()
+	close(out)
+
+	got := map[string]float64{}
+	for m := range out {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		key := m.Desc().String()
+		for _, l := range pb.GetLabel() {
+			key += "," + l.GetName() + "=" + l.GetValue()
+		}
+		got[key] += pb.GetGauge().GetValue() + pb.GetCounter().GetValue()
+	}
+
+	cpu := nodeAggregates[nodeCPUUtilizationPercentage].desc.String()
+	reads := nodeAggregates[nodeCassandraReadsTotal].desc.String()
+	expected := map[string]float64{
+		cpu + ",clusterId=cluster-uuid-1,stat=min": 10,
+		cpu + ",clusterId=cluster-uuid-1,stat=avg": 20,
+		cpu + ",clusterId=cluster-uuid-1,stat=max": 30,
+		cpu + ",clusterId=cluster-uuid-1,stat=p95": 30,
+		reads + ",clusterId=cluster-uuid-1":        400,
+	}
+	for _, nodeID := range []string{"a", "b", "c", "d"} {
+		expected[nodeRunning.String()+",nodeId="+nodeID] = 1
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v\nwant %v", got, expected)
+	}
+}
+
+func TestAggregatorMissingNode(t *testing.T) {
+	totals := newCounterTotals()
+	collections := []struct {
+		reads    map[string]float64
+		expected float64
+	}{
+		{map[string]float64{"a": 100, "b": 200}, 300},
+		// b couldn't be fetched, its last value is still summed up
+		{map[string]float64{"a": 150}, 350},
+		{map[string]float64{"a": 160, "b": 250}, 410},
+	}
+	for i, c := range collections {
+		out := make(chan prometheus.Metric, 10)
+		in, flush := aggregator("cluster-uuid-1", totals, out)
+		for nodeID, v := range c.reads {
+			in <- prometheus.MustNewConstMetric(nodeCassandraReadsTotal, prometheus.CounterValue, v, nodeID)
+		}
+		flush()
+		close(out)
+		pb := &dto.Metric{}
+		if err := (<-out).Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		if got := pb.GetCounter().GetValue(); got != c.expected {
+			t.Errorf("Collection %d: got %v want %v", i, got, c.expected)
+		}
+	}
+}
+
+func TestCounterTotalsRetain(t *testing.T) {
+	totals := newCounterTotals()
+	totals.sum("cluster-uuid-1", nodeCassandraReadsTotal, map[string]float64{"a": 100, "b": 200})
+	totals.sum("cluster-uuid-2", nodeCassandraReadsTotal, map[string]float64{"c": 50})
+
+	// b left the topology of its cluster, its counter isn't summed up anymore
+	totals.retainNodes("cluster-uuid-1", []datacentre{{Nodes: []node{{ID: "a"}}}})
+	if got := totals.sum("cluster-uuid-1", nodeCassandraReadsTotal, map[string]float64{"a": 150}); got != 150 {
+		t.Errorf("got %v want 150", got)
+	}
+
+	totals.retain([]cluster{{ID: "cluster-uuid-1"}})
+	if _, ok := totals.values["cluster-uuid-2"]; ok {
+		t.Error("Counters of the cluster no longer listed weren't forgotten")
+	}
+	if got := totals.sum("cluster-uuid-1", nodeCassandraReadsTotal, map[string]float64{}); got != 150 {
+		t.Errorf("got %v want 150", got)
+	}
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// accountLabel is the label naming the account of every metric when the
+// account has an alias
+const accountLabel = "account"
+
+// accountDescs are the descriptors of the metrics of an account with an
+// alias, the alias in their account constant label
+type accountDescs struct {
+	alias string
+	mu    sync.Mutex
+	descs map[*prometheus.Desc]*prometheus.Desc
+}
+
+func newAccountDescs(alias string) *accountDescs {
+	return &accountDescs{alias: alias, descs: map[*prometheus.Desc]*prometheus.Desc{}}
+}
+
+// of returns the descriptor of desc with the account label
+func (a *accountDescs) of(desc *prometheus.Desc) *prometheus.Desc {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	d, ok := a.descs[desc]
+	if !ok {
+		name, help, labels, _ := descParts(desc)
+		d = prometheus.NewDesc(name, help, labels, prometheus.Labels{accountLabel: a.alias})
+		a.descs[desc] = d
+	}
+	return d
+}
+
+// accountMetric is a metric of an account, labeled with its alias
+type accountMetric struct {
+	prometheus.Metric
+	desc  *prometheus.Desc
+	alias string
+}
+
+// Desc implements prometheus.Metric
+func (m accountMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+func (m accountMetric) Write(pb *dto.Metric) error {
+	if err := m.Metric.Write(pb); err != nil {
+		return err
+	}
+	pb.Label = append(pb.Label, &dto.LabelPair{Name: proto.String(accountLabel), Value: proto.String(m.alias)})
+	sort.Sort(prometheus.LabelPairSorter(pb.Label))
+	return nil
+}
+
+// describer forwards the descriptors sent to the returned channel to ch with
+// the account label. done must be called once every descriptor is sent.
+func (a *accountDescs) describer(ch chan<- *prometheus.Desc) (chan<- *prometheus.Desc, func()) {
+	in := make(chan *prometheus.Desc)
+	finished := make(chan struct{})
+	go func() {
+		for desc := range in {
+			ch <- a.of(desc)
+		}
+		close(finished)
+	}()
+	return in, func() {
+		close(in)
+		<-finished
+	}
+}
+
+// labeler labels the metrics sent to the returned channel with the account
+// alias before passing them to ch. done must be called once every metric is
+// sent.
+func (a *accountDescs) labeler(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	finished := make(chan struct{})
+	go func() {
+		for m := range in {
+			ch <- accountMetric{m, a.of(m.Desc()), a.alias}
+		}
+		close(finished)
+	}()
+	return in, func() {
+		close(in)
+		<-finished
+	}
+}
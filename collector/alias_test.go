@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAccountAlias(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.account = newAccountDescs("production")
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) == 0 {
+		t.Fatal("No metrics collected")
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels[accountLabel] != "production" {
+				t.Errorf("%s %v not labeled with the account alias", mf.GetName(), m.GetLabel())
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var lastCollectionTimestamp = prometheus.NewDesc(
+	"instaclustr_exporter_last_collection_timestamp_seconds",
+	"Unix time the last background collection finished.",
+	nil,
+	nil,
+)
+
+// RunBackground collects every CollectionInterval until stop is closed. The
+// metrics of the last collection are served by Collect meanwhile, so scrapes
+// don't wait for the API.
+func (e *Exporter) RunBackground(stop <-chan struct{}) {
+	if e.pollInterval <= 0 {
+		return
+	}
+	log.Infof("Collecting every %s in the background", e.pollInterval)
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+	for {
+		e.poll()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// LastPoll returns when the ongoing or last background collection started
+// and when the last one finished, zero before the first one did
+func (e *Exporter) LastPoll() (started, finished time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.pollStart, e.backgroundTime
+}
+
+// poll collects once, keeping the collected metrics
+func (e *Exporter) poll() {
+	e.mu.Lock()
+	e.pollStart = e.clock.Now()
+	e.mu.Unlock()
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var collected []prometheus.Metric
+		for m := range ch {
+			collected = append(collected, m)
+		}
+		done <- collected
+	}()
+	e.scrape(context.Background(), ch)
+	close(ch)
+	collected := <-done
+	e.mu.Lock()
+	e.background = collected
+	e.backgroundTime = e.clock.Now()
+	e.mu.Unlock()
+}
+
+// collectBackground serves the metrics of the last background collection,
+// nothing until the first one finishes
+func (e *Exporter) collectBackground(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	collected, t := e.background, e.backgroundTime
+	e.mu.Unlock()
+	if t.IsZero() {
+		return
+	}
+	for _, m := range collected {
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(lastCollectionTimestamp, prometheus.GaugeValue, float64(t.UnixNano())/1e9)
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBackgroundCollection(t *testing.T) {
+	prov := &countingProvider{}
+	e, err := newExporter(prov, ExporterOptions{CollectionInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	gather := func() map[string]bool {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, mf := range mfs {
+			got[mf.GetName()] = true
+		}
+		return got
+	}
+
+	if got := gather(); len(got) != 0 || prov.calls != 0 {
+		t.Fatalf("Before the first collection: got %d metrics, %d calls", len(got), prov.calls)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		e.RunBackground(stop)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if _, ok := e.LastScrape(); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+	for i := 0; i < 3; i++ {
+		got := gather()
+		for _, name := range []string{"cassandra_node_cpu_utilization_percentage", "instaclustr_exporter_last_collection_timestamp_seconds"} {
+			if !got[name] {
+				t.Errorf("%s not served", name)
+			}
+		}
+	}
+	if prov.calls != 1 {
+		t.Errorf("Got %d calls, want a single background collection", prov.calls)
+	}
+}
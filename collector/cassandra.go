@@ -1,12 +1,11 @@
 package collector
 
 import (
-	"strconv"
-	"strings"
+	"context"
 	"sync"
+	"time"
 
-	"encoding/json"
-
+	"github.com/fcgravalos/instaclustr_exporter/common"
 	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
@@ -17,28 +16,53 @@ const (
 	usTosecondsFactor = 1e-06
 )
 
-// InstaClustr API handlers
-var provisioningClient *instaclustr.ProvisioningClient
-var monitoringClient *instaclustr.MonitoringClient
-
-var allNodeMetricsQuery = []string{
-	//"n::nodeStatus",         //Whether Cassandra is available on the node. Returns a "warn" value, if no check in has been logged in the last 30 seconds.
-	"n::cpuUtilization",     //Current CPU utilisation as a percentage of total available. Maximum value is 100%, regardless of the number of cores on the node.
-	"n::diskUtilization",    //Total disk space utilisation, by Cassandra, as a percentage of total available.
-	"n::cassandraReads",     //Reads per second by Cassandra.
-	"n::cassandraWrites",    //Writes per second by Cassandra.
-	"n::compactions",        //Number of pending compactions.
-	"n::repairs",            //Number of active and pending repair tasks.
-	"n::clientRequestRead",  //95th & 99th percentile distribution and average latency per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
-	"n::clientRequestWrite", //95th & 99th percentile distribution and average latency per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+// coreNodeMetrics are the node metrics of Cassandra itself, and of its usage
+// of the CPU and disk
+var coreNodeMetrics = []string{
+	"cpuUtilization",     //Current CPU utilisation as a percentage of total available. Maximum value is 100%, regardless of the number of cores on the node.
+	"diskUtilization",    //Total disk space utilisation, by Cassandra, as a percentage of total available.
+	"cassandraReads",     //Reads per second by Cassandra.
+	"cassandraWrites",    //Writes per second by Cassandra.
+	"compactions",        //Number of pending compactions.
+	"repairs",            //Number of active and pending repair tasks.
+	"clientRequestRead",  //95th & 99th percentile distribution and average latency per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+	"clientRequestWrite", //95th & 99th percentile distribution and average latency per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
 }
 
-// Metric descriptors
+// allNodeMetrics are the node metrics the exporter knows how to export.
+// nodeStatus is only queried with ExporterOptions.NodeStatus.
+var allNodeMetrics = append(append(append([]string{}, coreNodeMetrics...), threadPoolNodeMetrics...), osNodeMetrics...)
+
+// Labels of the info metrics, extra labels are appended to them
 var (
-	clusterInfo = prometheus.NewDesc(
+	clusterInfoLabels = []string{"clusterId", "clusterName"}
+	nodeInfoLabels    = []string{"clusterId", "clusterName", "nodeId", "nodePublicIp", "nodePrivateIp", "rack", "size", "provider", "region"}
+)
+
+func newClusterInfoDesc(namespace string, extraLabelNames []string) *prometheus.Desc {
+	return prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "cluster", "info"),
 		"A mapping between the clusterId and clusterName",
-		[]string{"clusterId", "clusterName"},
+		append(append([]string{}, clusterInfoLabels...), extraLabelNames...),
+		nil,
+	)
+}
+
+func newNodeInfoDesc(namespace string, extraLabelNames []string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "info"),
+		"A mapping between nodeId with its IPs, rack, size, cloud provider and region, and cluster",
+		append(append([]string{}, nodeInfoLabels...), extraLabelNames...),
+		nil,
+	)
+}
+
+// Metric descriptors
+var (
+	monitoringDisabled = prometheus.NewDesc(
+		"instaclustr_exporter_monitoring_disabled",
+		"Whether node metrics aren't collected from the Monitoring API, because of collector.disable-node-metrics, a missing Monitoring API key or the minimal profile.",
+		nil,
 		nil,
 	)
 	clusterRunning = prometheus.NewDesc(
@@ -61,10 +85,10 @@ var (
 		[]string{"clusterId"},
 		nil,
 	)
-	nodeInfo = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "node", "info"),
-		"A mapping between nodeId with its IPs, racks and cluster",
-		[]string{"clusterId", "clusterName", "nodeId", "nodePublicIp", "nodePrivateIp", "rack"},
+	clusterNodesRunningRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "nodes_running_ratio"),
+		"Ratio of the nodes of the cluster running, from 0 to 1. Not exported for clusters without nodes.",
+		[]string{"clusterId"},
 		nil,
 	)
 	nodeRunning = prometheus.NewDesc(
@@ -97,6 +121,24 @@ var (
 		[]string{"nodeId"},
 		nil,
 	)
+	nodeCassandraReadsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "reads_total"),
+		"Reads by Cassandra, accumulated from the reads per second rate.",
+		[]string{"nodeId"},
+		nil,
+	)
+	nodeCassandraWritesTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "writes_total"),
+		"Writes by Cassandra, accumulated from the writes per second rate.",
+		[]string{"nodeId"},
+		nil,
+	)
+	nodeLastSampleTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "last_sample_timestamp_seconds"),
+		"Unix time of the most recent metric value returned by the Monitoring API for the node.",
+		[]string{"nodeId"},
+		nil,
+	)
 	nodeCassandraCompactions = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "compactions"),
 		"Number of pending compactions.",
@@ -117,48 +159,53 @@ var (
 	)
 	nodeClientRequestReadLatency = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_read_latency"),
-		"Average latency (s/1) per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"Average latency in seconds per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 	nodeClientRequestWriteLatency = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_write_latency"),
-		"Average latency (s/1) per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"Average latency in seconds per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 	nodeClientRequestReadPercentile = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_read_percentile95"),
-		"95th percentile (s) distribution per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"95th percentile distribution in seconds per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 	nodeClientRequestWritePercentile = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_write_percentile95"),
-		"95th percentile (s) distribution per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"95th percentile distribution in seconds per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 	nodeClientRequestReadPercentile99 = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_read_percentile99"),
-		"99th percentile (s) distribution per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"99th percentile distribution in seconds per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 	nodeClientRequestWritePercentile99 = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "client_request_write_percentile99"),
-		"99th percentile (s) distribution per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
+		"99th percentile distribution in seconds per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).",
 		[]string{"nodeId"},
 		nil,
 	)
 )
 
 type cluster struct {
-	ID               string  `json:"id"`
-	Name             string  `json:"name"`
-	NodeCount        float64 `json:"nodeCount"`
-	RunningNodeCount float64 `json:"runningNodeCount"`
-	DerivedStatus    string  `json:"derivedStatus"`
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	NodeCount        flexNumber `json:"nodeCount"`
+	RunningNodeCount flexNumber `json:"runningNodeCount"`
+	DerivedStatus    string     `json:"derivedStatus"`
+	// BundleType tells Cassandra clusters from Kafka, Redis, PostgreSQL and
+	// Cadence ones
+	BundleType string `json:"bundleType"`
+	// PCICompliant is nil when the API doesn't tell
+	PCICompliant *bool `json:"pciCompliantCluster"`
 }
 
 type node struct {
@@ -171,18 +218,44 @@ type node struct {
 	SparkMaster    bool   `json:"sparkMaster"`
 	SparkJobserver bool   `json:"sparkJobserver"`
 	Zeppelin       bool   `json:"zeppelin"`
+	// dataCentre is the name of the datacentre of the node
+	dataCentre string
+	// provider is the cloud provider of the datacentre of the node
+	provider string
+	// region is the cloud region of the datacentre of the node
+	region string
 }
 
 type datacentres struct {
 	Dcs []datacentre `json:"dataCentres"`
+	// AddonBundles are the add-ons of the cluster, e.g. SPARK
+	AddonBundles []addonBundle `json:"addonBundles"`
+}
+
+// addonBundle is an add-on a cluster runs along with its bundle
+type addonBundle struct {
+	Bundle  string `json:"bundle"`
+	Version string `json:"version"`
+}
+
+// withAddons returns dcs, each told the add-ons of their cluster
+func withAddons(dcs []datacentre, addons []addonBundle) []datacentre {
+	for i := range dcs {
+		dcs[i].AddonBundles = addons
+	}
+	return dcs
 }
 
 type datacentre struct {
-	ID         string                 `json:"id"`
-	Name       string                 `json:"name"`
-	Provider   string                 `json:"provider"`
-	CDCNetwork map[string]interface{} `json:"cdcNetwork"`
-	Nodes      []node                 `json:"nodes"`
+	ID                string                 `json:"id"`
+	Name              string                 `json:"name"`
+	Provider          string                 `json:"provider"`
+	Region            string                 `json:"region"`
+	CDCNetwork        map[string]interface{} `json:"cdcNetwork"`
+	ReplicationFactor flexNumber             `json:"replicationFactor"`
+	Nodes             []node                 `json:"nodes"`
+	// AddonBundles are the ones of the cluster of the datacentre
+	AddonBundles []addonBundle `json:"addonBundles,omitempty"`
 }
 
 type metrics struct {
@@ -194,93 +267,398 @@ type metric struct {
 	Type   string        `json:"type"`
 	Unit   string        `json:"unit"`
 	Values []metricValue `json:"values"`
+	// Keyspace and Table of the table metrics
+	Keyspace string `json:"keyspace,omitempty"`
+	Table    string `json:"table,omitempty"`
 }
 
 type metricValue struct {
-	Value string `json:"value"`
-	Time  string `json:"time"`
+	Value flexString `json:"value"`
+	Time  string     `json:"time"`
+}
+
+// ExporterOptions defines the collector configuration
+type ExporterOptions struct {
+	// ExtraLabelsFile is a YAML file mapping clusterIds and nodeIds to extra info labels
+	ExtraLabelsFile string
+	// RepairStatus enables collecting Instaclustr managed repairs
+	RepairStatus bool
+	// NodeOperations enables counting node operations from the Instaclustr events API
+	NodeOperations bool
+	// KafkaConsumerLag enables collecting the lag of the consumer groups of
+	// the Kafka clusters, from the Monitoring API
+	KafkaConsumerLag bool
+	// CadenceMetrics enables querying the Cadence metrics of the nodes of
+	// Cadence clusters, which the Monitoring API doesn't document
+	CadenceMetrics bool
+	// ParseErrorMode is what to export when a value can't be parsed, ParseErrorZero by default
+	ParseErrorMode string
+	// ParseErrorOverrides overrides ParseErrorMode per Monitoring API metric name
+	ParseErrorOverrides map[string]string
+	// SanitizeMode is what to do with values out of their bounds, SanitizeKeep by default
+	SanitizeMode string
+	// SanitizeRules overrides SanitizeMode per Monitoring API metric name, see ParseSanitizeRules
+	SanitizeRules map[string]string
+	// Profile is the name of the curated metric set to export, ProfileStandard by default
+	Profile string
+	// DataCentreInclude limits the collection to the datacentres with these names or ids
+	DataCentreInclude []string
+	// ProviderInclude limits the collection to the datacentres hosted by these cloud providers
+	ProviderInclude []string
+	// Clock tells the time, common.SystemClock by default
+	Clock common.Clock `json:"-"`
+	// AggregateNodes exports cluster level aggregates of the node metrics instead of per node series
+	AggregateNodes bool
+	// NotFoundTTL is how long nodes the Monitoring API didn't find are not queried again, 0 disables it
+	NotFoundTTL time.Duration
+	// QuietWindows are cron-like periods the API isn't polled, see parseQuietWindow
+	QuietWindows []string
+	// MaintenanceCache serves the metrics of the last collection while the
+	// API is in maintenance, instead of collections failing meanwhile
+	MaintenanceCache bool
+	// DisableNodeMetrics skips the Monitoring API, exporting the topology only
+	DisableNodeMetrics bool
+	// LatencyThreshold exports the latency metrics of a node only when any of
+	// them is at least this long, 0 exports them all
+	LatencyThreshold time.Duration
+	// MemoryLimit is the heap in bytes a collection may peak at before node
+	// metrics are aggregated per cluster, 0 disables it
+	MemoryLimit uint64
+	// CollectionInterval, when set, makes RunBackground collect on its own
+	// and Collect serve the last collection instead of polling the API
+	CollectionInterval time.Duration
+	// TopologyLabels adds the datacentre and rack labels to the latency and
+	// throughput node metrics
+	TopologyLabels bool
+	// ClusterConcurrency is how many cluster topologies are fetched at the
+	// same time, defaultClusterConcurrency if not positive
+	ClusterConcurrency int
+	// NodeConcurrency is how many nodes have their metrics fetched at the
+	// same time, defaultNodeConcurrency if not positive
+	NodeConcurrency int
+	// NodeStatus queries the nodeStatus Monitoring API metric, exported by
+	// state as cassandra_node_status
+	NodeStatus bool
+	// NodeStatusValues maps node states, e.g. warn, to the value exported
+	// for them
+	NodeStatusValues map[string]float64
+	// PinnedClusters are the IDs of the clusters to collect, without listing
+	// the clusters of the account. Every cluster is collected when empty.
+	PinnedClusters []string
+	// PinnedNodes are the IDs of the nodes of the pinned clusters to
+	// collect, all of them when empty
+	PinnedNodes []string
+	// FederationTargets are the base URLs, by origin, of the exporters to
+	// federate instead of collecting the Instaclustr API, see NewFederation
+	FederationTargets map[string]string
+	// Units are the units node metrics are exported in
+	Units Units
+	// Timeout bounds every collection from the API, the requests still in
+	// flight are cancelled once it's exceeded. None if 0.
+	Timeout time.Duration
+	// LegacyTopologyNames exports the cluster and node info and health
+	// metrics under their former cassandra_ names too, along with the
+	// instaclustr_ ones
+	LegacyTopologyNames bool
+	// NodeMetrics are the n:: Monitoring API metrics to query in place of
+	// the ones of the profile. The ones not in allNodeMetrics are exported
+	// as cassandra_node_ followed by their name in snake case, which can't
+	// be the name of a metric the exporter already exports.
+	NodeMetrics []string
+	// TableMetrics are the keyspace.table patterns, either part may be *,
+	// of the tables whose metrics are collected. None when empty. Patterns
+	// with a * only match the tables of the managed repairs.
+	TableMetrics []string
+	// SampleTimestamps exports the node metrics with the time the
+	// Monitoring API sampled them at instead of the scrape time
+	SampleTimestamps bool
+	// SampleMaxAge drops the node metric values sampled longer ago than
+	// this, 0 keeps them all
+	SampleMaxAge time.Duration
+	// MaxLabelLength truncates the label values longer than this many
+	// characters, 0 doesn't
+	MaxLabelLength int
 }
 
 // Exporter types defines a InstaClustr Exporter
 type Exporter struct {
-	provisioningClient *instaclustr.ProvisioningClient
-	monitoringClient   *instaclustr.MonitoringClient
+	provider       provider
+	clock          common.Clock
+	rates          *rateIntegrator
+	extraLabels    *extraLabels
+	repairStatus   bool
+	nodeOperations bool
+	operations     *operationCounter
+	consumerLag    bool
+	nodeMetrics    []string
+	// products are the kinds of clusters besides Cassandra whose node
+	// metrics are collected
+	products []*product
+	// extraNodeMetrics are the descriptors of the selected node metrics not
+	// in allNodeMetrics
+	extraNodeMetrics map[string]*prometheus.Desc
+	notFound         *notFoundCache
+	nodeRetries      *prometheus.CounterVec
+	nodeDurations    *monitoringDurations
+	aggregateNodes   bool
+	counterTotals    *counterTotals
+	// latencyThreshold in the latency unit, 0 disables the latency gate
+	latencyThreshold float64
+	transitions      *transitionTracker
+	provisioning     *provisioningTracker
+	quiet            *quietSchedule
+	maintenanceCache bool
+	memoryLimit      uint64
+	pollInterval     time.Duration
+	topologyLabels   bool
+	concurrency      int
+	nodeConcurrency  int
+	statusValues     map[string]float64
+	units            Units
+	timeout          time.Duration
+	pinned           *pinnedTargets
+	dcFilter         *dcFilter
+	values           *valueParser
+	topologies       []topologyMetrics
+	recentErrors     *errorLog
+	tables           *tableAllowlist
+	discovery        *discoveryTracker
+	sampleTimestamps bool
+	sampleMaxAge     time.Duration
+	staleSamples     *prometheus.CounterVec
+	maxLabelLength   int
+	sanitizedLabels  *prometheus.CounterVec
+	// account labels every metric with the alias of the account, nil
+	// without alias
+	account *accountDescs
+
+	mu                 sync.Mutex
+	lastScrape         *ScrapeSummary
+	cached             []prometheus.Metric
+	watermarks         memoryWatermarks
+	background         []prometheus.Metric
+	backgroundTime     time.Time
+	pollStart          time.Time
+	snapshotHandlers   []func(Snapshot)
+	transitionHandlers []func([]Transition)
+	// overMemoryLimit is set while the last collection peaked over memoryLimit
+	overMemoryLimit uint32
+	// queried are the queries of the last collection of the whole account
+	queried *querySet
 }
 
-// NewExporter creates new InstaClustr Exporter
-func NewExporter(instaclustrCfg instaclustr.Config) *Exporter {
-	// NewExporter creates new InstaClustr Cassandra Exporter
+// NewExporter creates new InstaClustr Exporter. Node metrics are disabled
+// when there's no Monitoring API key.
+func NewExporter(instaclustrCfg instaclustr.Config, opts ExporterOptions) (*Exporter, error) {
+	if instaclustrCfg.MonitoringAPIKey == "" && !opts.DisableNodeMetrics {
+		log.Warn("No Monitoring API key configured, exporting the topology only")
+		opts.DisableNodeMetrics = true
+	}
+	// The clients time their retries and waits on the clock of the exporter
+	if instaclustrCfg.Clock == nil {
+		instaclustrCfg.Clock = opts.Clock
+	}
+	prov := newInstaclustrProvider(instaclustrCfg)
+	prov.probeMaintenance = len(opts.PinnedClusters) > 0
+	e, err := newExporter(prov, opts)
+	if err != nil {
+		return nil, err
+	}
+	if instaclustrCfg.Alias != "" {
+		e.account = newAccountDescs(instaclustrCfg.Alias)
+	}
+	return e, nil
+}
+
+// newExporter creates an Exporter collecting from any managed Cassandra provider
+func newExporter(prov provider, opts ExporterOptions) (*Exporter, error) {
+	p, err := getProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	values, err := newValueParser(opts.ParseErrorMode, opts.ParseErrorOverrides)
+	if err != nil {
+		return nil, err
+	}
+	if values.sanitizer, err = newSanitizer(opts.SanitizeMode, opts.SanitizeRules); err != nil {
+		return nil, err
+	}
+	extraLabels, err := loadExtraLabels(opts.ExtraLabelsFile)
+	if err != nil {
+		return nil, err
+	}
+	quiet, err := newQuietSchedule(opts.QuietWindows)
+	if err != nil {
+		return nil, err
+	}
+	pinned, err := newPinnedTargets(opts.PinnedClusters, opts.PinnedNodes)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Units.validate(); err != nil {
+		return nil, err
+	}
+	tables, err := newTableAllowlist(opts.TableMetrics)
+	if err != nil {
+		return nil, err
+	}
+	selection, err := newNodeMetricSelection(opts.NodeMetrics)
+	if err != nil {
+		return nil, err
+	}
+	nodeMetrics := p.nodeMetrics
+	if len(selection.names) > 0 {
+		nodeMetrics = selection.names
+	}
+	if opts.DisableNodeMetrics {
+		nodeMetrics = nil
+	}
+	if opts.NodeStatus && len(nodeMetrics) > 0 && !selection.selects(nodeStatusMetric) {
+		nodeMetrics = append(append([]string{}, nodeMetrics...), nodeStatusMetric)
+	}
+	concurrency := opts.ClusterConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultClusterConcurrency
+	}
+	nodeConcurrency := opts.NodeConcurrency
+	if nodeConcurrency <= 0 {
+		nodeConcurrency = defaultNodeConcurrency
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = common.SystemClock
+	}
 	return &Exporter{
-		provisioningClient: instaclustr.NewProvisioningClient(instaclustrCfg),
-		monitoringClient:   instaclustr.NewMonitoringClient(instaclustrCfg),
+		provider:         prov,
+		clock:            clock,
+		rates:            newRateIntegrator(clock),
+		extraLabels:      extraLabels,
+		repairStatus:     opts.RepairStatus || p.repairStatus,
+		nodeOperations:   opts.NodeOperations || p.nodeOperations,
+		operations:       newOperationCounter(),
+		consumerLag:      opts.KafkaConsumerLag && !opts.DisableNodeMetrics,
+		nodeMetrics:      nodeMetrics,
+		products:         newProducts(prov, opts.CadenceMetrics),
+		extraNodeMetrics: selection.extra,
+		notFound:         newNotFoundCache(clock, opts.NotFoundTTL),
+		nodeRetries:      newNodeRetries(),
+		nodeDurations:    newMonitoringDurations(),
+		aggregateNodes:   opts.AggregateNodes,
+		counterTotals:    newCounterTotals(),
+		latencyThreshold: opts.Units.duration(opts.LatencyThreshold),
+		transitions:      newTransitionTracker(),
+		provisioning:     newProvisioningTracker(clock),
+		quiet:            quiet,
+		maintenanceCache: opts.MaintenanceCache,
+		memoryLimit:      opts.MemoryLimit,
+		pollInterval:     opts.CollectionInterval,
+		topologyLabels:   opts.TopologyLabels,
+		concurrency:      concurrency,
+		nodeConcurrency:  nodeConcurrency,
+		statusValues:     lowerKeys(opts.NodeStatusValues),
+		units:            opts.Units,
+		timeout:          opts.Timeout,
+		pinned:           pinned,
+		dcFilter:         newDCFilter(opts.DataCentreInclude, opts.ProviderInclude),
+		values:           values,
+		topologies:       newTopologies(opts.LegacyTopologyNames, extraLabels),
+		recentErrors:     newErrorLog(recentErrorsSize),
+		tables:           tables,
+		discovery:        newDiscoveryTracker(),
+		sampleTimestamps: opts.SampleTimestamps,
+		sampleMaxAge:     opts.SampleMaxAge,
+		staleSamples:     newStaleSamples(),
+		maxLabelLength:   opts.MaxLabelLength,
+		sanitizedLabels:  newSanitizedLabels(),
+	}, nil
+}
+
+func (e *Exporter) clusterInfoCollector(c cluster, ch chan<- prometheus.Metric) {
+	labelValues := append([]string{c.ID, c.Name}, e.extraLabels.clusterValues(c.ID)...)
+	for _, t := range e.topologies {
+		ch <- prometheus.MustNewConstMetric(
+			t.clusterInfo,
+			prometheus.CounterValue,
+			1,
+			labelValues...,
+		)
 	}
 }
 
-func clusterInfoCollector(c cluster, ch chan<- prometheus.Metric) {
-	ch <- prometheus.MustNewConstMetric(
-		clusterInfo,
-		prometheus.CounterValue,
-		1,
-		c.ID,
-		c.Name,
-	)
+func (e *Exporter) clusterHealthCollector(c cluster, ch chan<- prometheus.Metric) {
+	for _, t := range e.topologies {
+		clusterHealthCollector(t, c, ch)
+	}
 }
 
-func clusterHealthCollector(c cluster, ch chan<- prometheus.Metric) {
+func clusterHealthCollector(t topologyMetrics, c cluster, ch chan<- prometheus.Metric) {
 	if c.DerivedStatus == "RUNNING" {
 		ch <- prometheus.MustNewConstMetric(
-			clusterRunning,
+			t.clusterRunning,
 			prometheus.GaugeValue,
 			1,
 			c.ID,
 		)
 	} else {
 		ch <- prometheus.MustNewConstMetric(
-			clusterRunning,
+			t.clusterRunning,
 			prometheus.GaugeValue,
 			0,
 			c.ID,
 		)
 	}
 	ch <- prometheus.MustNewConstMetric(
-		clusterNodesCount,
+		t.clusterNodes,
 		prometheus.GaugeValue,
-		c.NodeCount,
+		float64(c.NodeCount),
 		c.ID,
 	)
 	ch <- prometheus.MustNewConstMetric(
-		clusterNodesRunningCount,
+		t.clusterNodesRunning,
 		prometheus.GaugeValue,
-		c.RunningNodeCount,
+		float64(c.RunningNodeCount),
 		c.ID,
 	)
+	// Computed here so alerts don't divide series that can go missing
+	if c.NodeCount > 0 {
+		ch <- prometheus.MustNewConstMetric(
+			t.clusterNodesRunningRatio,
+			prometheus.GaugeValue,
+			float64(c.RunningNodeCount)/float64(c.NodeCount),
+			c.ID,
+		)
+	}
 }
 
-func nodeInfoCollector(c cluster, n node, ch chan<- prometheus.Metric) {
-	ch <- prometheus.MustNewConstMetric(
-		nodeInfo,
-		prometheus.CounterValue,
-		1,
-		c.ID,
-		c.Name,
-		n.ID,
-		n.PublicIP,
-		n.PrivateIP,
-		n.Rack,
-	)
+func (e *Exporter) nodeInfoCollector(c cluster, n node, ch chan<- prometheus.Metric) {
+	labelValues := append([]string{c.ID, c.Name, n.ID, n.PublicIP, n.PrivateIP, n.Rack, n.Size, n.provider, n.region}, e.extraLabels.nodeValues(c.ID, n.ID)...)
+	for _, t := range e.topologies {
+		ch <- prometheus.MustNewConstMetric(
+			t.nodeInfo,
+			prometheus.CounterValue,
+			1,
+			labelValues...,
+		)
+	}
+}
+
+func (e *Exporter) nodeHealthCollector(c cluster, n node, ch chan<- prometheus.Metric) {
+	for _, t := range e.topologies {
+		nodeHealthCollector(t, c, n, ch)
+	}
 }
 
-func nodeHealthCollector(c cluster, n node, ch chan<- prometheus.Metric) {
+func nodeHealthCollector(t topologyMetrics, c cluster, n node, ch chan<- prometheus.Metric) {
 	if n.Status == "RUNNING" {
 		ch <- prometheus.MustNewConstMetric(
-			nodeRunning,
+			t.nodeRunning,
 			prometheus.GaugeValue,
 			1,
 			n.ID,
 		)
 	} else {
 		ch <- prometheus.MustNewConstMetric(
-			nodeRunning,
+			t.nodeRunning,
 			prometheus.GaugeValue,
 			0,
 			n.ID,
@@ -288,199 +666,714 @@ func nodeHealthCollector(c cluster, n node, ch chan<- prometheus.Metric) {
 	}
 }
 
-// nodeMetricsCollector gathers all Node metrics but the status
-func nodeMetricsCollector(c cluster, n node, ms []metrics, ch chan<- prometheus.Metric) {
+// parseSampleTime returns the time a metric value was taken by the Monitoring API
+func parseSampleTime(m metric) (time.Time, bool) {
+	if len(m.Values) == 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, m.Values[0].Time)
+	if err != nil {
+		log.Debugf("Error parsing metric time %s: %v", m.Values[0].Time, err)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// sampleTime returns the time a metric value was taken by the Monitoring API,
+// falling back to the current time if it can't be parsed
+func (e *Exporter) sampleTime(m metric) time.Time {
+	if t, ok := parseSampleTime(m); ok {
+		return t
+	}
+	return e.clock.Now()
+}
+
+// nodeMetricsCollector gathers all Node metrics
+func (e *Exporter) nodeMetricsCollector(c cluster, n node, ms []metrics, ch chan<- prometheus.Metric) {
+	var lastSample time.Time
 
 	for _, mc := range ms {
 		for _, m := range mc.Metrics {
-			value, err := strconv.ParseFloat(m.Values[0].Value, 64)
-			if err != nil {
-				log.Errorf("Error parsing value metric %s : %s", m.Name, m.Values[0].Value)
-				value = 0
+			if t, ok := parseSampleTime(m); ok && t.After(lastSample) {
+				lastSample = t
+			}
+			if e.stale(m) {
+				continue
+			}
+			if m.Name == nodeStatusMetric {
+				e.nodeStatusCollector(n, m, ch)
+				continue
+			}
+			value, ok := e.values.parse(n, m, ch)
+			if !ok {
+				continue
 			}
-			switch m.Name {
-
-			case "cpuUtilization":
-				ch <- prometheus.MustNewConstMetric(
-					nodeCPUUtilizationPercentage,
-					prometheus.GaugeValue,
-					value,
-					n.ID,
-				)
-
-			case "diskUtilization":
-				ch <- prometheus.MustNewConstMetric(
-					nodeDiskUtilizationPercentage,
-					prometheus.GaugeValue,
-					value,
-					n.ID,
-				)
-
-			case "cassandraReads":
-				ch <- prometheus.MustNewConstMetric(
-					nodeCassandraReadsPerSecond,
-					prometheus.GaugeValue,
-					value,
-					n.ID,
-				)
-
-			case "cassandraWrites":
-				ch <- prometheus.MustNewConstMetric(
-					nodeCassandraWritesPerSecond,
-					prometheus.GaugeValue,
-					value,
-					n.ID,
-				)
-
-			case "compactions":
-				ch <- prometheus.MustNewConstMetric(
-					nodeCassandraCompactions,
-					prometheus.GaugeValue,
-					value,
-					n.ID,
-				)
-
-			case "repairs":
-				if m.Type == "pendingtasks" {
+			e.timestamped(m, ch, func(ch chan<- prometheus.Metric) {
+				if desc, ok := e.extraNodeMetrics[m.Name]; ok {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, n.ID, m.Type)
+					return
+				}
+				if desc, ok := osNodeDescs[m.Name]; ok {
+					ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, n.ID)
+					return
+				}
+				switch m.Name {
+
+				case "cpuUtilization":
+					e.units.utilization(nodeCPUUtilizationPercentage, nodeCPUUtilizationRatio, value, n.ID, ch)
+
+				case "diskUtilization":
+					e.units.utilization(nodeDiskUtilizationPercentage, nodeDiskUtilizationRatio, value, n.ID, ch)
+
+				case "cassandraReads":
 					ch <- prometheus.MustNewConstMetric(
-						nodeCassandraRepairsPending,
+						nodeCassandraReadsPerSecond,
 						prometheus.GaugeValue,
 						value,
 						n.ID,
 					)
-				} else if m.Type == "activetasks" {
 					ch <- prometheus.MustNewConstMetric(
-						nodeCassandraRepairsActive,
-						prometheus.GaugeValue,
-						value,
+						nodeCassandraReadsTotal,
+						prometheus.CounterValue,
+						e.rates.add(n.ID+"/"+m.Name, value, e.sampleTime(m)),
 						n.ID,
 					)
-				} else {
-					log.Warnf("Unknown n::%s metric type %s", m.Name, m.Type)
-				}
 
-			case "clientRequestRead":
-				if m.Type == "latency_per_operation" {
+				case "cassandraWrites":
 					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestReadLatency,
+						nodeCassandraWritesPerSecond,
 						prometheus.GaugeValue,
-						value*usTosecondsFactor,
+						value,
 						n.ID,
 					)
-				} else if m.Type == "95thPercentile" {
 					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestReadPercentile,
-						prometheus.GaugeValue,
-						value*usTosecondsFactor,
+						nodeCassandraWritesTotal,
+						prometheus.CounterValue,
+						e.rates.add(n.ID+"/"+m.Name, value, e.sampleTime(m)),
 						n.ID,
 					)
 
-				} else if m.Type == "99thPercentile" {
+				case "compactions":
 					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestReadPercentile99,
+						nodeCassandraCompactions,
 						prometheus.GaugeValue,
-						value*usTosecondsFactor,
+						value,
 						n.ID,
 					)
-				} else {
-					log.Warnf("Unknown n::%s metric type %s", m.Name, m.Type)
-				}
 
-			case "clientRequestWrite":
-				if m.Type == "latency_per_operation" {
-					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestWriteLatency,
-						prometheus.GaugeValue,
-						value*usTosecondsFactor,
-						n.ID,
-					)
-				} else if m.Type == "95thPercentile" {
-					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestWritePercentile,
-						prometheus.GaugeValue,
-						value*usTosecondsFactor,
-						n.ID,
-					)
-				} else if m.Type == "99thPercentile" {
+				case "repairs":
+					if m.Type == "pendingtasks" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeCassandraRepairsPending,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+						)
+					} else if m.Type == "activetasks" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeCassandraRepairsActive,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+						)
+					} else {
+						log.Warnf("Unknown n::%s metric type %s", logValue(m.Name), logValue(m.Type))
+					}
+
+				case "nativeTransportRequests", "mutationStage", "readStage":
+					if m.Type == "pendingtasks" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeThreadPoolPendingTasks,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+							threadPools[m.Name],
+						)
+					} else if m.Type == "blockedtasks" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeThreadPoolBlockedTasks,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+							threadPools[m.Name],
+						)
+					} else {
+						log.Warnf("Unknown n::%s metric type %s", logValue(m.Name), logValue(m.Type))
+					}
+
+				case "droppedMessages":
+					if m.Type == "mutation" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeDroppedMutationsPerSecond,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+						)
+					} else if m.Type == "read" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeDroppedReadsPerSecond,
+							prometheus.GaugeValue,
+							value,
+							n.ID,
+						)
+					} else {
+						log.Warnf("Unknown n::%s metric type %s", logValue(m.Name), logValue(m.Type))
+					}
+
+				case "hintsTotal":
 					ch <- prometheus.MustNewConstMetric(
-						nodeClientRequestWritePercentile99,
-						prometheus.GaugeValue,
-						value*usTosecondsFactor,
+						nodeHintsTotal,
+						prometheus.CounterValue,
+						value,
 						n.ID,
 					)
-				} else {
-					log.Warnf("Unknown n::%s metric type %s", m.Name, m.Type)
+
+				case "clientRequestRead":
+					if m.Type == "latency_per_operation" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestReadLatency,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+					} else if m.Type == "95thPercentile" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestReadPercentile,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+
+					} else if m.Type == "99thPercentile" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestReadPercentile99,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+					} else {
+						log.Warnf("Unknown n::%s metric type %s", logValue(m.Name), logValue(m.Type))
+					}
+
+				case "clientRequestWrite":
+					if m.Type == "latency_per_operation" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestWriteLatency,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+					} else if m.Type == "95thPercentile" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestWritePercentile,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+					} else if m.Type == "99thPercentile" {
+						ch <- prometheus.MustNewConstMetric(
+							nodeClientRequestWritePercentile99,
+							prometheus.GaugeValue,
+							e.units.latency(value),
+							n.ID,
+						)
+					} else {
+						log.Warnf("Unknown n::%s metric type %s", logValue(m.Name), logValue(m.Type))
+					}
 				}
-			}
+			})
 		}
 	}
+
+	if !lastSample.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			nodeLastSampleTimestamp,
+			prometheus.GaugeValue,
+			float64(lastSample.UnixNano())/1e9,
+			n.ID,
+		)
+	}
 }
 
 // Describe describes all the metrics ever exported by the Instaclustr exporter. It
 // implements prometheus.Collector.
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- clusterInfo
-	ch <- clusterRunning
-	ch <- clusterNodesCount
-	ch <- clusterNodesRunningCount
-	ch <- nodeInfo
-	ch <- nodeRunning
-	ch <- nodeCPUUtilizationPercentage
-	ch <- nodeDiskUtilizationPercentage
-	ch <- nodeCassandraReadsPerSecond
-	ch <- nodeCassandraWritesPerSecond
+	if e.account != nil {
+		var done func()
+		ch, done = e.account.describer(ch)
+		defer done()
+	}
+	ch, described := e.units.latencyDescriber(ch)
+	defer described()
+	instaclustr.Describe(ch)
+	for _, t := range e.topologies {
+		t.describe(ch)
+	}
+	ch <- clusterComplianceInfo
+	ch <- datacentreInfo
+	ch <- datacentreNodes
+	ch <- datacentreRackLossTolerant
+	ch <- topologyLastRefreshTimestamp
+	ch <- topologyLastChangeTimestamp
+	describeSpark(ch)
+	ch <- nodeProvisioningDuration
+	e.units.describeUtilization(ch)
 	ch <- nodeCassandraCompactions
 	ch <- nodeCassandraRepairsPending
 	ch <- nodeCassandraRepairsActive
-	ch <- nodeClientRequestReadLatency
-	ch <- nodeClientRequestWriteLatency
-	ch <- nodeClientRequestReadPercentile
-	ch <- nodeClientRequestWritePercentile
-	ch <- nodeClientRequestReadPercentile99
-	ch <- nodeClientRequestWritePercentile99
+	if e.topologyLabels {
+		describeTopology(ch)
+	} else {
+		ch <- nodeCassandraReadsPerSecond
+		ch <- nodeCassandraWritesPerSecond
+		ch <- nodeCassandraReadsTotal
+		ch <- nodeCassandraWritesTotal
+		ch <- nodeClientRequestReadLatency
+		ch <- nodeClientRequestWriteLatency
+		ch <- nodeClientRequestReadPercentile
+		ch <- nodeClientRequestWritePercentile
+		ch <- nodeClientRequestReadPercentile99
+		ch <- nodeClientRequestWritePercentile99
+	}
+	describeThreadPools(ch)
+	describeOS(ch)
+	ch <- nodeLastSampleTimestamp
+	ch <- nodeMetricParseError
+	if len(e.nodeMetrics) > 0 {
+		ch <- nodeMonitoringMissing
+		ch <- nodeScrapeSuccess
+	}
+	for _, desc := range e.extraNodeMetrics {
+		ch <- desc
+	}
+	if e.describesNodeStatus() {
+		ch <- nodeStatus
+	}
+	for _, p := range e.products {
+		p.describe(ch)
+	}
+	if _, ok := e.provider.(tablesProvider); ok && e.tables != nil {
+		describeTables(ch)
+	}
+	if e.aggregateNodes || e.memoryLimit > 0 {
+		describeAggregates(ch)
+	}
+	if e.pollInterval > 0 {
+		ch <- lastCollectionTimestamp
+	}
+	ch <- scrapePeakHeapBytes
+	ch <- scrapePeakGoroutines
+	if e.memoryLimit > 0 {
+		ch <- memoryLimitExceeded
+	}
+	e.notFound.suppressed.Describe(ch)
+	e.nodeRetries.Describe(ch)
+	e.nodeDurations.Describe(ch)
+	e.values.sanitizer.sanitized.Describe(ch)
+	e.staleSamples.Describe(ch)
+	e.sanitizedLabels.Describe(ch)
+	ch <- apiCallsLastScrape
+	ch <- scrapeDuration
+	ch <- lastScrapeSuccess
+	ch <- clusterScrapeSuccess
+	ch <- apiUp
+	ch <- monitoringDisabled
+	if e.latencyThreshold > 0 {
+		ch <- latencyCoverageRatio
+	}
+	if e.quiet.enabled() {
+		e.quiet.mode.Describe(ch)
+	}
+	if e.repairStatus {
+		ch <- clusterLastRepairTimestamp
+		ch <- tableLastRepairTimestamp
+		ch <- tableRepairStatus
+	}
+	if e.nodeOperations {
+		ch <- nodeOperationsTotal
+	}
+	if e.consumerLag {
+		ch <- kafkaConsumerGroupLag
+		ch <- kafkaConsumerGroupConsumers
+	}
+}
+
+// LastScrape returns the summary of the last finished collection
+func (e *Exporter) LastScrape() (ScrapeSummary, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lastScrape == nil {
+		return ScrapeSummary{}, false
+	}
+	return *e.lastScrape, true
+}
+
+// OnSnapshot registers f to be called, in its own goroutine, with the
+// snapshot of every finished collection
+func (e *Exporter) OnSnapshot(f func(Snapshot)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.snapshotHandlers = append(e.snapshotHandlers, f)
+}
+
+// OnTransitions registers f to be called, in its own goroutine, with the
+// cluster and node status transitions found by every collection, if any
+func (e *Exporter) OnTransitions(f func([]Transition)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.transitionHandlers = append(e.transitionHandlers, f)
 }
 
 // Collect fetches the stats from configured Instaclustr location and delivers them
-// as Prometheus metrics. It implements prometheus.Collector.
+// as Prometheus metrics, or the last background collection ones when
+// CollectionInterval is set. It implements prometheus.Collector.
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	clusters := []cluster{}
-	dcs := new(datacentres)
-	wg := new(sync.WaitGroup)
+	e.CollectContext(context.Background(), ch)
+}
+
+// CollectContext is Collect bounded by ctx, e.g. by the scrape timeout: the
+// API requests still in flight when it's done are cancelled and the metrics
+// collected so far delivered
+func (e *Exporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	ch, sanitized := e.labelSanitizer(ch)
+	defer sanitized()
+	if e.account != nil {
+		var done func()
+		ch, done = e.account.labeler(ch)
+		defer done()
+	}
+	ch, labeled := e.units.latencyLabeler(ch)
+	defer labeled()
+	if e.pollInterval > 0 {
+		e.collectBackground(ch)
+		return
+	}
+	e.scrape(ctx, ch)
+}
+
+// scrape collects from the API within ctx and the timeout, or from the cache
+// in quiet windows and, with ExporterOptions.MaintenanceCache, while the API
+// is in maintenance
+func (e *Exporter) scrape(ctx context.Context, ch chan<- prometheus.Metric) {
+	if e.quiet.enabled() && e.quiet.active(e.clock.Now()) {
+		e.collectQuiet(ch)
+		return
+	}
+	if e.maintenanceCache && instaclustr.InMaintenance(e.clock) {
+		e.collectMaintenance(ch)
+		return
+	}
+	if e.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+	s := newScrape(e.clock)
+	s.provider = e.provider
+	s.recentErrors = e.recentErrors
+	s.shared = sharedTopologyFrom(ctx).of(e.provider)
+	s.filter = clusterFilterFrom(ctx)
+	if cp, ok := e.provider.(contextProvider); ok {
+		s.provider = cp.withContext(ctx)
+	}
+	counted, wait := s.count(ch)
+	stopSampling := sampleMemory()
+	// The metrics are only kept when served again in quiet windows or
+	// maintenance
+	if e.quiet.enabled() || e.maintenanceCache {
+		recorded, stop := record(counted)
+		e.collect(s, recorded)
+		// Failed and filtered collections, and the ones the API went into
+		// maintenance during, don't replace them
+		if cached := stop(); len(cached) > 0 && s.filter == nil && !instaclustr.InMaintenance(e.clock) {
+			e.mu.Lock()
+			e.cached = cached
+			e.mu.Unlock()
+		}
+	} else {
+		e.collect(s, counted)
+	}
+	if e.quiet.enabled() {
+		e.quiet.mode.Set(0)
+		e.quiet.mode.Collect(counted)
+	}
+	e.checkMemory(stopSampling())
+	e.collectMemory(counted)
+	s.collectAPICalls(counted)
+	s.collectAPIUp(counted)
+	s.collectOutcome(counted)
+	e.collectMonitoringDisabled(counted)
+	if e.latencyThreshold > 0 {
+		s.latency.collect(counted)
+	}
+	instaclustr.Collect(counted)
+	e.notFound.suppressed.Collect(counted)
+	e.nodeRetries.Collect(counted)
+	e.nodeDurations.Collect(counted)
+	e.values.sanitizer.sanitized.Collect(counted)
+	e.staleSamples.Collect(counted)
+	e.sanitizedLabels.Collect(counted)
+	wait()
+	s.failures.log()
+	if err := ctx.Err(); err != nil {
+		log.Warnf("Collection interrupted after %s, its metrics are partial: %v", e.clock.Now().Sub(s.start), err)
+		s.snapshot.setPartial()
+	}
 
-	// Fetching clusters list
-	if err := json.Unmarshal(e.provisioningClient.GetClusters(), &clusters); err != nil {
+	// Filtered collections only saw some clusters, they're no inventory
+	if s.filter != nil {
+		return
+	}
+	summary := s.summary()
+	snapshot := s.snapshot.build()
+	transitions := e.transitions.diff(snapshot)
+	e.mu.Lock()
+	e.lastScrape = &summary
+	e.queried = s.queried
+	for _, h := range e.snapshotHandlers {
+		go h(snapshot)
+	}
+	if len(transitions) > 0 {
+		for _, h := range e.transitionHandlers {
+			go h(transitions)
+		}
+	}
+	e.mu.Unlock()
+}
+
+// collectMonitoringDisabled tells whether node metrics are collected
+func (e *Exporter) collectMonitoringDisabled(ch chan<- prometheus.Metric) {
+	v := 0.0
+	if len(e.nodeMetrics) == 0 {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(monitoringDisabled, prometheus.GaugeValue, v)
+}
+
+// collectQuiet serves the metrics of the last collection without polling the API
+func (e *Exporter) collectQuiet(ch chan<- prometheus.Metric) {
+	e.quiet.mode.Set(1)
+	e.quiet.mode.Collect(ch)
+	e.collectCached(ch)
+}
+
+// collectMaintenance serves the metrics of the last collection until the API
+// is out of maintenance, so its clusters don't look down meanwhile
+func (e *Exporter) collectMaintenance(ch chan<- prometheus.Metric) {
+	if e.quiet.enabled() {
+		e.quiet.mode.Set(0)
+		e.quiet.mode.Collect(ch)
+	}
+	e.collectCached(ch)
+}
+
+// collectCached serves the metrics of the last collection along with the
+// exporter's own
+func (e *Exporter) collectCached(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	cached := e.cached
+	e.mu.Unlock()
+	for _, m := range cached {
+		ch <- m
+	}
+	// Nothing is polled
+	newScrape(e.clock).collectAPICalls(ch)
+	e.collectMemory(ch)
+	e.collectMonitoringDisabled(ch)
+	instaclustr.Collect(ch)
+	e.notFound.suppressed.Collect(ch)
+	e.nodeRetries.Collect(ch)
+	e.nodeDurations.Collect(ch)
+	e.values.sanitizer.sanitized.Collect(ch)
+	e.staleSamples.Collect(ch)
+	e.sanitizedLabels.Collect(ch)
+}
+
+func (e *Exporter) collect(s *scrape, ch chan<- prometheus.Metric) {
+	// Nodes failing are retried once all the others are collected, node
+	// aggregates are flushed after that
+	retries := new(retryQueue)
+	var flushes []func()
+	defer func() {
+		e.retryNodes(s, retries)
+		for _, flush := range flushes {
+			flush()
+		}
+	}()
+	e.provisioning.evict()
+	e.rates.evict()
+	pool := newNodePool(e.nodeConcurrency, func(f nodeFetch) {
+		defer recoverNode(s, f)
+		e.collectNode(s, f, retries)
+	})
+	defer pool.wait()
+
+	// Fetching clusters list, unless pinned
+	clusters, err := e.listClusters(s)
+	if err != nil {
 		log.Errorf("Couldn't get clusters: %v", err)
+		s.error()
+		s.recordError("ListClusters", "", "", err)
+		s.snapshot.setPartial()
 		return
 	}
+	// Clusters filtered out of the scrape are still there
+	if s.filter == nil {
+		e.discovery.retain(clusters)
+		e.nodeDurations.retain(clusters)
+		e.counterTotals.retain(clusters)
+	}
 
-	for _, c := range clusters {
-		clusterInfoCollector(c, ch)
-		clusterHealthCollector(c, ch)
-		// Queryng status of the cluster, gathers the list of Datacentres
-		if err := json.Unmarshal(e.provisioningClient.GetClusterStatus(c.ID), &dcs); err != nil {
-			log.Errorf("Couldn't get cluster %s datacentres: %v", c.ID, err)
-			return
+	// Queryng status of the clusters, gathers their lists of Datacentres
+	topologies := e.fetchTopologies(s, clusters)
+	for i, c := range clusters {
+		if described := topologies[i].described; described != nil {
+			c = *described
+		}
+		s.clusterScanned()
+		s.snapshot.addCluster(c)
+		e.clusterInfoCollector(c, ch)
+		e.clusterHealthCollector(c, ch)
+		complianceCollector(c, ch)
+		var repairs []repair
+		if e.repairStatus {
+			s.apiCall(provisioningAPI)
+			repairs = e.repairCollector(s, c, ch)
 		}
-		for _, dc := range dcs.Dcs {
+		if e.nodeOperations {
+			s.apiCall(provisioningAPI)
+			e.operationsCollector(s, c, ch)
+		}
+		if e.consumerLag && isKafka(c) {
+			e.consumerLagCollector(s, c, ch)
+		}
+		if err := topologies[i].err; err != nil {
+			s.fail("GetTopology", c.ID, "", err)
+			s.snapshot.setPartial()
+			ch <- prometheus.MustNewConstMetric(clusterScrapeSuccess, prometheus.GaugeValue, 0, c.ID)
+			e.discovery.collectLast(c, ch)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(clusterScrapeSuccess, prometheus.GaugeValue, 1, c.ID)
+		dcs := e.dcFilter.filter(topologies[i].dcs)
+		s.snapshot.addDataCentres(c.ID, dcs)
+		e.discovery.collect(c, dcs, e.clock.Now(), ch)
+		datacentreCollector(c, dcs, ch)
+		rackCollector(c, dcs, ch)
+		sparkCollector(c, dcs, ch)
+		tables := e.discoverTables(s, c, repairs)
+		if p := productOf(c); p == nil || e.collects(p) {
+			s.queried.add(c, tables)
+		}
+		nodeCh, flush := ch, func() {}
+		if e.aggregating() {
+			e.counterTotals.retainNodes(c.ID, topologies[i].dcs)
+			nodeCh, flush = aggregator(c.ID, e.counterTotals, ch)
+		}
+		for _, dc := range dcs {
 			for _, n := range dc.Nodes {
-				wg.Add(1)
-				go func(c cluster, n node, ch chan<- prometheus.Metric) {
-					defer wg.Done()
-					nodeInfoCollector(c, n, ch)
-					nodeHealthCollector(c, n, ch)
-					// Fetch all metrics from node
-					ms := []metrics{}
-					if err := json.Unmarshal(e.monitoringClient.GetNodeMetric(n.ID, strings.Join(allNodeMetricsQuery, ",")), &ms); err != nil {
-						log.Errorf("Could not gather any metric: %v\n", err)
-						return
-					}
-					// Collecting node metrics
-					nodeMetricsCollector(c, n, ms, ch)
-
-				}(c, n, ch)
+				if !e.pinned.includes(n) {
+					continue
+				}
+				n.dataCentre, n.provider, n.region = dc.Name, dc.Provider, dc.Region
+				pool.add(nodeFetch{c, n, nodeCh, tables})
 			}
-			// We don't close the channel, prometheus does the job
-			wg.Wait()
 		}
+		flushes = append(flushes, flush)
+	}
+}
+
+// collectNode exports the topology metrics of a node then fetches its
+// metrics, queueing it in retries when they couldn't be
+func (e *Exporter) collectNode(s *scrape, f nodeFetch, retries *retryQueue) {
+	c, n, ch := f.c, f.n, f.ch
+	s.nodeScanned()
+	e.nodeInfoCollector(c, n, ch)
+	e.nodeHealthCollector(c, n, ch)
+	e.provisioning.collect(n, ch)
+	if len(e.nodeMetrics) == 0 {
+		return
+	}
+	if e.notFound.skip(n.ID) {
+		collectMonitoringMissing(n, true, ch)
+		return
+	}
+	if p := productOf(c); p != nil && !e.collects(p) {
+		return
+	}
+	if len(f.tables) > 0 {
+		e.tableCollector(s, f)
+	}
+	// Fetch all metrics from node, in this worker's own slice
+	ms, err := e.fetchNodeMetrics(s, c, n)
+	if err == errNodeNotFound {
+		e.notFound.add(n.ID)
+		s.fail("GetNodeMetrics", c.ID, n.ID, err)
+		collectMonitoringMissing(n, true, ch)
+		collectNodeScrapeSuccess(n, false, ch)
+		return
+	}
+	if err != nil {
+		retries.add(f)
+		return
+	}
+	e.collectNodeMetrics(s, c, n, ms, ch)
+}
+
+// providerFor returns the provider of the collection s, bound to its context
+// when the provider supports it so the requests stop along with it and spend
+// the collection call budgets
+func (e *Exporter) providerFor(s *scrape) provider {
+	if s.provider != nil {
+		return s.provider
+	}
+	return e.provider
+}
+
+// listClusters returns the clusters to collect: the pinned ones or, when none
+// is, every cluster of the account, listed once for all the collectors
+// sharing the topology of the scrape. Only the ones the filter of the
+// collection matches are returned.
+func (e *Exporter) listClusters(s *scrape) ([]cluster, error) {
+	if e.pinned != nil {
+		// Pinned clusters are only named once their topology is fetched
+		return s.filter.filterClusterIDs(e.pinned.list()), nil
+	}
+	clusters, err := s.shared.listClusters(func() ([]cluster, error) {
+		s.apiCall(provisioningAPI)
+		clusters, err := e.providerFor(s).ListClusters()
+		s.called("ListClusters", err)
+		return clusters, err
+	})
+	return s.filter.filterClusters(clusters), err
+}
+
+// collectNodeMetrics exports the metrics fetched for n, then its scrape
+// success, which recoverNode exports as a failure when they panic
+func (e *Exporter) collectNodeMetrics(s *scrape, c cluster, n node, ms []metrics, ch chan<- prometheus.Metric) {
+	s.snapshot.addNodeMetrics(c.ID, n.ID, ms)
+	collectMonitoringMissing(n, monitoringMissing(ms), ch)
+	e.exportNodeMetrics(s, c, n, ms, ch)
+	collectNodeScrapeSuccess(n, true, ch)
+}
+
+// exportNodeMetrics exports the metrics of n, by its product
+func (e *Exporter) exportNodeMetrics(s *scrape, c cluster, n node, ms []metrics, ch chan<- prometheus.Metric) {
+	if p := productOf(c); p != nil {
+		e.productNodeCollector(p, c, n, ms, ch)
+		return
+	}
+	// Aggregates don't have per node labels
+	if e.topologyLabels && !e.aggregating() {
+		var done func()
+		ch, done = topologyLabeler(n, ch)
+		defer done()
+	}
+	if e.latencyThreshold > 0 {
+		gated, flush := latencyGate(e.latencyThreshold, ch)
+		e.nodeMetricsCollector(c, n, ms, gated)
+		s.latency.add(flush())
+	} else {
+		e.nodeMetricsCollector(c, n, ms, ch)
 	}
 }
@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var clusterComplianceInfo = prometheus.NewDesc(
+	prometheus.BuildFQName("instaclustr", "cluster", "compliance_info"),
+	"Compliance mode the cluster was provisioned in. Only exported when the Provisioning API returns it.",
+	[]string{"clusterId", "pci"},
+	nil,
+)
+
+// complianceCollector exports the compliance flags returned by the
+// Provisioning API for c
+func complianceCollector(c cluster, ch chan<- prometheus.Metric) {
+	if c.PCICompliant == nil {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(clusterComplianceInfo, prometheus.GaugeValue, 1, c.ID, strconv.FormatBool(*c.PCICompliant))
+}
@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestComplianceCollector(t *testing.T) {
+	cases := []struct {
+		json     string
+		expected string
+	}{
+		{`{"id": "c1", "pciCompliantCluster": true}`, "true"},
+		{`{"id": "c1", "pciCompliantCluster": false}`, "false"},
+		{`{"id": "c1"}`, ""},
+	}
+	for _, c := range cases {
+		var cl cluster
+		if err := json.Unmarshal([]byte(c.json), &cl); err != nil {
+			t.Fatal(err)
+		}
+		ch := make(chan prometheus.Metric, 1)
+		complianceCollector(cl, ch)
+		close(ch)
+		pci := ""
+		for m := range ch {
+			pb := &dto.Metric{}
+			m.Write(pb)
+			for _, l := range pb.GetLabel() {
+				if l.GetName() == "pci" {
+					pci = l.GetValue()
+				}
+			}
+		}
+		if pci != c.expected {
+			t.Errorf("%s: got pci %q want %q", c.json, pci, c.expected)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+// Totals not added to for this long are forgotten, e.g. the ones of removed
+// nodes
+const rateForgetAfter = time.Hour
+
+// rateSample is the last rate observed for a node metric along with the
+// accumulated total integrated so far
+type rateSample struct {
+	rate  float64
+	time  time.Time
+	total float64
+	// lastSeen is when the sample was last added, by the exporter clock
+	lastSeen time.Time
+}
+
+// rateIntegrator turns the per-second rates returned by the Monitoring API
+// into monotonically increasing totals. Every new sample adds the previous
+// rate multiplied by the time elapsed since it was taken, so repeated
+// collections of the same API sample do not count twice.
+type rateIntegrator struct {
+	mu      sync.Mutex
+	clock   common.Clock
+	samples map[string]*rateSample
+}
+
+func newRateIntegrator(clock common.Clock) *rateIntegrator {
+	return &rateIntegrator{clock: clock, samples: make(map[string]*rateSample)}
+}
+
+// add records a rate sampled at t for key and returns the accumulated total
+func (ri *rateIntegrator) add(key string, rate float64, t time.Time) float64 {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	s, ok := ri.samples[key]
+	if ok {
+		s.lastSeen = ri.clock.Now()
+	}
+	if math.IsNaN(rate) {
+		if ok {
+			return s.total
+		}
+		return 0
+	}
+
+	if !ok {
+		ri.samples[key] = &rateSample{rate: rate, time: t, lastSeen: ri.clock.Now()}
+		return 0
+	}
+	if t.After(s.time) {
+		// Rates are never negative, a negative value is just bad data
+		if s.rate > 0 {
+			s.total += s.rate * t.Sub(s.time).Seconds()
+		}
+		s.rate = rate
+		s.time = t
+	}
+	return s.total
+}
+
+// evict forgets the totals not added to for rateForgetAfter, once per
+// collection
+func (ri *rateIntegrator) evict() {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	now := ri.clock.Now()
+	for key, s := range ri.samples {
+		if now.Sub(s.lastSeen) > rateForgetAfter {
+			delete(ri.samples, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+func TestRateIntegrator(t *testing.T) {
+	start := time.Date(2017, 7, 3, 9, 0, 0, 0, time.UTC)
+	ri := newRateIntegrator(common.NewFakeClock(start))
+	steps := []struct {
+		rate     float64
+		sampled  time.Duration
+		expected float64
+	}{
+		{10, 0, 0},
+		{20, time.Minute, 600},
+		// The same API sample doesn't count twice
+		{20, time.Minute, 600},
+		// Nor does an older one
+		{50, 30 * time.Second, 600},
+		{-5, 2 * time.Minute, 1800},
+		// A negative rate is bad data, not integrated
+		{0, 3 * time.Minute, 1800},
+		{math.NaN(), 4 * time.Minute, 1800},
+	}
+	for i, s := range steps {
+		if total := ri.add("n1/cassandraReads", s.rate, start.Add(s.sampled)); total != s.expected {
+			t.Errorf("Step %d: got total %v want %v", i, total, s.expected)
+		}
+	}
+	if total := ri.add("n2/cassandraReads", math.NaN(), start); total != 0 {
+		t.Errorf("Got total %v for a first NaN rate, want 0", total)
+	}
+}
+
+func TestRateIntegratorEvict(t *testing.T) {
+	start := time.Date(2017, 7, 3, 9, 0, 0, 0, time.UTC)
+	clock := common.NewFakeClock(start)
+	ri := newRateIntegrator(clock)
+	for _, key := range []string{"n1/cassandraReads", "removed/cassandraReads"} {
+		ri.add(key, 10, start)
+	}
+
+	// Still added to, a NaN rate included, n1 is kept
+	for i := 1; i <= 3; i++ {
+		clock.Advance(30 * time.Minute)
+		rate := 10.0
+		if i == 2 {
+			rate = math.NaN()
+		}
+		ri.add("n1/cassandraReads", rate, start.Add(time.Duration(i)*time.Minute))
+		ri.evict()
+	}
+	if _, ok := ri.samples["removed/cassandraReads"]; ok {
+		t.Error("Total of a removed node kept")
+	}
+	if total := ri.add("n1/cassandraReads", 10, start.Add(4*time.Minute)); total != 2400 {
+		t.Errorf("Got total %v, want 2400", total)
+	}
+	// Counted from 0 again once forgotten
+	clock.Advance(2 * time.Hour)
+	ri.evict()
+	if total := ri.add("n1/cassandraReads", 10, start.Add(5*time.Minute)); total != 0 {
+		t.Errorf("Got total %v once forgotten, want 0", total)
+	}
+}
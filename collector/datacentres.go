@@ -0,0 +1,27 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	datacentreInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacentre", "info"),
+		"A mapping between the dcId and its name, cloud provider and cluster.",
+		[]string{"dcId", "dcName", "provider", "clusterId"},
+		nil,
+	)
+	datacentreNodes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "datacentre", "nodes"),
+		"Number of nodes the datacentre is composed of.",
+		[]string{"clusterId", "dcId"},
+		nil,
+	)
+)
+
+// datacentreCollector exports what the datacentres of c are and how many
+// nodes they have, so the nodes of multi-DC clusters can be joined to theirs
+func datacentreCollector(c cluster, dcs []datacentre, ch chan<- prometheus.Metric) {
+	for _, dc := range dcs {
+		ch <- prometheus.MustNewConstMetric(datacentreInfo, prometheus.GaugeValue, 1, dc.ID, dc.Name, dc.Provider, c.ID)
+		ch <- prometheus.MustNewConstMetric(datacentreNodes, prometheus.GaugeValue, float64(len(dc.Nodes)), c.ID, dc.ID)
+	}
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDatacentreCollector(t *testing.T) {
+	dcs := []datacentre{
+		{ID: "dc1", Name: "EU_WEST_1", Provider: "AWS_VPC", Nodes: []node{{ID: "n1"}, {ID: "n2"}}},
+		{ID: "dc2", Name: "US_EAST_1", Provider: "AWS_VPC"},
+	}
+	ch := make(chan prometheus.Metric, 4)
+	datacentreCollector(cluster{ID: "c1"}, dcs, ch)
+	close(ch)
+
+	nodes := map[string]float64{}
+	infos := 0
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		switch m.Desc() {
+		case datacentreInfo:
+			infos++
+			if labels["clusterId"] != "c1" || labels["provider"] != "AWS_VPC" || labels["dcName"] == "" {
+				t.Errorf("Unexpected datacentre info labels %v", labels)
+			}
+		case datacentreNodes:
+			nodes[labels["dcId"]] = pb.GetGauge().GetValue()
+		}
+	}
+	if infos != 2 {
+		t.Errorf("Got %d datacentre info series, want 2", infos)
+	}
+	if nodes["dc1"] != 2 || nodes["dc2"] != 0 || len(nodes) != 2 {
+		t.Errorf("Got datacentre nodes %v, want dc1 2 and dc2 0", nodes)
+	}
+}
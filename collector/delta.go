@@ -0,0 +1,143 @@
+package collector
+
+import (
+	"context"
+	"sort"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	clusterNodesDelta = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "nodes_delta"),
+		"Nodes of the cluster in the other account minus nodes in the collected one, clusters are matched by name.",
+		[]string{"clusterName", "delta"},
+		nil,
+	)
+	clusterNodesRunningDelta = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "nodes_running_delta"),
+		"Running nodes of the cluster in the other account minus running nodes in the collected one, clusters are matched by name.",
+		[]string{"clusterName", "delta"},
+		nil,
+	)
+	clusterStatusMatch = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "status_match"),
+		"Whether the cluster exists in both accounts with the same status, clusters are matched by name.",
+		[]string{"clusterName", "delta"},
+		nil,
+	)
+)
+
+// CompareOptions defines a second account compared with the collected one,
+// e.g. the new account of a migration
+type CompareOptions struct {
+	// Name of the collected account
+	Name string
+	// OtherName is the name of the compared account
+	OtherName string
+	// Other is the compared account, only its Provisioning API is used
+	Other instaclustr.Config
+}
+
+// Enabled tells whether an account to compare with has been configured
+func (o CompareOptions) Enabled() bool {
+	return o.Other.User != "" && o.Other.ProvisioningAPIKey != ""
+}
+
+// DeltaCollector exports the differences between the clusters of two
+// accounts, to track the parity of a migration
+type DeltaCollector struct {
+	base  provider
+	other provider
+	delta string
+}
+
+// NewDeltaCollector creates a DeltaCollector comparing the account of cfg with opts.Other
+func NewDeltaCollector(cfg instaclustr.Config, opts CompareOptions) *DeltaCollector {
+	return newDeltaCollector(newInstaclustrProvider(cfg), newInstaclustrProvider(opts.Other), opts.Name, opts.OtherName)
+}
+
+func newDeltaCollector(base, other provider, name, otherName string) *DeltaCollector {
+	return &DeltaCollector{base: base, other: other, delta: name + ":" + otherName}
+}
+
+// Describe implements prometheus.Collector
+func (d *DeltaCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterNodesDelta
+	ch <- clusterNodesRunningDelta
+	ch <- clusterStatusMatch
+}
+
+// clustersByName keys clusters by their sanitized name. Cluster names come
+// from the API, like the ones the Exporter sanitizes, the clusters whose name
+// is the same once sanitized are skipped as their series would clash.
+func clustersByName(clusters []cluster, err error) (map[string]cluster, error) {
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]cluster, len(clusters))
+	for _, c := range clusters {
+		name, _ := sanitizeLabelValue(c.Name, 0)
+		if other, ok := byName[name]; ok {
+			log.Errorf("Skipping cluster %s, named %q like cluster %s once sanitized", c.ID, name, other.ID)
+			continue
+		}
+		byName[name] = c
+	}
+	return byName, nil
+}
+
+// Collect implements prometheus.Collector. Clusters missing from one of the
+// accounts count as having no nodes.
+func (d *DeltaCollector) Collect(ch chan<- prometheus.Metric) {
+	d.CollectContext(context.Background(), ch)
+}
+
+// CollectContext is Collect with the requests to both accounts bound to ctx,
+// reusing the clusters of the collected account listed by the other
+// collectors sharing the topology of ctx
+func (d *DeltaCollector) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	baseProvider, otherProvider := d.base, d.other
+	if cp, ok := baseProvider.(contextProvider); ok {
+		baseProvider = cp.withContext(ctx)
+	}
+	if cp, ok := otherProvider.(contextProvider); ok {
+		otherProvider = cp.withContext(ctx)
+	}
+
+	base, err := clustersByName(sharedTopologyFrom(ctx).of(d.base).listClusters(baseProvider.ListClusters))
+	if err != nil {
+		log.Errorf("Couldn't get clusters of the collected account: %v", err)
+		return
+	}
+	other, err := clustersByName(otherProvider.ListClusters())
+	if err != nil {
+		log.Errorf("Couldn't get clusters of the compared account: %v", err)
+		return
+	}
+
+	names := make([]string, 0, len(base)+len(other))
+	for name := range base {
+		names = append(names, name)
+	}
+	for name := range other {
+		if _, ok := base[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, inBase := base[name]
+		o, inOther := other[name]
+		ch <- prometheus.MustNewConstMetric(clusterNodesDelta, prometheus.GaugeValue, float64(o.NodeCount-b.NodeCount), name, d.delta)
+		ch <- prometheus.MustNewConstMetric(clusterNodesRunningDelta, prometheus.GaugeValue, float64(o.RunningNodeCount-b.RunningNodeCount), name, d.delta)
+		match := 0.0
+		if inBase && inOther && b.DerivedStatus == o.DerivedStatus {
+			match = 1
+		}
+		ch <- prometheus.MustNewConstMetric(clusterStatusMatch, prometheus.GaugeValue, match, name, d.delta)
+	}
+}
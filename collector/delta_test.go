@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// clustersProvider only lists clusters
+type clustersProvider []cluster
+
+func (p clustersProvider) ListClusters() ([]cluster, error) { return p, nil }
+
+func (p clustersProvider) GetTopology(clusterID string) ([]datacentre, error) { return nil, nil }
+
+func (p clustersProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return nil, nil
+}
+
+// hangingProvider lists clusters once its context is done, like an account
+// not answering
+type hangingProvider struct {
+	clustersProvider
+	ctx context.Context
+}
+
+func (p hangingProvider) withContext(ctx context.Context) provider {
+	return hangingProvider{clustersProvider: p.clustersProvider, ctx: ctx}
+}
+
+func (p hangingProvider) ListClusters() ([]cluster, error) {
+	<-p.ctx.Done()
+	return nil, p.ctx.Err()
+}
+
+func TestDeltaCollector(t *testing.T) {
+	old := clustersProvider{
+		{ID: "1", Name: "orders", NodeCount: 6, RunningNodeCount: 6, DerivedStatus: "RUNNING"},
+		{ID: "2", Name: "sessions", NodeCount: 3, RunningNodeCount: 3, DerivedStatus: "RUNNING"},
+	}
+	migrated := clustersProvider{
+		{ID: "a", Name: "orders", NodeCount: 6, RunningNodeCount: 5, DerivedStatus: "DEGRADED"},
+		{ID: "b", Name: "search", NodeCount: 3, RunningNodeCount: 3, DerivedStatus: "RUNNING"},
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(newDeltaCollector(old, migrated, "old", "new")); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["delta"] != "old:new" {
+				t.Errorf("Unexpected delta label %q", labels["delta"])
+			}
+			got[mf.GetName()+"/"+labels["clusterName"]] = m.GetGauge().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_cluster_nodes_delta/orders":           0,
+		"cassandra_cluster_nodes_delta/sessions":         -3,
+		"cassandra_cluster_nodes_delta/search":           3,
+		"cassandra_cluster_nodes_running_delta/orders":   -1,
+		"cassandra_cluster_nodes_running_delta/sessions": -3,
+		"cassandra_cluster_nodes_running_delta/search":   3,
+		"cassandra_cluster_status_match/orders":          0,
+		"cassandra_cluster_status_match/sessions":        0,
+		"cassandra_cluster_status_match/search":          0,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+	for k, v := range expected {
+		if got[k] != v {
+			t.Errorf("%s: got %v want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestDeltaCollectorSanitizesNames(t *testing.T) {
+	dirty := clustersProvider{{ID: "1", Name: "pay\xffments\n", DerivedStatus: "RUNNING"}}
+	ch := make(chan prometheus.Metric, 3)
+	newDeltaCollector(dirty, dirty, "old", "new").Collect(ch)
+	close(ch)
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "clusterName" && l.GetValue() != "pay\ufffdments" {
+				t.Errorf("clusterName %q not sanitized", l.GetValue())
+			}
+		}
+	}
+}
+
+func TestDeltaCollectorBindsContext(t *testing.T) {
+	base := clustersProvider{{ID: "1", Name: "orders", DerivedStatus: "RUNNING"}}
+	other := hangingProvider{ctx: context.Background()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan prometheus.Metric, 3)
+	done := make(chan struct{})
+	go func() {
+		newDeltaCollector(base, other, "old", "new").CollectContext(ctx, ch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("CollectContext kept waiting for the compared account after ctx was done")
+	}
+	if len(ch) != 0 {
+		t.Errorf("got %d metrics without the compared account, want none", len(ch))
+	}
+}
+
+func TestDeltaCollectorSkipsNameCollisions(t *testing.T) {
+	// Both names are "pay\ufffdments" once sanitized
+	clashing := clustersProvider{
+		{ID: "1", Name: "pay\xffments", NodeCount: 3, DerivedStatus: "RUNNING"},
+		{ID: "2", Name: "pay\xfements", NodeCount: 6, DerivedStatus: "RUNNING"},
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(newDeltaCollector(clashing, clashing, "old", "new")); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if len(mf.GetMetric()) != 1 {
+			t.Errorf("%s: got %d series want 1", mf.GetName(), len(mf.GetMetric()))
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	topologyLastRefreshTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "topology", "last_refresh_timestamp_seconds"),
+		"Unix time the topology of the cluster was last fetched from the Provisioning API.",
+		[]string{"clusterId"},
+		nil,
+	)
+	topologyLastChangeTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "topology", "last_change_timestamp_seconds"),
+		"Unix time the nodes of the cluster, their datacentre, rack or size, were last seen changing. The time they were first fetched at until then.",
+		[]string{"clusterId"},
+		nil,
+	)
+)
+
+// discoveredTopology is when the topology of a cluster was last fetched and
+// last changed
+type discoveredTopology struct {
+	fingerprint string
+	refreshed   time.Time
+	changed     time.Time
+}
+
+// discoveryTracker tells how current the topology of the clusters is
+type discoveryTracker struct {
+	mu       sync.Mutex
+	clusters map[string]*discoveredTopology
+}
+
+func newDiscoveryTracker() *discoveryTracker {
+	return &discoveryTracker{clusters: map[string]*discoveredTopology{}}
+}
+
+// topologyFingerprint identifies the nodes of dcs along with their
+// datacentre, rack and size, whatever their order
+func topologyFingerprint(dcs []datacentre) string {
+	var nodes []string
+	for _, dc := range dcs {
+		for _, n := range dc.Nodes {
+			nodes = append(nodes, strings.Join([]string{n.ID, dc.ID, n.Rack, n.Size}, "/"))
+		}
+	}
+	sort.Strings(nodes)
+	return strings.Join(nodes, ",")
+}
+
+// refresh records the topology of c fetched at now, telling when it was
+// last refreshed and changed
+func (t *discoveryTracker) refresh(c cluster, dcs []datacentre, now time.Time) discoveredTopology {
+	fingerprint := topologyFingerprint(dcs)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.clusters[c.ID]
+	if !ok {
+		d = &discoveredTopology{fingerprint: fingerprint, changed: now}
+		t.clusters[c.ID] = d
+	}
+	if d.fingerprint != fingerprint {
+		d.fingerprint = fingerprint
+		d.changed = now
+	}
+	d.refreshed = now
+	return *d
+}
+
+// collect exports when the topology of c, just fetched, was refreshed and
+// changed
+func (t *discoveryTracker) collect(c cluster, dcs []datacentre, now time.Time, ch chan<- prometheus.Metric) {
+	exportTopology(c.ID, t.refresh(c, dcs, now), ch)
+}
+
+// collectLast exports when the topology of c, which couldn't be fetched, was
+// last refreshed and changed, nothing if it never was
+func (t *discoveryTracker) collectLast(c cluster, ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	d, ok := t.clusters[c.ID]
+	var last discoveredTopology
+	if ok {
+		last = *d
+	}
+	t.mu.Unlock()
+	if ok {
+		exportTopology(c.ID, last, ch)
+	}
+}
+
+// retain forgets the topology of the clusters no longer listed
+func (t *discoveryTracker) retain(clusters []cluster) {
+	listed := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		listed[c.ID] = true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.clusters {
+		if !listed[id] {
+			delete(t.clusters, id)
+		}
+	}
+}
+
+func exportTopology(clusterID string, d discoveredTopology, ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(topologyLastRefreshTimestamp, prometheus.GaugeValue, float64(d.refreshed.UnixNano())/1e9, clusterID)
+	ch <- prometheus.MustNewConstMetric(topologyLastChangeTimestamp, prometheus.GaugeValue, float64(d.changed.UnixNano())/1e9, clusterID)
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestDiscoveryTracker(t *testing.T) {
+	tracker := newDiscoveryTracker()
+	c := cluster{ID: "c1"}
+	t0 := time.Unix(1500000000, 0)
+	dcs := []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Rack: "r1"}, {ID: "n2", Rack: "r2"}}}}
+
+	d := tracker.refresh(c, dcs, t0)
+	if !d.refreshed.Equal(t0) || !d.changed.Equal(t0) {
+		t.Errorf("First refresh %v, changed %v, want both %v", d.refreshed, d.changed, t0)
+	}
+
+	// Same nodes, listed in another order, with another status
+	t1 := t0.Add(time.Minute)
+	same := []datacentre{{ID: "dc1", Nodes: []node{{ID: "n2", Rack: "r2"}, {ID: "n1", Rack: "r1", Status: "UNREACHABLE"}}}}
+	d = tracker.refresh(c, same, t1)
+	if !d.refreshed.Equal(t1) || !d.changed.Equal(t0) {
+		t.Errorf("Unchanged topology refreshed %v, changed %v, want %v and %v", d.refreshed, d.changed, t1, t0)
+	}
+
+	t2 := t1.Add(time.Minute)
+	replaced := []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Rack: "r1"}, {ID: "n3", Rack: "r2"}}}}
+	d = tracker.refresh(c, replaced, t2)
+	if !d.changed.Equal(t2) {
+		t.Errorf("Replaced node changed %v, want %v", d.changed, t2)
+	}
+
+	t3 := t2.Add(time.Minute)
+	resized := []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Rack: "r1", Size: "large"}, {ID: "n3", Rack: "r2"}}}}
+	if d = tracker.refresh(c, resized, t3); !d.changed.Equal(t3) {
+		t.Errorf("Resized node changed %v, want %v", d.changed, t3)
+	}
+}
+
+func TestDiscoveryTrackerFailedFetch(t *testing.T) {
+	tracker := newDiscoveryTracker()
+	c := cluster{ID: "c1"}
+	tracker.refresh(c, []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1"}}}}, time.Unix(1500000000, 0))
+
+	ch := make(chan prometheus.Metric, 4)
+	tracker.collectLast(c, ch)
+	tracker.collectLast(cluster{ID: "never-fetched"}, ch)
+	if len(ch) != 2 {
+		t.Fatalf("Got %d metrics for a failed fetch, want the 2 last timestamps", len(ch))
+	}
+	m := &dto.Metric{}
+	if err := (<-ch).Write(m); err != nil || m.GetGauge().GetValue() != 1500000000 {
+		t.Errorf("Got last refresh %v (%v), want 1500000000", m.GetGauge().GetValue(), err)
+	}
+
+	tracker.retain([]cluster{{ID: "c2"}})
+	if _, ok := tracker.clusters["c1"]; ok {
+		t.Error("Deleted cluster still tracked")
+	}
+}
@@ -0,0 +1,195 @@
+package collector
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricDoc documents a metric the exporter can emit
+type MetricDoc struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Help   string   `json:"help"`
+	Labels []string `json:"labels"`
+	Unit   string   `json:"unit,omitempty"`
+	// Source is the Instaclustr metric the value comes from, if any
+	Source string `json:"source,omitempty"`
+}
+
+// descSource is the Monitoring API metric a descriptor is exported from
+type descSource struct {
+	metric, unit string
+}
+
+var descSources = map[*prometheus.Desc]descSource{
+	nodeCPUUtilizationPercentage:            {"n::cpuUtilization", "percent"},
+	nodeDiskUtilizationPercentage:           {"n::diskUtilization", "percent"},
+	nodeCPUUtilizationRatio:                 {"n::cpuUtilization", "ratio"},
+	nodeDiskUtilizationRatio:                {"n::diskUtilization", "ratio"},
+	nodeCassandraReadsPerSecond:             {"n::cassandraReads", "per second"},
+	nodeCassandraWritesPerSecond:            {"n::cassandraWrites", "per second"},
+	nodeCassandraReadsTotal:                 {"n::cassandraReads", ""},
+	nodeCassandraWritesTotal:                {"n::cassandraWrites", ""},
+	nodeCassandraCompactions:                {"n::compactions", ""},
+	nodeStatus:                              {"n::nodeStatus", ""},
+	nodeCassandraRepairsPending:             {"n::repairs (pendingtasks)", ""},
+	nodeCassandraRepairsActive:              {"n::repairs (activetasks)", ""},
+	nodeThreadPoolPendingTasks:              {"n::nativeTransportRequests, n::mutationStage and n::readStage (pendingtasks)", ""},
+	nodeThreadPoolBlockedTasks:              {"n::nativeTransportRequests, n::mutationStage and n::readStage (blockedtasks)", ""},
+	nodeDroppedMutationsPerSecond:           {"n::droppedMessages (mutation)", "per second"},
+	nodeDroppedReadsPerSecond:               {"n::droppedMessages (read)", "per second"},
+	nodeHintsTotal:                          {"n::hintsTotal", ""},
+	nodeOSLoad:                              {"n::osLoad", ""},
+	nodeMemoryAvailableBytes:                {"n::memAvailable", "bytes"},
+	nodeNetworkInDeltaBytes:                 {"n::networkInDelta", "bytes"},
+	nodeNetworkOutDeltaBytes:                {"n::networkOutDelta", "bytes"},
+	nodeSwapUsedBytes:                       {"n::swapUsed", "bytes"},
+	nodeClientRequestReadLatency:            {"n::clientRequestRead (latency_per_operation)", "seconds"},
+	nodeClientRequestWriteLatency:           {"n::clientRequestWrite (latency_per_operation)", "seconds"},
+	nodeClientRequestReadPercentile:         {"n::clientRequestRead (95thPercentile)", "seconds"},
+	nodeClientRequestWritePercentile:        {"n::clientRequestWrite (95thPercentile)", "seconds"},
+	nodeClientRequestReadPercentile99:       {"n::clientRequestRead (99thPercentile)", "seconds"},
+	nodeClientRequestWritePercentile99:      {"n::clientRequestWrite (99thPercentile)", "seconds"},
+	kafkaNodeBytesInPerSecond:               {"k::kafkaBrokerTopicMetrics (bytesInPerSecond)", "bytes per second"},
+	kafkaNodeBytesOutPerSecond:              {"k::kafkaBrokerTopicMetrics (bytesOutPerSecond)", "bytes per second"},
+	kafkaNodeMessagesInPerSecond:            {"k::kafkaBrokerTopicMetrics (messagesInPerSecond)", "per second"},
+	kafkaNodeUnderReplicatedPartitions:      {"k::underReplicatedPartitions", ""},
+	kafkaNodeOfflinePartitions:              {"k::offlinePartitions", ""},
+	kafkaNodePartitions:                     {"k::partitionCount", ""},
+	kafkaNodeLeaders:                        {"k::leaderCount", ""},
+	kafkaConsumerGroupLag:                   {"consumer group consumerLag", ""},
+	kafkaConsumerGroupConsumers:             {"consumer group consumerCount", ""},
+	redisNodeMemoryUsedBytes:                {"r::usedMemory", "bytes"},
+	redisNodeConnectedClients:               {"r::connectedClients", ""},
+	redisNodeOpsPerSecond:                   {"r::instantaneousOpsPerSec", "per second"},
+	redisNodeEvictedKeysTotal:               {"r::evictedKeys", ""},
+	redisNodeKeyspaceHitsTotal:              {"r::keyspaceHits", ""},
+	redisNodeKeyspaceMissesTotal:            {"r::keyspaceMisses", ""},
+	postgresqlNodeConnections:               {"pg::connections", ""},
+	postgresqlNodeTransactionsPerSecond:     {"pg::transactionsPerSecond", "per second"},
+	postgresqlNodeReplicationLag:            {"pg::replicationLag", "seconds"},
+	postgresqlNodeDiskUtilizationPercentage: {"pg::diskUtilization", "percent"},
+	cadenceNodeWorkflowStartsPerSecond:      {"cadence::workflowStarts", "per second"},
+	cadenceNodeWorkflowCompletionsPerSecond: {"cadence::workflowCompletions", "per second"},
+	cadenceNodeTaskListBacklog:              {"cadence::taskListBacklog", ""},
+	cadenceNodeHistoryShards:                {"cadence::historyShards", ""},
+	cadenceNodeHistoryShardsUnhealthy:       {"cadence::historyShardsUnhealthy", ""},
+	tableReadLatency:                        {"cf::readLatency", "seconds"},
+	tableWriteLatency:                       {"cf::writeLatency", "seconds"},
+	tableLiveSSTables:                       {"cf::liveSSTableCount", ""},
+	tableLiveDiskSpaceUsedBytes:             {"cf::liveDiskSpaceUsed", "bytes"},
+}
+
+// Units told by the metric name suffixes
+var suffixUnits = []struct{ suffix, unit string }{
+	{"_seconds", "seconds"},
+	{"_percentage", "percent"},
+	{"_ratio", "ratio"},
+	{"_per_second", "per second"},
+}
+
+// metricTypes are the types of the metrics that are neither gauges nor
+// counters named _total, which descriptors don't tell
+var metricTypes = map[string]string{
+	"instaclustr_cluster_info":                        "counter",
+	"instaclustr_node_info":                           "counter",
+	"cassandra_cluster_info":                          "counter",
+	"cassandra_node_info":                             "counter",
+	"instaclustr_monitoring_request_duration_seconds": "histogram",
+}
+
+// Docs documents the metrics described by the collectors, sorted by name,
+// without collecting them. Descriptors don't tell the metric type: it's
+// taken from metricTypes, falling back to counter for _total names and
+// gauge otherwise.
+func Docs(collectors ...prometheus.Collector) []MetricDoc {
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		for _, c := range collectors {
+			c.Describe(ch)
+		}
+		close(ch)
+	}()
+	sources := map[string]descSource{}
+	for desc, src := range descSources {
+		sources[descName(desc)] = src
+	}
+	for desc, a := range nodeAggregates {
+		if src, ok := descSources[desc]; ok {
+			sources[descName(a.desc)] = src
+		}
+	}
+
+	seen := map[string]bool{}
+	docs := []MetricDoc{}
+	for desc := range ch {
+		name, help, labels, ok := descParts(desc)
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		doc := MetricDoc{Name: name, Help: help, Labels: labels, Type: metricTypes[name]}
+		if doc.Type == "" {
+			doc.Type = "gauge"
+			if strings.HasSuffix(doc.Name, "_total") {
+				doc.Type = "counter"
+			}
+		}
+		doc.Unit, doc.Source = sources[doc.Name].unit, sources[doc.Name].metric
+		for _, s := range suffixUnits {
+			if doc.Unit == "" && strings.HasSuffix(doc.Name, s.suffix) {
+				doc.Unit = s.unit
+			}
+		}
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Name < docs[j].Name })
+	return docs
+}
+
+// descParts returns the name, help and variable labels of desc, read from
+// its String(), the only way Desc exposes them. The name and help are
+// unquoted as they were quoted, whatever they contain, and the variable
+// labels, which can't contain spaces nor brackets, come last.
+func descParts(desc *prometheus.Desc) (string, string, []string, bool) {
+	const labelsField = ", variableLabels: ["
+	name, s, ok := quotedField(desc.String(), "Desc{fqName: ")
+	if !ok || name == "" {
+		return "", "", nil, false
+	}
+	help, s, ok := quotedField(s, ", help: ")
+	if !ok {
+		return "", "", nil, false
+	}
+	i := strings.LastIndex(s, labelsField)
+	if i < 0 || !strings.HasSuffix(s, "]}") {
+		return "", "", nil, false
+	}
+	return name, help, strings.Fields(s[i+len(labelsField) : len(s)-len("]}")]), true
+}
+
+// quotedField returns the Go quoted string following prefix in s, unquoted,
+// along with the rest of s
+func quotedField(s, prefix string) (string, string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return "", "", false
+	}
+	s = s[len(prefix):]
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", false
+	}
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", false
+	}
+	return value, s[len(quoted):], true
+}
+
+func descName(desc *prometheus.Desc) string {
+	name, _, _, _ := descParts(desc)
+	return name
+}
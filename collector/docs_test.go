@@ -0,0 +1,55 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDocs(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{AggregateNodes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := Docs(e)
+	byName := map[string]MetricDoc{}
+	for i, d := range docs {
+		if i > 0 && docs[i-1].Name >= d.Name {
+			t.Errorf("%s listed after %s", d.Name, docs[i-1].Name)
+		}
+		byName[d.Name] = d
+	}
+	expected := []MetricDoc{
+		{Name: "instaclustr_cluster_info", Type: "counter", Help: "A mapping between the clusterId and clusterName", Labels: []string{"clusterId", "clusterName"}},
+		{Name: "cassandra_node_reads_total", Type: "counter", Help: "Reads by Cassandra, accumulated from the reads per second rate.", Labels: []string{"nodeId"}, Source: "n::cassandraReads"},
+		{Name: "cassandra_node_client_request_read_percentile95", Type: "gauge", Help: byName["cassandra_node_client_request_read_percentile95"].Help, Labels: []string{"nodeId"}, Unit: "seconds", Source: "n::clientRequestRead (95thPercentile)"},
+		{Name: "cassandra_cluster_cpu_utilization_percentage", Type: "gauge", Help: byName["cassandra_cluster_cpu_utilization_percentage"].Help, Labels: []string{"clusterId", "stat"}, Unit: "percent", Source: "n::cpuUtilization"},
+		{Name: "instaclustr_exporter_monitoring_disabled", Type: "gauge"},
+	}
+	for _, want := range expected {
+		got, ok := byName[want.Name]
+		if !ok {
+			t.Errorf("%s not documented", want.Name)
+			continue
+		}
+		if want.Help == "" {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	}
+}
+
+func TestDescParts(t *testing.T) {
+	desc := prometheus.NewDesc("instaclustr_test", `Help quoting ", constLabels: {" and [brackets]`, []string{"clusterId", "nodeId"}, prometheus.Labels{"account": `a}, variableLabels: [x]`})
+	name, help, labels, ok := descParts(desc)
+	if !ok || name != "instaclustr_test" || help != `Help quoting ", constLabels: {" and [brackets]` || !reflect.DeepEqual(labels, []string{"clusterId", "nodeId"}) {
+		t.Errorf("Got %q, %q, %v (%v)", name, help, labels, ok)
+	}
+	if _, _, _, ok := descParts(prometheus.NewInvalidDesc(errors.New("invalid"))); ok {
+		t.Error("Invalid descriptor documented")
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+)
+
+// Collection errors kept by the exporter, the oldest ones are dropped first
+const recentErrorsSize = 100
+
+// operationAPIs are the APIs the operations call
+var operationAPIs = map[string]string{
+	"ListClusters":      provisioningAPI,
+	"GetTopology":       provisioningAPI,
+	"GetNodeMetrics":    monitoringAPI,
+	"GetRepairs":        provisioningAPI,
+	"GetEvents":         provisioningAPI,
+	"GetTableMetrics":   monitoringAPI,
+	"GetConsumerGroups": monitoringAPI,
+}
+
+// CollectionError is an error of a collection, for incident tooling
+type CollectionError struct {
+	Time time.Time `json:"time"`
+	// Origin is the federated exporter the error happened in, if any
+	Origin    string `json:"origin,omitempty"`
+	Operation string `json:"operation"`
+	// Endpoint is the API called, provisioning or monitoring
+	Endpoint string `json:"endpoint"`
+	Cluster  string `json:"clusterId,omitempty"`
+	Node     string `json:"nodeId,omitempty"`
+	// Class tells timeouts, network failures, API error statuses... apart,
+	// see errorClass
+	Class   string `json:"class"`
+	Message string `json:"message"`
+}
+
+// errorLog is a ring buffer of the latest collection errors
+type errorLog struct {
+	mu      sync.Mutex
+	entries []CollectionError
+	next    int
+}
+
+func newErrorLog(size int) *errorLog {
+	return &errorLog{entries: make([]CollectionError, 0, size)}
+}
+
+func (l *errorLog) add(e CollectionError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, e)
+		return
+	}
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// list returns the errors, oldest first
+func (l *errorLog) list() []CollectionError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]CollectionError, 0, len(l.entries))
+	list = append(list, l.entries[l.next:]...)
+	return append(list, l.entries[:l.next]...)
+}
+
+// errorClass classifies err so tooling can group failures without parsing
+// their messages
+func errorClass(err error) string {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+	switch e := err.(type) {
+	case *instaclustr.APIError:
+		return fmt.Sprintf("status_%d", e.Status)
+	case *instaclustr.MaintenanceError:
+		return "maintenance"
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return "decode"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	switch err {
+	case errNodeNotFound:
+		return "not_found"
+	case context.DeadlineExceeded:
+		return "timeout"
+	case context.Canceled:
+		return "canceled"
+	case instaclustr.ErrBudgetExceeded:
+		return "budget_exceeded"
+	case instaclustr.ErrResponseTooLarge:
+		return "response_too_large"
+	}
+	return "other"
+}
+
+// RecentErrors returns the latest errors of the collections, oldest first
+func (e *Exporter) RecentErrors() []CollectionError {
+	return e.recentErrors.list()
+}
+
+// RecentErrors returns the latest errors of the collections of every
+// origin, oldest first
+func (f *Federation) RecentErrors() []CollectionError {
+	var errors []CollectionError
+	for i, exp := range f.exporters {
+		for _, e := range exp.RecentErrors() {
+			e.Origin = f.origins[i]
+			errors = append(errors, e)
+		}
+	}
+	sort.SliceStable(errors, func(i, j int) bool { return errors[i].Time.Before(errors[j].Time) })
+	return errors
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestErrorLog(t *testing.T) {
+	l := newErrorLog(3)
+	for i := 0; i < 5; i++ {
+		l.add(CollectionError{Node: fmt.Sprintf("n%d", i)})
+	}
+	list := l.list()
+	if len(list) != 3 || list[0].Node != "n2" || list[2].Node != "n4" {
+		t.Errorf("Got %+v, want the last 3 errors oldest first", list)
+	}
+
+	classes := map[error]string{
+		&instaclustr.APIError{Status: 503}: "status_503",
+		&instaclustr.MaintenanceError{}:    "maintenance",
+		context.DeadlineExceeded:           "timeout",
+		instaclustr.ErrBudgetExceeded:      "budget_exceeded",
+		errNodeNotFound:                    "not_found",
+		errors.New("something else"):       "other",
+	}
+	for err, class := range classes {
+		if got := errorClass(err); got != class {
+			t.Errorf("%v: got class %q, want %q", err, got, class)
+		}
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	e, err := newExporter(&flakyProvider{failures: 2}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.Collect(ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+	errors := e.RecentErrors()
+	// The first failure is retried, only the retry failing is an error
+	if len(errors) != 1 {
+		t.Fatalf("Got errors %+v, want 1", errors)
+	}
+	got := errors[0]
+	if got.Operation != "GetNodeMetrics" || got.Endpoint != "monitoring" || got.Cluster != "c1" || got.Node != "n1" ||
+		got.Class != "other" || got.Message != "throttled" || got.Time.IsZero() {
+		t.Errorf("Got %+v", got)
+	}
+}
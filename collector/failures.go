@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/common/log"
+)
+
+// failure is every error of an operation during a collection, only the first
+// one is kept as an example
+type failure struct {
+	kind    string
+	count   int
+	example string
+	err     error
+}
+
+// failures aggregates the errors of a collection by operation, so an API
+// outage logs one line per operation instead of one per node
+type failures struct {
+	mu    sync.Mutex
+	order []string
+	byOp  map[string]*failure
+}
+
+func newFailures() *failures {
+	return &failures{byOp: make(map[string]*failure)}
+}
+
+// add records that op failed for the kind ("cluster", "node"...) of object id
+func (f *failures) add(op, kind, id string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fl, ok := f.byOp[op]
+	if !ok {
+		fl = &failure{kind: kind, example: id, err: err}
+		f.byOp[op] = fl
+		f.order = append(f.order, op)
+	}
+	fl.count++
+}
+
+// messages returns a line per failed operation, in the order they first failed
+func (f *failures) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msgs := make([]string, 0, len(f.order))
+	for _, op := range f.order {
+		fl := f.byOp[op]
+		if fl.count == 1 {
+			msgs = append(msgs, fmt.Sprintf("%s failed for %s %s: %v", op, fl.kind, fl.example, fl.err))
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("%s failed for %d %ss (example: %s: %v)", op, fl.count, fl.kind, fl.example, fl.err))
+	}
+	return msgs
+}
+
+func (f *failures) log() {
+	for _, msg := range f.messages() {
+		log.Error(logValue(msg))
+	}
+}
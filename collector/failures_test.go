@@ -0,0 +1,23 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFailures(t *testing.T) {
+	f := newFailures()
+	f.add("GetNodeMetrics", "node", "node-uuid-1", errors.New("connection refused"))
+	f.add("GetTopology", "cluster", "cluster-uuid-1", errors.New("timeout"))
+	f.add("GetNodeMetrics", "node", "node-uuid-2", errors.New("connection reset"))
+	f.add("GetNodeMetrics", "node", "node-uuid-3", errors.New("connection refused"))
+
+	expected := []string{
+		"GetNodeMetrics failed for 3 nodes (example: node-uuid-1: connection refused)",
+		"GetTopology failed for cluster cluster-uuid-1: timeout",
+	}
+	if got := f.messages(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q want %q", got, expected)
+	}
+}
@@ -0,0 +1,308 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// SnapshotPath is the route exporters serve the snapshot of their last
+// collection at, the one federated exporters are collected from
+const SnapshotPath = "/status/snapshot"
+
+const snapshotRequestTimeout = 30 * time.Second
+
+// originLabel is the label naming the federated exporter of every metric of
+// a Federation
+const originLabel = "origin"
+
+// ParseFederationTargets parses a comma separated list of origin=URL pairs,
+// URL being the base URL of an exporter
+func ParseFederationTargets(s string) (map[string]string, error) {
+	targets := map[string]string{}
+	if s == "" {
+		return targets, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid federation target %q, expected origin=URL", pair)
+		}
+		if _, ok := targets[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate federation target origin %q", kv[0])
+		}
+		targets[kv[0]] = kv[1]
+	}
+	return targets, nil
+}
+
+// snapshotProvider collects from the last snapshot of another exporter
+// instead of the Instaclustr API. The snapshot is fetched once per collection,
+// when listing the clusters, topologies and node metrics come from it.
+type snapshotProvider struct {
+	url    string
+	client *http.Client
+	mu     sync.Mutex
+	// clusters of the last snapshot by ID
+	clusters map[string]*clusterSnapshot
+	// nodes are the node metrics of the last snapshot by node ID
+	nodes map[string][]metric
+}
+
+func newSnapshotProvider(baseURL string) *snapshotProvider {
+	return &snapshotProvider{
+		url:    strings.TrimRight(baseURL, "/") + SnapshotPath,
+		client: &http.Client{Timeout: snapshotRequestTimeout},
+	}
+}
+
+func (p *snapshotProvider) ListClusters() ([]cluster, error) {
+	return p.listClusters(context.Background())
+}
+
+func (p *snapshotProvider) withContext(ctx context.Context) provider {
+	return boundSnapshotProvider{p, ctx}
+}
+
+// listClusters fetches the snapshot within ctx
+func (p *snapshotProvider) listClusters(ctx context.Context) ([]cluster, error) {
+	req, err := http.NewRequest("GET", p.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, p.url)
+	}
+	var snapshot Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, err
+	}
+	clusters := make([]cluster, 0, len(snapshot.Clusters))
+	byID := make(map[string]*clusterSnapshot, len(snapshot.Clusters))
+	nodes := map[string][]metric{}
+	for _, cs := range snapshot.Clusters {
+		clusters = append(clusters, cs.cluster)
+		byID[cs.ID] = cs
+		for id, ms := range cs.NodeMetrics {
+			nodes[id] = ms
+		}
+	}
+	p.mu.Lock()
+	p.clusters, p.nodes = byID, nodes
+	p.mu.Unlock()
+	return clusters, nil
+}
+
+func (p *snapshotProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cs, ok := p.clusters[clusterID]
+	if !ok {
+		return nil, fmt.Errorf("cluster %s not in the snapshot of %s", clusterID, p.url)
+	}
+	return cs.DataCentres, nil
+}
+
+// GetNodeMetrics returns the metrics the other exporter collected, nodes
+// whose metrics it didn't collect have none
+func (p *snapshotProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return []metrics{{Metrics: p.nodes[nodeID]}}, nil
+}
+
+// boundSnapshotProvider fetches the snapshot within ctx, sharing it with its
+// snapshotProvider
+type boundSnapshotProvider struct {
+	*snapshotProvider
+	ctx context.Context
+}
+
+func (p boundSnapshotProvider) ListClusters() ([]cluster, error) {
+	return p.listClusters(p.ctx)
+}
+
+// Federation collects other exporters through their snapshots, exporting
+// their metrics with an origin label, so per region exporters can be scraped
+// as a single target
+type Federation struct {
+	origins   []string
+	exporters []*Exporter
+	// client metrics are left out, the Instaclustr API isn't called
+	client map[*prometheus.Desc]bool
+}
+
+// NewFederation creates a Federation of the exporters at the base URLs in
+// opts.FederationTargets, processing their snapshots with opts. Clusters
+// can't be pinned, the snapshots have the clusters collected by the origins.
+func NewFederation(opts ExporterOptions) (*Federation, error) {
+	targets := opts.FederationTargets
+	opts.PinnedClusters, opts.PinnedNodes = nil, nil
+	f := &Federation{client: map[*prometheus.Desc]bool{}}
+	for origin := range targets {
+		f.origins = append(f.origins, origin)
+	}
+	sort.Strings(f.origins)
+	for _, origin := range f.origins {
+		exp, err := newExporter(newSnapshotProvider(targets[origin]), opts)
+		if err != nil {
+			return nil, err
+		}
+		f.exporters = append(f.exporters, exp)
+	}
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		instaclustr.Describe(ch)
+		close(ch)
+	}()
+	for desc := range ch {
+		f.client[desc] = true
+	}
+	return f, nil
+}
+
+// Describe implements prometheus.Collector, every origin has the same
+// metrics
+func (f *Federation) Describe(ch chan<- *prometheus.Desc) {
+	if len(f.exporters) == 0 {
+		return
+	}
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		f.exporters[0].Describe(descs)
+		close(descs)
+	}()
+	for desc := range descs {
+		if !f.client[desc] {
+			ch <- desc
+		}
+	}
+}
+
+// Collect implements prometheus.Collector, origins are collected
+// concurrently and emitted in origin order
+func (f *Federation) Collect(ch chan<- prometheus.Metric) {
+	f.CollectContext(context.Background(), ch)
+}
+
+// CollectContext is Collect bounded by ctx, see Exporter.CollectContext
+func (f *Federation) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	collected := make([][]prometheus.Metric, len(f.exporters))
+	var wg sync.WaitGroup
+	for i, exp := range f.exporters {
+		wg.Add(1)
+		go func(i int, exp *Exporter) {
+			defer wg.Done()
+			metrics := make(chan prometheus.Metric)
+			go func() {
+				exp.CollectContext(ctx, metrics)
+				close(metrics)
+			}()
+			for m := range metrics {
+				if !f.client[m.Desc()] {
+					collected[i] = append(collected[i], originMetric{m, f.origins[i]})
+				}
+			}
+		}(i, exp)
+	}
+	wg.Wait()
+	for _, metrics := range collected {
+		for _, m := range metrics {
+			ch <- m
+		}
+	}
+}
+
+// RunBackground collects every origin in the background until stop is
+// closed, see Exporter.RunBackground
+func (f *Federation) RunBackground(stop <-chan struct{}) {
+	for _, exp := range f.exporters {
+		go exp.RunBackground(stop)
+	}
+}
+
+// OnSnapshot registers f to be called with the snapshot of every origin
+func (f *Federation) OnSnapshot(h func(Snapshot)) {
+	for _, exp := range f.exporters {
+		exp.OnSnapshot(h)
+	}
+}
+
+// OnTransitions registers h to be called with the transitions of every origin
+func (f *Federation) OnTransitions(h func([]Transition)) {
+	for _, exp := range f.exporters {
+		exp.OnTransitions(h)
+	}
+}
+
+// LastScrape sums up the last collection of every origin, from the earliest
+// start to the longest duration, successful if every origin's was. It's
+// false until every origin was collected.
+func (f *Federation) LastScrape() (ScrapeSummary, bool) {
+	total := ScrapeSummary{Success: true}
+	for _, exp := range f.exporters {
+		summary, ok := exp.LastScrape()
+		if !ok {
+			return ScrapeSummary{}, false
+		}
+		if total.Start.IsZero() || summary.Start.Before(total.Start) {
+			total.Start = summary.Start
+		}
+		if summary.Duration > total.Duration {
+			total.Duration = summary.Duration
+		}
+		total.Clusters += summary.Clusters
+		total.Nodes += summary.Nodes
+		total.APICalls += summary.APICalls
+		total.Errors += summary.Errors
+		total.Series += summary.Series
+		total.FailedAPICalls += summary.FailedAPICalls
+		total.Success = total.Success && summary.Success
+	}
+	return total, len(f.exporters) > 0
+}
+
+// LastPoll returns the earliest LastPoll times of the origins, see
+// Exporter.LastPoll
+func (f *Federation) LastPoll() (started, finished time.Time) {
+	for i, exp := range f.exporters {
+		s, e := exp.LastPoll()
+		if i == 0 || s.Before(started) {
+			started = s
+		}
+		if i == 0 || e.Before(finished) {
+			finished = e
+		}
+	}
+	return started, finished
+}
+
+// originMetric is a metric of a federated exporter, labeled with its origin
+type originMetric struct {
+	prometheus.Metric
+	origin string
+}
+
+func (m originMetric) Write(pb *dto.Metric) error {
+	if err := m.Metric.Write(pb); err != nil {
+		return err
+	}
+	pb.Label = append(pb.Label, &dto.LabelPair{Name: proto.String(originLabel), Value: proto.String(m.origin)})
+	sort.Sort(prometheus.LabelPairSorter(pb.Label))
+	return nil
+}
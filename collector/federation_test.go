@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestFederation(t *testing.T) {
+	snapshot := Snapshot{Time: time.Now(), Clusters: []*clusterSnapshot{{
+		cluster:     cluster{ID: "c1", Name: "cluster", DerivedStatus: "RUNNING"},
+		DataCentres: []datacentre{{ID: "dc1", Name: "DC1", Nodes: []node{{ID: "n1", Status: "RUNNING"}}}},
+		NodeMetrics: map[string][]metric{"n1": {{Name: "cpuUtilization", Values: []metricValue{{Value: "42"}}}}},
+	}}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(SnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(snapshot)
+	})
+	mux.HandleFunc("/down"+SnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "No collection has finished yet.", http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f, err := NewFederation(ExporterOptions{FederationTargets: map[string]string{
+		"eu":   server.URL,
+		"us":   server.URL + "/",
+		"apac": server.URL + "/down",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		f.Collect(ch)
+		close(ch)
+	}()
+	cpu := map[string]float64{}
+	up := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["origin"] == "" {
+			t.Errorf("%s exported without origin", m.Desc())
+		}
+		switch m.Desc() {
+		case nodeCPUUtilizationPercentage:
+			cpu[labels["origin"]] = pb.GetGauge().GetValue()
+		case lastScrapeSuccess:
+			up[labels["origin"]] = pb.GetGauge().GetValue()
+		}
+	}
+	if len(cpu) != 2 || cpu["eu"] != 42 || cpu["us"] != 42 {
+		t.Errorf("Got CPU utilization %v", cpu)
+	}
+	if up["eu"] != 1 || up["us"] != 1 || up["apac"] != 0 {
+		t.Errorf("Got last scrape success %v", up)
+	}
+	if summary, ok := f.LastScrape(); !ok || summary.Clusters != 2 || summary.Errors == 0 {
+		t.Errorf("Got summary %+v", summary)
+	}
+	queries := f.MetricQueries()
+	if len(queries) != 2 || len(queries["eu/cassandra"]) == 0 || len(queries["us/cassandra"]) == 0 {
+		t.Errorf("Got metric queries %v", queries)
+	}
+
+	if _, err := ParseFederationTargets("eu=http://exporter-eu:9279,us"); err == nil {
+		t.Errorf("Target without URL parsed")
+	}
+	if _, err := ParseFederationTargets("eu=http://exporter-eu:9279,eu=http://exporter-us:9279"); err == nil {
+		t.Errorf("Targets with the same origin parsed")
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import "sync"
+
+const (
+	// Clusters whose topology is fetched at the same time by default
+	defaultClusterConcurrency = 4
+	// Nodes whose metrics are fetched at the same time by default
+	defaultNodeConcurrency = 10
+)
+
+// topologyResult is the topology of a cluster or why it couldn't be fetched
+type topologyResult struct {
+	dcs []datacentre
+	err error
+	// described is the cluster as described along with its topology, nil
+	// when listed
+	described *cluster
+}
+
+// fetchTopologies fetches the topology of every cluster, at most concurrency
+// at a time, unless another collector of the scrape already did. Results are
+// in the order of clusters, so metrics are still emitted in a deterministic
+// order.
+func (e *Exporter) fetchTopologies(s *scrape, clusters []cluster) []topologyResult {
+	results := make([]topologyResult, len(clusters))
+	sem := make(chan struct{}, e.concurrency)
+	wg := new(sync.WaitGroup)
+	for i, c := range clusters {
+		wg.Add(1)
+		go func(i int, c cluster) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = s.shared.topology(c.ID, func() topologyResult {
+				s.apiCall(provisioningAPI)
+				result := e.fetchTopology(s, c)
+				s.called("GetTopology", result.err)
+				return result
+			})
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+// fetchTopology fetches the topology of c, describing it too when the
+// clusters are pinned, as they weren't listed
+func (e *Exporter) fetchTopology(s *scrape, c cluster) topologyResult {
+	prov := e.providerFor(s)
+	if d, ok := prov.(clusterDescriber); ok && e.pinned != nil {
+		described, dcs, err := d.DescribeCluster(c.ID)
+		if err != nil {
+			return topologyResult{err: err}
+		}
+		return topologyResult{dcs: dcs, described: &described}
+	}
+	dcs, err := prov.GetTopology(c.ID)
+	return topologyResult{dcs: dcs, err: err}
+}
+
+// nodePool runs work on the nodes added to it with a fixed number of
+// workers, so a collection has at most that many Monitoring API requests in
+// flight whatever the size of the clusters
+type nodePool struct {
+	nodes chan nodeFetch
+	wg    sync.WaitGroup
+}
+
+func newNodePool(workers int, work func(nodeFetch)) *nodePool {
+	p := &nodePool{nodes: make(chan nodeFetch)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for f := range p.nodes {
+				work(f)
+			}
+		}()
+	}
+	return p
+}
+
+// add hands f to the next idle worker, blocking until there's one
+func (p *nodePool) add(f nodeFetch) {
+	p.nodes <- f
+}
+
+// wait waits for the nodes added to be worked on. Nothing can be added after.
+func (p *nodePool) wait() {
+	close(p.nodes)
+	p.wg.Wait()
+}
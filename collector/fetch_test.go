@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// slowProvider lists many clusters whose topologies take a while
+type slowProvider struct {
+	fakeProvider
+	mu                sync.Mutex
+	inFlight, maxSeen int
+}
+
+func (p *slowProvider) ListClusters() ([]cluster, error) {
+	clusters := []cluster{}
+	for i := 0; i < 10; i++ {
+		clusters = append(clusters, cluster{ID: fmt.Sprintf("c%d", i)})
+	}
+	return clusters, nil
+}
+
+func (p *slowProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	p.mu.Lock()
+	p.inFlight++
+	if p.inFlight > p.maxSeen {
+		p.maxSeen = p.inFlight
+	}
+	p.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return []datacentre{{ID: "dc-" + clusterID}}, nil
+}
+
+func TestFetchTopologies(t *testing.T) {
+	prov := &slowProvider{}
+	e, err := newExporter(prov, ExporterOptions{ClusterConcurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters, _ := prov.ListClusters()
+	results := e.fetchTopologies(newScrape(e.clock), clusters)
+	for i, r := range results {
+		if r.err != nil || len(r.dcs) != 1 || r.dcs[0].ID != "dc-"+clusters[i].ID {
+			t.Errorf("%s: got %+v", clusters[i].ID, r)
+		}
+	}
+	if prov.maxSeen < 2 || prov.maxSeen > 3 {
+		t.Errorf("Got up to %d concurrent fetches, want 2 to 3", prov.maxSeen)
+	}
+}
+
+// slowNodesProvider has a cluster of many nodes whose metrics take a while
+type slowNodesProvider struct {
+	slowProvider
+	fetched int
+}
+
+func (p *slowNodesProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "c1"}}, nil
+}
+
+func (p *slowNodesProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	var nodes []node
+	for i := 0; i < 20; i++ {
+		nodes = append(nodes, node{ID: fmt.Sprintf("n%d", i)})
+	}
+	return []datacentre{{ID: "dc1", Nodes: nodes[:12]}, {ID: "dc2", Nodes: nodes[12:]}}, nil
+}
+
+func (p *slowNodesProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.fetched++
+	if p.inFlight > p.maxSeen {
+		p.maxSeen = p.inFlight
+	}
+	p.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return p.fakeProvider.GetNodeMetrics(nodeID, names)
+}
+
+func TestNodeConcurrency(t *testing.T) {
+	prov := &slowNodesProvider{}
+	e, err := newExporter(prov, ExporterOptions{NodeConcurrency: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.collect(newScrape(e.clock), ch)
+		close(ch)
+	}()
+	cpu := 0
+	for m := range ch {
+		if m.Desc() == nodeCPUUtilizationPercentage {
+			cpu++
+		}
+	}
+	if prov.fetched != 20 || cpu != 20 {
+		t.Errorf("Fetched %d nodes, exported the CPU of %d, want 20", prov.fetched, cpu)
+	}
+	if prov.maxSeen < 2 || prov.maxSeen > 4 {
+		t.Errorf("Got up to %d concurrent fetches, want 2 to 4", prov.maxSeen)
+	}
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// dcFilter keeps the datacentres whose name (or id) and provider are
+// included, an empty list includes every datacentre
+type dcFilter struct {
+	names     map[string]bool
+	providers map[string]bool
+}
+
+// normalizeDC makes "eu-west-1" match the Instaclustr "EU_WEST_1"
+func normalizeDC(s string) string {
+	return strings.ToUpper(strings.Replace(strings.TrimSpace(s), "-", "_", -1))
+}
+
+func newDCFilter(names, providers []string) *dcFilter {
+	f := &dcFilter{names: map[string]bool{}, providers: map[string]bool{}}
+	for _, n := range names {
+		f.names[normalizeDC(n)] = true
+	}
+	for _, p := range providers {
+		f.providers[normalizeDC(p)] = true
+	}
+	return f
+}
+
+func (f *dcFilter) include(dc datacentre) bool {
+	if len(f.names) > 0 && !f.names[normalizeDC(dc.Name)] && !f.names[normalizeDC(dc.ID)] {
+		return false
+	}
+	if len(f.providers) > 0 && !f.providers[normalizeDC(dc.Provider)] {
+		return false
+	}
+	return true
+}
+
+// filter returns the included datacentres of dcs
+func (f *dcFilter) filter(dcs []datacentre) []datacentre {
+	if len(f.names) == 0 && len(f.providers) == 0 {
+		return dcs
+	}
+	included := make([]datacentre, 0, len(dcs))
+	for _, dc := range dcs {
+		if f.include(dc) {
+			included = append(included, dc)
+		}
+	}
+	return included
+}
+
+// ClusterFilter selects clusters by id and name, a nil field matches them all
+type ClusterFilter struct {
+	IDs  map[string]bool
+	Name *regexp.Regexp
+}
+
+// Match tells whether the cluster with id and name is selected
+func (f ClusterFilter) Match(id, name string) bool {
+	return (f.IDs == nil || f.IDs[id]) && (f.Name == nil || f.Name.MatchString(name))
+}
+
+type clusterFilterKey struct{}
+
+// WithClusterFilter returns ctx limiting the collections within it to the
+// clusters f matches, so the other clusters aren't fetched at all
+func WithClusterFilter(ctx context.Context, f ClusterFilter) context.Context {
+	return context.WithValue(ctx, clusterFilterKey{}, f)
+}
+
+// clusterFilterFrom returns the cluster filter of ctx, nil when there's none
+func clusterFilterFrom(ctx context.Context) *ClusterFilter {
+	f, ok := ctx.Value(clusterFilterKey{}).(ClusterFilter)
+	if !ok {
+		return nil
+	}
+	return &f
+}
+
+// filterClusters returns the clusters of cs f matches, all of them if f is nil
+func (f *ClusterFilter) filterClusters(cs []cluster) []cluster {
+	if f == nil {
+		return cs
+	}
+	var matched []cluster
+	for _, c := range cs {
+		if f.Match(c.ID, c.Name) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// filterClusterIDs returns the clusters of cs whose id f matches, all of them
+// if f is nil
+func (f *ClusterFilter) filterClusterIDs(cs []cluster) []cluster {
+	if f == nil {
+		return cs
+	}
+	return (&ClusterFilter{IDs: f.IDs}).filterClusters(cs)
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDCFilter(t *testing.T) {
+	dcs := []datacentre{
+		{ID: "dc-1", Name: "EU_WEST_1", Provider: "AWS_VPC"},
+		{ID: "dc-2", Name: "US_EAST_1", Provider: "AWS_VPC"},
+		{ID: "dc-3", Name: "europe-west1", Provider: "GCP"},
+	}
+	tests := []struct {
+		names     []string
+		providers []string
+		expected  []string
+	}{
+		{nil, nil, []string{"dc-1", "dc-2", "dc-3"}},
+		{[]string{"eu-west-1"}, nil, []string{"dc-1"}},
+		{[]string{"dc-2", "EUROPE_WEST1"}, nil, []string{"dc-2", "dc-3"}},
+		{nil, []string{"aws_vpc"}, []string{"dc-1", "dc-2"}},
+		{[]string{"eu-west-1", "europe-west1"}, []string{"AWS_VPC"}, []string{"dc-1"}},
+		{nil, []string{"AZURE"}, []string{}},
+	}
+	for _, test := range tests {
+		got := []string{}
+		for _, dc := range newDCFilter(test.names, test.providers).filter(dcs) {
+			got = append(got, dc.ID)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("Names %v providers %v: got %v want %v", test.names, test.providers, got, test.expected)
+		}
+	}
+}
+
+// fakeTwoClustersProvider lists two clusters, recording the topologies fetched
+type fakeTwoClustersProvider struct {
+	fakeProvider
+	fetched *[]string
+}
+
+func (fakeTwoClustersProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "c1", Name: "payments"}, {ID: "c2", Name: "search"}}, nil
+}
+
+func (p fakeTwoClustersProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	*p.fetched = append(*p.fetched, clusterID)
+	return []datacentre{{ID: "dc-" + clusterID, Nodes: []node{{ID: "n-" + clusterID, Status: "RUNNING"}}}}, nil
+}
+
+func TestClusterFilterCollection(t *testing.T) {
+	var fetched []string
+	e, err := newExporter(fakeTwoClustersProvider{fetched: &fetched}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		ctx := WithClusterFilter(context.Background(), ClusterFilter{Name: regexp.MustCompile("^(?:search)$")})
+		e.CollectContext(ctx, ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+	if expected := []string{"c2"}; !reflect.DeepEqual(fetched, expected) {
+		t.Errorf("Fetched the topologies of %v, want %v", fetched, expected)
+	}
+	if _, ok := e.LastScrape(); ok {
+		t.Error("A filtered collection replaced the last scrape summary")
+	}
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The InstaClustr API sometimes switches between numeric and string encodings
+// of the same field. The flexible types below decode both, so such a change
+// doesn't fail a whole response or zero out a metric.
+
+// flexNumber is a number that may be encoded as a JSON number or string
+type flexNumber float64
+
+// UnmarshalJSON implements json.Unmarshaler. null and "" decode to 0.
+func (n *flexNumber) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*n = 0
+		return nil
+	}
+	raw := string(data)
+	if data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		raw = strings.TrimSpace(s)
+		if raw == "" {
+			*n = 0
+			return nil
+		}
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*n = flexNumber(v)
+	return nil
+}
+
+// flexString is a string that may be encoded as a JSON string or number, e.g.
+// Monitoring API values
+type flexString string
+
+// UnmarshalJSON implements json.Unmarshaler. Numbers are kept as written, null
+// decodes to "".
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ""
+	case data[0] == '"':
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		*s = flexString(str)
+	default:
+		var num json.Number
+		if err := json.Unmarshal(data, &num); err != nil {
+			return fmt.Errorf("invalid string or number %s", data)
+		}
+		*s = flexString(num)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFlexibleClusterCounts(t *testing.T) {
+	cases := []string{
+		`[{"id":"c1","nodeCount":3,"runningNodeCount":2}]`,
+		`[{"id":"c1","nodeCount":"3","runningNodeCount":"2"}]`,
+		`[{"id":"c1","nodeCount":3.0,"runningNodeCount":" 2 "}]`,
+	}
+	for _, data := range cases {
+		clusters := []cluster{}
+		if err := json.Unmarshal([]byte(data), &clusters); err != nil {
+			t.Errorf("%s: %v", data, err)
+			continue
+		}
+		if clusters[0].NodeCount != 3 || clusters[0].RunningNodeCount != 2 {
+			t.Errorf("%s: got %v/%v nodes running want 2/3", data, clusters[0].RunningNodeCount, clusters[0].NodeCount)
+		}
+	}
+
+	for _, data := range []string{`{"nodeCount":null}`, `{"nodeCount":""}`} {
+		c := cluster{NodeCount: 5}
+		if err := json.Unmarshal([]byte(data), &c); err != nil || c.NodeCount != 0 {
+			t.Errorf("%s: got %v, %v want 0", data, c.NodeCount, err)
+		}
+	}
+	for _, data := range []string{`{"nodeCount":"three"}`, `{"nodeCount":true}`} {
+		c := cluster{}
+		if err := json.Unmarshal([]byte(data), &c); err == nil {
+			t.Errorf("%s should fail to decode", data)
+		}
+	}
+}
+
+func TestFlexibleMetricValues(t *testing.T) {
+	data := `[{"id":"n1","payload":[
+		{"metric":"cpuUtilization","type":"percentage","values":[{"time":"2017-07-03T09:37:04.000Z","value":"2.5"}]},
+		{"metric":"diskUtilization","type":"percentage","values":[{"time":"2017-07-03T09:37:04.000Z","value":7.25}]},
+		{"metric":"compactions","type":"pendingtasks","values":[{"time":"2017-07-03T09:37:04.000Z","value":null}]}
+	]}]`
+	ms, err := parseNodeMetrics([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]flexString{"cpuUtilization": "2.5", "diskUtilization": "7.25", "compactions": ""}
+	if len(ms) != 1 || len(ms[0].Metrics) != len(expected) {
+		t.Fatalf("got %+v", ms)
+	}
+	for _, m := range ms[0].Metrics {
+		if got := m.Values[0].Value; got != expected[m.Name] {
+			t.Errorf("%s: got %q want %q", m.Name, got, expected[m.Name])
+		}
+	}
+}
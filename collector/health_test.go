@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestClusterNodesRunningRatio(t *testing.T) {
+	cases := []struct {
+		nodes, running flexNumber
+		expected       float64
+		exported       bool
+	}{
+		{4, 3, 0.75, true},
+		{3, 3, 1, true},
+		{0, 0, 0, false},
+	}
+	for _, c := range cases {
+		ch := make(chan prometheus.Metric, 10)
+		clusterHealthCollector(neutralTopology, cluster{ID: "c1", NodeCount: c.nodes, RunningNodeCount: c.running}, ch)
+		close(ch)
+		exported := false
+		for m := range ch {
+			if m.Desc() != instaclustrClusterNodesRunningRatio {
+				continue
+			}
+			exported = true
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				t.Fatal(err)
+			}
+			if v := pb.GetGauge().GetValue(); v != c.expected {
+				t.Errorf("%v/%v nodes running: got ratio %v, want %v", c.running, c.nodes, v, c.expected)
+			}
+		}
+		if exported != c.exported {
+			t.Errorf("%v nodes: ratio exported %v, want %v", c.nodes, exported, c.exported)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/fcgravalos/instaclustr_exporter/parquet"
+)
+
+// Inventory formats
+const (
+	InventoryCSV     = "csv"
+	InventoryParquet = "parquet"
+)
+
+// inventoryHeader are the columns of the inventory, one row per node
+var inventoryHeader = []string{
+	"clusterId", "clusterName", "clusterStatus", "nodeCount", "runningNodeCount",
+	"dataCentreId", "dataCentre", "provider",
+	"nodeId", "size", "rack", "nodeStatus", "publicAddress", "privateAddress",
+}
+
+// inventoryWriter writes the rows of the inventory in a format
+type inventoryWriter interface {
+	Write(row []string) error
+	// Close writes what is left, not closing the underlying writer
+	Close() error
+}
+
+// csvInventory writes the inventory as CSV, the header included
+type csvInventory struct {
+	*csv.Writer
+}
+
+func (w csvInventory) Close() error {
+	w.Flush()
+	return w.Error()
+}
+
+// newInventoryWriter returns the writer of the inventory in format to w
+func newInventoryWriter(format string, w io.Writer) (inventoryWriter, error) {
+	switch format {
+	case InventoryCSV:
+		cw := csvInventory{csv.NewWriter(w)}
+		return cw, cw.Write(inventoryHeader)
+	case InventoryParquet:
+		columns := make([]parquet.Column, len(inventoryHeader))
+		for i, name := range inventoryHeader {
+			columns[i] = parquet.Column{Name: name, Type: parquet.String}
+			if name == "nodeCount" || name == "runningNodeCount" {
+				columns[i].Type = parquet.Int64
+			}
+		}
+		return parquet.NewWriter(w, columns), nil
+	}
+	return nil, errInventoryFormat(format)
+}
+
+// ValidInventoryFormat checks the inventory can be written in format
+func ValidInventoryFormat(format string) error {
+	if format != InventoryCSV && format != InventoryParquet {
+		return errInventoryFormat(format)
+	}
+	return nil
+}
+
+func errInventoryFormat(format string) error {
+	return fmt.Errorf("unsupported format %q, expected %s or %s", format, InventoryCSV, InventoryParquet)
+}
+
+// WriteInventory writes the clusters, datacentres and nodes of the account in
+// format, CSV or Parquet, to w, one row per node
+func WriteInventory(cfg instaclustr.Config, format string, w io.Writer) error {
+	return writeInventory(newInstaclustrProvider(cfg), format, w)
+}
+
+func writeInventory(prov provider, format string, w io.Writer) error {
+	if err := ValidInventoryFormat(format); err != nil {
+		return err
+	}
+	clusters, err := prov.ListClusters()
+	if err != nil {
+		return err
+	}
+	iw, err := newInventoryWriter(format, w)
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		dcs, err := prov.GetTopology(c.ID)
+		if err != nil {
+			return err
+		}
+		for _, dc := range dcs {
+			for _, n := range dc.Nodes {
+				if err := iw.Write(inventoryRow(c, dc, n)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return iw.Close()
+}
+
+// inventoryRow is the inventory of n, in the inventoryHeader order
+func inventoryRow(c cluster, dc datacentre, n node) []string {
+	return []string{
+		c.ID, c.Name, c.DerivedStatus,
+		strconv.FormatFloat(float64(c.NodeCount), 'f', -1, 64),
+		strconv.FormatFloat(float64(c.RunningNodeCount), 'f', -1, 64),
+		dc.ID, dc.Name, dc.Provider,
+		n.ID, n.Size, n.Rack, n.Status, n.PublicIP, n.PrivateIP,
+	}
+}
+
+// InventoryFields are the fields of every node of the inventory
+func InventoryFields() []string {
+	return append([]string(nil), inventoryHeader...)
+}
+
+// SnapshotInventory is the inventory of the nodes collected in s, one record
+// of InventoryFields per node
+func SnapshotInventory(s Snapshot) []map[string]string {
+	var records []map[string]string
+	for _, c := range s.Clusters {
+		for _, dc := range c.DataCentres {
+			for _, n := range dc.Nodes {
+				record := make(map[string]string, len(inventoryHeader))
+				for i, value := range inventoryRow(c.cluster, dc, n) {
+					record[inventoryHeader[i]] = value
+				}
+				records = append(records, record)
+			}
+		}
+	}
+	return records
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteInventory(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeInventory(fakeProvider{}, InventoryCSV, buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "clusterId,clusterName,clusterStatus,nodeCount,runningNodeCount,dataCentreId,dataCentre,provider,nodeId,size,rack,nodeStatus,publicAddress,privateAddress\n" +
+		"c1,cluster,RUNNING,1,1,dc1,,,n1,,r1,RUNNING,,\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", got, expected)
+	}
+}
+
+func TestWriteInventoryParquet(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := writeInventory(fakeProvider{}, InventoryParquet, buf); err != nil {
+		t.Fatal(err)
+	}
+	if b := buf.Bytes(); !bytes.HasPrefix(b, []byte("PAR1")) || !bytes.HasSuffix(b, []byte("PAR1")) {
+		t.Errorf("Got %q, want a Parquet file", b)
+	}
+	for _, column := range append(inventoryHeader, "c1", "n1") {
+		if !bytes.Contains(buf.Bytes(), []byte(column)) {
+			t.Errorf("%s missing from the Parquet inventory", column)
+		}
+	}
+	if err := writeInventory(fakeProvider{}, "json", new(bytes.Buffer)); err == nil {
+		t.Error("Inventory written in an unsupported format")
+	}
+}
+
+func TestSnapshotInventory(t *testing.T) {
+	s := Snapshot{Clusters: []*clusterSnapshot{{
+		cluster:     cluster{ID: "c1", Name: "cluster", DerivedStatus: "RUNNING", NodeCount: 2, RunningNodeCount: 2},
+		DataCentres: []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Rack: "r1"}, {ID: "n2", Rack: "r2"}}}},
+	}}}
+	records := SnapshotInventory(s)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if r := records[1]; r["clusterName"] != "cluster" || r["nodeCount"] != "2" || r["nodeId"] != "n2" || r["rack"] != "r2" {
+		t.Errorf("got %v", r)
+	}
+	if records := SnapshotInventory(Snapshot{}); records != nil {
+		t.Errorf("Empty snapshot inventory %v, want none", records)
+	}
+}
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// Kafka consumer group metric descriptors
+var (
+	kafkaConsumerGroupLag = prometheus.NewDesc(
+		prometheus.BuildFQName("kafka", "consumer_group", "lag"),
+		"Messages the consumer group is behind the end of the topic, across its partitions and clients.",
+		[]string{"clusterId", "consumerGroup", "topic"},
+		nil,
+	)
+	kafkaConsumerGroupConsumers = prometheus.NewDesc(
+		prometheus.BuildFQName("kafka", "consumer_group", "consumers"),
+		"Number of consumers of the consumer group consuming the topic.",
+		[]string{"clusterId", "consumerGroup", "topic"},
+		nil,
+	)
+)
+
+// consumerGroupMetrics are the Monitoring API metrics queried for every topic
+// of every consumer group, and their descriptors
+var consumerGroupMetrics = map[string]*prometheus.Desc{
+	"consumerLag":   kafkaConsumerGroupLag,
+	"consumerCount": kafkaConsumerGroupConsumers,
+}
+
+// consumerMetrics are the metrics of the consumption of a topic by a client
+// of a consumer group
+type consumerMetrics struct {
+	ClientID string `json:"clientID"`
+	metrics
+}
+
+// isKafka tells whether c is a Kafka cluster
+func isKafka(c cluster) bool {
+	p := productOf(c)
+	return p != nil && p.name == "kafka"
+}
+
+// consumerLagCollector exports the lag and consumers of the consumer groups
+// of a Kafka cluster, by topic. It takes a request per group and per topic of
+// every group on top of the listing of the groups, so a group or topic that
+// can't be queried is only logged and skipped.
+func (e *Exporter) consumerLagCollector(s *scrape, c cluster, ch chan<- prometheus.Metric) {
+	cp, ok := e.providerFor(s).(consumerGroupsProvider)
+	if !ok {
+		return
+	}
+	s.apiCall(monitoringAPI)
+	groups, err := cp.GetConsumerGroups(c.ID)
+	s.called("GetConsumerGroups", err)
+	if err != nil {
+		log.Errorf("Couldn't get the consumer groups of cluster %s: %v", c.ID, err)
+		return
+	}
+	names := make([]string, 0, len(consumerGroupMetrics))
+	for name := range consumerGroupMetrics {
+		names = append(names, name)
+	}
+	for _, group := range groups {
+		s.apiCall(monitoringAPI)
+		topics, err := cp.GetConsumerGroupTopics(c.ID, group)
+		s.called("GetConsumerGroups", err)
+		if err != nil {
+			log.Errorf("Couldn't get the topics of consumer group %s of cluster %s: %v", group, c.ID, err)
+			continue
+		}
+		for _, topic := range topics {
+			s.apiCall(monitoringAPI)
+			cms, err := cp.GetConsumerGroupMetrics(c.ID, group, topic, names)
+			s.called("GetConsumerGroups", err)
+			if err != nil {
+				log.Errorf("Couldn't get the metrics of consumer group %s of cluster %s for topic %s: %v", group, c.ID, topic, err)
+				continue
+			}
+			for desc, v := range sumConsumerMetrics(cms) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, c.ID, group, topic)
+			}
+		}
+	}
+}
+
+// sumConsumerMetrics sums the metrics of the clients of a consumer group, by
+// descriptor. Values that can't be parsed are left out.
+func sumConsumerMetrics(cms []consumerMetrics) map[*prometheus.Desc]float64 {
+	sums := map[*prometheus.Desc]float64{}
+	for _, cm := range cms {
+		for _, m := range cm.Metrics {
+			desc, ok := consumerGroupMetrics[m.Name]
+			if !ok || len(m.Values) == 0 {
+				continue
+			}
+			v, err := strconv.ParseFloat(string(m.Values[0].Value), 64)
+			if err != nil {
+				log.Debugf("Error parsing consumer metric %s of client %s: %v", m.Name, logValue(cm.ClientID), err)
+				continue
+			}
+			sums[desc] += v
+		}
+	}
+	return sums
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeConsumerGroupsProvider manages a Kafka cluster whose consumer groups
+// consume topics, the metrics of one of them failing
+type fakeConsumerGroupsProvider struct {
+	fakeProductProvider
+}
+
+func (fakeConsumerGroupsProvider) GetConsumerGroups(clusterID string) ([]string, error) {
+	return []string{"billing", "audit"}, nil
+}
+
+func (fakeConsumerGroupsProvider) GetConsumerGroupTopics(clusterID, group string) ([]string, error) {
+	if group == "audit" {
+		return []string{"invoices", "payments"}, nil
+	}
+	return []string{"invoices"}, nil
+}
+
+func (fakeConsumerGroupsProvider) GetConsumerGroupMetrics(clusterID, group, topic string, names []string) ([]consumerMetrics, error) {
+	if topic == "payments" {
+		return nil, errors.New("unavailable")
+	}
+	lag := "120"
+	if group == "audit" {
+		lag = "not a number"
+	}
+	return []consumerMetrics{
+		{ClientID: "c1", metrics: metrics{Metrics: []metric{
+			{Name: "consumerLag", Values: []metricValue{{Value: flexString(lag)}}},
+			{Name: "consumerCount", Values: []metricValue{{Value: "1"}}},
+		}}},
+		{ClientID: "c2", metrics: metrics{Metrics: []metric{
+			{Name: "consumerLag", Values: []metricValue{{Value: "30"}}},
+			{Name: "consumerCount", Values: []metricValue{{Value: "1"}}},
+		}}},
+	}, nil
+}
+
+func TestConsumerLagCollector(t *testing.T) {
+	prov := fakeConsumerGroupsProvider{fakeProductProvider{bundle: "KAFKA", metrics: productMetrics}}
+	for _, enabled := range []bool{true, false} {
+		e, err := newExporter(prov, ExporterOptions{KafkaConsumerLag: enabled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				key := mf.GetName()
+				for _, l := range m.GetLabel() {
+					key += " " + l.GetValue()
+				}
+				got[key] = m.GetGauge().GetValue()
+			}
+		}
+		expected := map[string]float64{
+			"kafka_consumer_group_lag p1 billing invoices":       150,
+			"kafka_consumer_group_consumers p1 billing invoices": 2,
+			// The unparsable value of a client is left out
+			"kafka_consumer_group_lag p1 audit invoices":       30,
+			"kafka_consumer_group_consumers p1 audit invoices": 2,
+		}
+		for key, value := range expected {
+			if v, ok := got[key]; ok != enabled || v != value && enabled {
+				t.Errorf("Enabled %v: %s: got %v (found %v) want %v", enabled, key, v, ok, value)
+			}
+		}
+		if _, ok := got["kafka_consumer_group_lag p1 audit payments"]; ok {
+			t.Error("Lag of a topic whose metrics failed exported")
+		}
+		if up, ok := got["instaclustr_exporter_api_up GetConsumerGroups"]; ok != enabled || up != 0 && enabled {
+			t.Errorf("Enabled %v: got consumer groups up %v (found %v), want 0 on the failed topic", enabled, up, ok)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// extraLabels maps clusterIds and nodeIds to operator defined labels attached
+// to the info metrics, e.g. service names or cost centers. Node info metrics
+// get their cluster labels too, node labels taking precedence.
+type extraLabels struct {
+	Clusters map[string]map[string]string `yaml:"clusters"`
+	Nodes    map[string]map[string]string `yaml:"nodes"`
+
+	clusterLabelNames []string
+	nodeLabelNames    []string
+}
+
+// loadExtraLabels reads the extra labels mapping from a YAML file. An empty
+// path returns an empty mapping.
+func loadExtraLabels(path string) (*extraLabels, error) {
+	l := &extraLabels{}
+	if path == "" {
+		return l, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", path, err)
+	}
+	// Cluster labels are attached to the node info metrics too, so they
+	// can't be named after a node info label either, nor after the account
+	// label of the accounts with an alias or the origin label of federations
+	reserved := []string{accountLabel, originLabel}
+	if l.clusterLabelNames, err = labelNames(l.Clusters, mergeLabelNames(reserved, mergeLabelNames(clusterInfoLabels, nodeInfoLabels))); err != nil {
+		return nil, err
+	}
+	if l.nodeLabelNames, err = labelNames(l.Nodes, mergeLabelNames(reserved, nodeInfoLabels)); err != nil {
+		return nil, err
+	}
+	l.nodeLabelNames = mergeLabelNames(l.nodeLabelNames, l.clusterLabelNames)
+	return l, nil
+}
+
+// labelNames returns the sorted set of label names used across mapping,
+// checking they are valid and don't clash with reserved names
+func labelNames(mapping map[string]map[string]string, reserved []string) ([]string, error) {
+	set := map[string]bool{}
+	for id, labels := range mapping {
+		for name := range labels {
+			if !labelNameRE.MatchString(name) {
+				return nil, fmt.Errorf("invalid label name %q for %s", name, id)
+			}
+			for _, r := range reserved {
+				if name == r {
+					return nil, fmt.Errorf("label name %q for %s clashes with an exported label", name, id)
+				}
+			}
+			set[name] = true
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func mergeLabelNames(a, b []string) []string {
+	set := map[string]bool{}
+	for _, name := range append(a, b...) {
+		set[name] = true
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// clusterValues returns the extra label values for a cluster, in clusterLabelNames order
+func (l *extraLabels) clusterValues(clusterID string) []string {
+	values := make([]string, len(l.clusterLabelNames))
+	for i, name := range l.clusterLabelNames {
+		values[i] = l.Clusters[clusterID][name]
+	}
+	return values
+}
+
+// nodeValues returns the extra label values for a node, in nodeLabelNames order
+func (l *extraLabels) nodeValues(clusterID, nodeID string) []string {
+	values := make([]string, len(l.nodeLabelNames))
+	for i, name := range l.nodeLabelNames {
+		if v, ok := l.Nodes[nodeID][name]; ok {
+			values[i] = v
+		} else {
+			values[i] = l.Clusters[clusterID][name]
+		}
+	}
+	return values
+}
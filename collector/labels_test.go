@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "instaclustr_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestLoadExtraLabels(t *testing.T) {
+	path := writeTempFile(t, `
+clusters:
+  cluster-uuid-1:
+    service: payments
+    cost_center: cc-01
+nodes:
+  node-uuid-1:
+    service: payments-ledger
+    host_group: hg-a
+`)
+	defer os.Remove(path)
+
+	l, err := loadExtraLabels(path)
+	if err != nil {
+		t.Fatalf("loadExtraLabels returned unexpected error: %v", err)
+	}
+	if expected := []string{"cost_center", "service"}; !reflect.DeepEqual(l.clusterLabelNames, expected) {
+		t.Errorf("Unexpected cluster label names: got %v want %v", l.clusterLabelNames, expected)
+	}
+	if expected := []string{"cost_center", "host_group", "service"}; !reflect.DeepEqual(l.nodeLabelNames, expected) {
+		t.Errorf("Unexpected node label names: got %v want %v", l.nodeLabelNames, expected)
+	}
+	if got, expected := l.nodeValues("cluster-uuid-1", "node-uuid-1"), []string{"cc-01", "hg-a", "payments-ledger"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected node label values: got %v want %v", got, expected)
+	}
+	if got, expected := l.nodeValues("cluster-uuid-2", "node-uuid-2"), []string{"", "", ""}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected node label values for unmapped node: got %v want %v", got, expected)
+	}
+}
+
+func TestLoadExtraLabelsInvalid(t *testing.T) {
+	cases := []string{
+		"clusters:\n  cluster-uuid-1:\n    clusterName: foo\n",
+		"clusters:\n  cluster-uuid-1:\n    rack: foo\n",
+		"nodes:\n  node-uuid-1:\n    region: emea\n",
+		"nodes:\n  node-uuid-1:\n    account: production\n",
+		"clusters:\n  cluster-uuid-1:\n    origin: eu\n",
+		"nodes:\n  node-uuid-1:\n    not-valid: foo\n",
+		"nodes: [",
+	}
+	for _, c := range cases {
+		path := writeTempFile(t, c)
+		if _, err := loadExtraLabels(path); err == nil {
+			t.Errorf("loadExtraLabels should fail for:\n%s", c)
+		}
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func newSanitizedLabels() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "instaclustr_exporter",
+		Name:      "sanitized_label_values_total",
+		Help:      "Number of label values exported with their invalid UTF-8 replaced, control characters stripped or truncated to the max label length, by label.",
+	}, []string{"label"})
+}
+
+// hashSuffixLength is the length of the hash suffix of truncated label
+// values: a separator and 8 hexadecimal digits
+const hashSuffixLength = 9
+
+// sanitizeLabelValue returns v with its invalid UTF-8 replaced by U+FFFD, its
+// control characters stripped and truncated to max characters, unless max is
+// 0, telling whether it changed. Values truncated to more than
+// hashSuffixLength characters end with a hash of v, so values sharing their
+// first characters don't collide.
+func sanitizeLabelValue(v string, max int) (string, bool) {
+	clean := utf8.ValidString(v) && (max <= 0 || utf8.RuneCountInString(v) <= max)
+	for _, r := range v {
+		clean = clean && !unicode.IsControl(r)
+	}
+	if clean {
+		return v, false
+	}
+	var b bytes.Buffer
+	for _, r := range v {
+		if !unicode.IsControl(r) {
+			b.WriteRune(r)
+		}
+	}
+	runes := []rune(b.String())
+	if max <= 0 || len(runes) <= max {
+		return string(runes), true
+	}
+	if max <= hashSuffixLength {
+		return string(runes[:max]), true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(v))
+	return fmt.Sprintf("%s~%08x", string(runes[:max-hashSuffixLength]), h.Sum32()), true
+}
+
+// logValue sanitizes a value of the API for the logs, see sanitizeLabelValue,
+// so it can't forge log lines
+func logValue(v string) string {
+	v, _ = sanitizeLabelValue(v, 0)
+	return v
+}
+
+// sanitizedMetric is a metric whose label values are sanitized when written
+type sanitizedMetric struct {
+	prometheus.Metric
+	max int
+}
+
+func (m sanitizedMetric) Write(pb *dto.Metric) error {
+	if err := m.Metric.Write(pb); err != nil {
+		return err
+	}
+	sanitizeLabels(pb, m.max)
+	return nil
+}
+
+// sanitizeLabels sanitizes the label values of pb, returning the names of
+// the labels whose value changed
+func sanitizeLabels(pb *dto.Metric, max int) []string {
+	var changed []string
+	for _, l := range pb.Label {
+		if v, ok := sanitizeLabelValue(l.GetValue(), max); ok {
+			l.Value = proto.String(v)
+			changed = append(changed, l.GetName())
+		}
+	}
+	return changed
+}
+
+// labelSanitizer sanitizes the label values of the metrics sent to the
+// returned channel, see sanitizeLabelValue, before passing them to ch. The
+// sanitized values are counted once per collection, not whenever the metrics
+// are written. done must be called once every metric is sent.
+func (e *Exporter) labelSanitizer(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	finished := make(chan struct{})
+	go func() {
+		for m := range in {
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				ch <- m
+				continue
+			}
+			changed := sanitizeLabels(pb, e.maxLabelLength)
+			if len(changed) == 0 {
+				ch <- m
+				continue
+			}
+			for _, name := range changed {
+				e.sanitizedLabels.WithLabelValues(name).Inc()
+			}
+			ch <- sanitizedMetric{m, e.maxLabelLength}
+		}
+		close(finished)
+	}()
+	return in, func() {
+		close(in)
+		<-finished
+	}
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSanitizeLabelValue(t *testing.T) {
+	cases := []struct {
+		value    string
+		max      int
+		expected string
+		changed  bool
+	}{
+		{"MOCKED_CLUSTER_01", 0, "MOCKED_CLUSTER_01", false},
+		{"café", 4, "café", false},
+		{"bad\xffname", 0, "bad�name", true},
+		{"two\nlines\x00", 0, "twolines", true},
+		{"production-cluster", 12, "pro~f6186dfd", true},
+		{"production-cluster", 9, "productio", true},
+		{"ça\tva", 3, "çav", true},
+	}
+	for _, c := range cases {
+		got, changed := sanitizeLabelValue(c.value, c.max)
+		if got != c.expected || changed != c.changed {
+			t.Errorf("sanitizeLabelValue(%q, %d) = %q, %v, want %q, %v", c.value, c.max, got, changed, c.expected, c.changed)
+		}
+	}
+	a, _ := sanitizeLabelValue("payments-eu-west-1-primary", 16)
+	b, _ := sanitizeLabelValue("payments-eu-west-1-replica", 16)
+	if a == b {
+		t.Errorf("Values sharing their first characters truncated to the same %q", a)
+	}
+}
+
+// dirtyNamesProvider names its cluster with invalid UTF-8 and a newline
+type dirtyNamesProvider struct {
+	fakeProvider
+}
+
+func (dirtyNamesProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "c1", Name: "pay\xffments\n", DerivedStatus: "RUNNING"}}, nil
+}
+
+func TestLabelSanitizer(t *testing.T) {
+	e, err := newExporter(dirtyNamesProvider{}, ExporterOptions{MaxLabelLength: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "clusterName" && l.GetValue() != "pay�ments" {
+					t.Errorf("%s clusterName %q not sanitized", mf.GetName(), l.GetValue())
+				}
+			}
+		}
+	}
+	// cassandra_cluster_info and cassandra_node_info at least
+	m := &dto.Metric{}
+	if err := e.sanitizedLabels.WithLabelValues("clusterName").Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got < 2 {
+		t.Errorf("Counted %v sanitized clusterName values, want 2 or more", got)
+	}
+}
+
+func TestLabelSanitizerCountsOnce(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 1)
+	in, done := e.labelSanitizer(ch)
+	in <- prometheus.MustNewConstMetric(clusterNodesDelta, prometheus.GaugeValue, 1, "bad\xffname", "a:b")
+	done()
+	sanitized := <-ch
+	// Every gatherer writes the metric again, e.g. /docs/metrics
+	for i := 0; i < 3; i++ {
+		pb := &dto.Metric{}
+		if err := sanitized.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		if v := pb.GetLabel()[0].GetValue(); v != "bad\ufffdname" {
+			t.Errorf("clusterName %q not sanitized", v)
+		}
+	}
+	m := &dto.Metric{}
+	if err := e.sanitizedLabels.WithLabelValues("clusterName").Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Counted %v sanitized clusterName values, want 1", got)
+	}
+}
@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// latencyDescs are the node latency metrics, in seconds
+var latencyDescs = map[*prometheus.Desc]bool{
+	nodeClientRequestReadLatency:       true,
+	nodeClientRequestWriteLatency:      true,
+	nodeClientRequestReadPercentile:    true,
+	nodeClientRequestWritePercentile:   true,
+	nodeClientRequestReadPercentile99:  true,
+	nodeClientRequestWritePercentile99: true,
+}
+
+var latencyCoverageRatio = prometheus.NewDesc(
+	"instaclustr_exporter_latency_coverage_ratio",
+	"Fraction of the nodes reporting latency whose latency metrics were exported by the last scrape, the others didn't exceed the latency threshold.",
+	nil,
+	nil,
+)
+
+// latencyGate holds back the latency metrics of a node sent to the returned
+// channel, the others are forwarded to ch as they are. The returned function
+// closes the channel and forwards the latency metrics only if any of them is
+// at least threshold seconds, telling whether the node reported latency and
+// whether it was exported.
+func latencyGate(threshold float64, ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func() (bool, bool)) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var held []prometheus.Metric
+	anomaly := false
+	go func() {
+		for m := range in {
+			if !latencyDescs[m.Desc()] {
+				ch <- m
+				continue
+			}
+			held = append(held, m)
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err == nil && pb.GetGauge().GetValue() >= threshold {
+				anomaly = true
+			}
+		}
+		close(done)
+	}()
+	return in, func() (bool, bool) {
+		close(in)
+		<-done
+		if anomaly {
+			for _, m := range held {
+				ch <- m
+			}
+		}
+		return len(held) > 0, anomaly
+	}
+}
+
+// latencyCoverage counts the nodes reporting latency, and the ones exported,
+// across a scrape
+type latencyCoverage struct {
+	nodes    int64
+	exported int64
+}
+
+func (lc *latencyCoverage) add(reported, exported bool) {
+	if reported {
+		atomic.AddInt64(&lc.nodes, 1)
+	}
+	if exported {
+		atomic.AddInt64(&lc.exported, 1)
+	}
+}
+
+func (lc *latencyCoverage) collect(ch chan<- prometheus.Metric) {
+	ratio := 1.0
+	if nodes := atomic.LoadInt64(&lc.nodes); nodes > 0 {
+		ratio = float64(atomic.LoadInt64(&lc.exported)) / float64(nodes)
+	}
+	ch <- prometheus.MustNewConstMetric(latencyCoverageRatio, prometheus.GaugeValue, ratio)
+}
@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLatencyGate(t *testing.T) {
+	latency := func(v float64) prometheus.Metric {
+		return prometheus.MustNewConstMetric(nodeClientRequestReadPercentile99, prometheus.GaugeValue, v, "n1")
+	}
+	cpu := prometheus.MustNewConstMetric(nodeCPUUtilizationPercentage, prometheus.GaugeValue, 42, "n1")
+	cases := []struct {
+		name     string
+		metrics  []prometheus.Metric
+		reported bool
+		exported bool
+		sent     int
+	}{
+		{"below threshold", []prometheus.Metric{cpu, latency(0.01), latency(0.02)}, true, false, 1},
+		{"above threshold", []prometheus.Metric{cpu, latency(0.01), latency(0.2)}, true, true, 3},
+		{"no latency", []prometheus.Metric{cpu}, false, false, 1},
+	}
+	for _, c := range cases {
+		ch := make(chan prometheus.Metric, len(c.metrics))
+		gated, flush := latencyGate(0.1, ch)
+		for _, m := range c.metrics {
+			gated <- m
+		}
+		reported, exported := flush()
+		if reported != c.reported || exported != c.exported || len(ch) != c.sent {
+			t.Errorf("%s: got reported %v, exported %v, %d metrics sent want %v, %v, %d",
+				c.name, reported, exported, len(ch), c.reported, c.exported, c.sent)
+		}
+	}
+}
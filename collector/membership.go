@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// NodeChange is a node added to or removed from a cluster between two
+// collections, e.g. when Instaclustr replaces a node
+type NodeChange struct {
+	// Change is "added" or "removed"
+	Change         string `json:"change"`
+	ClusterID      string `json:"clusterId"`
+	ClusterName    string `json:"clusterName"`
+	DataCentreID   string `json:"dcId"`
+	DataCentreName string `json:"dcName"`
+	NodeID         string `json:"nodeId"`
+	PublicIP       string `json:"publicIp"`
+	PrivateIP      string `json:"privateIp"`
+}
+
+// MembershipTracker remembers the nodes of every cluster seen. The first
+// nodes of a cluster are no changes, and a cluster whose topology couldn't
+// be fetched, or missing from a collection, keeps its nodes. It outlives the
+// exporters replaced on reload, so no change is missed meanwhile.
+type MembershipTracker struct {
+	mu       sync.Mutex
+	clusters map[string]map[string]NodeChange
+	// seen is the time of the snapshot the nodes of every cluster are from
+	seen map[string]time.Time
+}
+
+// NewMembershipTracker creates a MembershipTracker
+func NewMembershipTracker() *MembershipTracker {
+	return &MembershipTracker{clusters: make(map[string]map[string]NodeChange), seen: make(map[string]time.Time)}
+}
+
+// Diff returns the nodes added and removed since the previous snapshot, the
+// removed ones by node id. Clusters are skipped in snapshots older than the
+// one their nodes are from, e.g. handled out of order.
+func (mt *MembershipTracker) Diff(s Snapshot) []NodeChange {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	var changes []NodeChange
+	for _, c := range s.Clusters {
+		if c.DataCentres == nil || s.Time.Before(mt.seen[c.ID]) {
+			continue
+		}
+		mt.seen[c.ID] = s.Time
+		nodes := make(map[string]NodeChange)
+		for _, dc := range c.DataCentres {
+			for _, n := range dc.Nodes {
+				nodes[n.ID] = NodeChange{
+					ClusterID:      c.ID,
+					ClusterName:    c.Name,
+					DataCentreID:   dc.ID,
+					DataCentreName: dc.Name,
+					NodeID:         n.ID,
+					PublicIP:       n.PublicIP,
+					PrivateIP:      n.PrivateIP,
+				}
+			}
+		}
+		previous, ok := mt.clusters[c.ID]
+		mt.clusters[c.ID] = nodes
+		if !ok {
+			continue
+		}
+		for _, dc := range c.DataCentres {
+			for _, n := range dc.Nodes {
+				if _, ok := previous[n.ID]; !ok {
+					added := nodes[n.ID]
+					added.Change = "added"
+					changes = append(changes, added)
+				}
+			}
+		}
+		var removed []string
+		for id := range previous {
+			if _, ok := nodes[id]; !ok {
+				removed = append(removed, id)
+			}
+		}
+		sort.Strings(removed)
+		for _, id := range removed {
+			r := previous[id]
+			r.Change = "removed"
+			changes = append(changes, r)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func membershipSnapshot(nodes ...node) Snapshot {
+	return Snapshot{Clusters: []*clusterSnapshot{{
+		cluster:     cluster{ID: "c1", Name: "cluster"},
+		DataCentres: []datacentre{{ID: "dc1", Name: "EU_WEST_1", Nodes: nodes}},
+	}}}
+}
+
+func TestMembershipTracker(t *testing.T) {
+	n1 := node{ID: "n1", PublicIP: "1.1.1.1", PrivateIP: "10.0.0.1"}
+	n2 := node{ID: "n2", PublicIP: "2.2.2.2", PrivateIP: "10.0.0.2"}
+	n3 := node{ID: "n3", PublicIP: "3.3.3.3", PrivateIP: "10.0.0.3"}
+	mt := NewMembershipTracker()
+	if got := mt.Diff(membershipSnapshot(n1, n2)); len(got) != 0 {
+		t.Errorf("First nodes are not changes, got %v", got)
+	}
+	// Neither a collection missing the cluster nor one missing its topology
+	// removes its nodes
+	if got := mt.Diff(Snapshot{}); len(got) != 0 {
+		t.Errorf("Missing clusters are not changes, got %v", got)
+	}
+	if got := mt.Diff(Snapshot{Clusters: []*clusterSnapshot{{cluster: cluster{ID: "c1"}}}}); len(got) != 0 {
+		t.Errorf("Clusters without topology are not changes, got %v", got)
+	}
+
+	// n2 replaced by n3
+	expected := []NodeChange{
+		{Change: "added", ClusterID: "c1", ClusterName: "cluster", DataCentreID: "dc1", DataCentreName: "EU_WEST_1", NodeID: "n3", PublicIP: "3.3.3.3", PrivateIP: "10.0.0.3"},
+		{Change: "removed", ClusterID: "c1", ClusterName: "cluster", DataCentreID: "dc1", DataCentreName: "EU_WEST_1", NodeID: "n2", PublicIP: "2.2.2.2", PrivateIP: "10.0.0.2"},
+	}
+	if got := mt.Diff(membershipSnapshot(n1, n3)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+	if got := mt.Diff(membershipSnapshot(n3, n1)); len(got) != 0 {
+		t.Errorf("Unchanged nodes are not changes, got %v", got)
+	}
+}
+
+func TestMembershipTrackerOutOfOrder(t *testing.T) {
+	n1, n2 := node{ID: "n1"}, node{ID: "n2"}
+	t0 := time.Unix(1500000000, 0)
+	older, newer := membershipSnapshot(n1), membershipSnapshot(n1, n2)
+	older.Time, newer.Time = t0, t0.Add(time.Minute)
+	mt := NewMembershipTracker()
+	mt.Diff(membershipSnapshot(n1))
+	if got := mt.Diff(newer); len(got) != 1 || got[0].NodeID != "n2" {
+		t.Errorf("Got %v, want n2 added", got)
+	}
+	if got := mt.Diff(older); len(got) != 0 {
+		t.Errorf("Older snapshot handled late got %v, want no change", got)
+	}
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// How often the heap and goroutines are sampled during a collection
+const memorySampleInterval = 250 * time.Millisecond
+
+var (
+	scrapePeakHeapBytes = prometheus.NewDesc(
+		"instaclustr_exporter_scrape_peak_heap_bytes",
+		"Peak heap in use sampled during the last collection.",
+		nil,
+		nil,
+	)
+	scrapePeakGoroutines = prometheus.NewDesc(
+		"instaclustr_exporter_scrape_peak_goroutines",
+		"Peak number of goroutines sampled during the last collection.",
+		nil,
+		nil,
+	)
+	memoryLimitExceeded = prometheus.NewDesc(
+		"instaclustr_exporter_memory_limit_exceeded",
+		"Whether the last collection peaked over collector.memory-limit, node metrics are aggregated per cluster until one peaks under it.",
+		nil,
+		nil,
+	)
+)
+
+// memoryWatermarks are the peaks sampled during a collection
+type memoryWatermarks struct {
+	heap       uint64
+	goroutines int
+}
+
+func (w *memoryWatermarks) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapInuse > w.heap {
+		w.heap = stats.HeapInuse
+	}
+	if n := runtime.NumGoroutine(); n > w.goroutines {
+		w.goroutines = n
+	}
+}
+
+// sampleMemory samples the heap and goroutines until the returned function
+// is called, which returns their peaks
+func sampleMemory() func() memoryWatermarks {
+	stop := make(chan struct{})
+	done := make(chan memoryWatermarks)
+	go func() {
+		w := memoryWatermarks{}
+		w.sample()
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.sample()
+			case <-stop:
+				w.sample()
+				done <- w
+				return
+			}
+		}
+	}()
+	return func() memoryWatermarks {
+		close(stop)
+		return <-done
+	}
+}
+
+// checkMemory logs the watermarks of a collection. Once the heap peaks over
+// the soft memory limit, node metrics are aggregated per cluster from the
+// next collection on, until a collection peaks under the limit again.
+func (e *Exporter) checkMemory(w memoryWatermarks) {
+	log.Debugf("Collection peaked at %d heap bytes and %d goroutines", w.heap, w.goroutines)
+	e.mu.Lock()
+	e.watermarks = w
+	e.mu.Unlock()
+	if e.memoryLimit == 0 {
+		return
+	}
+	if w.heap <= e.memoryLimit {
+		if atomic.CompareAndSwapUint32(&e.overMemoryLimit, 1, 0) {
+			log.Infof("Collection peaked at %d heap bytes, under the %d bytes memory limit: exporting node metrics per node again",
+				w.heap, e.memoryLimit)
+		}
+		return
+	}
+	if atomic.CompareAndSwapUint32(&e.overMemoryLimit, 0, 1) {
+		log.Warnf("Collection peaked at %d heap bytes and %d goroutines, over the %d bytes memory limit: aggregating node metrics per cluster until a collection peaks under it",
+			w.heap, w.goroutines, e.memoryLimit)
+	}
+}
+
+// collectMemory exports the watermarks of the last collection
+func (e *Exporter) collectMemory(ch chan<- prometheus.Metric) {
+	e.mu.Lock()
+	w := e.watermarks
+	e.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(scrapePeakHeapBytes, prometheus.GaugeValue, float64(w.heap))
+	ch <- prometheus.MustNewConstMetric(scrapePeakGoroutines, prometheus.GaugeValue, float64(w.goroutines))
+	if e.memoryLimit > 0 {
+		ch <- prometheus.MustNewConstMetric(memoryLimitExceeded, prometheus.GaugeValue, float64(atomic.LoadUint32(&e.overMemoryLimit)))
+	}
+}
+
+// aggregating tells whether node metrics are aggregated per cluster, as
+// configured or because of the memory limit
+func (e *Exporter) aggregating() bool {
+	return e.aggregateNodes || atomic.LoadUint32(&e.overMemoryLimit) == 1
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{MemoryLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	gather := func() map[string]float64 {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				got[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+		return got
+	}
+
+	first := gather()
+	if first["instaclustr_exporter_scrape_peak_heap_bytes"] <= 1 || first["instaclustr_exporter_scrape_peak_goroutines"] < 1 {
+		t.Errorf("Got peaks of %v heap bytes and %v goroutines", first["instaclustr_exporter_scrape_peak_heap_bytes"], first["instaclustr_exporter_scrape_peak_goroutines"])
+	}
+	if _, ok := first["cassandra_node_cpu_utilization_percentage"]; !ok {
+		t.Errorf("First collection aggregated")
+	}
+	if first["instaclustr_exporter_memory_limit_exceeded"] != 1 {
+		t.Errorf("Memory limit not exceeded")
+	}
+
+	second := gather()
+	if _, ok := second["cassandra_node_cpu_utilization_percentage"]; ok {
+		t.Errorf("Node metrics exported over the memory limit")
+	}
+	if _, ok := second["cassandra_cluster_cpu_utilization_percentage"]; !ok {
+		t.Errorf("Node metrics not aggregated over the memory limit")
+	}
+
+	// Back under the limit, the next collection exports node metrics again
+	e.memoryLimit = 1 << 62
+	if third := gather(); third["instaclustr_exporter_memory_limit_exceeded"] != 0 {
+		t.Errorf("Memory limit still exceeded under it")
+	}
+	fourth := gather()
+	if _, ok := fourth["cassandra_node_cpu_utilization_percentage"]; !ok {
+		t.Errorf("Node metrics still aggregated under the memory limit")
+	}
+}
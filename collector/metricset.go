@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+)
+
+// tablePatternsKind lists the table metrics queried for the tables that
+// patterns with a * match, until a collection discovered them
+const tablePatternsKind = "table_patterns"
+
+// querySet are the kinds of clusters and the tables whose metrics a
+// collection queried
+type querySet struct {
+	mu     sync.Mutex
+	kinds  map[string]bool
+	tables map[table]bool
+}
+
+func newQuerySet() *querySet {
+	return &querySet{kinds: map[string]bool{}, tables: map[table]bool{}}
+}
+
+// add records the queries of the nodes of c, the metrics of tables included
+func (q *querySet) add(c cluster, tables []table) {
+	kind := "cassandra"
+	if p := productOf(c); p != nil {
+		kind = p.name
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.kinds[kind] = true
+	for _, t := range tables {
+		q.tables[t] = true
+	}
+}
+
+// MetricQueries returns the Monitoring API metrics the exporter queries for
+// every node, by kind of cluster (cassandra and the products collected, e.g.
+// kafka), along with the table metrics queried for the tables of
+// ExporterOptions.TableMetrics, e.g. cf::shop::orders::readLatency. Once the
+// whole account has been collected, only the kinds of its clusters and the
+// tables discovered are listed. Until then, every kind is, and the table
+// patterns with a * are listed as such under table_patterns. There are none
+// when node metrics aren't collected.
+func (e *Exporter) MetricQueries() map[string][]string {
+	queries := map[string][]string{}
+	if len(e.nodeMetrics) == 0 {
+		return queries
+	}
+	e.mu.Lock()
+	queried := e.queried
+	e.mu.Unlock()
+	if queried != nil {
+		queried.mu.Lock()
+		defer queried.mu.Unlock()
+	}
+
+	if queried == nil || queried.kinds["cassandra"] {
+		queries["cassandra"] = prefixed("n::", e.nodeMetrics)
+	}
+	for _, p := range e.products {
+		if queried == nil || queried.kinds[p.name] {
+			queries[p.name] = prefixed(p.prefix, p.metrics)
+		}
+	}
+	if _, ok := e.provider.(tablesProvider); !ok || e.tables == nil {
+		return queries
+	}
+	var tables, patterns []table
+	if queried != nil {
+		for t := range queried.tables {
+			tables = append(tables, t)
+		}
+		sort.Slice(tables, func(i, j int) bool {
+			if tables[i].Keyspace != tables[j].Keyspace {
+				return tables[i].Keyspace < tables[j].Keyspace
+			}
+			return tables[i].Table < tables[j].Table
+		})
+	} else {
+		for _, t := range e.tables.patterns {
+			if t.Keyspace == "*" || t.Table == "*" {
+				patterns = append(patterns, t)
+			} else {
+				tables = append(tables, t)
+			}
+		}
+	}
+	if len(tables) > 0 {
+		queries["table"] = tableQueries(tables)
+	}
+	if len(patterns) > 0 {
+		queries[tablePatternsKind] = tableQueries(patterns)
+	}
+	return queries
+}
+
+// MetricQueries returns the Monitoring API metrics read from the snapshot of
+// every origin, by origin/kind, e.g. eu/cassandra. The origins query them
+// along with the ones of their own configuration.
+func (f *Federation) MetricQueries() map[string][]string {
+	queries := map[string][]string{}
+	for i, exp := range f.exporters {
+		for kind, q := range exp.MetricQueries() {
+			queries[f.origins[i]+"/"+kind] = q
+		}
+	}
+	return queries
+}
+
+// tableQueries returns the table metric queries of tables
+func tableQueries(tables []table) []string {
+	var queries []string
+	for _, t := range tables {
+		queries = append(queries, prefixed("cf::"+t.Keyspace+"::"+t.Table+"::", tableMetrics)...)
+	}
+	return queries
+}
+
+// prefixed returns names, each prefixed with prefix
+func prefixed(prefix string, names []string) []string {
+	query := make([]string, len(names))
+	for i, name := range names {
+		query[i] = prefix + name
+	}
+	return query
+}
@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricQueries(t *testing.T) {
+	var queried []table
+	e, err := newExporter(fakeTablesProvider{queried: &queried}, ExporterOptions{NodeMetrics: []string{"cpuUtilization"}, TableMetrics: []string{"audit.logins", "shop.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := e.MetricQueries()
+	if expected := []string{"n::cpuUtilization"}; !reflect.DeepEqual(queries["cassandra"], expected) {
+		t.Errorf("Cassandra queries %v, want %v", queries["cassandra"], expected)
+	}
+	if len(queries["table"]) != len(tableMetrics) || queries["table"][0] != "cf::audit::logins::readLatency" {
+		t.Errorf("Unexpected table queries before the first collection %v", queries["table"])
+	}
+	if len(queries[tablePatternsKind]) != len(tableMetrics) || queries[tablePatternsKind][0] != "cf::shop::*::readLatency" {
+		t.Errorf("Unexpected table patterns %v", queries[tablePatternsKind])
+	}
+
+	// Once collected, the discovered tables are listed instead of the patterns
+	if err := gather(e); err != nil {
+		t.Fatal(err)
+	}
+	queries = e.MetricQueries()
+	if len(queries["table"]) != 3*len(tableMetrics) || queries["table"][len(tableMetrics)] != "cf::shop::carts::readLatency" {
+		t.Errorf("Unexpected table queries %v", queries["table"])
+	}
+	if _, ok := queries[tablePatternsKind]; ok {
+		t.Errorf("Table patterns listed once the tables were discovered: %v", queries[tablePatternsKind])
+	}
+
+	// Only the products of the account are listed once it's collected, the
+	// opt-in ones never when they're not enabled
+	e, err = newExporter(fakeProductProvider{bundle: "KAFKA", metrics: productMetrics}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries = e.MetricQueries()
+	for _, kind := range []string{"cassandra", "kafka", "redis", "postgresql"} {
+		if _, ok := queries[kind]; !ok {
+			t.Errorf("%s queries not listed before the first collection", kind)
+		}
+	}
+	if _, ok := queries["cadence"]; ok {
+		t.Error("Cadence queries listed without collector.cadence-metrics")
+	}
+	if err := gather(e); err != nil {
+		t.Fatal(err)
+	}
+	queries = e.MetricQueries()
+	if len(queries) != 1 || len(queries["kafka"]) == 0 {
+		t.Errorf("Queries of an account of a Kafka cluster: %v", queries)
+	}
+
+	e, err = newExporter(fakeProvider{}, ExporterOptions{DisableNodeMetrics: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries := e.MetricQueries(); len(queries) != 0 {
+		t.Errorf("Queries without node metrics: %v", queries)
+	}
+}
+
+// gather collects c through a pedantic registry
+func gather(c prometheus.Collector) error {
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(c); err != nil {
+		return err
+	}
+	_, err := r.Gather()
+	return err
+}
@@ -0,0 +1,32 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var nodeMonitoringMissing = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "node", "monitoring_missing"),
+	"Whether the node, listed by the Provisioning API, has no data in the Monitoring API: not found or without any value, e.g. its agent isn't registered yet. Not exported while its metrics couldn't be fetched.",
+	[]string{"nodeId"},
+	nil,
+)
+
+// monitoringMissing tells whether ms, the metrics fetched for a node, have
+// no value at all
+func monitoringMissing(ms []metrics) bool {
+	for _, mc := range ms {
+		for _, m := range mc.Metrics {
+			if len(m.Values) > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collectMonitoringMissing exports whether the Monitoring API has data for n
+func collectMonitoringMissing(n node, missing bool, ch chan<- prometheus.Metric) {
+	v := 0.0
+	if missing {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(nodeMonitoringMissing, prometheus.GaugeValue, v, n.ID)
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeMissingProvider answers the node metrics requests with metrics and err
+type fakeMissingProvider struct {
+	fakeProvider
+	metrics []metrics
+	err     error
+}
+
+func (p fakeMissingProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return p.metrics, p.err
+}
+
+func TestNodeMonitoringMissing(t *testing.T) {
+	cases := []struct {
+		name     string
+		provider fakeMissingProvider
+		// expected is -1 when not exported
+		expected float64
+	}{
+		{"with data", fakeMissingProvider{metrics: []metrics{{Metrics: []metric{{Name: "cpuUtilization", Values: []metricValue{{Value: "42"}}}}}}}, 0},
+		{"not found", fakeMissingProvider{err: errNodeNotFound}, 1},
+		{"no metric", fakeMissingProvider{metrics: []metrics{{}}}, 1},
+		{"no value", fakeMissingProvider{metrics: []metrics{{Metrics: []metric{{Name: "cpuUtilization"}}}}}, 1},
+		{"failing", fakeMissingProvider{err: errors.New("connection reset")}, -1},
+	}
+	for _, c := range cases {
+		e, err := newExporter(c.provider, ExporterOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := -1.0
+		for _, mf := range mfs {
+			if mf.GetName() == "cassandra_node_monitoring_missing" {
+				got = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		if got != c.expected {
+			t.Errorf("%s: got %v want %v", c.name, got, c.expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Namespace of the topology metrics, shared by every bundle
+const topologyNamespace = "instaclustr"
+
+// Topology metric descriptors of the product neutral namespace
+var (
+	instaclustrClusterRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "cluster", "running"),
+		"Whether or not the cluster is running.",
+		[]string{"clusterId"},
+		nil,
+	)
+	instaclustrClusterNodes = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "cluster", "nodes"),
+		"Number of nodes the cluster is composed",
+		[]string{"clusterId"},
+		nil,
+	)
+	instaclustrClusterNodesRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "cluster", "nodes_running"),
+		"Number of nodes running in the cluster",
+		[]string{"clusterId"},
+		nil,
+	)
+	instaclustrClusterNodesRunningRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "cluster", "nodes_running_ratio"),
+		"Ratio of the nodes of the cluster running, from 0 to 1. Not exported for clusters without nodes.",
+		[]string{"clusterId"},
+		nil,
+	)
+	instaclustrNodeRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(topologyNamespace, "node", "running"),
+		"Whether or not a single node is running",
+		[]string{"nodeId"},
+		nil,
+	)
+)
+
+// topologyMetrics are the descriptors of the cluster and node info and
+// health metrics under a namespace. Whatever their bundle, clusters and
+// nodes get them under the instaclustr_ namespace, their product metrics
+// being under its own, and under the cassandra_ one they were first
+// exported with when ExporterOptions.LegacyTopologyNames is set.
+type topologyMetrics struct {
+	clusterInfo              *prometheus.Desc
+	clusterRunning           *prometheus.Desc
+	clusterNodes             *prometheus.Desc
+	clusterNodesRunning      *prometheus.Desc
+	clusterNodesRunningRatio *prometheus.Desc
+	nodeInfo                 *prometheus.Desc
+	nodeRunning              *prometheus.Desc
+}
+
+// legacyTopology are the cassandra_ topology metrics
+var legacyTopology = topologyMetrics{
+	clusterRunning:           clusterRunning,
+	clusterNodes:             clusterNodesCount,
+	clusterNodesRunning:      clusterNodesRunningCount,
+	clusterNodesRunningRatio: clusterNodesRunningRatio,
+	nodeRunning:              nodeRunning,
+}
+
+// neutralTopology are the instaclustr_ topology metrics
+var neutralTopology = topologyMetrics{
+	clusterRunning:           instaclustrClusterRunning,
+	clusterNodes:             instaclustrClusterNodes,
+	clusterNodesRunning:      instaclustrClusterNodesRunning,
+	clusterNodesRunningRatio: instaclustrClusterNodesRunningRatio,
+	nodeRunning:              instaclustrNodeRunning,
+}
+
+// newTopologies returns the topology metrics to export, the info ones having
+// the extra labels
+func newTopologies(legacy bool, extra *extraLabels) []topologyMetrics {
+	neutral := neutralTopology
+	neutral.clusterInfo = newClusterInfoDesc(topologyNamespace, extra.clusterLabelNames)
+	neutral.nodeInfo = newNodeInfoDesc(topologyNamespace, extra.nodeLabelNames)
+	topologies := []topologyMetrics{neutral}
+	if legacy {
+		l := legacyTopology
+		l.clusterInfo = newClusterInfoDesc(namespace, extra.clusterLabelNames)
+		l.nodeInfo = newNodeInfoDesc(namespace, extra.nodeLabelNames)
+		topologies = append(topologies, l)
+	}
+	return topologies
+}
+
+func (t topologyMetrics) describe(ch chan<- *prometheus.Desc) {
+	ch <- t.clusterInfo
+	ch <- t.clusterRunning
+	ch <- t.clusterNodes
+	ch <- t.clusterNodesRunning
+	ch <- t.clusterNodesRunningRatio
+	ch <- t.nodeInfo
+	ch <- t.nodeRunning
+}
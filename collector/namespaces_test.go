@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLegacyTopologyNames(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		e, err := newExporter(fakeProductProvider{bundle: "KAFKA", metrics: productMetrics}, ExporterOptions{LegacyTopologyNames: legacy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, mf := range mfs {
+			got[mf.GetName()] = true
+		}
+		for _, name := range []string{"instaclustr_cluster_info", "instaclustr_cluster_running", "instaclustr_node_info", "instaclustr_node_running", "kafka_node_partitions"} {
+			if !got[name] {
+				t.Errorf("legacy %v: %s not exported", legacy, name)
+			}
+		}
+		for _, name := range []string{"cassandra_cluster_info", "cassandra_cluster_running", "cassandra_node_info", "cassandra_node_running"} {
+			if got[name] != legacy {
+				t.Errorf("legacy %v: %s exported %v", legacy, name, got[name])
+			}
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var nodeScrapeSuccess = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "node", "scrape_success"),
+	"Whether the metrics of the node were fetched from the Monitoring API by the last collection, once retried if need be. Not exported for the nodes not queried, e.g. recently not found.",
+	[]string{"nodeId"},
+	nil,
+)
+
+// collectNodeScrapeSuccess exports whether the metrics of n were fetched
+func collectNodeScrapeSuccess(n node, success bool, ch chan<- prometheus.Metric) {
+	v := 0.0
+	if success {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(nodeScrapeSuccess, prometheus.GaugeValue, v, n.ID)
+}
+
+// recoverNode stops a panic collecting the node of f, e.g. on a payload the
+// collector doesn't expect, from taking down the other nodes, counting it as
+// a failure of the node, exported as its scrape success. It must be deferred.
+func recoverNode(s *scrape, f nodeFetch) {
+	if r := recover(); r != nil {
+		log.Errorf("Collecting node %s of cluster %s panicked: %v", logValue(f.n.ID), logValue(f.c.ID), r)
+		collectNodeScrapeSuccess(f.n, false, f.ch)
+		s.fail("GetNodeMetrics", f.c.ID, f.n.ID, fmt.Errorf("panic: %v", r))
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// badNodesProvider has a datacentre of three nodes: n1 is fine, n2 always
+// fails and n3 makes the collector panic
+type badNodesProvider struct {
+	fakeProvider
+}
+
+func (badNodesProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	return []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1"}, {ID: "n2"}, {ID: "n3"}}}}, nil
+}
+
+func (p badNodesProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	switch nodeID {
+	case "n2":
+		return nil, errors.New("throttled")
+	case "n3":
+		panic("unexpected payload")
+	}
+	return p.fakeProvider.GetNodeMetrics(nodeID, names)
+}
+
+func TestNodeScrapeSuccess(t *testing.T) {
+	e, err := newExporter(badNodesProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	success := map[string]float64{}
+	cpu := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "cassandra_node_scrape_success":
+				success[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			case "cassandra_node_cpu_utilization_percentage":
+				cpu[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	if expected := map[string]float64{"n1": 1, "n2": 0, "n3": 0}; !reflect.DeepEqual(success, expected) {
+		t.Errorf("Scrape success %v, want %v", success, expected)
+	}
+	if expected := map[string]float64{"n1": 42}; !reflect.DeepEqual(cpu, expected) {
+		t.Errorf("CPU utilization %v, want %v", cpu, expected)
+	}
+	if summary, _ := e.LastScrape(); summary.Errors != 2 {
+		t.Errorf("Got %d errors, want n2 and n3 failing", summary.Errors)
+	}
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// notFoundCache remembers the nodes the provider didn't find, so they aren't
+// queried again until the ttl expires. Decommissioned nodes keep being listed
+// for a while after they are gone.
+type notFoundCache struct {
+	mu    sync.Mutex
+	clock common.Clock
+	ttl   time.Duration
+	until map[string]time.Time
+
+	suppressed prometheus.Counter
+}
+
+func newNotFoundCache(clock common.Clock, ttl time.Duration) *notFoundCache {
+	return &notFoundCache{
+		clock: clock,
+		ttl:   ttl,
+		until: make(map[string]time.Time),
+		suppressed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "instaclustr_exporter",
+			Name:      "suppressed_node_requests_total",
+			Help:      "Number of node metrics requests skipped because the node was recently not found.",
+		}),
+	}
+}
+
+// add remembers nodeID wasn't found
+func (c *notFoundCache) add(nodeID string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until[nodeID] = c.clock.Now().Add(c.ttl)
+}
+
+// skip tells whether nodeID wasn't found within the ttl, counting the
+// suppressed request if so
+func (c *notFoundCache) skip(nodeID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until, ok := c.until[nodeID]
+	if !ok {
+		return false
+	}
+	if !c.clock.Now().Before(until) {
+		delete(c.until, nodeID)
+		return false
+	}
+	c.suppressed.Inc()
+	return true
+}
@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestNotFoundCache(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 3, 9, 37, 4, 0, time.UTC))
+	c := newNotFoundCache(clock, time.Minute)
+
+	if c.skip("node-uuid-1") {
+		t.Errorf("Unknown node should not be skipped")
+	}
+	c.add("node-uuid-1")
+	clock.Advance(30 * time.Second)
+	if !c.skip("node-uuid-1") {
+		t.Errorf("Node not found 30s ago should be skipped")
+	}
+	if c.skip("node-uuid-2") {
+		t.Errorf("Other nodes should not be skipped")
+	}
+	clock.Advance(30 * time.Second)
+	if c.skip("node-uuid-1") {
+		t.Errorf("Node should be queried again once the ttl expires")
+	}
+
+	m := &dto.Metric{}
+	if err := c.suppressed.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("Expected 1 suppressed request, got %v", got)
+	}
+
+	disabled := newNotFoundCache(clock, 0)
+	disabled.add("node-uuid-1")
+	if disabled.skip("node-uuid-1") {
+		t.Errorf("Nodes should never be skipped with a 0 ttl")
+	}
+}
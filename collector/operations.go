@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	nodeOperationsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName("instaclustr", "node", "operations_total"),
+		"Number of node operations (reboots and replacements) listed by the Instaclustr events API since the exporter started.",
+		[]string{"clusterId", "type"},
+		nil,
+	)
+)
+
+// nodeOperationTypes are the types of the events counted as node operations
+var nodeOperationTypes = []string{"NODE_REBOOT", "NODE_REPLACE"}
+
+type clusterEvent struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	NodeID string `json:"nodeId"`
+	Time   string `json:"time"`
+}
+
+// operationCounter counts node operations per cluster and type, every event
+// is only counted once no matter how many polls list it
+type operationCounter struct {
+	mu     sync.Mutex
+	seen   map[string]map[string]bool
+	counts map[string]map[string]float64
+}
+
+func newOperationCounter() *operationCounter {
+	return &operationCounter{
+		seen:   make(map[string]map[string]bool),
+		counts: make(map[string]map[string]float64),
+	}
+}
+
+// observe counts the node operation events not seen before and returns the
+// totals per type. The first poll of a cluster only records the events
+// already listed, which happened before the exporter started. Events no
+// longer listed are forgotten, the API only lists recent ones.
+func (oc *operationCounter) observe(clusterID string, events []clusterEvent) map[string]float64 {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	first := oc.counts[clusterID] == nil
+	if first {
+		oc.counts[clusterID] = make(map[string]float64, len(nodeOperationTypes))
+		for _, t := range nodeOperationTypes {
+			oc.counts[clusterID][t] = 0
+		}
+	}
+	seen := make(map[string]bool, len(events))
+	for _, ev := range events {
+		if _, ok := oc.counts[clusterID][ev.Type]; !ok {
+			continue
+		}
+		seen[ev.ID] = true
+		if !first && !oc.seen[clusterID][ev.ID] {
+			oc.counts[clusterID][ev.Type]++
+		}
+	}
+	oc.seen[clusterID] = seen
+
+	totals := make(map[string]float64, len(oc.counts[clusterID]))
+	for t, v := range oc.counts[clusterID] {
+		totals[t] = v
+	}
+	return totals
+}
+
+// operationsCollector exports the node operations of a cluster. Not every
+// account exposes them, so a response that can't be decoded is only logged at
+// debug level.
+func (e *Exporter) operationsCollector(s *scrape, c cluster, ch chan<- prometheus.Metric) {
+	ep, ok := e.providerFor(s).(eventsProvider)
+	if !ok {
+		return
+	}
+	events, err := ep.GetEvents(c.ID)
+	s.called("GetEvents", err)
+	if err != nil {
+		log.Debugf("Node operations not available for cluster %s: %v", c.ID, err)
+		return
+	}
+	for t, v := range e.operations.observe(c.ID, events) {
+		ch <- prometheus.MustNewConstMetric(
+			nodeOperationsTotal,
+			prometheus.CounterValue,
+			v,
+			c.ID,
+			t,
+		)
+	}
+}
@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOperationCounter(t *testing.T) {
+	oc := newOperationCounter()
+	polls := []struct {
+		events   []clusterEvent
+		expected map[string]float64
+	}{
+		{
+			// Events from before the exporter started aren't counted
+			[]clusterEvent{{ID: "1", Type: "NODE_REBOOT"}, {ID: "2", Type: "NODE_REPLACE"}},
+			map[string]float64{"NODE_REBOOT": 0, "NODE_REPLACE": 0},
+		},
+		{
+			// Same events listed again plus new ones, other types ignored
+			[]clusterEvent{{ID: "1", Type: "NODE_REBOOT"}, {ID: "2", Type: "NODE_REPLACE"}, {ID: "3", Type: "NODE_REBOOT"}, {ID: "4", Type: "CLUSTER_RESIZE"}},
+			map[string]float64{"NODE_REBOOT": 1, "NODE_REPLACE": 0},
+		},
+		{
+			// Old events fell out of the API window
+			[]clusterEvent{{ID: "3", Type: "NODE_REBOOT"}, {ID: "5", Type: "NODE_REPLACE"}},
+			map[string]float64{"NODE_REBOOT": 1, "NODE_REPLACE": 1},
+		},
+	}
+	for i, p := range polls {
+		if got := oc.observe("cluster-uuid-1", p.events); !reflect.DeepEqual(got, p.expected) {
+			t.Errorf("Poll %d: got %v want %v", i, got, p.expected)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Monitoring API host ("n::") metrics of the nodes, to correlate Cassandra
+// with the pressure on its host
+var osNodeMetrics = []string{
+	"osLoad",          //Load average of the node over the last minute.
+	"memAvailable",    //Bytes of memory available for starting new applications, without swapping.
+	"networkInDelta",  //Bytes received by the node since the previous sample.
+	"networkOutDelta", //Bytes sent by the node since the previous sample.
+	"swapUsed",        //Bytes of swap space used.
+}
+
+func newOSNodeDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "node", name), help, []string{"nodeId"}, nil)
+}
+
+// Host metric descriptors
+var (
+	nodeOSLoad               = newOSNodeDesc("os_load", "Load average of the node over the last minute.")
+	nodeMemoryAvailableBytes = newOSNodeDesc("memory_available_bytes", "Bytes of memory available for starting new applications, without swapping.")
+	nodeNetworkInDeltaBytes  = newOSNodeDesc("network_in_delta_bytes", "Bytes received by the node since the previous Monitoring API sample.")
+	nodeNetworkOutDeltaBytes = newOSNodeDesc("network_out_delta_bytes", "Bytes sent by the node since the previous Monitoring API sample.")
+	nodeSwapUsedBytes        = newOSNodeDesc("swap_used_bytes", "Bytes of swap space used.")
+)
+
+// osNodeDescs maps the host metrics to their descriptor
+var osNodeDescs = map[string]*prometheus.Desc{
+	"osLoad":          nodeOSLoad,
+	"memAvailable":    nodeMemoryAvailableBytes,
+	"networkInDelta":  nodeNetworkInDeltaBytes,
+	"networkOutDelta": nodeNetworkOutDeltaBytes,
+	"swapUsed":        nodeSwapUsedBytes,
+}
+
+func describeOS(ch chan<- *prometheus.Desc) {
+	for _, d := range osNodeDescs {
+		ch <- d
+	}
+}
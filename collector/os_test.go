@@ -0,0 +1,79 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeOSProvider returns the host metrics of its node
+type fakeOSProvider struct {
+	fakeProvider
+	queried *[]string
+}
+
+func (p fakeOSProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	*p.queried = names
+	return []metrics{{Metrics: []metric{
+		{Name: "osLoad", Values: []metricValue{{Value: "2.5"}}},
+		{Name: "memAvailable", Values: []metricValue{{Value: "4294967296"}}},
+		{Name: "networkInDelta", Values: []metricValue{{Value: "1024"}}},
+		{Name: "networkOutDelta", Values: []metricValue{{Value: "2048"}}},
+		{Name: "swapUsed", Values: []metricValue{{Value: "0"}}},
+	}}}, nil
+}
+
+func TestOSNodeMetrics(t *testing.T) {
+	var queried []string
+	e, err := newExporter(fakeOSProvider{queried: &queried}, ExporterOptions{Profile: ProfileFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			got[mf.GetName()] = m.GetGauge().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_node_os_load":                 2.5,
+		"cassandra_node_memory_available_bytes":  4294967296,
+		"cassandra_node_network_in_delta_bytes":  1024,
+		"cassandra_node_network_out_delta_bytes": 2048,
+		"cassandra_node_swap_used_bytes":         0,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", name, v, ok, value)
+		}
+	}
+}
+
+func TestOSNodeMetricsNotInStandardProfile(t *testing.T) {
+	var queried []string
+	e, err := newExporter(fakeOSProvider{queried: &queried}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range queried {
+		if _, ok := osNodeDescs[name]; ok {
+			t.Errorf("%s queried by the standard profile", name)
+		}
+	}
+}
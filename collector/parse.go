@@ -0,0 +1,42 @@
+package collector
+
+import (
+	"encoding/json"
+
+	"github.com/prometheus/common/log"
+)
+
+// nodeMetricsResponse is the Monitoring API response for a node, metrics are
+// kept raw so each one can be decoded on its own
+type nodeMetricsResponse struct {
+	ID      string            `json:"id"`
+	Payload []json.RawMessage `json:"payload"`
+}
+
+// parseNodeMetrics decodes a Monitoring API node metrics response. A malformed
+// metric is skipped instead of failing the whole response, so one bad value
+// doesn't drop every other metric of the node.
+func parseNodeMetrics(data []byte) ([]metrics, error) {
+	responses := []nodeMetricsResponse{}
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, err
+	}
+	ms := make([]metrics, 0, len(responses))
+	for _, r := range responses {
+		mc := metrics{Metrics: make([]metric, 0, len(r.Payload))}
+		for _, raw := range r.Payload {
+			var m metric
+			if err := json.Unmarshal(raw, &m); err != nil {
+				log.Errorf("Skipping malformed metric of node %s: %v", r.ID, err)
+				continue
+			}
+			// null entries decode into an empty metric
+			if m.Name == "" {
+				continue
+			}
+			mc.Metrics = append(mc.Metrics, m)
+		}
+		ms = append(ms, mc)
+	}
+	return ms, nil
+}
@@ -0,0 +1,111 @@
+//go:build go1.18
+// +build go1.18
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+func mockData(t testing.TB, name string) []byte {
+	_, filename, _, _ := runtime.Caller(0)
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(filename), "..", "mock", "data", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newFuzzExporter(t testing.TB) *Exporter {
+	values, err := newValueParser(ParseErrorFlag, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extraLabels, err := loadExtraLabels("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Exporter{
+		clock:       common.SystemClock,
+		rates:       newRateIntegrator(common.SystemClock),
+		values:      values,
+		extraLabels: extraLabels,
+		topologies:  newTopologies(true, extraLabels),
+	}
+}
+
+// drain discards every metric sent to the returned channel until it's closed
+func drain() (chan<- prometheus.Metric, func()) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	return ch, func() {
+		close(ch)
+		<-done
+	}
+}
+
+// quietLogs keeps the expected parsing errors from flooding the fuzzer output
+func quietLogs(f *testing.F) {
+	log.Base().SetLevel("fatal")
+	f.Cleanup(func() { log.Base().SetLevel("info") })
+}
+
+func FuzzParseNodeMetrics(f *testing.F) {
+	quietLogs(f)
+	f.Add(mockData(f, "node-uuid-1/getAllNodeMetrics.json"))
+	f.Add([]byte(`[{"id":"n","payload":[{"metric":"cpuUtilization","type":"percentage","values":[{"time":"2017-07-03T09:37:04.000Z","value":"NaN"}]}]}]`))
+	f.Add([]byte(`[{"id":"n","payload":[{"metric":"cassandraReads","values":[]},{"metric":"cassandraWrites","values":null}]}]`))
+	f.Add([]byte(`[{"id":"n","payload":[{"metric":"compactions","values":[{"value":3}]},null,{"metric":12}]}]`))
+	f.Add([]byte(`[{"id":"n","payload":[{"metric":"repairs","type":"pendingtasks","values":[{"value":"1e400"}]}`))
+	f.Add([]byte(`{"status":404}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ms, err := parseNodeMetrics(data)
+		if err != nil {
+			return
+		}
+		e := newFuzzExporter(t)
+		ch, wait := drain()
+		e.nodeMetricsCollector(cluster{ID: "c"}, node{ID: "n"}, ms, ch)
+		wait()
+	})
+}
+
+func FuzzParseClusterStatus(f *testing.F) {
+	quietLogs(f)
+	f.Add(mockData(f, "cluster-uuid-1/getClusterStatus.json"))
+	f.Add([]byte(`{"dataCentres":[{"id":null,"nodes":[null,{"id":"n","nodeStatus":null}]}]}`))
+	f.Add([]byte(`{"dataCentres":null}`))
+	f.Add([]byte(`{"dataCentres":[{"nodes":[{"id":1}]}]}`))
+	f.Add([]byte(`{"dataCentres":[{"nodes":[{"id":"n"`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dcs := new(datacentres)
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(dcs); err != nil {
+			return
+		}
+		e := newFuzzExporter(t)
+		ch, wait := drain()
+		for _, dc := range dcs.Dcs {
+			for _, n := range dc.Nodes {
+				e.nodeInfoCollector(cluster{ID: "c"}, n, ch)
+				e.nodeHealthCollector(cluster{ID: "c"}, n, ch)
+			}
+		}
+		wait()
+	})
+}
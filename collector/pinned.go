@@ -0,0 +1,76 @@
+package collector
+
+import "errors"
+
+// pinnedTargets are the clusters, and optionally the nodes, pinned in the
+// configuration. The clusters of the account aren't listed then, saving an
+// API call per scrape and keeping a broad API key from scraping the whole
+// account.
+type pinnedTargets struct {
+	clusters []string
+	// nodes collected, all of them when empty
+	nodes map[string]bool
+}
+
+// newPinnedTargets returns nil when no cluster is pinned
+func newPinnedTargets(clusters, nodes []string) (*pinnedTargets, error) {
+	if len(clusters) == 0 {
+		if len(nodes) > 0 {
+			return nil, errors.New("pinned nodes require pinned clusters")
+		}
+		return nil, nil
+	}
+	p := &pinnedTargets{clusters: clusters, nodes: map[string]bool{}}
+	for _, n := range nodes {
+		p.nodes[n] = true
+	}
+	return p, nil
+}
+
+// list returns the pinned clusters, only their IDs are known until they are
+// described
+func (p *pinnedTargets) list() []cluster {
+	clusters := make([]cluster, len(p.clusters))
+	for i, id := range p.clusters {
+		clusters[i] = cluster{ID: id}
+	}
+	return clusters
+}
+
+// includes tells whether the metrics of n are collected
+func (p *pinnedTargets) includes(n node) bool {
+	return p == nil || len(p.nodes) == 0 || p.nodes[n.ID]
+}
+
+// clusterDescriber is implemented by providers telling the attributes of a
+// cluster along with its topology, so pinned clusters don't need the cluster
+// list
+type clusterDescriber interface {
+	DescribeCluster(clusterID string) (cluster, []datacentre, error)
+}
+
+// clusterStatus is the Provisioning API cluster status, which has the
+// attributes of the cluster along with its datacentres
+type clusterStatus struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"clusterName"`
+	Status string       `json:"clusterStatus"`
+	Dcs    []datacentre `json:"dataCentres"`
+	// AddonBundles are the add-ons of the cluster, e.g. SPARK
+	AddonBundles []addonBundle `json:"addonBundles"`
+}
+
+// cluster returns the cluster the status is of, its node counts are the
+// ones of its datacentres
+func (s *clusterStatus) cluster(clusterID string) cluster {
+	c := cluster{ID: clusterID, Name: s.Name, DerivedStatus: s.Status}
+	for _, dc := range s.Dcs {
+		for _, n := range dc.Nodes {
+			c.NodeCount++
+			if n.Status == "RUNNING" {
+				c.RunningNodeCount++
+			}
+		}
+	}
+	return c
+}
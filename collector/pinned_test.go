@@ -0,0 +1,126 @@
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// describingProvider describes clusters with two nodes, failing to list them
+type describingProvider struct {
+	fakeProvider
+	mu    sync.Mutex
+	nodes []string
+}
+
+func (*describingProvider) ListClusters() ([]cluster, error) {
+	return nil, errors.New("clusters listed")
+}
+
+func (*describingProvider) DescribeCluster(clusterID string) (cluster, []datacentre, error) {
+	status := &clusterStatus{Name: "cluster-" + clusterID, Status: "RUNNING", Dcs: []datacentre{{ID: "dc1", Nodes: []node{
+		{ID: clusterID + "-n1", Status: "RUNNING"},
+		{ID: clusterID + "-n2", Status: "JOINING"},
+	}}}}
+	return status.cluster(clusterID), status.Dcs, nil
+}
+
+func (p *describingProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	p.mu.Lock()
+	p.nodes = append(p.nodes, nodeID)
+	p.mu.Unlock()
+	return p.fakeProvider.GetNodeMetrics(nodeID, names)
+}
+
+func TestPinnedClusters(t *testing.T) {
+	p := &describingProvider{}
+	e, err := newExporter(p, ExporterOptions{PinnedClusters: []string{"c1", "c2"}, PinnedNodes: []string{"c1-n1", "c2-n2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.Collect(ch)
+		close(ch)
+	}()
+	clusters := map[string]string{}
+	for m := range ch {
+		if m.Desc() != e.topologies[0].clusterInfo {
+			continue
+		}
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		clusters[labels["clusterId"]] = labels["clusterName"]
+	}
+	if summary, _ := e.LastScrape(); summary.Errors != 0 {
+		t.Errorf("Got %d errors", summary.Errors)
+	}
+	sort.Strings(p.nodes)
+	if len(p.nodes) != 2 || p.nodes[0] != "c1-n1" || p.nodes[1] != "c2-n2" {
+		t.Errorf("Got metrics of nodes %v", p.nodes)
+	}
+	if clusters["c1"] != "cluster-c1" || clusters["c2"] != "cluster-c2" {
+		t.Errorf("Got cluster names %v", clusters)
+	}
+
+	if _, err := newExporter(p, ExporterOptions{PinnedNodes: []string{"n1"}}); err == nil {
+		t.Errorf("Nodes pinned without clusters")
+	}
+}
+
+func TestPinnedClustersMaintenance(t *testing.T) {
+	var sent int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&sent, 1)
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Long past, so the maintenance started here is over for the wall clock
+	// of the other tests
+	clock := common.NewFakeClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	e, err := NewExporter(instaclustr.Config{Url: server.URL, MonitoringAPIKey: "key"},
+		ExporterOptions{PinnedClusters: []string{"c1", "c2"}, MaintenanceCache: true, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collect := func() {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			e.Collect(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+	}
+	collect()
+	if !instaclustr.InMaintenance(clock) {
+		t.Fatal("API not in maintenance after a 503 to the status of the first pinned cluster")
+	}
+	polled := atomic.LoadInt64(&sent)
+	collect()
+	if n := atomic.LoadInt64(&sent); n != polled {
+		t.Errorf("Sent %d requests during the maintenance", n-polled)
+	}
+	clock.Advance(2 * time.Minute)
+	if instaclustr.InMaintenance(clock) {
+		t.Errorf("API still in maintenance after the Retry-After")
+	}
+}
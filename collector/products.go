@@ -0,0 +1,250 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// productProvider is implemented by providers managing clusters of other
+// products than Cassandra too
+type productProvider interface {
+	// GetProductNodeMetrics returns the latest values of the given metrics of
+	// a product, by their Monitoring API prefix, e.g. "k::" for Kafka,
+	// errNodeNotFound if the node doesn't exist
+	GetProductNodeMetrics(nodeID, prefix string, names []string) ([]metrics, error)
+}
+
+// productDesc is the descriptor and value type of a node metric of a product
+type productDesc struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+// product is a kind of cluster other than Cassandra: the bundles it's told
+// by, the Monitoring API metrics queried for its nodes instead of the
+// Cassandra ones and the descriptors they're exported with, under the
+// namespace of the product
+type product struct {
+	// name is the kind of cluster, and namespace, e.g. "kafka"
+	name string
+	// bundles are the bundleTypes of its clusters
+	bundles []string
+	// prefix of its Monitoring API metrics, e.g. "k::"
+	prefix string
+	// metrics queried for every node
+	metrics []string
+	// descs maps the metrics to their descriptor, by name or, for the
+	// metrics having types, by name/type
+	descs map[string]productDesc
+	// optIn products are only collected when enabled, their metrics not
+	// being part of the documented Monitoring API
+	optIn bool
+}
+
+func newProductNodeDesc(namespace, name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "node", name), help, []string{"clusterId", "nodeId"}, nil)
+}
+
+func gauge(desc *prometheus.Desc) productDesc {
+	return productDesc{desc, prometheus.GaugeValue}
+}
+
+func counter(desc *prometheus.Desc) productDesc {
+	return productDesc{desc, prometheus.CounterValue}
+}
+
+// Kafka metric descriptors
+var (
+	kafkaNodeBytesInPerSecond          = newProductNodeDesc("kafka", "bytes_in_per_second", "Bytes per second received by the broker across all its topics.")
+	kafkaNodeBytesOutPerSecond         = newProductNodeDesc("kafka", "bytes_out_per_second", "Bytes per second sent by the broker across all its topics.")
+	kafkaNodeMessagesInPerSecond       = newProductNodeDesc("kafka", "messages_in_per_second", "Messages per second received by the broker across all its topics.")
+	kafkaNodeUnderReplicatedPartitions = newProductNodeDesc("kafka", "under_replicated_partitions", "Number of partitions of the broker whose followers are out of sync.")
+	kafkaNodeOfflinePartitions         = newProductNodeDesc("kafka", "offline_partitions", "Number of partitions without an active leader.")
+	kafkaNodePartitions                = newProductNodeDesc("kafka", "partitions", "Number of partitions hosted by the broker.")
+	kafkaNodeLeaders                   = newProductNodeDesc("kafka", "leaders", "Number of partitions the broker leads.")
+)
+
+// Redis metric descriptors
+var (
+	redisNodeMemoryUsedBytes     = newProductNodeDesc("redis", "memory_used_bytes", "Bytes of memory allocated by Redis.")
+	redisNodeConnectedClients    = newProductNodeDesc("redis", "connected_clients", "Number of client connections, replicas excluded.")
+	redisNodeOpsPerSecond        = newProductNodeDesc("redis", "ops_per_second", "Commands processed per second.")
+	redisNodeEvictedKeysTotal    = newProductNodeDesc("redis", "evicted_keys_total", "Keys evicted because of the maxmemory limit since the start of the node.")
+	redisNodeKeyspaceHitsTotal   = newProductNodeDesc("redis", "keyspace_hits_total", "Successful key lookups since the start of the node.")
+	redisNodeKeyspaceMissesTotal = newProductNodeDesc("redis", "keyspace_misses_total", "Failed key lookups since the start of the node.")
+)
+
+// PostgreSQL metric descriptors
+var (
+	postgresqlNodeConnections               = newProductNodeDesc("postgresql", "connections", "Number of client connections to the node.")
+	postgresqlNodeTransactionsPerSecond     = newProductNodeDesc("postgresql", "transactions_per_second", "Transactions committed or rolled back per second.")
+	postgresqlNodeReplicationLag            = newProductNodeDesc("postgresql", "replication_lag_seconds", "Seconds the replica is behind its primary, 0 on the primary.")
+	postgresqlNodeDiskUtilizationPercentage = newProductNodeDesc("postgresql", "disk_utilization_percentage", "Disk space utilisation, as a percentage of total available.")
+)
+
+// Cadence metric descriptors
+var (
+	cadenceNodeWorkflowStartsPerSecond      = newProductNodeDesc("cadence", "workflow_starts_per_second", "Workflows started per second.")
+	cadenceNodeWorkflowCompletionsPerSecond = newProductNodeDesc("cadence", "workflow_completions_per_second", "Workflows completed per second, whatever their outcome.")
+	cadenceNodeTaskListBacklog              = newProductNodeDesc("cadence", "task_list_backlog", "Tasks waiting in the task lists of the node.")
+	cadenceNodeHistoryShards                = newProductNodeDesc("cadence", "history_shards", "History shards owned by the node.")
+	cadenceNodeHistoryShardsUnhealthy       = newProductNodeDesc("cadence", "history_shards_unhealthy", "History shards of the node failing to process their tasks.")
+)
+
+// products are the kinds of clusters collected besides Cassandra
+var products = []*product{
+	{
+		name:    "kafka",
+		bundles: []string{"KAFKA"},
+		prefix:  "k::",
+		metrics: []string{
+			"kafkaBrokerTopicMetrics",   //Bytes in, bytes out and messages in per second across the topics of the broker.
+			"underReplicatedPartitions", //Number of partitions of the broker whose followers are out of sync.
+			"offlinePartitions",         //Number of partitions without an active leader.
+			"partitionCount",            //Number of partitions hosted by the broker.
+			"leaderCount",               //Number of partitions the broker leads.
+		},
+		descs: map[string]productDesc{
+			"kafkaBrokerTopicMetrics/bytesInPerSecond":    gauge(kafkaNodeBytesInPerSecond),
+			"kafkaBrokerTopicMetrics/bytesOutPerSecond":   gauge(kafkaNodeBytesOutPerSecond),
+			"kafkaBrokerTopicMetrics/messagesInPerSecond": gauge(kafkaNodeMessagesInPerSecond),
+			"underReplicatedPartitions":                   gauge(kafkaNodeUnderReplicatedPartitions),
+			"offlinePartitions":                           gauge(kafkaNodeOfflinePartitions),
+			"partitionCount":                              gauge(kafkaNodePartitions),
+			"leaderCount":                                 gauge(kafkaNodeLeaders),
+		},
+	},
+	{
+		// Valkey is the Redis fork, with the same metrics
+		name:    "redis",
+		bundles: []string{"REDIS", "VALKEY"},
+		prefix:  "r::",
+		metrics: []string{
+			"usedMemory",             //Bytes of memory allocated by Redis.
+			"connectedClients",       //Number of client connections, replicas excluded.
+			"instantaneousOpsPerSec", //Commands processed per second.
+			"evictedKeys",            //Keys evicted because of the maxmemory limit since the start of the node.
+			"keyspaceHits",           //Successful key lookups since the start of the node.
+			"keyspaceMisses",         //Failed key lookups since the start of the node.
+		},
+		descs: map[string]productDesc{
+			"usedMemory":             gauge(redisNodeMemoryUsedBytes),
+			"connectedClients":       gauge(redisNodeConnectedClients),
+			"instantaneousOpsPerSec": gauge(redisNodeOpsPerSecond),
+			"evictedKeys":            counter(redisNodeEvictedKeysTotal),
+			"keyspaceHits":           counter(redisNodeKeyspaceHitsTotal),
+			"keyspaceMisses":         counter(redisNodeKeyspaceMissesTotal),
+		},
+	},
+	{
+		name:    "postgresql",
+		bundles: []string{"POSTGRESQL"},
+		prefix:  "pg::",
+		metrics: []string{
+			"connections",           //Number of client connections to the node.
+			"transactionsPerSecond", //Transactions committed or rolled back per second.
+			"replicationLag",        //Seconds the replica is behind its primary, 0 on the primary.
+			"diskUtilization",       //Percentage of the disk used.
+		},
+		descs: map[string]productDesc{
+			"connections":           gauge(postgresqlNodeConnections),
+			"transactionsPerSecond": gauge(postgresqlNodeTransactionsPerSecond),
+			"replicationLag":        gauge(postgresqlNodeReplicationLag),
+			"diskUtilization":       gauge(postgresqlNodeDiskUtilizationPercentage),
+		},
+	},
+	{
+		name:    "cadence",
+		bundles: []string{"CADENCE"},
+		prefix:  "cadence::",
+		metrics: []string{
+			"workflowStarts",         //Workflows started per second.
+			"workflowCompletions",    //Workflows completed per second, whatever their outcome.
+			"taskListBacklog",        //Tasks waiting in the task lists of the node.
+			"historyShards",          //History shards owned by the node.
+			"historyShardsUnhealthy", //History shards of the node failing to process their tasks.
+		},
+		descs: map[string]productDesc{
+			"workflowStarts":         gauge(cadenceNodeWorkflowStartsPerSecond),
+			"workflowCompletions":    gauge(cadenceNodeWorkflowCompletionsPerSecond),
+			"taskListBacklog":        gauge(cadenceNodeTaskListBacklog),
+			"historyShards":          gauge(cadenceNodeHistoryShards),
+			"historyShardsUnhealthy": gauge(cadenceNodeHistoryShardsUnhealthy),
+		},
+		optIn: true,
+	},
+}
+
+// productOf returns the product of c, nil for Cassandra clusters
+func productOf(c cluster) *product {
+	for _, p := range products {
+		for _, b := range p.bundles {
+			if strings.EqualFold(c.BundleType, b) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// isCassandra tells whether c is a Cassandra cluster
+func isCassandra(c cluster) bool {
+	return productOf(c) == nil
+}
+
+// newProducts returns the products collected: every one but the opt-in ones
+// not enabled, none when the provider doesn't manage other products
+func newProducts(prov provider, cadence bool) []*product {
+	if _, ok := prov.(productProvider); !ok {
+		return nil
+	}
+	var collected []*product
+	for _, p := range products {
+		if !p.optIn || cadence {
+			collected = append(collected, p)
+		}
+	}
+	return collected
+}
+
+// collects tells whether the metrics of the nodes of p are collected
+func (e *Exporter) collects(p *product) bool {
+	for _, c := range e.products {
+		if c == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *product) describe(ch chan<- *prometheus.Desc) {
+	for _, d := range p.descs {
+		ch <- d.desc
+	}
+}
+
+// fetchProductNodeMetrics queries the metrics of p for n
+func (e *Exporter) fetchProductNodeMetrics(s *scrape, p *product, n node) ([]metrics, error) {
+	return e.providerFor(s).(productProvider).GetProductNodeMetrics(n.ID, p.prefix, p.metrics)
+}
+
+// productNodeCollector exports the metrics of a node of a cluster of p
+func (e *Exporter) productNodeCollector(p *product, c cluster, n node, ms []metrics, ch chan<- prometheus.Metric) {
+	for _, mc := range ms {
+		for _, m := range mc.Metrics {
+			d, ok := p.descs[m.Name+"/"+m.Type]
+			if !ok {
+				d, ok = p.descs[m.Name]
+			}
+			if !ok {
+				continue
+			}
+			value, ok := e.values.parse(n, m, ch)
+			if !ok {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(d.desc, d.valueType, value, c.ID, n.ID)
+		}
+	}
+}
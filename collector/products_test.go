@@ -0,0 +1,154 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeProductProvider manages a cluster of another product than Cassandra,
+// its nodes returning the metrics of their product
+type fakeProductProvider struct {
+	fakeProvider
+	bundle  string
+	metrics map[string][]metric
+}
+
+func (p fakeProductProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "p1", Name: "product", NodeCount: 1, RunningNodeCount: 1, DerivedStatus: "RUNNING", BundleType: p.bundle}}, nil
+}
+
+func (fakeProductProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	panic("Cassandra metrics queried for the node of another product")
+}
+
+func (p fakeProductProvider) GetProductNodeMetrics(nodeID, prefix string, names []string) ([]metrics, error) {
+	return []metrics{{Metrics: p.metrics[prefix]}}, nil
+}
+
+// productMetrics are the metrics of every product, by prefix
+var productMetrics = map[string][]metric{
+	"k::": {
+		{Name: "kafkaBrokerTopicMetrics", Type: "bytesInPerSecond", Values: []metricValue{{Value: "1024"}}},
+		{Name: "kafkaBrokerTopicMetrics", Type: "messagesInPerSecond", Values: []metricValue{{Value: "10"}}},
+		{Name: "underReplicatedPartitions", Values: []metricValue{{Value: "2"}}},
+		{Name: "partitionCount", Values: []metricValue{{Value: "48"}}},
+	},
+	"r::": {
+		{Name: "usedMemory", Values: []metricValue{{Value: "1048576"}}},
+		{Name: "connectedClients", Values: []metricValue{{Value: "12"}}},
+		{Name: "evictedKeys", Values: []metricValue{{Value: "3"}}},
+		{Name: "keyspaceHits", Values: []metricValue{{Value: "900"}}},
+	},
+	"pg::": {
+		{Name: "connections", Values: []metricValue{{Value: "37"}}},
+		{Name: "transactionsPerSecond", Values: []metricValue{{Value: "250.5"}}},
+		{Name: "replicationLag", Values: []metricValue{{Value: "0.2"}}},
+		{Name: "diskUtilization", Values: []metricValue{{Value: "61"}}},
+	},
+	"cadence::": {
+		{Name: "workflowStarts", Values: []metricValue{{Value: "12.5"}}},
+		{Name: "taskListBacklog", Values: []metricValue{{Value: "340"}}},
+		{Name: "historyShards", Values: []metricValue{{Value: "128"}}},
+		{Name: "historyShardsUnhealthy", Values: []metricValue{{Value: "2"}}},
+	},
+}
+
+func TestProductNodeCollector(t *testing.T) {
+	cases := []struct {
+		bundle   string
+		opts     ExporterOptions
+		expected map[string]float64
+		// absent are not exported
+		absent []string
+	}{
+		{
+			bundle: "KAFKA",
+			expected: map[string]float64{
+				"kafka_node_bytes_in_per_second":         1024,
+				"kafka_node_messages_in_per_second":      10,
+				"kafka_node_under_replicated_partitions": 2,
+				"kafka_node_partitions":                  48,
+			},
+		},
+		{
+			bundle: "REDIS",
+			expected: map[string]float64{
+				"redis_node_memory_used_bytes":   1048576,
+				"redis_node_connected_clients":   12,
+				"redis_node_evicted_keys_total":  3,
+				"redis_node_keyspace_hits_total": 900,
+			},
+		},
+		{
+			bundle: "Valkey",
+			expected: map[string]float64{
+				"redis_node_memory_used_bytes": 1048576,
+			},
+		},
+		{
+			bundle: "POSTGRESQL",
+			expected: map[string]float64{
+				"postgresql_node_connections":                 37,
+				"postgresql_node_transactions_per_second":     250.5,
+				"postgresql_node_replication_lag_seconds":     0.2,
+				"postgresql_node_disk_utilization_percentage": 61,
+			},
+		},
+		{
+			bundle: "CADENCE",
+			opts:   ExporterOptions{CadenceMetrics: true},
+			expected: map[string]float64{
+				"cadence_node_workflow_starts_per_second": 12.5,
+				"cadence_node_task_list_backlog":          340,
+				"cadence_node_history_shards":             128,
+				"cadence_node_history_shards_unhealthy":   2,
+			},
+		},
+		{
+			// Not documented, the Cadence metrics are opt-in
+			bundle:   "CADENCE",
+			expected: map[string]float64{},
+			absent:   []string{"cadence_node_history_shards", "cassandra_node_scrape_success"},
+		},
+	}
+	for _, c := range cases {
+		e, err := newExporter(fakeProductProvider{bundle: c.bundle, metrics: productMetrics}, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatalf("%s: %v", c.bundle, err)
+		}
+
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				got[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+				if _, ok := c.expected[mf.GetName()]; !ok {
+					continue
+				}
+				// Every product labels its node metrics the same way
+				if labels := m.GetLabel(); len(labels) != 2 || labels[0].GetName() != "clusterId" || labels[1].GetName() != "nodeId" {
+					t.Errorf("%s: %s labelled %v", c.bundle, mf.GetName(), labels)
+				}
+			}
+		}
+		c.expected["instaclustr_node_running"] = 1
+		for name, value := range c.expected {
+			if v, ok := got[name]; !ok || v != value {
+				t.Errorf("%s: %s: got %v (found %v) want %v", c.bundle, name, v, ok, value)
+			}
+		}
+		for _, name := range append(c.absent, "cassandra_node_cpu_utilization_percentage") {
+			if _, ok := got[name]; ok {
+				t.Errorf("%s: %s exported", c.bundle, name)
+			}
+		}
+	}
+}
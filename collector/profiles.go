@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Metric profiles selectable through ExporterOptions.Profile
+const (
+	// ProfileMinimal only exports the topology: cluster and node info and health
+	ProfileMinimal = "minimal"
+	// ProfileStandard exports the topology plus the core node metrics
+	ProfileStandard = "standard"
+	// ProfileFull exports everything the exporter knows how to collect
+	ProfileFull = "full"
+)
+
+// profile is a curated set of metrics
+type profile struct {
+	nodeMetrics    []string
+	repairStatus   bool
+	nodeOperations bool
+}
+
+var profiles = map[string]profile{
+	ProfileMinimal: {},
+	ProfileStandard: {
+		nodeMetrics: coreNodeMetrics,
+	},
+	ProfileFull: {
+		nodeMetrics:    allNodeMetrics,
+		repairStatus:   true,
+		nodeOperations: true,
+	},
+}
+
+// Profiles returns the names of the available metric profiles
+func Profiles() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getProfile(name string) (profile, error) {
+	if name == "" {
+		name = ProfileStandard
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return profile{}, fmt.Errorf("unknown profile %q, expected one of %v", name, Profiles())
+	}
+	return p, nil
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	if expected := []string{ProfileFull, ProfileMinimal, ProfileStandard}; !reflect.DeepEqual(Profiles(), expected) {
+		t.Errorf("Got profiles %v, want %v", Profiles(), expected)
+	}
+	if _, err := getProfile("everything"); err == nil {
+		t.Error("Unknown profile accepted")
+	}
+}
+
+func TestProfileMetrics(t *testing.T) {
+	cases := []struct {
+		profile     string
+		nodeMetrics []string
+		repairs     bool
+	}{
+		{ProfileMinimal, nil, false},
+		// The standard profile is the default
+		{"", coreNodeMetrics, false},
+		{ProfileStandard, coreNodeMetrics, false},
+		{ProfileFull, allNodeMetrics, true},
+	}
+	for _, c := range cases {
+		e, err := newExporter(fakeProvider{}, ExporterOptions{Profile: c.profile})
+		if err != nil {
+			t.Fatalf("%q: %v", c.profile, err)
+		}
+		if !reflect.DeepEqual(e.nodeMetrics, c.nodeMetrics) {
+			t.Errorf("%q: got node metrics %v, want %v", c.profile, e.nodeMetrics, c.nodeMetrics)
+		}
+		if e.repairStatus != c.repairs || e.nodeOperations != c.repairs {
+			t.Errorf("%q: got repair status %v and node operations %v, want %v", c.profile, e.repairStatus, e.nodeOperations, c.repairs)
+		}
+	}
+	// The metrics of collector.node-metrics replace the ones of the profile
+	e, err := newExporter(fakeProvider{}, ExporterOptions{Profile: ProfileMinimal, NodeMetrics: []string{"cpuUtilization"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"cpuUtilization"}; !reflect.DeepEqual(e.nodeMetrics, expected) {
+		t.Errorf("Got node metrics %v, want %v", e.nodeMetrics, expected)
+	}
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+)
+
+// errNodeNotFound is returned by GetNodeMetrics for unknown nodes, e.g. just
+// decommissioned ones
+var errNodeNotFound = errors.New("node not found")
+
+// provider is a managed Cassandra service the exporter collects from. Every
+// provider normalizes its clusters, topologies and node metrics to the same
+// schema, so the exported metrics don't depend on the service behind them.
+// Node metric names are the ones in allNodeMetrics, providers translate them
+// to whatever their API expects.
+type provider interface {
+	// ListClusters returns the clusters of the account
+	ListClusters() ([]cluster, error)
+	// GetTopology returns the datacentres of a cluster along with their nodes
+	GetTopology(clusterID string) ([]datacentre, error)
+	// GetNodeMetrics returns the latest values of the given node metrics,
+	// errNodeNotFound if the node doesn't exist
+	GetNodeMetrics(nodeID string, names []string) ([]metrics, error)
+}
+
+// contextProvider is implemented by providers whose requests can be
+// cancelled. withContext returns the provider with its requests bound to ctx.
+type contextProvider interface {
+	withContext(ctx context.Context) provider
+}
+
+// repairsProvider is implemented by providers exposing their managed repairs
+type repairsProvider interface {
+	GetRepairs(clusterID string) ([]repair, error)
+}
+
+// eventsProvider is implemented by providers exposing node operations
+type eventsProvider interface {
+	GetEvents(clusterID string) ([]clusterEvent, error)
+}
+
+// consumerGroupsProvider is implemented by providers exposing the consumer
+// groups of their Kafka clusters
+type consumerGroupsProvider interface {
+	// GetConsumerGroups returns the consumer groups of a cluster
+	GetConsumerGroups(clusterID string) ([]string, error)
+	// GetConsumerGroupTopics returns the topics a consumer group consumes
+	GetConsumerGroupTopics(clusterID, group string) ([]string, error)
+	// GetConsumerGroupMetrics returns the given metrics of the consumption
+	// of topic by the clients of group
+	GetConsumerGroupMetrics(clusterID, group, topic string, names []string) ([]consumerMetrics, error)
+}
+
+// instaclustrProvider collects from the Instaclustr Provisioning and Monitoring APIs
+type instaclustrProvider struct {
+	provisioningClient *instaclustr.ProvisioningClient
+	monitoringClient   *instaclustr.MonitoringClient
+	// user is the account, along with its API URL
+	user string
+	// probeMaintenance lets the first request of every collection start a
+	// maintenance, the clusters being pinned instead of listed
+	probeMaintenance bool
+}
+
+func newInstaclustrProvider(cfg instaclustr.Config) *instaclustrProvider {
+	return &instaclustrProvider{
+		provisioningClient: instaclustr.NewProvisioningClient(cfg),
+		monitoringClient:   instaclustr.NewMonitoringClient(cfg),
+		user:               cfg.Url + " " + cfg.User,
+	}
+}
+
+func (p *instaclustrProvider) withContext(ctx context.Context) provider {
+	pc := p.provisioningClient.WithContext(ctx)
+	if p.probeMaintenance {
+		pc = pc.WithMaintenanceProbe()
+	}
+	return &instaclustrProvider{
+		provisioningClient: pc,
+		monitoringClient:   p.monitoringClient.WithContext(ctx),
+		user:               p.user,
+		probeMaintenance:   p.probeMaintenance,
+	}
+}
+
+func (p *instaclustrProvider) account() string {
+	return p.user
+}
+
+func (p *instaclustrProvider) ListClusters() ([]cluster, error) {
+	data, err := p.provisioningClient.GetClusters()
+	if err != nil {
+		return nil, err
+	}
+	clusters := []cluster{}
+	if err := json.Unmarshal(data, &clusters); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+func (p *instaclustrProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	dcs := new(datacentres)
+	if err := p.provisioningClient.DecodeClusterStatus(clusterID, dcs); err != nil {
+		return nil, err
+	}
+	return withAddons(dcs.Dcs, dcs.AddonBundles), nil
+}
+
+// DescribeCluster returns the attributes of a cluster along with its
+// topology, out of its status alone
+func (p *instaclustrProvider) DescribeCluster(clusterID string) (cluster, []datacentre, error) {
+	status := new(clusterStatus)
+	if err := p.provisioningClient.DecodeClusterStatus(clusterID, status); err != nil {
+		return cluster{}, nil, err
+	}
+	return status.cluster(clusterID), withAddons(status.Dcs, status.AddonBundles), nil
+}
+
+// GetNodeMetrics queries the node level ("n::") metrics of the Monitoring API
+func (p *instaclustrProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return p.getNodeMetrics(nodeID, "n::", names)
+}
+
+// GetProductNodeMetrics queries the metrics of another product than
+// Cassandra, e.g. the Kafka broker ("k::") metrics of the Monitoring API
+func (p *instaclustrProvider) GetProductNodeMetrics(nodeID, prefix string, names []string) ([]metrics, error) {
+	return p.getNodeMetrics(nodeID, prefix, names)
+}
+
+// GetTableMetrics queries the table ("cf::") metrics of the Monitoring API
+func (p *instaclustrProvider) GetTableMetrics(nodeID string, tables []table, names []string) ([]metrics, error) {
+	query := make([]string, 0, len(tables)*len(names))
+	for _, t := range tables {
+		for _, name := range names {
+			query = append(query, t.Keyspace+"::"+t.Table+"::"+name)
+		}
+	}
+	return p.getNodeMetrics(nodeID, "cf::", query)
+}
+
+func (p *instaclustrProvider) getNodeMetrics(nodeID, prefix string, names []string) ([]metrics, error) {
+	data, err := p.monitoringClient.GetNodeMetric(nodeID, strings.Join(prefixed(prefix, names), ","))
+	if apiErr, ok := err.(*instaclustr.APIError); ok && apiErr.Status == http.StatusNotFound {
+		return nil, errNodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseNodeMetrics(data)
+}
+
+func (p *instaclustrProvider) GetRepairs(clusterID string) ([]repair, error) {
+	data, err := p.provisioningClient.GetClusterRepairs(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	repairs := []repair{}
+	if err := json.Unmarshal(data, &repairs); err != nil {
+		return nil, err
+	}
+	return repairs, nil
+}
+
+func (p *instaclustrProvider) GetEvents(clusterID string) ([]clusterEvent, error) {
+	data, err := p.provisioningClient.GetClusterEvents(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	events := []clusterEvent{}
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (p *instaclustrProvider) GetConsumerGroups(clusterID string) ([]string, error) {
+	return p.getNames(p.monitoringClient.GetConsumerGroups(clusterID))
+}
+
+func (p *instaclustrProvider) GetConsumerGroupTopics(clusterID, group string) ([]string, error) {
+	return p.getNames(p.monitoringClient.GetConsumerGroupTopics(clusterID, group))
+}
+
+// getNames decodes the list of names of a response
+func (p *instaclustrProvider) getNames(data []byte, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func (p *instaclustrProvider) GetConsumerGroupMetrics(clusterID, group, topic string, names []string) ([]consumerMetrics, error) {
+	data, err := p.monitoringClient.GetConsumerGroupMetrics(clusterID, group, topic, strings.Join(names, ","))
+	if err != nil {
+		return nil, err
+	}
+	cms := []consumerMetrics{}
+	if err := json.Unmarshal(data, &cms); err != nil {
+		return nil, err
+	}
+	return cms, nil
+}
@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeProvider is a provider without repairs nor events
+type fakeProvider struct{}
+
+func (fakeProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "c1", Name: "cluster", NodeCount: 1, RunningNodeCount: 1, DerivedStatus: "RUNNING"}}, nil
+}
+
+func (fakeProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	return []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Rack: "r1", Status: "RUNNING"}}}}, nil
+}
+
+func (fakeProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return []metrics{{Metrics: []metric{
+		{Name: "cpuUtilization", Values: []metricValue{{Value: "42", Time: "2017-07-03T09:37:04.000Z"}}},
+	}}}, nil
+}
+
+func TestProviderSchema(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{Profile: ProfileFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			got[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"instaclustr_cluster_info":                     1,
+		"instaclustr_cluster_running":                  1,
+		"instaclustr_node_info":                        1,
+		"instaclustr_node_running":                     1,
+		"cassandra_node_cpu_utilization_percentage":    42,
+		"cassandra_node_last_sample_timestamp_seconds": 1499074624,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", name, v, ok, value)
+		}
+	}
+	for _, name := range []string{"cassandra_table_repair_status", "instaclustr_node_operations_total"} {
+		if _, ok := got[name]; ok {
+			t.Errorf("%s exported by a provider without it", name)
+		}
+	}
+}
+
+func TestDisableNodeMetrics(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{Profile: ProfileFull, DisableNodeMetrics: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			got[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	if v, ok := got["instaclustr_exporter_monitoring_disabled"]; !ok || v != 1 {
+		t.Errorf("instaclustr_exporter_monitoring_disabled: got %v (found %v) want 1", v, ok)
+	}
+	if _, ok := got["instaclustr_node_running"]; !ok {
+		t.Errorf("Topology not exported")
+	}
+	if _, ok := got["cassandra_node_cpu_utilization_percentage"]; ok {
+		t.Errorf("Node metrics exported")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	e, err := newExporter(newInstaclustrProvider(instaclustr.Config{Url: server.URL}), ExporterOptions{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			for range ch {
+			}
+		}()
+		e.Collect(ch)
+		close(ch)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Collection outlived its timeout")
+	}
+	if summary, ok := e.LastScrape(); !ok || summary.Errors == 0 {
+		t.Errorf("Got summary %+v of an interrupted collection", summary)
+	}
+}
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Nodes not seen for this long are forgotten, e.g. decommissioned ones
+const provisioningForgetAfter = time.Hour
+
+// provisioningStates are the statuses of the nodes being provisioned
+var provisioningStates = map[string]bool{"PROVISIONING": true, "PROVISIONED": true}
+
+var nodeProvisioningDuration = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "node", "provisioning_duration_seconds"),
+	"Seconds since the exporter first saw the node provisioning, for nodes never seen RUNNING yet.",
+	[]string{"nodeId"},
+	nil,
+)
+
+type provisioningNode struct {
+	firstSeen time.Time
+	lastSeen  time.Time
+	// done is set once the node is seen RUNNING, or when it's first seen
+	// in a state other than provisioning, e.g. a node already there and
+	// stopped when the exporter starts
+	done bool
+}
+
+// provisioningTracker remembers when every node was first seen, to tell how
+// long the ones first seen provisioning that never ran have been
+// provisioning. Nodes already provisioning when the exporter starts count
+// from then.
+type provisioningTracker struct {
+	mu    sync.Mutex
+	clock common.Clock
+	nodes map[string]*provisioningNode
+}
+
+func newProvisioningTracker(clock common.Clock) *provisioningTracker {
+	return &provisioningTracker{clock: clock, nodes: make(map[string]*provisioningNode)}
+}
+
+// observe records the status of n, returning how long it has been
+// provisioning and false once it has been seen RUNNING, or if it wasn't
+// provisioning when first seen
+func (pt *provisioningTracker) observe(n node) (time.Duration, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	now := pt.clock.Now()
+	pn, ok := pt.nodes[n.ID]
+	if !ok {
+		pn = &provisioningNode{firstSeen: now, done: !provisioningStates[n.Status]}
+		pt.nodes[n.ID] = pn
+	}
+	pn.lastSeen = now
+	if n.Status == "RUNNING" {
+		pn.done = true
+	}
+	if pn.done {
+		return 0, false
+	}
+	return now.Sub(pn.firstSeen), true
+}
+
+// evict forgets the nodes not seen for provisioningForgetAfter, once per
+// collection
+func (pt *provisioningTracker) evict() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	now := pt.clock.Now()
+	for id, pn := range pt.nodes {
+		if now.Sub(pn.lastSeen) > provisioningForgetAfter {
+			delete(pt.nodes, id)
+		}
+	}
+}
+
+func (pt *provisioningTracker) collect(n node, ch chan<- prometheus.Metric) {
+	if d, ok := pt.observe(n); ok {
+		ch <- prometheus.MustNewConstMetric(nodeProvisioningDuration, prometheus.GaugeValue, d.Seconds(), n.ID)
+	}
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+func TestProvisioningTracker(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 3, 9, 0, 0, 0, time.UTC))
+	pt := newProvisioningTracker(clock)
+	steps := []struct {
+		advance  time.Duration
+		status   string
+		expected time.Duration
+		ok       bool
+	}{
+		{0, "PROVISIONING", 0, true},
+		{5 * time.Minute, "PROVISIONING", 5 * time.Minute, true},
+		{5 * time.Minute, "PROVISIONED", 10 * time.Minute, true},
+		{time.Minute, "RUNNING", 0, false},
+		// A node that ran isn't provisioning when it stops
+		{time.Minute, "FAILED", 0, false},
+		// Forgotten after an hour without being seen, then seen as new
+		{2 * time.Hour, "PROVISIONING", 0, true},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		pt.evict()
+		d, ok := pt.observe(node{ID: "n1", Status: s.status})
+		if d != s.expected || ok != s.ok {
+			t.Errorf("Step %d (%s): got (%v, %v) want (%v, %v)", i, s.status, d, ok, s.expected, s.ok)
+		}
+	}
+}
+
+func TestProvisioningTrackerFirstSeenStopped(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 3, 9, 0, 0, 0, time.UTC))
+	pt := newProvisioningTracker(clock)
+	for i, status := range []string{"FAILED", "PROVISIONING"} {
+		clock.Advance(time.Minute)
+		if d, ok := pt.observe(node{ID: "n1", Status: status}); ok {
+			t.Errorf("Step %d (%s): node first seen %s reported provisioning for %v", i, status, "FAILED", d)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// quietWindow is a period the InstaClustr API must not be polled, e.g. the
+// maintenance windows of the provider. It starts every minute matching its
+// cron fields and lasts duration.
+type quietWindow struct {
+	fields   [5][]bool
+	duration time.Duration
+}
+
+// Minimum and maximum values of the minute, hour, day of month, month and
+// day of week (0 is Sunday) cron fields
+var cronBounds = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseQuietWindow parses a "<minute> <hour> <day of month> <month> <day of
+// week> <duration>" spec, e.g. "0 2 * * 0 4h" for Sundays from 02:00 to
+// 06:00 UTC. Cron fields support *, lists, ranges and steps. Unlike cron,
+// the day of month and day of week must both match.
+func parseQuietWindow(spec string) (quietWindow, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != 6 {
+		return quietWindow{}, fmt.Errorf("quiet window %q: expected 5 cron fields and a duration", spec)
+	}
+	w := quietWindow{}
+	for i, bounds := range cronBounds {
+		field, err := parseCronField(parts[i], bounds[0], bounds[1])
+		if err != nil {
+			return quietWindow{}, fmt.Errorf("quiet window %q: %v", spec, err)
+		}
+		w.fields[i] = field
+	}
+	d, err := time.ParseDuration(parts[5])
+	if err != nil || d < time.Minute {
+		return quietWindow{}, fmt.Errorf("quiet window %q: invalid duration %q, expected at least 1m", spec, parts[5])
+	}
+	w.duration = d
+	return w, nil
+}
+
+// parseCronField returns which values between min and max the field matches
+func parseCronField(field string, min, max int) ([]bool, error) {
+	matches := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			to = from
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range %q", part)
+				}
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			matches[v] = true
+		}
+	}
+	return matches, nil
+}
+
+// starts tells whether the window starts at the minute of t
+func (w quietWindow) starts(t time.Time) bool {
+	values := [5]int{t.Minute(), t.Hour(), t.Day(), int(t.Month()), int(t.Weekday())}
+	for i, v := range values {
+		if !w.fields[i][v] {
+			return false
+		}
+	}
+	return true
+}
+
+// active tells whether t is within the window
+func (w quietWindow) active(t time.Time) bool {
+	t = t.UTC().Truncate(time.Minute)
+	for d := time.Duration(0); d < w.duration; d += time.Minute {
+		if w.starts(t.Add(-d)) {
+			return true
+		}
+	}
+	return false
+}
+
+// quietSchedule are the windows the exporter serves the metrics of the last
+// collection instead of polling the API
+type quietSchedule struct {
+	windows []quietWindow
+	mode    prometheus.Gauge
+}
+
+func newQuietSchedule(specs []string) (*quietSchedule, error) {
+	q := &quietSchedule{
+		mode: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "instaclustr_exporter",
+			Name:      "quiet_mode",
+			Help:      "Whether the exporter is within a quiet window, serving the metrics of the last collection without polling the API.",
+		}),
+	}
+	for _, spec := range specs {
+		w, err := parseQuietWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		q.windows = append(q.windows, w)
+	}
+	return q, nil
+}
+
+func (q *quietSchedule) enabled() bool {
+	return len(q.windows) > 0
+}
+
+// active tells whether t is within any of the windows
+func (q *quietSchedule) active(t time.Time) bool {
+	for _, w := range q.windows {
+		if w.active(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// record forwards every metric sent to the returned channel to ch. The
+// returned function closes the channel and returns the forwarded metrics.
+func record(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func() []prometheus.Metric) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	var recorded []prometheus.Metric
+	go func() {
+		for m := range in {
+			recorded = append(recorded, m)
+			ch <- m
+		}
+		close(done)
+	}()
+	return in, func() []prometheus.Metric {
+		close(in)
+		<-done
+		return recorded
+	}
+}
@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestQuietWindowActive(t *testing.T) {
+	w, err := parseQuietWindow("0 2 * * 0 4h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		time     string
+		expected bool
+	}{
+		{"2017-07-02T01:59:00Z", false}, // Sunday
+		{"2017-07-02T02:00:00Z", true},
+		{"2017-07-02T05:59:59Z", true},
+		{"2017-07-02T06:00:00Z", false},
+		{"2017-07-03T03:00:00Z", false}, // Monday
+		{"2017-07-02T04:00:00+02:00", true},
+	}
+	for _, c := range cases {
+		tm, _ := time.Parse(time.RFC3339, c.time)
+		if got := w.active(tm); got != c.expected {
+			t.Errorf("%s: got %v want %v", c.time, got, c.expected)
+		}
+	}
+}
+
+func TestParseQuietWindow(t *testing.T) {
+	valid := []string{"*/15 * * * * 5m", "0 0 1,15 * 1-5 1h", "30 22 * 12 6 90m"}
+	for _, spec := range valid {
+		if _, err := parseQuietWindow(spec); err != nil {
+			t.Errorf("%q: %v", spec, err)
+		}
+	}
+	invalid := []string{"", "0 2 * * 0", "60 * * * * 1h", "* * 0 * * 1h", "* * * * 7 1h", "5-1 * * * * 1h", "*/0 * * * * 1h", "* * * * * 30s", "a * * * * 1h"}
+	for _, spec := range invalid {
+		if _, err := parseQuietWindow(spec); err == nil {
+			t.Errorf("%q should be invalid", spec)
+		}
+	}
+}
+
+// countingProvider counts the clusters listings
+type countingProvider struct {
+	fakeProvider
+	calls int64
+}
+
+func (p *countingProvider) ListClusters() ([]cluster, error) {
+	atomic.AddInt64(&p.calls, 1)
+	return p.fakeProvider.ListClusters()
+}
+
+func TestQuietMode(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 2, 1, 0, 0, 0, time.UTC))
+	prov := &countingProvider{}
+	e, err := newExporter(prov, ExporterOptions{Clock: clock, QuietWindows: []string{"0 2 * * 0 4h"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	gather := func() map[string]float64 {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				got[mf.GetName()] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+			}
+		}
+		return got
+	}
+
+	polled := gather()
+	if polled["instaclustr_exporter_quiet_mode"] != 0 || prov.calls != 1 {
+		t.Fatalf("out of the window: quiet mode %v, %d calls", polled["instaclustr_exporter_quiet_mode"], prov.calls)
+	}
+
+	clock.Advance(2 * time.Hour)
+	quiet := gather()
+	if quiet["instaclustr_exporter_quiet_mode"] != 1 || prov.calls != 1 {
+		t.Fatalf("within the window: quiet mode %v, %d calls", quiet["instaclustr_exporter_quiet_mode"], prov.calls)
+	}
+	for _, name := range []string{"instaclustr_cluster_running", "cassandra_node_cpu_utilization_percentage"} {
+		if _, ok := quiet[name]; !ok || quiet[name] != polled[name] {
+			t.Errorf("%s: got %v want the last collection's %v", name, quiet[name], polled[name])
+		}
+	}
+}
+
+func TestCachedOnlyWhenServedAgain(t *testing.T) {
+	cases := []struct {
+		opts     ExporterOptions
+		expected bool
+	}{
+		{ExporterOptions{}, false},
+		{ExporterOptions{QuietWindows: []string{"0 2 * * 0 4h"}}, true},
+		{ExporterOptions{MaintenanceCache: true}, true},
+	}
+	for _, c := range cases {
+		e, err := newExporter(fakeProvider{}, c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Gather(); err != nil {
+			t.Fatal(err)
+		}
+		e.mu.Lock()
+		cached := len(e.cached) > 0
+		e.mu.Unlock()
+		if cached != c.expected {
+			t.Errorf("%+v: metrics kept %v, want %v", c.opts, cached, c.expected)
+		}
+	}
+}
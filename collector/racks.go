@@ -0,0 +1,41 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var datacentreRackLossTolerant = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "datacentre", "rack_loss_tolerant"),
+	"Whether losing any single rack of the datacentre keeps a QUORUM of the replicas of every token range. Only exported when the API returns the replication factor.",
+	[]string{"clusterId", "dcId"},
+	nil,
+)
+
+// rackLossTolerant tells whether a QUORUM of the rf replicas of every token
+// range survives losing any single rack of dc. Cassandra spreads the replicas
+// across racks, so a rack holds at most ceil(rf/racks) of them.
+func rackLossTolerant(dc datacentre, rf int) bool {
+	racks := map[string]bool{}
+	for _, n := range dc.Nodes {
+		racks[n.Rack] = true
+	}
+	if len(racks) == 0 || len(dc.Nodes) < rf {
+		return false
+	}
+	lost := (rf + len(racks) - 1) / len(racks)
+	return rf-lost >= rf/2+1
+}
+
+// rackCollector exports the failure domain awareness of the datacentres
+// whose replication factor is known
+func rackCollector(c cluster, dcs []datacentre, ch chan<- prometheus.Metric) {
+	for _, dc := range dcs {
+		rf := int(dc.ReplicationFactor)
+		if rf <= 0 {
+			continue
+		}
+		v := 0.0
+		if rackLossTolerant(dc, rf) {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(datacentreRackLossTolerant, prometheus.GaugeValue, v, c.ID, dc.ID)
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import "testing"
+
+func TestRackLossTolerant(t *testing.T) {
+	nodes := func(racks ...string) []node {
+		ns := make([]node, len(racks))
+		for i, r := range racks {
+			ns[i] = node{ID: r + string(rune('a'+i)), Rack: r}
+		}
+		return ns
+	}
+	cases := []struct {
+		name     string
+		nodes    []node
+		rf       int
+		expected bool
+	}{
+		{"3 racks rf 3", nodes("r1", "r2", "r3"), 3, true},
+		{"6 nodes in 3 racks rf 3", nodes("r1", "r1", "r2", "r2", "r3", "r3"), 3, true},
+		{"1 rack rf 3", nodes("r1", "r1", "r1"), 3, false},
+		{"2 racks rf 3", nodes("r1", "r1", "r2"), 3, false},
+		{"2 racks rf 2", nodes("r1", "r2"), 2, false},
+		{"3 racks rf 5", nodes("r1", "r1", "r2", "r2", "r3"), 5, true},
+		{"fewer nodes than rf", nodes("r1", "r2"), 3, false},
+		{"rf 1", nodes("r1", "r2", "r3"), 1, false},
+	}
+	for _, c := range cases {
+		if got := rackLossTolerant(datacentre{Nodes: c.nodes}, c.rf); got != c.expected {
+			t.Errorf("%s: got %v want %v", c.name, got, c.expected)
+		}
+	}
+}
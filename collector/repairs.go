@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	clusterLastRepairTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "last_repair_timestamp_seconds"),
+		"Unix time of the last completed Instaclustr managed repair across all the tables of the cluster.",
+		[]string{"clusterId"},
+		nil,
+	)
+	tableLastRepairTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "table", "last_repair_timestamp_seconds"),
+		"Unix time of the last completed Instaclustr managed repair of the table.",
+		[]string{"clusterId", "keyspace", "table"},
+		nil,
+	)
+	tableRepairStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "table", "repair_status"),
+		"Status of the last Instaclustr managed repair of the table.",
+		[]string{"clusterId", "keyspace", "table", "status"},
+		nil,
+	)
+)
+
+type repair struct {
+	Keyspace    string `json:"keyspace"`
+	Table       string `json:"table"`
+	Status      string `json:"status"`
+	CompletedAt string `json:"completedAt"`
+}
+
+// repairCollector exports the managed repairs of a cluster, returning them.
+// Not every account exposes them, so a response that can't be decoded is only
+// logged at debug level.
+func (e *Exporter) repairCollector(s *scrape, c cluster, ch chan<- prometheus.Metric) []repair {
+	rp, ok := e.providerFor(s).(repairsProvider)
+	if !ok {
+		return nil
+	}
+	repairs, err := rp.GetRepairs(c.ID)
+	s.called("GetRepairs", err)
+	if err != nil {
+		log.Debugf("Repair status not available for cluster %s: %v", c.ID, err)
+		return nil
+	}
+
+	var last time.Time
+	for _, t := range lastRepairs(repairs) {
+		ch <- prometheus.MustNewConstMetric(
+			tableRepairStatus,
+			prometheus.GaugeValue,
+			1,
+			c.ID,
+			t.Keyspace,
+			t.Table,
+			t.Status,
+		)
+		if t.completedAt.IsZero() {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			tableLastRepairTimestamp,
+			prometheus.GaugeValue,
+			float64(t.completedAt.Unix()),
+			c.ID,
+			t.Keyspace,
+			t.Table,
+		)
+		if t.completedAt.After(last) {
+			last = t.completedAt
+		}
+	}
+
+	if !last.IsZero() {
+		ch <- prometheus.MustNewConstMetric(
+			clusterLastRepairTimestamp,
+			prometheus.GaugeValue,
+			float64(last.Unix()),
+			c.ID,
+		)
+	}
+	return repairs
+}
+
+// tableRepair is the last repair of a table, along with its last completion
+type tableRepair struct {
+	repair
+	completedAt time.Time
+}
+
+// lastRepairs returns the last repair of every table of repairs, in the order
+// they're first listed, so tables repaired several times are exported once.
+// Repairs not completed yet are the last ones, the others are ordered by
+// their completion.
+func lastRepairs(repairs []repair) []*tableRepair {
+	var tables []*tableRepair
+	byTable := map[table]*tableRepair{}
+	for _, r := range repairs {
+		var completedAt time.Time
+		if r.CompletedAt != "" {
+			var err error
+			if completedAt, err = time.Parse(time.RFC3339Nano, r.CompletedAt); err != nil {
+				log.Errorf("Error parsing repair completion time %s: %v", r.CompletedAt, err)
+			}
+		}
+		t, ok := byTable[table{r.Keyspace, r.Table}]
+		if !ok {
+			t = &tableRepair{repair: r, completedAt: completedAt}
+			byTable[table{r.Keyspace, r.Table}] = t
+			tables = append(tables, t)
+			continue
+		}
+		if r.CompletedAt == "" || (t.CompletedAt != "" && completedAt.After(t.completedAt)) {
+			t.repair = r
+		}
+		if completedAt.After(t.completedAt) {
+			t.completedAt = completedAt
+		}
+	}
+	return tables
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeRepairsProvider lists a table repaired several times, once in progress
+type fakeRepairsProvider struct {
+	fakeProvider
+}
+
+func (fakeRepairsProvider) GetRepairs(clusterID string) ([]repair, error) {
+	return []repair{
+		{Keyspace: "shop", Table: "orders", Status: "COMPLETED", CompletedAt: "2017-07-03T09:00:00Z"},
+		{Keyspace: "shop", Table: "orders", Status: "COMPLETED", CompletedAt: "2017-07-04T09:00:00Z"},
+		{Keyspace: "shop", Table: "orders", Status: "COMPLETED", CompletedAt: "2017-07-02T09:00:00Z"},
+		{Keyspace: "shop", Table: "carts", Status: "FAILED", CompletedAt: "2017-07-01T09:00:00Z"},
+		{Keyspace: "shop", Table: "carts", Status: "RUNNING"},
+	}, nil
+}
+
+func TestRepairCollector(t *testing.T) {
+	e, err := newExporter(fakeRepairsProvider{}, ExporterOptions{RepairStatus: true, DisableNodeMetrics: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed on repeated repairs: %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			key := mf.GetName()
+			for _, name := range []string{"table", "status"} {
+				if v, ok := labels[name]; ok {
+					key += " " + v
+				}
+			}
+			got[key] = m.GetGauge().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_table_repair_status orders COMPLETED":       1,
+		"cassandra_table_repair_status carts RUNNING":          1,
+		"cassandra_table_last_repair_timestamp_seconds orders": 1499158800,
+		"cassandra_table_last_repair_timestamp_seconds carts":  1498899600,
+		"cassandra_cluster_last_repair_timestamp_seconds":      1499158800,
+	}
+	for key, value := range expected {
+		if v, ok := got[key]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", key, v, ok, value)
+		}
+	}
+	if _, ok := got["cassandra_table_repair_status carts FAILED"]; ok {
+		t.Error("The status of a repair superseded by a running one is exported")
+	}
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// nodeFetch is a node whose metrics are to be fetched, along with the
+// channel its metrics go to and the tables whose metrics are fetched too
+type nodeFetch struct {
+	c      cluster
+	n      node
+	ch     chan<- prometheus.Metric
+	tables []table
+}
+
+// retryQueue holds the nodes whose metrics couldn't be fetched, so they get a
+// second chance at the end of the scrape, once transient throttling may
+// have passed
+type retryQueue struct {
+	mu    sync.Mutex
+	nodes []nodeFetch
+}
+
+func (q *retryQueue) add(f nodeFetch) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.nodes = append(q.nodes, f)
+}
+
+// drain returns the queued nodes, emptying the queue
+func (q *retryQueue) drain() []nodeFetch {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	nodes := q.nodes
+	q.nodes = nil
+	return nodes
+}
+
+func newNodeRetries() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "instaclustr_exporter",
+		Name:      "node_retries_total",
+		Help:      "Number of node metrics requests retried at the end of the scrape after failing, by result of the retry.",
+	}, []string{"result"})
+}
+
+// monitoringDurations is the histogram of the node metrics request durations
+// by cluster, tracking the clusters observed so the ones no longer listed are
+// dropped
+type monitoringDurations struct {
+	*prometheus.HistogramVec
+	mu       sync.Mutex
+	clusters map[string]bool
+}
+
+func newMonitoringDurations() *monitoringDurations {
+	return &monitoringDurations{
+		HistogramVec: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "instaclustr",
+			Subsystem: "monitoring",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the Monitoring API requests for the metrics of a node, including the retries of the API client, by cluster of the node.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		}, []string{"clusterId"}),
+		clusters: map[string]bool{},
+	}
+}
+
+// observe records the duration of a request for a node of clusterID
+func (d *monitoringDurations) observe(clusterID string, duration time.Duration) {
+	d.mu.Lock()
+	d.clusters[clusterID] = true
+	d.mu.Unlock()
+	d.WithLabelValues(clusterID).Observe(duration.Seconds())
+}
+
+// retain drops the durations of the clusters no longer listed
+func (d *monitoringDurations) retain(clusters []cluster) {
+	listed := make(map[string]bool, len(clusters))
+	for _, c := range clusters {
+		listed[c.ID] = true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.clusters {
+		if !listed[id] {
+			d.DeleteLabelValues(id)
+			delete(d.clusters, id)
+		}
+	}
+}
+
+// fetchNodeMetrics queries the metrics of n, the ones of its product for the
+// clusters other than Cassandra
+func (e *Exporter) fetchNodeMetrics(s *scrape, c cluster, n node) (ms []metrics, err error) {
+	s.apiCall(monitoringAPI)
+	start := e.clock.Now()
+	defer func() {
+		s.called("GetNodeMetrics", err)
+		e.nodeDurations.observe(c.ID, e.clock.Now().Sub(start))
+	}()
+	if p := productOf(c); p != nil {
+		return e.fetchProductNodeMetrics(s, p, n)
+	}
+	return e.providerFor(s).GetNodeMetrics(n.ID, e.nodeMetrics)
+}
+
+// retryNodes fetches the queued nodes once more, the ones failing again are skipped
+func (e *Exporter) retryNodes(s *scrape, q *retryQueue) {
+	pool := newNodePool(e.nodeConcurrency, func(f nodeFetch) {
+		defer recoverNode(s, f)
+		ms, err := e.fetchNodeMetrics(s, f.c, f.n)
+		if err != nil {
+			e.nodeRetries.WithLabelValues("failure").Inc()
+			if err == errNodeNotFound {
+				e.notFound.add(f.n.ID)
+				collectMonitoringMissing(f.n, true, f.ch)
+			}
+			collectNodeScrapeSuccess(f.n, false, f.ch)
+			s.fail("GetNodeMetrics", f.c.ID, f.n.ID, err)
+			return
+		}
+		e.nodeRetries.WithLabelValues("success").Inc()
+		e.collectNodeMetrics(s, f.c, f.n, ms, f.ch)
+	})
+	for _, f := range q.drain() {
+		pool.add(f)
+	}
+	pool.wait()
+}
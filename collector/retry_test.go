@@ -0,0 +1,147 @@
+package collector
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// flakyProvider fails the first failures node metrics requests
+type flakyProvider struct {
+	fakeProvider
+	mu       sync.Mutex
+	failures int
+}
+
+func (p *flakyProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return nil, errors.New("throttled")
+	}
+	return p.fakeProvider.GetNodeMetrics(nodeID, names)
+}
+
+func TestNodeRetries(t *testing.T) {
+	cases := []struct {
+		failures int
+		cpu      bool
+		success  float64
+		failure  float64
+	}{
+		{0, true, 0, 0},
+		{1, true, 1, 0},
+		{2, false, 0, 1},
+	}
+	for _, c := range cases {
+		e, err := newExporter(&flakyProvider{failures: c.failures}, ExporterOptions{AggregateNodes: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := prometheus.NewPedanticRegistry()
+		if err := r.Register(e); err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpu := false
+		retries := map[string]float64{}
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				switch mf.GetName() {
+				case "cassandra_cluster_cpu_utilization_percentage":
+					cpu = true
+				case "instaclustr_exporter_node_retries_total":
+					retries[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+				}
+			}
+		}
+		if cpu != c.cpu || retries["success"] != c.success || retries["failure"] != c.failure {
+			t.Errorf("%d failures: got cpu %v, %v retries, want %v, %v success and %v failure", c.failures, cpu, retries, c.cpu, c.success, c.failure)
+		}
+		if summary, _ := e.LastScrape(); (summary.Errors > 0) == c.cpu {
+			t.Errorf("%d failures: got %d errors", c.failures, summary.Errors)
+		}
+	}
+}
+
+func TestMonitoringDurations(t *testing.T) {
+	e, err := newExporter(&flakyProvider{failures: 1}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "instaclustr_monitoring_request_duration_seconds" {
+			continue
+		}
+		m := mf.GetMetric()[0]
+		// The failed request and its retry
+		if m.GetLabel()[0].GetValue() != "c1" || m.GetHistogram().GetSampleCount() != 2 {
+			t.Errorf("Got %v, want 2 requests of cluster c1", m)
+		}
+		return
+	}
+	t.Error("instaclustr_monitoring_request_duration_seconds not exported")
+}
+
+// deletedClusterProvider lists c1 until deleted
+type deletedClusterProvider struct {
+	fakeProvider
+	mu      sync.Mutex
+	deleted bool
+}
+
+func (p *deletedClusterProvider) ListClusters() ([]cluster, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.deleted {
+		return nil, nil
+	}
+	return p.fakeProvider.ListClusters()
+}
+
+func TestMonitoringDurationsDeletedCluster(t *testing.T) {
+	prov := &deletedClusterProvider{}
+	e, err := newExporter(prov, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	durations := func() int {
+		mfs, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			if mf.GetName() == "instaclustr_monitoring_request_duration_seconds" {
+				return len(mf.GetMetric())
+			}
+		}
+		return 0
+	}
+	if n := durations(); n != 1 {
+		t.Fatalf("Got the durations of %d clusters, want c1", n)
+	}
+	prov.mu.Lock()
+	prov.deleted = true
+	prov.mu.Unlock()
+	if n := durations(); n != 0 {
+		t.Errorf("Got the durations of %d clusters once c1 deleted, want none", n)
+	}
+}
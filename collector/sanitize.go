@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// What to do with node metric values out of their bounds
+const (
+	// SanitizeKeep exports them as they are
+	SanitizeKeep = "keep"
+	// SanitizeClamp exports the closest bound instead
+	SanitizeClamp = "clamp"
+	// SanitizeDrop drops the series
+	SanitizeDrop = "drop"
+)
+
+var sanitizeModes = []string{SanitizeKeep, SanitizeClamp, SanitizeDrop}
+
+// bounds are the sane values of a metric, in Monitoring API units
+type bounds struct {
+	min, max float64
+}
+
+// Every node metric is a rate, a count or a latency, so never negative, and
+// utilizations are percentages
+var (
+	defaultBounds = bounds{0, math.Inf(1)}
+	metricBounds  = map[string]bounds{
+		"cpuUtilization":  {0, 100},
+		"diskUtilization": {0, 100},
+	}
+)
+
+// sanitizeRule is what to do with the values of a metric out of its bounds
+type sanitizeRule struct {
+	mode   string
+	bounds bounds
+}
+
+// sanitizer clamps or drops absurd values returned by the Monitoring API,
+// e.g. negative latencies
+type sanitizer struct {
+	mode      string
+	rules     map[string]sanitizeRule
+	sanitized *prometheus.CounterVec
+}
+
+func validSanitizeMode(mode string) bool {
+	for _, m := range sanitizeModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// newSanitizer builds a sanitizer with a default mode and per metric rules,
+// keyed by Monitoring API metric name
+func newSanitizer(mode string, rules map[string]string) (*sanitizer, error) {
+	if mode == "" {
+		mode = SanitizeKeep
+	}
+	if !validSanitizeMode(mode) {
+		return nil, fmt.Errorf("unknown sanitize mode %q, expected one of %v", mode, sanitizeModes)
+	}
+	parsed := make(map[string]sanitizeRule, len(rules))
+	for metric, spec := range rules {
+		rule, err := parseSanitizeRule(metric, spec)
+		if err != nil {
+			return nil, err
+		}
+		parsed[metric] = rule
+	}
+	return &sanitizer{
+		mode:  mode,
+		rules: parsed,
+		sanitized: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "instaclustr_exporter",
+			Name:      "sanitized_samples_total",
+			Help:      "Number of node metric values out of their sane bounds, by Monitoring API metric and what was done with them.",
+		}, []string{"metric", "action"}),
+	}, nil
+}
+
+// ParseSanitizeRules parses a comma separated list of metric=rule pairs. A
+// rule is a mode optionally followed by :min:max bounds overriding the
+// default ones, e.g. clientRequestRead=drop:0:60000000.
+func ParseSanitizeRules(s string) (map[string]string, error) {
+	rules := map[string]string{}
+	if s == "" {
+		return rules, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid sanitize rule %q, expected metric=mode[:min:max]", pair)
+		}
+		rules[strings.TrimPrefix(kv[0], "n::")] = kv[1]
+	}
+	return rules, nil
+}
+
+// parseSanitizeRule parses the mode[:min:max] rule of metric, an empty bound
+// is unbounded
+func parseSanitizeRule(metric, spec string) (sanitizeRule, error) {
+	parts := strings.Split(spec, ":")
+	if !validSanitizeMode(parts[0]) {
+		return sanitizeRule{}, fmt.Errorf("unknown sanitize mode %q for %s, expected one of %v", parts[0], metric, sanitizeModes)
+	}
+	rule := sanitizeRule{mode: parts[0], bounds: boundsFor(metric)}
+	switch len(parts) {
+	case 1:
+		return rule, nil
+	case 3:
+		var err error
+		if rule.bounds.min, err = parseBound(parts[1], math.Inf(-1)); err != nil {
+			return sanitizeRule{}, fmt.Errorf("invalid sanitize rule %q for %s: %v", spec, metric, err)
+		}
+		if rule.bounds.max, err = parseBound(parts[2], math.Inf(1)); err != nil {
+			return sanitizeRule{}, fmt.Errorf("invalid sanitize rule %q for %s: %v", spec, metric, err)
+		}
+		if rule.bounds.min > rule.bounds.max {
+			return sanitizeRule{}, fmt.Errorf("invalid sanitize rule %q for %s: min greater than max", spec, metric)
+		}
+		return rule, nil
+	default:
+		return sanitizeRule{}, fmt.Errorf("invalid sanitize rule %q for %s, expected mode[:min:max]", spec, metric)
+	}
+}
+
+func parseBound(s string, unbounded float64) (float64, error) {
+	if s == "" {
+		return unbounded, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func boundsFor(metric string) bounds {
+	if b, ok := metricBounds[metric]; ok {
+		return b
+	}
+	return defaultBounds
+}
+
+func (s *sanitizer) ruleFor(metric string) sanitizeRule {
+	if r, ok := s.rules[metric]; ok {
+		return r
+	}
+	return sanitizeRule{mode: s.mode, bounds: boundsFor(metric)}
+}
+
+// apply returns the sanitized value of m and whether it should be exported.
+// A nil sanitizer keeps every value.
+func (s *sanitizer) apply(m metric, value float64) (float64, bool) {
+	if s == nil {
+		return value, true
+	}
+	r := s.ruleFor(m.Name)
+	if r.mode == SanitizeKeep || math.IsNaN(value) || (value >= r.bounds.min && value <= r.bounds.max) {
+		return value, true
+	}
+	s.sanitized.WithLabelValues(m.Name, r.mode).Inc()
+	if r.mode == SanitizeDrop {
+		return 0, false
+	}
+	return math.Max(r.bounds.min, math.Min(r.bounds.max, value)), true
+}
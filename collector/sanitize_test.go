@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSanitizer(t *testing.T) {
+	s, err := newSanitizer(SanitizeClamp, map[string]string{
+		"diskUtilization":   SanitizeKeep,
+		"clientRequestRead": "drop::1000",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		metric   string
+		value    float64
+		expected float64
+		ok       bool
+	}{
+		{"cpuUtilization", 42, 42, true},
+		{"cpuUtilization", 120, 100, true},
+		{"cpuUtilization", -1, 0, true},
+		{"compactions", -3, 0, true},
+		{"compactions", 1e9, 1e9, true},
+		{"diskUtilization", 120, 120, true},
+		{"clientRequestRead", -5, -5, true},
+		{"clientRequestRead", 5000, 0, false},
+		{"cpuUtilization", math.Inf(1), 100, true},
+	}
+	for _, c := range cases {
+		value, ok := s.apply(metric{Name: c.metric}, c.value)
+		if value != c.expected || ok != c.ok {
+			t.Errorf("%s %v: got (%v, %v) want (%v, %v)", c.metric, c.value, value, ok, c.expected, c.ok)
+		}
+	}
+}
+
+func TestInvalidSanitizeRules(t *testing.T) {
+	for _, spec := range []string{"cut", "drop:1", "drop:a:1", "drop:10:1", "drop:1:2:3"} {
+		if _, err := newSanitizer(SanitizeKeep, map[string]string{"cpuUtilization": spec}); err == nil {
+			t.Errorf("%q should be invalid", spec)
+		}
+	}
+	if _, err := newSanitizer("cut", nil); err == nil {
+		t.Errorf("Unknown sanitize mode should be invalid")
+	}
+}
@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Monitoring API node metric names, e.g. commitLogSize
+var nodeMetricNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*$`)
+
+// nodeMetricSelection are the n:: metrics queried, in place of the ones of
+// the profile, and the descriptors of the extra ones the exporter doesn't
+// know about
+type nodeMetricSelection struct {
+	names []string
+	extra map[string]*prometheus.Desc
+}
+
+// newNodeMetricSelection selects the node metrics of names, with or without
+// their n:: prefix
+func newNodeMetricSelection(names []string) (nodeMetricSelection, error) {
+	known := map[string]bool{nodeStatusMetric: true}
+	for _, name := range allNodeMetrics {
+		known[name] = true
+	}
+	reserved := knownNodeDescNames()
+	s := nodeMetricSelection{extra: map[string]*prometheus.Desc{}}
+	seen := map[string]bool{}
+	// extra metrics by their exported name
+	exported := map[string]string{}
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "n::")
+		if !nodeMetricNamePattern.MatchString(name) {
+			return s, fmt.Errorf("invalid node metric %q, expected a Monitoring API metric name, e.g. commitLogSize", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		s.names = append(s.names, name)
+		if known[name] {
+			continue
+		}
+		desc := newExtraNodeMetricDesc(name)
+		if reserved[descName(desc)] {
+			return s, fmt.Errorf("node metric %q would be exported as %s, which the exporter already exports", name, descName(desc))
+		}
+		if other, ok := exported[snakeCase(name)]; ok {
+			return s, fmt.Errorf("node metrics %q and %q would be exported under the same name", other, name)
+		}
+		exported[snakeCase(name)] = name
+		s.extra[name] = desc
+	}
+	return s, nil
+}
+
+// knownNodeDescNames returns the names of the node metrics the exporter
+// exports on its own, which the extra node metrics can't be exported under
+func knownNodeDescNames() map[string]bool {
+	names := map[string]bool{}
+	for desc := range descSources {
+		names[descName(desc)] = true
+	}
+	for _, desc := range []*prometheus.Desc{
+		newNodeInfoDesc(namespace, nil),
+		nodeRunning,
+		nodeStatus,
+		nodeScrapeSuccess,
+		nodeMonitoringMissing,
+		nodeLastSampleTimestamp,
+		nodeMetricParseError,
+		nodeProvisioningDuration,
+	} {
+		names[descName(desc)] = true
+	}
+	return names
+}
+
+// selects tells whether name is selected, nodeStatus not being queried twice
+// when selected along with ExporterOptions.NodeStatus
+func (s nodeMetricSelection) selects(name string) bool {
+	for _, n := range s.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newExtraNodeMetricDesc returns the descriptor of the n::name metric,
+// cassandra_node_ followed by name in snake case
+func newExtraNodeMetricDesc(name string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", snakeCase(name)),
+		fmt.Sprintf("Value of the n::%s Monitoring API metric, by its type.", name),
+		[]string{"nodeId", "type"},
+		nil,
+	)
+}
+
+// snakeCase turns a camel case metric name into snake case, e.g.
+// commitLogSize into commit_log_size
+func snakeCase(name string) string {
+	var b bytes.Buffer
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
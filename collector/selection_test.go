@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeSelectionProvider returns the node metrics queried, commitLogSize included
+type fakeSelectionProvider struct {
+	fakeProvider
+	queried *[]string
+}
+
+func (p fakeSelectionProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	*p.queried = names
+	return []metrics{{Metrics: []metric{
+		{Name: "cpuUtilization", Type: "percentage", Values: []metricValue{{Value: "42"}}},
+		{Name: "commitLogSize", Type: "count", Values: []metricValue{{Value: "1.5"}}},
+	}}}, nil
+}
+
+func TestNodeMetricSelection(t *testing.T) {
+	var queried []string
+	e, err := newExporter(fakeSelectionProvider{queried: &queried}, ExporterOptions{NodeMetrics: []string{"cpuUtilization", "n::commitLogSize", "commitLogSize"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"cpuUtilization", "commitLogSize"}; !reflect.DeepEqual(queried, expected) {
+		t.Errorf("Queried %v, want %v", queried, expected)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			got[mf.GetName()] = m.GetGauge().GetValue()
+			if mf.GetName() == "cassandra_node_commit_log_size" && m.GetLabel()[1].GetValue() != "count" {
+				t.Errorf("cassandra_node_commit_log_size labels %v, want the count type", m.GetLabel())
+			}
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_node_cpu_utilization_percentage": 42,
+		"cassandra_node_commit_log_size":            1.5,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", name, v, ok, value)
+		}
+	}
+}
+
+func TestNodeMetricSelectionErrors(t *testing.T) {
+	for _, names := range [][]string{{"os load"}, {"n::"}, {"commitLogSize", "CommitLogSize"}, {"running"}, {"info"}, {"status"}, {"readsTotal"}} {
+		if _, err := newNodeMetricSelection(names); err == nil {
+			t.Errorf("%q accepted", names)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"osLoad":         "os_load",
+		"memAvailable":   "mem_available",
+		"cpuUtilization": "cpu_utilization",
+		"compactions":    "compactions",
+	} {
+		if got := snakeCase(name); got != expected {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"context"
+	"sync"
+)
+
+// accountProvider is implemented by providers telling the account they
+// collect, so the collectors of a scrape polling the same account can share
+// what they fetch
+type accountProvider interface {
+	account() string
+}
+
+// sharedTopology is what the collectors of a scrape fetched from the
+// Provisioning API, by account, so one listing of the clusters and one
+// topology per cluster serve all of them. It's safe for concurrent use:
+// collectors asking for what another one is fetching wait for it.
+type sharedTopology struct {
+	mu       sync.Mutex
+	accounts map[string]*accountTopology
+}
+
+// accountTopology is the clusters of an account along with their topology,
+// each fetched once
+type accountTopology struct {
+	list     sync.Once
+	clusters []cluster
+	err      error
+
+	mu         sync.Mutex
+	topologies map[string]*clusterTopology
+}
+
+type clusterTopology struct {
+	once   sync.Once
+	result topologyResult
+}
+
+type sharedTopologyKey struct{}
+
+// WithSharedTopology returns ctx carrying the topology the collectors
+// collecting within it share, e.g. the ones gathered for a scrape
+func WithSharedTopology(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sharedTopologyKey{}, &sharedTopology{accounts: map[string]*accountTopology{}})
+}
+
+// sharedTopologyFrom returns the topology shared within ctx, nil when none is
+func sharedTopologyFrom(ctx context.Context) *sharedTopology {
+	t, _ := ctx.Value(sharedTopologyKey{}).(*sharedTopology)
+	return t
+}
+
+// of returns the topology of the account of prov, nil when there is nothing
+// shared or prov doesn't tell its account
+func (t *sharedTopology) of(prov provider) *accountTopology {
+	ap, ok := prov.(accountProvider)
+	if t == nil || !ok {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	a, ok := t.accounts[ap.account()]
+	if !ok {
+		a = &accountTopology{topologies: map[string]*clusterTopology{}}
+		t.accounts[ap.account()] = a
+	}
+	return a
+}
+
+// listClusters returns the clusters fetch lists, calling it only if no other
+// collector of the scrape did. a may be nil, fetch is always called then.
+func (a *accountTopology) listClusters(fetch func() ([]cluster, error)) ([]cluster, error) {
+	if a == nil {
+		return fetch()
+	}
+	a.list.Do(func() { a.clusters, a.err = fetch() })
+	return a.clusters, a.err
+}
+
+// topology returns the topology of clusterID fetch returns, calling it only
+// if no other collector of the scrape did. a may be nil, fetch is always
+// called then.
+func (a *accountTopology) topology(clusterID string, fetch func() topologyResult) topologyResult {
+	if a == nil {
+		return fetch()
+	}
+	a.mu.Lock()
+	ct, ok := a.topologies[clusterID]
+	if !ok {
+		ct = &clusterTopology{}
+		a.topologies[clusterID] = ct
+	}
+	a.mu.Unlock()
+	ct.once.Do(func() { ct.result = fetch() })
+	return ct.result
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// accountCountingProvider counts the clusters listings of an account
+type accountCountingProvider struct {
+	fakeProvider
+	user     string
+	listings *int64
+}
+
+func (p accountCountingProvider) account() string { return p.user }
+
+func (p accountCountingProvider) ListClusters() ([]cluster, error) {
+	atomic.AddInt64(p.listings, 1)
+	return p.fakeProvider.ListClusters()
+}
+
+func TestSharedTopology(t *testing.T) {
+	var listings, otherListings int64
+	prov := accountCountingProvider{user: "user", listings: &listings}
+	e, err := newExporter(prov, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := newDeltaCollector(prov, accountCountingProvider{user: "other", listings: &otherListings}, "old", "new")
+
+	// The exporter and the delta collected concurrently, like a registry does
+	ctx := WithSharedTopology(context.Background())
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); e.CollectContext(ctx, ch) }()
+	go func() { defer wg.Done(); delta.CollectContext(ctx, ch) }()
+	wg.Wait()
+	close(ch)
+	<-done
+
+	if listings != 1 {
+		t.Errorf("Collected account listed %d times, want once", listings)
+	}
+	if otherListings != 1 {
+		t.Errorf("Compared account listed %d times, want once", otherListings)
+	}
+
+	// Without shared topology, every collector lists
+	e.Collect(make(chan prometheus.Metric, 1000))
+	if listings != 2 {
+		t.Errorf("Collected account listed %d times, want twice", listings)
+	}
+}
+
+func TestSharedTopologyByAccount(t *testing.T) {
+	shared := sharedTopologyFrom(WithSharedTopology(context.Background()))
+	var a, b int64
+	pa := accountCountingProvider{user: "a", listings: &a}
+	pb := accountCountingProvider{user: "b", listings: &b}
+	for i := 0; i < 2; i++ {
+		shared.of(pa).listClusters(pa.ListClusters)
+		shared.of(pb).listClusters(pb.ListClusters)
+	}
+	if a != 1 || b != 1 {
+		t.Errorf("Listed a %d and b %d times, want each once", a, b)
+	}
+	// Providers not telling their account don't share
+	if shared.of(fakeProvider{}) != nil {
+		t.Error("Topology shared with a provider of unknown account")
+	}
+}
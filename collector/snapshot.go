@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// Snapshot holds everything a collection fetched from the InstaClustr API
+type Snapshot struct {
+	Time     time.Time          `json:"time"`
+	Clusters []*clusterSnapshot `json:"clusters"`
+	// Partial snapshots miss clusters or topologies the collection couldn't
+	// fetch, e.g. when listing the clusters failed or it was interrupted
+	Partial bool `json:"partial,omitempty"`
+}
+
+type clusterSnapshot struct {
+	cluster
+	DataCentres []datacentre        `json:"dataCentres"`
+	NodeMetrics map[string][]metric `json:"nodeMetrics"`
+}
+
+// snapshotBuilder builds a Snapshot while the node goroutines add their metrics
+type snapshotBuilder struct {
+	mu       sync.Mutex
+	snapshot Snapshot
+	clusters map[string]*clusterSnapshot
+}
+
+func newSnapshotBuilder(t time.Time) *snapshotBuilder {
+	return &snapshotBuilder{
+		snapshot: Snapshot{Time: t, Clusters: []*clusterSnapshot{}},
+		clusters: make(map[string]*clusterSnapshot),
+	}
+}
+
+func (sb *snapshotBuilder) addCluster(c cluster) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	cs := &clusterSnapshot{cluster: c, NodeMetrics: make(map[string][]metric)}
+	sb.clusters[c.ID] = cs
+	sb.snapshot.Clusters = append(sb.snapshot.Clusters, cs)
+}
+
+func (sb *snapshotBuilder) addDataCentres(clusterID string, dcs []datacentre) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if cs, ok := sb.clusters[clusterID]; ok {
+		cs.DataCentres = dcs
+	}
+}
+
+func (sb *snapshotBuilder) addNodeMetrics(clusterID, nodeID string, ms []metrics) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	cs, ok := sb.clusters[clusterID]
+	if !ok {
+		return
+	}
+	for _, mc := range ms {
+		cs.NodeMetrics[nodeID] = append(cs.NodeMetrics[nodeID], mc.Metrics...)
+	}
+}
+
+// setPartial marks the snapshot as partial
+func (sb *snapshotBuilder) setPartial() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.snapshot.Partial = true
+}
+
+func (sb *snapshotBuilder) build() Snapshot {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.snapshot
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace of the metrics of the Spark add-on of Cassandra clusters
+const sparkNamespace = "spark"
+
+// Spark metric descriptors
+var (
+	sparkNodeRoleInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(sparkNamespace, "node", "role_info"),
+		"Spark roles the Provisioning API reports for the node: master, jobserver or zeppelin.",
+		[]string{"clusterId", "nodeId", "role"},
+		nil,
+	)
+	sparkClusterMasterRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(sparkNamespace, "cluster", "master_running"),
+		"Whether or not the node of the Spark master is running.",
+		[]string{"clusterId"},
+		nil,
+	)
+	sparkClusterWorkers = prometheus.NewDesc(
+		prometheus.BuildFQName(sparkNamespace, "cluster", "workers"),
+		"Number of nodes of the datacentres with the Spark add-on, each running a Spark worker.",
+		[]string{"clusterId"},
+		nil,
+	)
+	sparkClusterWorkersRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(sparkNamespace, "cluster", "workers_running"),
+		"Number of nodes of the datacentres with the Spark add-on running.",
+		[]string{"clusterId"},
+		nil,
+	)
+)
+
+func describeSpark(ch chan<- *prometheus.Desc) {
+	ch <- sparkNodeRoleInfo
+	ch <- sparkClusterMasterRunning
+	ch <- sparkClusterWorkers
+	ch <- sparkClusterWorkersRunning
+}
+
+// hasSpark tells whether the cluster of dc has the Spark add-on bundle
+func hasSpark(dc datacentre) bool {
+	for _, b := range dc.AddonBundles {
+		if strings.EqualFold(b.Bundle, "SPARK") {
+			return true
+		}
+	}
+	return false
+}
+
+// sparkRoles returns the Spark roles the Provisioning API reports for n
+func sparkRoles(n node) []string {
+	var roles []string
+	if n.SparkMaster {
+		roles = append(roles, "master")
+	}
+	if n.SparkJobserver {
+		roles = append(roles, "jobserver")
+	}
+	if n.Zeppelin {
+		roles = append(roles, "zeppelin")
+	}
+	return roles
+}
+
+// sparkCollector exports the Spark roles of the nodes of c, and the health
+// of its master and workers as told by the status of their nodes, when c has
+// the Spark add-on
+func sparkCollector(c cluster, dcs []datacentre, ch chan<- prometheus.Metric) {
+	var spark, master bool
+	var workers, running float64
+	for _, dc := range dcs {
+		if !hasSpark(dc) {
+			continue
+		}
+		spark = true
+		for _, n := range dc.Nodes {
+			for _, role := range sparkRoles(n) {
+				ch <- prometheus.MustNewConstMetric(sparkNodeRoleInfo, prometheus.GaugeValue, 1, c.ID, n.ID, role)
+			}
+			workers++
+			if n.Status != "RUNNING" {
+				continue
+			}
+			running++
+			if n.SparkMaster {
+				master = true
+			}
+		}
+	}
+	if !spark {
+		return
+	}
+	v := 0.0
+	if master {
+		v = 1
+	}
+	ch <- prometheus.MustNewConstMetric(sparkClusterMasterRunning, prometheus.GaugeValue, v, c.ID)
+	ch <- prometheus.MustNewConstMetric(sparkClusterWorkers, prometheus.GaugeValue, workers, c.ID)
+	ch <- prometheus.MustNewConstMetric(sparkClusterWorkersRunning, prometheus.GaugeValue, running, c.ID)
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestSparkCollector(t *testing.T) {
+	spark := []addonBundle{{Bundle: "SPARK", Version: "apache-spark:2.1.3"}}
+	dcs := []datacentre{
+		{ID: "dc1", AddonBundles: spark, Nodes: []node{
+			{ID: "n1", Status: "RUNNING", SparkMaster: true, Zeppelin: true},
+			{ID: "n2", Status: "RUNNING", SparkJobserver: true},
+			{ID: "n3", Status: "UNREACHABLE"},
+		}},
+		// Without the Spark add-on, whatever the node flags
+		{ID: "dc2", Nodes: []node{{ID: "n4", Status: "RUNNING", SparkMaster: true}}},
+	}
+	ch := make(chan prometheus.Metric, 100)
+	sparkCollector(cluster{ID: "c1"}, dcs, ch)
+	close(ch)
+
+	roles := map[string]int{}
+	got := map[*prometheus.Desc]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		if m.Desc() != sparkNodeRoleInfo {
+			got[m.Desc()] = pb.GetGauge().GetValue()
+			continue
+		}
+		labels := map[string]string{}
+		for _, l := range pb.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["nodeId"] == "n4" {
+			t.Errorf("Spark role %s of a node of a datacentre without Spark", labels["role"])
+		}
+		roles[labels["role"]]++
+	}
+	expectedRoles := map[string]int{"master": 1, "jobserver": 1, "zeppelin": 1}
+	if !reflect.DeepEqual(roles, expectedRoles) {
+		t.Errorf("Spark roles %v, want the ones the API reports %v", roles, expectedRoles)
+	}
+	expected := map[*prometheus.Desc]float64{
+		sparkClusterMasterRunning:  1,
+		sparkClusterWorkers:        3,
+		sparkClusterWorkersRunning: 2,
+	}
+	for desc, value := range expected {
+		if v, ok := got[desc]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", desc, v, ok, value)
+		}
+	}
+}
+
+func TestSparkCollectorWithoutSpark(t *testing.T) {
+	ch := make(chan prometheus.Metric, 10)
+	sparkCollector(cluster{ID: "c1"}, []datacentre{{ID: "dc1", Nodes: []node{{ID: "n1", Status: "RUNNING"}}}}, ch)
+	close(ch)
+	for m := range ch {
+		t.Errorf("%s exported for a cluster without Spark", m.Desc())
+	}
+}
+
+func TestSparkAddonBundle(t *testing.T) {
+	data := `{"addonBundles": [{"bundle": "SPARK", "version": "apache-spark:2.1.3"}], "dataCentres": [{"id": "dc1", "nodes": [{"id": "n1"}]}]}`
+	status := new(datacentres)
+	if err := json.Unmarshal([]byte(data), status); err != nil {
+		t.Fatal(err)
+	}
+	dcs := withAddons(status.Dcs, status.AddonBundles)
+	if len(dcs) != 1 || !hasSpark(dcs[0]) {
+		t.Errorf("Spark add-on of the cluster not told to its datacentres: %+v", dcs)
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// nodeStatusMetric is the Monitoring API metric telling whether Cassandra is
+// available on a node. It returns "warn", instead of a number, when the node
+// hasn't checked in for the last 30 seconds.
+const nodeStatusMetric = "nodeStatus"
+
+// numericNodeStates name the numeric node states, the other numbers aren't
+// exported
+var numericNodeStates = map[float64]string{1: "up", 0: "down"}
+
+var (
+	nodeStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "status"),
+		"Status of Cassandra on the node returned by the Monitoring API, by state: up, down or the one returned instead of a number, e.g. warn. The value is the one configured for the state, 1 for up and 0 for down otherwise, 1 for the other states.",
+		[]string{"nodeId", "state"},
+		nil,
+	)
+)
+
+// ParseNodeStatusValues parses a comma separated list of state=value pairs,
+// e.g. warn=0
+func ParseNodeStatusValues(s string) (map[string]float64, error) {
+	values := map[string]float64{}
+	if s == "" {
+		return values, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid node status value %q, expected state=value", pair)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for node status %q: %v", kv[0], err)
+		}
+		values[strings.ToLower(strings.TrimSpace(kv[0]))] = v
+	}
+	return values, nil
+}
+
+// nodeStatusCollector exports the status of n, bypassing the value parser so
+// non-numeric states aren't parse errors. Numeric states are exported under
+// their name, the unknown ones not at all.
+func (e *Exporter) nodeStatusCollector(n node, m metric, ch chan<- prometheus.Metric) {
+	if len(m.Values) == 0 {
+		return
+	}
+	state := strings.ToLower(strings.TrimSpace(string(m.Values[0].Value)))
+	if state == "" {
+		return
+	}
+	v := 1.0
+	if number, err := strconv.ParseFloat(state, 64); err == nil {
+		name, ok := numericNodeStates[number]
+		if !ok {
+			log.Debugf("Unknown status %s of node %s", logValue(state), logValue(n.ID))
+			return
+		}
+		state, v = name, number
+	}
+	if configured, ok := e.statusValues[state]; ok {
+		v = configured
+	}
+	ch <- prometheus.MustNewConstMetric(nodeStatus, prometheus.GaugeValue, v, n.ID, state)
+}
+
+// lowerKeys returns values with its states lowercased, as they are matched
+func lowerKeys(values map[string]float64) map[string]float64 {
+	lowered := make(map[string]float64, len(values))
+	for state, v := range values {
+		lowered[strings.ToLower(state)] = v
+	}
+	return lowered
+}
+
+// describesNodeStatus tells whether the nodeStatus metric is queried
+func (e *Exporter) describesNodeStatus() bool {
+	for _, name := range e.nodeMetrics {
+		if name == nodeStatusMetric {
+			return true
+		}
+	}
+	return false
+}
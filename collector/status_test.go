@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// statusProvider reports the status of its nodes, one of them not checking in
+type statusProvider struct {
+	fakeProvider
+	names []string
+}
+
+func (p *statusProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	p.names = names
+	status := "1"
+	switch nodeID {
+	case "node-uuid-2":
+		status = "WARN"
+	case "node-uuid-3":
+		status = "0"
+	case "node-uuid-4":
+		status = "7"
+	}
+	return []metrics{{Metrics: []metric{{Name: nodeStatusMetric, Values: []metricValue{{Value: flexString(status)}}}}}}, nil
+}
+
+func TestParseNodeStatusValues(t *testing.T) {
+	values, err := ParseNodeStatusValues("warn=0, Down=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["warn"] != 0 || values["down"] != -1 || len(values) != 2 {
+		t.Errorf("Got %v", values)
+	}
+	for _, s := range []string{"warn", "=0", "warn=x"} {
+		if _, err := ParseNodeStatusValues(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestNodeStatus(t *testing.T) {
+	p := &statusProvider{}
+	e, err := newExporter(p, ExporterOptions{NodeStatus: true, NodeStatusValues: map[string]float64{"warn": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 4)
+	for _, id := range []string{"node-uuid-1", "node-uuid-2", "node-uuid-3", "node-uuid-4"} {
+		ms, err := e.provider.GetNodeMetrics(id, e.nodeMetrics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.nodeMetricsCollector(cluster{}, node{ID: id}, ms, ch)
+	}
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		if m.Desc() != nodeStatus {
+			continue
+		}
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		got[pb.GetLabel()[0].GetValue()+"/"+pb.GetLabel()[1].GetValue()] = pb.GetGauge().GetValue()
+	}
+	// Unknown numeric states aren't exported
+	expected := map[string]float64{"node-uuid-1/up": 1, "node-uuid-2/warn": 0, "node-uuid-3/down": 0}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v want %v", got, expected)
+	}
+	if last := p.names[len(p.names)-1]; last != nodeStatusMetric {
+		t.Errorf("nodeStatus not queried: %v", p.names)
+	}
+
+	e, err = newExporter(p, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.describesNodeStatus() {
+		t.Errorf("nodeStatus queried without NodeStatus")
+	}
+}
@@ -0,0 +1,249 @@
+package collector
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstaClustr APIs the collection calls, the endpoint label of apiCallsLastScrape
+const (
+	provisioningAPI = "provisioning"
+	monitoringAPI   = "monitoring"
+)
+
+var (
+	apiCallsLastScrape = prometheus.NewDesc(
+		"instaclustr_exporter_api_calls_last_scrape",
+		"Number of InstaClustr API calls made by the last scrape.",
+		[]string{"endpoint"},
+		nil,
+	)
+	scrapeDuration = prometheus.NewDesc(
+		"instaclustr_exporter_scrape_duration_seconds",
+		"Duration of the last collection from the InstaClustr API.",
+		nil,
+		nil,
+	)
+	lastScrapeSuccess = prometheus.NewDesc(
+		"instaclustr_exporter_last_scrape_success",
+		"Whether the last collection from the InstaClustr API finished without errors.",
+		nil,
+		nil,
+	)
+	clusterScrapeSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "scrape_success"),
+		"Whether the topology of the cluster was fetched by the last collection, the other clusters are collected either way.",
+		[]string{"clusterId"},
+		nil,
+	)
+	apiUp = prometheus.NewDesc(
+		"instaclustr_exporter_api_up",
+		"Whether every call of the InstaClustr API operation made by the last scrape succeeded.",
+		[]string{"operation"},
+		nil,
+	)
+)
+
+// Provider operations the collection calls, the operation label of apiUp
+var apiOperations = []string{"ListClusters", "GetTopology", "GetNodeMetrics", "GetRepairs", "GetEvents", "GetTableMetrics", "GetConsumerGroups"}
+
+// operationCalls counts the calls of an API operation and how many failed
+type operationCalls struct {
+	calls    int64
+	failures int64
+}
+
+// ScrapeSummary describes what a single collection did
+type ScrapeSummary struct {
+	Start    time.Time
+	Duration time.Duration
+	Clusters int64
+	Nodes    int64
+	APICalls int64
+	Errors   int64
+	Series   int64
+	// FailedAPICalls are the APICalls that failed
+	FailedAPICalls int64
+	// Success is the instaclustr_exporter_last_scrape_success of the
+	// collection
+	Success bool
+}
+
+// scrape keeps the counters of an ongoing collection, they are updated
+// concurrently by the node goroutines
+type scrape struct {
+	// provider is the one of the collection, see Exporter.providerFor
+	provider provider
+	// shared is the topology shared with the other collectors of the scrape,
+	// nil when there are none
+	shared *accountTopology
+	// filter limits the clusters collected, nil when every one is
+	filter   *ClusterFilter
+	clock    common.Clock
+	start    time.Time
+	snapshot *snapshotBuilder
+	// queried are the kinds of clusters and the tables queried
+	queried  *querySet
+	failures *failures
+	// recentErrors keeps the errors past the collection, nil if not
+	recentErrors *errorLog
+	clusters     int64
+	nodes        int64
+	apiCalls     int64
+	// apiCalls by endpoint, the map itself is never written once created
+	endpointCalls map[string]*int64
+	errors        int64
+	latency       latencyCoverage
+	series        int64
+	// calls by operation, the map itself is never written once created
+	operations map[string]*operationCalls
+}
+
+func newScrape(clock common.Clock) *scrape {
+	now := clock.Now()
+	s := &scrape{
+		clock:         clock,
+		start:         now,
+		snapshot:      newSnapshotBuilder(now),
+		queried:       newQuerySet(),
+		failures:      newFailures(),
+		endpointCalls: map[string]*int64{provisioningAPI: new(int64), monitoringAPI: new(int64)},
+		operations:    make(map[string]*operationCalls, len(apiOperations)),
+	}
+	for _, op := range apiOperations {
+		s.operations[op] = new(operationCalls)
+	}
+	return s
+}
+
+func (s *scrape) clusterScanned() { atomic.AddInt64(&s.clusters, 1) }
+func (s *scrape) nodeScanned()    { atomic.AddInt64(&s.nodes, 1) }
+func (s *scrape) error()          { atomic.AddInt64(&s.errors, 1) }
+
+// apiCall counts a call to the endpoint API
+func (s *scrape) apiCall(endpoint string) {
+	atomic.AddInt64(&s.apiCalls, 1)
+	atomic.AddInt64(s.endpointCalls[endpoint], 1)
+}
+
+// collectAPICalls exports the API calls made so far by endpoint
+func (s *scrape) collectAPICalls(ch chan<- prometheus.Metric) {
+	for endpoint, calls := range s.endpointCalls {
+		ch <- prometheus.MustNewConstMetric(apiCallsLastScrape, prometheus.GaugeValue, float64(atomic.LoadInt64(calls)), endpoint)
+	}
+}
+
+// called records the outcome of a call of the API operation op. Unknown
+// nodes are an answer of the API, not a failure.
+func (s *scrape) called(op string, err error) {
+	o := s.operations[op]
+	atomic.AddInt64(&o.calls, 1)
+	if err != nil && err != errNodeNotFound {
+		atomic.AddInt64(&o.failures, 1)
+	}
+}
+
+// collectAPIUp exports whether the operations called so far succeeded, the
+// ones not called aren't exported
+func (s *scrape) collectAPIUp(ch chan<- prometheus.Metric) {
+	for _, op := range apiOperations {
+		o := s.operations[op]
+		if atomic.LoadInt64(&o.calls) == 0 {
+			continue
+		}
+		up := 1.0
+		if atomic.LoadInt64(&o.failures) > 0 {
+			up = 0
+		}
+		ch <- prometheus.MustNewConstMetric(apiUp, prometheus.GaugeValue, up, op)
+	}
+}
+
+// collectOutcome exports how long the collection has taken and whether it
+// failed so far
+func (s *scrape) collectOutcome(ch chan<- prometheus.Metric) {
+	success := 0.0
+	if s.succeeded() {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeDuration, prometheus.GaugeValue, s.clock.Now().Sub(s.start).Seconds())
+	ch <- prometheus.MustNewConstMetric(lastScrapeSuccess, prometheus.GaugeValue, success)
+}
+
+// succeeded tells whether the collection has had no error so far
+func (s *scrape) succeeded() bool {
+	return atomic.LoadInt64(&s.errors) == 0
+}
+
+// fail counts an error of op on the kind of object id, logged along with the
+// other failures of op once the collection finishes
+func (s *scrape) fail(op, clusterID, nodeID string, err error) {
+	s.error()
+	kind, id := "cluster", clusterID
+	if nodeID != "" {
+		kind, id = "node", nodeID
+	}
+	s.failures.add(op, kind, id, err)
+	s.recordError(op, clusterID, nodeID, err)
+}
+
+// recordError keeps the error of op in the recent errors of the exporter
+func (s *scrape) recordError(op, clusterID, nodeID string, err error) {
+	if s.recentErrors == nil {
+		return
+	}
+	s.recentErrors.add(CollectionError{
+		Time:      s.clock.Now(),
+		Operation: op,
+		Endpoint:  operationAPIs[op],
+		Cluster:   clusterID,
+		Node:      nodeID,
+		Class:     errorClass(err),
+		Message:   err.Error(),
+	})
+}
+
+// count forwards every metric sent to the returned channel to ch, counting
+// them. The returned function closes the channel and waits for the forwarding
+// to finish.
+func (s *scrape) count(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	counted := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range counted {
+			s.series++
+			ch <- m
+		}
+		close(done)
+	}()
+	return counted, func() {
+		close(counted)
+		<-done
+	}
+}
+
+func (s *scrape) summary() ScrapeSummary {
+	return ScrapeSummary{
+		Start:          s.start,
+		Duration:       s.clock.Now().Sub(s.start),
+		Clusters:       atomic.LoadInt64(&s.clusters),
+		Nodes:          atomic.LoadInt64(&s.nodes),
+		APICalls:       atomic.LoadInt64(&s.apiCalls),
+		Errors:         atomic.LoadInt64(&s.errors),
+		Series:         s.series,
+		FailedAPICalls: s.failedCalls(),
+		Success:        s.succeeded(),
+	}
+}
+
+// failedCalls counts the failed calls of every operation
+func (s *scrape) failedCalls() int64 {
+	var failed int64
+	for _, o := range s.operations {
+		failed += atomic.LoadInt64(&o.failures)
+	}
+	return failed
+}
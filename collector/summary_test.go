@@ -0,0 +1,226 @@
+package collector
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestScrapeSummary(t *testing.T) {
+	start := time.Date(2017, 7, 3, 9, 37, 4, 0, time.UTC)
+	clock := common.NewFakeClock(start)
+	s := newScrape(clock)
+	s.clusterScanned()
+	s.nodeScanned()
+	s.nodeScanned()
+	s.apiCall(monitoringAPI)
+	s.fail("GetNodeMetrics", "cluster-uuid-1", "node-uuid-1", errors.New("timeout"))
+	clock.Advance(1500 * time.Millisecond)
+
+	expected := ScrapeSummary{
+		Start:    start,
+		Duration: 1500 * time.Millisecond,
+		Clusters: 1,
+		Nodes:    2,
+		APICalls: 1,
+		Errors:   1,
+	}
+	if got := s.summary(); got != expected {
+		t.Errorf("got %+v want %+v", got, expected)
+	}
+}
+
+func TestCollectAPICalls(t *testing.T) {
+	s := newScrape(common.SystemClock)
+	s.apiCall(provisioningAPI)
+	s.apiCall(provisioningAPI)
+	s.apiCall(monitoringAPI)
+
+	ch := make(chan prometheus.Metric, 2)
+	s.collectAPICalls(ch)
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		got[pb.GetLabel()[0].GetValue()] = pb.GetGauge().GetValue()
+	}
+	expected := map[string]float64{provisioningAPI: 2, monitoringAPI: 1}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+}
+
+func TestCollectOutcome(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 3, 9, 37, 4, 0, time.UTC))
+	collect := func(s *scrape) []float64 {
+		ch := make(chan prometheus.Metric, 2)
+		s.collectOutcome(ch)
+		close(ch)
+		values := []float64{}
+		for m := range ch {
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, pb.GetGauge().GetValue())
+		}
+		return values
+	}
+
+	s := newScrape(clock)
+	clock.Advance(2 * time.Second)
+	if got := collect(s); !reflect.DeepEqual(got, []float64{2, 1}) {
+		t.Errorf("Successful scrape: got duration and success %v", got)
+	}
+	s.fail("GetTopology", "cluster-uuid-1", "", errors.New("timeout"))
+	if got := collect(s); !reflect.DeepEqual(got, []float64{2, 0}) {
+		t.Errorf("Failed scrape: got duration and success %v", got)
+	}
+}
+
+func TestCollectAPIUp(t *testing.T) {
+	s := newScrape(common.SystemClock)
+	s.called("ListClusters", nil)
+	s.called("GetTopology", nil)
+	s.called("GetTopology", errors.New("timeout"))
+	s.called("GetNodeMetrics", errNodeNotFound)
+
+	ch := make(chan prometheus.Metric, len(apiOperations))
+	s.collectAPIUp(ch)
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		got[pb.GetLabel()[0].GetValue()] = pb.GetGauge().GetValue()
+	}
+	expected := map[string]float64{"ListClusters": 1, "GetTopology": 0, "GetNodeMetrics": 1}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+}
+
+// oneFailingClusterProvider fails to fetch the topology of the first of its
+// two clusters
+type oneFailingClusterProvider struct {
+	fakeProvider
+}
+
+func (oneFailingClusterProvider) ListClusters() ([]cluster, error) {
+	return []cluster{{ID: "c0", Name: "failing"}, {ID: "c1", Name: "cluster"}}, nil
+}
+
+func (p oneFailingClusterProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	if clusterID == "c0" {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	return p.fakeProvider.GetTopology(clusterID)
+}
+
+func TestClusterScrapeSuccess(t *testing.T) {
+	e, err := newExporter(oneFailingClusterProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	success := map[string]float64{}
+	nodes := 0
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "cassandra_cluster_scrape_success":
+				success[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			case "cassandra_node_cpu_utilization_percentage":
+				nodes++
+			}
+		}
+	}
+	if expected := map[string]float64{"c0": 0, "c1": 1}; !reflect.DeepEqual(success, expected) {
+		t.Errorf("Scrape success %v, want %v", success, expected)
+	}
+	if nodes != 1 {
+		t.Errorf("Collected %d nodes after the failing cluster, want 1", nodes)
+	}
+}
+
+func TestPartialSnapshot(t *testing.T) {
+	for _, c := range []struct {
+		provider provider
+		partial  bool
+	}{
+		{fakeProvider{}, false},
+		{oneFailingClusterProvider{}, true},
+	} {
+		e, err := newExporter(c.provider, ExporterOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		snapshots := make(chan Snapshot, 1)
+		e.OnSnapshot(func(s Snapshot) { snapshots <- s })
+		ch := make(chan prometheus.Metric)
+		go func() {
+			e.Collect(ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+		select {
+		case s := <-snapshots:
+			if s.Partial != c.partial {
+				t.Errorf("%T: partial snapshot %v, want %v", c.provider, s.Partial, c.partial)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%T: no snapshot", c.provider)
+		}
+	}
+}
+
+func TestLastScrape(t *testing.T) {
+	e, err := newExporter(fakeProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.LastScrape(); ok {
+		t.Fatal("Summary of a scrape that didn't happen")
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series int64
+	for _, mf := range mfs {
+		series += int64(len(mf.GetMetric()))
+	}
+	summary, ok := e.LastScrape()
+	if !ok {
+		t.Fatal("No summary of the scrape")
+	}
+	if summary.Clusters != 1 || summary.Nodes != 1 || summary.APICalls == 0 || summary.Errors != 0 {
+		t.Errorf("Got %+v, want 1 cluster and node, API calls and no errors", summary)
+	}
+	if summary.Series != series {
+		t.Errorf("Got %d series emitted, want %d", summary.Series, series)
+	}
+}
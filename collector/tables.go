@@ -0,0 +1,196 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// Monitoring API table ("cf::{keyspace}::{table}::") metrics
+var tableMetrics = []string{
+	"readLatency",       //Average latency (us/1) per local read of the table.
+	"writeLatency",      //Average latency (us/1) per local write of the table.
+	"liveSSTableCount",  //Number of SSTables of the table.
+	"liveDiskSpaceUsed", //Bytes of disk used by the live SSTables of the table.
+}
+
+// table is a Cassandra table, by keyspace
+type table struct {
+	Keyspace string
+	Table    string
+}
+
+// tablesProvider is implemented by providers exposing per table metrics
+type tablesProvider interface {
+	// GetTableMetrics returns the latest values of the given metrics of the
+	// tables on a node, errNodeNotFound if the node doesn't exist. Every
+	// metric tells the keyspace and table it's of.
+	GetTableMetrics(nodeID string, tables []table, names []string) ([]metrics, error)
+}
+
+func newTableDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "table", name), help, []string{"nodeId", "keyspace", "table"}, nil)
+}
+
+// Table metric descriptors
+var (
+	tableReadLatency            = newTableDesc("read_latency", "Average latency in seconds per local read of the table on the node.")
+	tableWriteLatency           = newTableDesc("write_latency", "Average latency in seconds per local write of the table on the node.")
+	tableLiveSSTables           = newTableDesc("live_sstables", "Number of SSTables of the table on the node.")
+	tableLiveDiskSpaceUsedBytes = newTableDesc("live_disk_space_used_bytes", "Bytes of disk used by the live SSTables of the table on the node.")
+)
+
+// tableDescs maps the table metrics to their descriptor
+var tableDescs = map[string]*prometheus.Desc{
+	"readLatency":       tableReadLatency,
+	"writeLatency":      tableWriteLatency,
+	"liveSSTableCount":  tableLiveSSTables,
+	"liveDiskSpaceUsed": tableLiveDiskSpaceUsedBytes,
+}
+
+func describeTables(ch chan<- *prometheus.Desc) {
+	for _, d := range tableDescs {
+		ch <- d
+	}
+}
+
+// tableAllowlist are the tables whose metrics are collected, by
+// keyspace.table patterns where either part may be *. The Monitoring API
+// doesn't list the tables of a cluster: the ones of the patterns with a *
+// are discovered from the managed repairs of the cluster only, so tables
+// never repaired, or only by keyspace-wide repairs, aren't matched.
+type tableAllowlist struct {
+	patterns []table
+}
+
+// newTableAllowlist returns nil when there's no pattern, table metrics are
+// disabled then
+func newTableAllowlist(patterns []string) (*tableAllowlist, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	l := &tableAllowlist{}
+	for _, p := range patterns {
+		parts := strings.Split(p, ".")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid table %q, expected keyspace.table", p)
+		}
+		l.patterns = append(l.patterns, table{Keyspace: parts[0], Table: parts[1]})
+	}
+	return l, nil
+}
+
+// includes tells whether the metrics of t are collected
+func (l *tableAllowlist) includes(t table) bool {
+	for _, p := range l.patterns {
+		if (p.Keyspace == "*" || p.Keyspace == t.Keyspace) && (p.Table == "*" || p.Table == t.Table) {
+			return true
+		}
+	}
+	return false
+}
+
+// discovers tells whether some patterns have a *, the tables they match
+// being discovered
+func (l *tableAllowlist) discovers() bool {
+	for _, p := range l.patterns {
+		if p.Keyspace == "*" || p.Table == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// tables returns the tables of the patterns without a * along with the
+// discovered ones the patterns include, without duplicates
+func (l *tableAllowlist) tables(discovered []table) []table {
+	var tables []table
+	seen := map[table]bool{}
+	add := func(t table) {
+		if !seen[t] {
+			seen[t] = true
+			tables = append(tables, t)
+		}
+	}
+	for _, p := range l.patterns {
+		if p.Keyspace != "*" && p.Table != "*" {
+			add(p)
+		}
+	}
+	for _, t := range discovered {
+		if l.includes(t) {
+			add(t)
+		}
+	}
+	return tables
+}
+
+// discoverTables returns the tables of c whose metrics are collected. The
+// managed repairs already fetched are reused, the ones of c are fetched
+// otherwise when some tables are to be discovered.
+func (e *Exporter) discoverTables(s *scrape, c cluster, repairs []repair) []table {
+	// Only Cassandra clusters have tables
+	if e.tables == nil || !isCassandra(c) {
+		return nil
+	}
+	if _, ok := e.provider.(tablesProvider); !ok || len(e.nodeMetrics) == 0 {
+		return nil
+	}
+	if e.tables.discovers() && !e.repairStatus {
+		if rp, ok := e.providerFor(s).(repairsProvider); ok {
+			s.apiCall(provisioningAPI)
+			var err error
+			repairs, err = rp.GetRepairs(c.ID)
+			s.called("GetRepairs", err)
+			if err != nil {
+				log.Debugf("Tables of cluster %s not discovered: %v", c.ID, err)
+			}
+		}
+	}
+	// Keyspace-wide repairs don't name a table
+	var discovered []table
+	for _, r := range repairs {
+		if r.Keyspace != "" && r.Table != "" {
+			discovered = append(discovered, table{Keyspace: r.Keyspace, Table: r.Table})
+		}
+	}
+	return e.tables.tables(discovered)
+}
+
+// fetchTableMetrics queries the metrics of the tables on n
+func (e *Exporter) fetchTableMetrics(s *scrape, n node, tables []table) (ms []metrics, err error) {
+	s.apiCall(monitoringAPI)
+	defer func() { s.called("GetTableMetrics", err) }()
+	return e.providerFor(s).(tablesProvider).GetTableMetrics(n.ID, tables, tableMetrics)
+}
+
+// tableCollector exports the metrics of the tables of f on its node. Unlike
+// the node metrics, they aren't retried when they couldn't be fetched.
+func (e *Exporter) tableCollector(s *scrape, f nodeFetch) {
+	ms, err := e.fetchTableMetrics(s, f.n, f.tables)
+	if err != nil {
+		if err == errNodeNotFound {
+			e.notFound.add(f.n.ID)
+		}
+		s.fail("GetTableMetrics", f.c.ID, f.n.ID, err)
+		return
+	}
+	for _, mc := range ms {
+		for _, m := range mc.Metrics {
+			desc, ok := tableDescs[m.Name]
+			if !ok || m.Keyspace == "" || m.Table == "" {
+				continue
+			}
+			value, ok := e.values.parse(f.n, m, f.ch)
+			if !ok {
+				continue
+			}
+			if desc == tableReadLatency || desc == tableWriteLatency {
+				value = e.units.latency(value)
+			}
+			f.ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, f.n.ID, m.Keyspace, m.Table)
+		}
+	}
+}
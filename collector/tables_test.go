@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeTablesProvider exposes the metrics of the tables of its node, and the
+// managed repairs its tables are discovered from, one of them keyspace-wide
+type fakeTablesProvider struct {
+	fakeProvider
+	queried *[]table
+}
+
+func (fakeTablesProvider) GetRepairs(clusterID string) ([]repair, error) {
+	return []repair{
+		{Keyspace: "shop", Table: "orders"},
+		{Keyspace: "shop", Table: "carts"},
+		{Keyspace: "shop"},
+		{Keyspace: "audit", Table: "logins"},
+	}, nil
+}
+
+func (p fakeTablesProvider) GetTableMetrics(nodeID string, tables []table, names []string) ([]metrics, error) {
+	*p.queried = tables
+	ms := metrics{}
+	for _, t := range tables {
+		ms.Metrics = append(ms.Metrics,
+			metric{Name: "readLatency", Keyspace: t.Keyspace, Table: t.Table, Values: []metricValue{{Value: "1500"}}},
+			metric{Name: "writeLatency", Keyspace: t.Keyspace, Table: t.Table, Values: []metricValue{{Value: "250"}}},
+			metric{Name: "liveSSTableCount", Keyspace: t.Keyspace, Table: t.Table, Values: []metricValue{{Value: "7"}}},
+			metric{Name: "liveDiskSpaceUsed", Keyspace: t.Keyspace, Table: t.Table, Values: []metricValue{{Value: "1048576"}}},
+		)
+	}
+	return []metrics{ms}, nil
+}
+
+func TestTableCollector(t *testing.T) {
+	var queried []table
+	e, err := newExporter(fakeTablesProvider{queried: &queried}, ExporterOptions{TableMetrics: []string{"audit.logins", "shop.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedTables := []table{{"audit", "logins"}, {"shop", "orders"}, {"shop", "carts"}}
+	if !reflect.DeepEqual(queried, expectedTables) {
+		t.Errorf("Queried tables %v, want %v", queried, expectedTables)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["keyspace"] == "shop" && labels["table"] == "orders" {
+				got[mf.GetName()] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_table_read_latency":               0.0015,
+		"cassandra_table_write_latency":              0.00025,
+		"cassandra_table_live_sstables":              7,
+		"cassandra_table_live_disk_space_used_bytes": 1048576,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", name, v, ok, value)
+		}
+	}
+}
+
+func TestTableAllowlist(t *testing.T) {
+	l, err := newTableAllowlist([]string{"shop.orders", "*.logins"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.discovers() {
+		t.Error("*.logins not discovered")
+	}
+	discovered := []table{{"shop", "orders"}, {"shop", "carts"}, {"audit", "logins"}}
+	expected := []table{{"shop", "orders"}, {"audit", "logins"}}
+	if got := l.tables(discovered); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got tables %v, want %v", got, expected)
+	}
+
+	if l, err := newTableAllowlist(nil); l != nil || err != nil {
+		t.Errorf("Got %v, %v without patterns, want nil", l, err)
+	}
+	for _, p := range []string{"shop", "shop.", ".orders", "shop.orders.v2"} {
+		if _, err := newTableAllowlist([]string{p}); err == nil {
+			t.Errorf("%q accepted", p)
+		}
+	}
+}
+
+func TestTableMetricsDisabled(t *testing.T) {
+	var queried []table
+	e, err := newExporter(fakeTablesProvider{queried: &queried}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	if queried != nil {
+		t.Errorf("Tables %v queried without collector.table-metrics", queried)
+	}
+}
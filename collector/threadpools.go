@@ -0,0 +1,62 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Monitoring API ("n::") thread pool, dropped messages and hints metrics of
+// the nodes, queried by the full profile only
+var threadPoolNodeMetrics = []string{
+	"nativeTransportRequests", //Number of pending and blocked client requests.
+	"mutationStage",           //Number of pending and blocked local writes.
+	"readStage",               //Number of pending and blocked local reads.
+	"droppedMessages",         //Mutations and reads dropped per second, not processed within their timeout.
+	"hintsTotal",              //Hints written for unavailable replicas since the start of the node.
+}
+
+// Monitoring API thread pool metrics, by the pool label they are exported with
+var threadPools = map[string]string{
+	"nativeTransportRequests": "native_transport",
+	"mutationStage":           "mutation_stage",
+	"readStage":               "read_stage",
+}
+
+// Thread pool, dropped messages and hints metric descriptors
+var (
+	nodeThreadPoolPendingTasks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "thread_pool_pending_tasks"),
+		"Number of tasks queued in the thread pool of the node.",
+		[]string{"nodeId", "pool"},
+		nil,
+	)
+	nodeThreadPoolBlockedTasks = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "thread_pool_blocked_tasks"),
+		"Number of tasks blocked because the queue of the thread pool of the node is full.",
+		[]string{"nodeId", "pool"},
+		nil,
+	)
+	nodeDroppedMutationsPerSecond = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "dropped_mutations_per_second"),
+		"Mutations dropped per second by the node, not processed within the write timeout.",
+		[]string{"nodeId"},
+		nil,
+	)
+	nodeDroppedReadsPerSecond = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "dropped_reads_per_second"),
+		"Reads dropped per second by the node, not processed within the read timeout.",
+		[]string{"nodeId"},
+		nil,
+	)
+	nodeHintsTotal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "hints_total"),
+		"Hints written by the node for unavailable replicas since it started.",
+		[]string{"nodeId"},
+		nil,
+	)
+)
+
+func describeThreadPools(ch chan<- *prometheus.Desc) {
+	ch <- nodeThreadPoolPendingTasks
+	ch <- nodeThreadPoolBlockedTasks
+	ch <- nodeDroppedMutationsPerSecond
+	ch <- nodeDroppedReadsPerSecond
+	ch <- nodeHintsTotal
+}
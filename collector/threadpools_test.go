@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeThreadPoolsProvider returns the thread pool, dropped messages and hints
+// metrics of its node
+type fakeThreadPoolsProvider struct {
+	fakeProvider
+}
+
+func (fakeThreadPoolsProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return []metrics{{Metrics: []metric{
+		{Name: "nativeTransportRequests", Type: "pendingtasks", Values: []metricValue{{Value: "12"}}},
+		{Name: "nativeTransportRequests", Type: "blockedtasks", Values: []metricValue{{Value: "3"}}},
+		{Name: "mutationStage", Type: "pendingtasks", Values: []metricValue{{Value: "5"}}},
+		{Name: "readStage", Type: "blockedtasks", Values: []metricValue{{Value: "1"}}},
+		{Name: "droppedMessages", Type: "mutation", Values: []metricValue{{Value: "0.5"}}},
+		{Name: "droppedMessages", Type: "read", Values: []metricValue{{Value: "0.25"}}},
+		{Name: "hintsTotal", Values: []metricValue{{Value: "1200"}}},
+	}}}, nil
+}
+
+func TestThreadPoolMetrics(t *testing.T) {
+	e, err := newExporter(fakeThreadPoolsProvider{}, ExporterOptions{Profile: ProfileFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "pool" {
+					name += "/" + l.GetValue()
+				}
+			}
+			got[name] = m.GetGauge().GetValue() + m.GetCounter().GetValue()
+		}
+	}
+	expected := map[string]float64{
+		"cassandra_node_thread_pool_pending_tasks/native_transport": 12,
+		"cassandra_node_thread_pool_blocked_tasks/native_transport": 3,
+		"cassandra_node_thread_pool_pending_tasks/mutation_stage":   5,
+		"cassandra_node_thread_pool_blocked_tasks/read_stage":       1,
+		"cassandra_node_dropped_mutations_per_second":               0.5,
+		"cassandra_node_dropped_reads_per_second":                   0.25,
+		"cassandra_node_hints_total":                                1200,
+	}
+	for name, value := range expected {
+		if v, ok := got[name]; !ok || v != value {
+			t.Errorf("%s: got %v (found %v) want %v", name, v, ok, value)
+		}
+	}
+}
+
+func TestThreadPoolMetricsProfile(t *testing.T) {
+	e, err := newExporter(fakeThreadPoolsProvider{}, ExporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range e.nodeMetrics {
+		for _, pool := range threadPoolNodeMetrics {
+			if name == pool {
+				t.Errorf("%s queried by the standard profile", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// timestampedMetric is a metric exported with the time its value was
+// sampled at instead of the scrape time
+type timestampedMetric struct {
+	prometheus.Metric
+	t time.Time
+}
+
+func (m timestampedMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.TimestampMs = proto.Int64(m.t.UnixNano() / int64(time.Millisecond))
+	return nil
+}
+
+// withTimestamp returns m exported at the timestamp of pb, m as is when pb
+// has none
+func withTimestamp(m prometheus.Metric, pb *dto.Metric) prometheus.Metric {
+	if pb.TimestampMs == nil {
+		return m
+	}
+	return timestampedMetric{m, time.Unix(0, pb.GetTimestampMs()*int64(time.Millisecond))}
+}
+
+func newStaleSamples() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "instaclustr_exporter",
+		Name:      "stale_samples_total",
+		Help:      "Number of node metric values dropped because the Monitoring API sampled them longer ago than the sample max age, by Monitoring API metric.",
+	}, []string{"metric"})
+}
+
+// stale tells whether m was sampled longer ago than the sample max age,
+// counting it if so. Values without a sample time are never stale.
+func (e *Exporter) stale(m metric) bool {
+	if e.sampleMaxAge <= 0 {
+		return false
+	}
+	t, ok := parseSampleTime(m)
+	if !ok || e.clock.Now().Sub(t) <= e.sampleMaxAge {
+		return false
+	}
+	e.staleSamples.WithLabelValues(m.Name).Inc()
+	return true
+}
+
+// timestamped calls collect with a channel whose metrics are sent to ch with
+// the time m was sampled at, when sample timestamps are enabled and it's
+// known, or with ch itself otherwise. collect may send any number of metrics.
+func (e *Exporter) timestamped(m metric, ch chan<- prometheus.Metric, collect func(chan<- prometheus.Metric)) {
+	t, ok := parseSampleTime(m)
+	if !e.sampleTimestamps || !ok {
+		collect(ch)
+		return
+	}
+	stamped := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for sm := range stamped {
+			ch <- timestampedMetric{sm, t}
+		}
+		close(done)
+	}()
+	collect(stamped)
+	close(stamped)
+	<-done
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sampledProvider returns a fresh CPU utilization and a stale disk one
+type sampledProvider struct {
+	fakeProvider
+}
+
+func (sampledProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return []metrics{{Metrics: []metric{
+		{Name: "cpuUtilization", Values: []metricValue{{Value: "42", Time: "2017-07-03T09:37:04.000Z"}}},
+		{Name: "diskUtilization", Values: []metricValue{{Value: "50", Time: "2017-07-03T08:00:00.000Z"}}},
+	}}}, nil
+}
+
+func TestSampleTimestamps(t *testing.T) {
+	clock := common.NewFakeClock(time.Date(2017, 7, 3, 9, 40, 0, 0, time.UTC))
+	e, err := newExporter(sampledProvider{}, ExporterOptions{Clock: clock, SampleTimestamps: true, SampleMaxAge: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "cassandra_node_cpu_utilization_percentage":
+				found = true
+				if expected := int64(1499074624000); m.GetTimestampMs() != expected {
+					t.Errorf("%s timestamp %d, want %d", mf.GetName(), m.GetTimestampMs(), expected)
+				}
+			case "cassandra_node_disk_utilization_percentage":
+				t.Errorf("Stale %s exported", mf.GetName())
+			case "instaclustr_exporter_stale_samples_total":
+				if m.GetLabel()[0].GetValue() != "diskUtilization" || m.GetCounter().GetValue() != 1 {
+					t.Errorf("Unexpected %s %v", mf.GetName(), m)
+				}
+			case "cassandra_node_last_sample_timestamp_seconds":
+				if m.TimestampMs != nil {
+					t.Errorf("%s has a timestamp", mf.GetName())
+				}
+			}
+		}
+	}
+	if !found {
+		t.Error("cassandra_node_cpu_utilization_percentage not exported")
+	}
+}
+
+func TestTimestampedForwardsEverySeries(t *testing.T) {
+	e := &Exporter{sampleTimestamps: true}
+	m := metric{Name: "cpuUtilization", Values: []metricValue{{Value: "42", Time: "2017-07-03T09:37:04.000Z"}}}
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.timestamped(m, ch, func(ch chan<- prometheus.Metric) {
+			for i := 0; i < 10; i++ {
+				ch <- prometheus.MustNewConstMetric(nodeCPUUtilizationPercentage, prometheus.GaugeValue, float64(i), "n1")
+			}
+		})
+		close(ch)
+	}()
+	count := 0
+	for sm := range ch {
+		if _, ok := sm.(timestampedMetric); !ok {
+			t.Errorf("%s forwarded without its sample time", sm.Desc())
+		}
+		count++
+	}
+	if count != 10 {
+		t.Errorf("%d series forwarded, want 10", count)
+	}
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Latency and throughput node metrics get the datacentre and rack of the
+// node as labels with ExporterOptions.TopologyLabels, so per datacentre
+// SLOs don't need joins with cassandra_node_info
+var topologyDescs = map[*prometheus.Desc]*prometheus.Desc{}
+
+func init() {
+	for _, desc := range []*prometheus.Desc{
+		nodeCassandraReadsPerSecond,
+		nodeCassandraWritesPerSecond,
+		nodeCassandraReadsTotal,
+		nodeCassandraWritesTotal,
+		nodeClientRequestReadLatency,
+		nodeClientRequestWriteLatency,
+		nodeClientRequestReadPercentile,
+		nodeClientRequestWritePercentile,
+		nodeClientRequestReadPercentile99,
+		nodeClientRequestWritePercentile99,
+	} {
+		name, help, labels, _ := descParts(desc)
+		topologyDescs[desc] = prometheus.NewDesc(name, help, append(labels, "datacentre", "rack"), nil)
+	}
+}
+
+// describeTopology sends the descriptors with topology labels to ch, they
+// replace the plain ones
+func describeTopology(ch chan<- *prometheus.Desc) {
+	for _, desc := range topologyDescs {
+		ch <- desc
+	}
+}
+
+// topologyLabeler adds the datacentre and rack of n to the latency and
+// throughput metrics sent to the returned channel, forwarding every metric
+// to ch. The returned function waits for the forwarding to finish.
+func topologyLabeler(n node, ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range in {
+			desc, ok := topologyDescs[m.Desc()]
+			if !ok {
+				ch <- m
+				continue
+			}
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				continue
+			}
+			if pb.Counter != nil {
+				ch <- withTimestamp(prometheus.MustNewConstMetric(desc, prometheus.CounterValue, pb.GetCounter().GetValue(), n.ID, n.dataCentre, n.Rack), pb)
+			} else {
+				ch <- withTimestamp(prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, pb.GetGauge().GetValue(), n.ID, n.dataCentre, n.Rack), pb)
+			}
+		}
+		close(done)
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// topologyProvider reports the latency and throughput of its node
+type topologyProvider struct {
+	fakeProvider
+}
+
+func (topologyProvider) GetTopology(clusterID string) ([]datacentre, error) {
+	return []datacentre{{ID: "dc1", Name: "EU_WEST_1", Nodes: []node{{ID: "n1", Rack: "eu-west-1a", Status: "RUNNING"}}}}, nil
+}
+
+func (topologyProvider) GetNodeMetrics(nodeID string, names []string) ([]metrics, error) {
+	return []metrics{{Metrics: []metric{
+		{Name: "cpuUtilization", Values: []metricValue{{Value: "42"}}},
+		{Name: "cassandraReads", Values: []metricValue{{Value: "10"}}},
+		{Name: "clientRequestRead", Type: "95thPercentile", Values: []metricValue{{Value: "2000"}}},
+	}}}, nil
+}
+
+func TestTopologyLabels(t *testing.T) {
+	e, err := newExporter(topologyProvider{}, ExporterOptions{TopologyLabels: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(e); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]map[string]string{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels[mf.GetName()] = map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[mf.GetName()][l.GetName()] = l.GetValue()
+			}
+		}
+	}
+	for _, name := range []string{"cassandra_node_reads_per_second", "cassandra_node_reads_total", "cassandra_node_client_request_read_percentile95"} {
+		if l := labels[name]; l["nodeId"] != "n1" || l["datacentre"] != "EU_WEST_1" || l["rack"] != "eu-west-1a" {
+			t.Errorf("%s: got labels %v", name, l)
+		}
+	}
+	if l := labels["cassandra_node_cpu_utilization_percentage"]; len(l) != 1 {
+		t.Errorf("cassandra_node_cpu_utilization_percentage: got labels %v, want nodeId only", l)
+	}
+}
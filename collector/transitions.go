@@ -0,0 +1,58 @@
+package collector
+
+import "sync"
+
+// Transition is a change of the status of a cluster or node between two
+// collections, e.g. from RUNNING to anything else
+type Transition struct {
+	// Kind is "cluster" or "node"
+	Kind      string
+	ID        string
+	ClusterID string
+	From      string
+	To        string
+}
+
+// Down tells whether the cluster or node stopped running
+func (t Transition) Down() bool {
+	return t.From == "RUNNING"
+}
+
+// transitionTracker remembers the last status of every cluster and node seen.
+// Objects missing from a collection keep their status, their first status
+// is not a transition.
+type transitionTracker struct {
+	mu       sync.Mutex
+	statuses map[string]string
+}
+
+func newTransitionTracker() *transitionTracker {
+	return &transitionTracker{statuses: make(map[string]string)}
+}
+
+func (tt *transitionTracker) observe(t Transition, transitions []Transition) []Transition {
+	key := t.Kind + "/" + t.ID
+	from, ok := tt.statuses[key]
+	tt.statuses[key] = t.To
+	if !ok || from == t.To {
+		return transitions
+	}
+	t.From = from
+	return append(transitions, t)
+}
+
+// diff returns the transitions since the previous snapshot
+func (tt *transitionTracker) diff(s Snapshot) []Transition {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	var transitions []Transition
+	for _, c := range s.Clusters {
+		transitions = tt.observe(Transition{Kind: "cluster", ID: c.ID, ClusterID: c.ID, To: c.DerivedStatus}, transitions)
+		for _, dc := range c.DataCentres {
+			for _, n := range dc.Nodes {
+				transitions = tt.observe(Transition{Kind: "node", ID: n.ID, ClusterID: c.ID, To: n.Status}, transitions)
+			}
+		}
+	}
+	return transitions
+}
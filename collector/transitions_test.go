@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testSnapshot(clusterStatus, nodeStatus string) Snapshot {
+	return Snapshot{Clusters: []*clusterSnapshot{{
+		cluster:     cluster{ID: "cluster-uuid-1", DerivedStatus: clusterStatus},
+		DataCentres: []datacentre{{Nodes: []node{{ID: "node-uuid-1", Status: nodeStatus}}}},
+	}}}
+}
+
+func TestTransitionTracker(t *testing.T) {
+	tt := newTransitionTracker()
+	if got := tt.diff(testSnapshot("RUNNING", "RUNNING")); len(got) != 0 {
+		t.Errorf("First statuses are not transitions, got %v", got)
+	}
+	if got := tt.diff(testSnapshot("RUNNING", "RUNNING")); len(got) != 0 {
+		t.Errorf("Unchanged statuses are not transitions, got %v", got)
+	}
+	// A collection missing the cluster keeps its status
+	if got := tt.diff(Snapshot{}); len(got) != 0 {
+		t.Errorf("Missing objects are not transitions, got %v", got)
+	}
+
+	expected := []Transition{
+		{Kind: "cluster", ID: "cluster-uuid-1", ClusterID: "cluster-uuid-1", From: "RUNNING", To: "DEGRADED"},
+		{Kind: "node", ID: "node-uuid-1", ClusterID: "cluster-uuid-1", From: "RUNNING", To: "UNREACHABLE"},
+	}
+	got := tt.diff(testSnapshot("DEGRADED", "UNREACHABLE"))
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v want %v", got, expected)
+	}
+	for _, tr := range got {
+		if !tr.Down() {
+			t.Errorf("%v should be down", tr)
+		}
+	}
+
+	got = tt.diff(testSnapshot("DEGRADED", "RUNNING"))
+	if len(got) != 1 || got[0].Kind != "node" || got[0].Down() {
+		t.Errorf("Expected the node back up, got %v", got)
+	}
+}
@@ -0,0 +1,220 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Units of the metric families, see Units
+const (
+	UnitSeconds      = "seconds"
+	UnitMicroseconds = "microseconds"
+	UnitPercent      = "percent"
+	UnitRatio        = "ratio"
+	// UnitBoth exports utilizations both as percentages and ratios
+	UnitBoth = "both"
+)
+
+var (
+	nodeCPUUtilizationRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "cpu_utilization_ratio"),
+		"Current CPU utilisation as a ratio of total available, from 0 to 1 regardless of the number of cores on the node.",
+		[]string{"nodeId"},
+		nil,
+	)
+	nodeDiskUtilizationRatio = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "disk_utilization_ratio"),
+		"Total disk space utilisation, by Cassandra, as a ratio of total available.",
+		[]string{"nodeId"},
+		nil,
+	)
+)
+
+// Units are the units node metrics are exported in, by family. Legacy
+// dashboards expecting microseconds or percentages keep working while they
+// are migrated to the convention compliant seconds and ratios.
+type Units struct {
+	// Latency of the client requests, UnitSeconds by default or
+	// UnitMicroseconds as the Monitoring API reports it. The metric names
+	// don't change, their HELP tells the unit.
+	Latency string `yaml:"latency"`
+	// Utilization of CPU and disk, UnitPercent in the _percentage metrics by
+	// default, UnitRatio in the _ratio ones or UnitBoth
+	Utilization string `yaml:"utilization"`
+}
+
+// ParseUnits parses a comma separated list of family=unit pairs, e.g.
+// latency=microseconds,utilization=both
+func ParseUnits(s string) (Units, error) {
+	var u Units
+	if s == "" {
+		return u, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return u, fmt.Errorf("invalid unit %q, expected family=unit", pair)
+		}
+		switch kv[0] {
+		case "latency":
+			u.Latency = kv[1]
+		case "utilization":
+			u.Utilization = kv[1]
+		default:
+			return u, fmt.Errorf("unknown metric family %q, expected latency or utilization", kv[0])
+		}
+	}
+	return u, u.validate()
+}
+
+func (u Units) validate() error {
+	switch u.Latency {
+	case "", UnitSeconds, UnitMicroseconds:
+	default:
+		return fmt.Errorf("invalid latency unit %q, expected %s or %s", u.Latency, UnitSeconds, UnitMicroseconds)
+	}
+	switch u.Utilization {
+	case "", UnitPercent, UnitRatio, UnitBoth:
+	default:
+		return fmt.Errorf("invalid utilization unit %q, expected %s, %s or %s", u.Utilization, UnitPercent, UnitRatio, UnitBoth)
+	}
+	return nil
+}
+
+// latency converts a latency in microseconds, as reported by the Monitoring
+// API, to the latency unit
+func (u Units) latency(us float64) float64 {
+	if u.Latency == UnitMicroseconds {
+		return us
+	}
+	return us * usTosecondsFactor
+}
+
+// duration converts d to the latency unit
+func (u Units) duration(d time.Duration) float64 {
+	if u.Latency == UnitMicroseconds {
+		return float64(d / time.Microsecond)
+	}
+	return d.Seconds()
+}
+
+// percentages tells whether utilizations are exported as percentages
+func (u Units) percentages() bool {
+	return u.Utilization != UnitRatio
+}
+
+// ratios tells whether utilizations are exported as ratios
+func (u Units) ratios() bool {
+	return u.Utilization == UnitRatio || u.Utilization == UnitBoth
+}
+
+// utilization exports a utilization percentage of node as percentage, ratio
+// or both
+func (u Units) utilization(percentage, ratio *prometheus.Desc, value float64, nodeID string, ch chan<- prometheus.Metric) {
+	if u.percentages() {
+		ch <- prometheus.MustNewConstMetric(percentage, prometheus.GaugeValue, value, nodeID)
+	}
+	if u.ratios() {
+		ch <- prometheus.MustNewConstMetric(ratio, prometheus.GaugeValue, value/100, nodeID)
+	}
+}
+
+// describeUtilization sends the descriptors of the utilization metrics to ch
+func (u Units) describeUtilization(ch chan<- *prometheus.Desc) {
+	if u.percentages() {
+		ch <- nodeCPUUtilizationPercentage
+		ch <- nodeDiskUtilizationPercentage
+	}
+	if u.ratios() {
+		ch <- nodeCPUUtilizationRatio
+		ch <- nodeDiskUtilizationRatio
+	}
+}
+
+var (
+	microsecondsOnce sync.Once
+	// microsecondDescs are the latency descriptors with a HELP in
+	// microseconds, by the one in seconds
+	microsecondDescs map[*prometheus.Desc]*prometheus.Desc
+)
+
+// microsecondDesc returns the descriptor of desc in microseconds, false if
+// desc isn't a latency
+func microsecondDesc(desc *prometheus.Desc) (*prometheus.Desc, bool) {
+	microsecondsOnce.Do(func() {
+		microsecondDescs = map[*prometheus.Desc]*prometheus.Desc{}
+		descs := []*prometheus.Desc{tableReadLatency, tableWriteLatency}
+		for desc := range latencyDescs {
+			descs = append(descs, desc, topologyDescs[desc])
+		}
+		for _, desc := range descs {
+			name, help, labels, _ := descParts(desc)
+			microsecondDescs[desc] = prometheus.NewDesc(name, strings.Replace(help, " in seconds ", " in microseconds ", 1), labels, nil)
+		}
+	})
+	d, ok := microsecondDescs[desc]
+	return d, ok
+}
+
+// latencyMetric is a latency metric described in the latency unit
+type latencyMetric struct {
+	prometheus.Metric
+	desc *prometheus.Desc
+}
+
+// Desc implements prometheus.Metric
+func (m latencyMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// latencyDescriber forwards the descriptors sent to the returned channel to
+// ch, the latency ones replaced by the ones of the latency unit. done must be
+// called once every descriptor is sent.
+func (u Units) latencyDescriber(ch chan<- *prometheus.Desc) (chan<- *prometheus.Desc, func()) {
+	if u.Latency != UnitMicroseconds {
+		return ch, func() {}
+	}
+	in := make(chan *prometheus.Desc)
+	finished := make(chan struct{})
+	go func() {
+		for desc := range in {
+			if d, ok := microsecondDesc(desc); ok {
+				desc = d
+			}
+			ch <- desc
+		}
+		close(finished)
+	}()
+	return in, func() {
+		close(in)
+		<-finished
+	}
+}
+
+// latencyLabeler forwards the metrics sent to the returned channel to ch,
+// the latency ones described in the latency unit. done must be called once
+// every metric is sent.
+func (u Units) latencyLabeler(ch chan<- prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	if u.Latency != UnitMicroseconds {
+		return ch, func() {}
+	}
+	in := make(chan prometheus.Metric)
+	finished := make(chan struct{})
+	go func() {
+		for m := range in {
+			if d, ok := microsecondDesc(m.Desc()); ok {
+				m = latencyMetric{m, d}
+			}
+			ch <- m
+		}
+		close(finished)
+	}()
+	return in, func() {
+		close(in)
+		<-finished
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestUnits(t *testing.T) {
+	ms := []metrics{{Metrics: []metric{
+		{Name: "cpuUtilization", Values: []metricValue{{Value: "42"}}},
+		{Name: "clientRequestRead", Type: "latency_per_operation", Values: []metricValue{{Value: "1500"}}},
+	}}}
+	cases := []struct {
+		units    string
+		expected map[*prometheus.Desc]float64
+	}{
+		{"", map[*prometheus.Desc]float64{nodeCPUUtilizationPercentage: 42, nodeClientRequestReadLatency: 0.0015}},
+		{"latency=microseconds,utilization=ratio", map[*prometheus.Desc]float64{nodeCPUUtilizationRatio: 0.42, nodeClientRequestReadLatency: 1500}},
+		{"utilization=both", map[*prometheus.Desc]float64{nodeCPUUtilizationPercentage: 42, nodeCPUUtilizationRatio: 0.42, nodeClientRequestReadLatency: 0.0015}},
+	}
+	for _, c := range cases {
+		units, err := ParseUnits(c.units)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := newExporter(fakeProvider{}, ExporterOptions{Units: units})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := make(chan prometheus.Metric, 10)
+		e.nodeMetricsCollector(cluster{}, node{ID: "n1"}, ms, ch)
+		close(ch)
+		got := map[*prometheus.Desc]float64{}
+		for m := range ch {
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				t.Fatal(err)
+			}
+			got[m.Desc()] = pb.GetGauge().GetValue()
+		}
+		for desc, v := range c.expected {
+			if got[desc] != v {
+				t.Errorf("%q: got %v for %s, want %v", c.units, got[desc], desc, v)
+			}
+		}
+		if len(got) != len(c.expected) {
+			t.Errorf("%q: got %d metrics, want %d", c.units, len(got), len(c.expected))
+		}
+	}
+
+	for _, s := range []string{"latency=ms", "utilization=fraction", "memory=bytes", "latency"} {
+		if _, err := ParseUnits(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestLatencyUnitHelp(t *testing.T) {
+	units := Units{Latency: UnitMicroseconds}
+	ch := make(chan prometheus.Metric, 2)
+	in, done := units.latencyLabeler(ch)
+	in <- prometheus.MustNewConstMetric(nodeClientRequestReadLatency, prometheus.GaugeValue, 1500, "n1")
+	in <- prometheus.MustNewConstMetric(nodeCassandraCompactions, prometheus.GaugeValue, 1, "n1")
+	done()
+	if desc := (<-ch).Desc(); !strings.Contains(desc.String(), "in microseconds") {
+		t.Errorf("Latency in microseconds described as %s", desc)
+	}
+	if desc := (<-ch).Desc(); desc != nodeCassandraCompactions {
+		t.Errorf("Compactions described as %s", desc)
+	}
+
+	descs := make(chan *prometheus.Desc, 2)
+	described, done := units.latencyDescriber(descs)
+	described <- nodeClientRequestWritePercentile99
+	described <- tableReadLatency
+	done()
+	close(descs)
+	for desc := range descs {
+		if !strings.Contains(desc.String(), "in microseconds") {
+			t.Errorf("Latency in microseconds described as %s", desc)
+		}
+	}
+
+	e, err := newExporter(fakeProvider{}, ExporterOptions{Units: units})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prometheus.NewPedanticRegistry().Register(e); err != nil {
+		t.Errorf("Exporter in microseconds not registered: %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// What to export when a metric value can't be parsed
+const (
+	// ParseErrorZero exports 0, indistinguishable from a real zero
+	ParseErrorZero = "zero"
+	// ParseErrorNaN exports NaN
+	ParseErrorNaN = "nan"
+	// ParseErrorOmit drops the series
+	ParseErrorOmit = "omit"
+	// ParseErrorFlag drops the series and exports cassandra_node_metric_parse_error instead
+	ParseErrorFlag = "flag"
+)
+
+var parseErrorModes = []string{ParseErrorZero, ParseErrorNaN, ParseErrorOmit, ParseErrorFlag}
+
+var (
+	nodeMetricParseError = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "metric_parse_error"),
+		"Set to 1 when a node metric value returned by the Monitoring API could not be parsed.",
+		[]string{"nodeId", "metric", "type"},
+		nil,
+	)
+)
+
+// valueParser is the single place where Monitoring API values are turned into
+// floats, applying the configured parse error mode
+type valueParser struct {
+	mode      string
+	overrides map[string]string
+	sanitizer *sanitizer
+}
+
+func validParseErrorMode(mode string) bool {
+	for _, m := range parseErrorModes {
+		if mode == m {
+			return true
+		}
+	}
+	return false
+}
+
+// newValueParser builds a valueParser with a default mode and per metric
+// overrides, keyed by Monitoring API metric name (e.g. cpuUtilization)
+func newValueParser(mode string, overrides map[string]string) (*valueParser, error) {
+	if mode == "" {
+		mode = ParseErrorZero
+	}
+	if !validParseErrorMode(mode) {
+		return nil, fmt.Errorf("unknown parse error mode %q, expected one of %v", mode, parseErrorModes)
+	}
+	for metric, m := range overrides {
+		if !validParseErrorMode(m) {
+			return nil, fmt.Errorf("unknown parse error mode %q for %s, expected one of %v", m, metric, parseErrorModes)
+		}
+	}
+	return &valueParser{mode: mode, overrides: overrides}, nil
+}
+
+// ParseErrorOverrides parses a comma separated list of metric=mode pairs
+func ParseErrorOverrides(s string) (map[string]string, error) {
+	overrides := map[string]string{}
+	if s == "" {
+		return overrides, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid parse error override %q, expected metric=mode", pair)
+		}
+		overrides[strings.TrimPrefix(kv[0], "n::")] = kv[1]
+	}
+	return overrides, nil
+}
+
+func (vp *valueParser) modeFor(metric string) string {
+	if m, ok := vp.overrides[metric]; ok {
+		return m
+	}
+	return vp.mode
+}
+
+// parse returns the value of m and whether it should be exported
+func (vp *valueParser) parse(n node, m metric, ch chan<- prometheus.Metric) (float64, bool) {
+	var raw string
+	if len(m.Values) > 0 {
+		raw = string(m.Values[0].Value)
+		value, err := strconv.ParseFloat(raw, 64)
+		if err == nil {
+			return vp.sanitizer.apply(m, value)
+		}
+	}
+	log.Errorf("Error parsing value metric %s : %s", logValue(m.Name), logValue(raw))
+
+	switch vp.modeFor(m.Name) {
+	case ParseErrorNaN:
+		return math.NaN(), true
+	case ParseErrorOmit:
+		return 0, false
+	case ParseErrorFlag:
+		ch <- prometheus.MustNewConstMetric(
+			nodeMetricParseError,
+			prometheus.GaugeValue,
+			1,
+			n.ID,
+			m.Name,
+			m.Type,
+		)
+		return 0, false
+	default:
+		return 0, true
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestValueParser(t *testing.T) {
+	n := node{ID: "node-uuid-1"}
+	invalid := metric{Name: "cpuUtilization", Type: "percentage", Values: []metricValue{{Value: "warn"}}}
+	empty := metric{Name: "diskUtilization", Type: "percentage"}
+
+	cases := []struct {
+		mode     string
+		m        metric
+		expected float64
+		ok       bool
+		flagged  bool
+	}{
+		{ParseErrorZero, metric{Name: "cpuUtilization", Values: []metricValue{{Value: "2.5"}}}, 2.5, true, false},
+		{ParseErrorZero, invalid, 0, true, false},
+		{ParseErrorZero, empty, 0, true, false},
+		{ParseErrorNaN, invalid, math.NaN(), true, false},
+		{ParseErrorOmit, invalid, 0, false, false},
+		{ParseErrorFlag, invalid, 0, false, true},
+	}
+	for _, c := range cases {
+		vp, err := newValueParser(c.mode, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := make(chan prometheus.Metric, 1)
+		value, ok := vp.parse(n, c.m, ch)
+		if ok != c.ok || (value != c.expected && !(math.IsNaN(value) && math.IsNaN(c.expected))) {
+			t.Errorf("Mode %s: got (%v, %v) want (%v, %v)", c.mode, value, ok, c.expected, c.ok)
+		}
+		if flagged := len(ch) == 1; flagged != c.flagged {
+			t.Errorf("Mode %s: parse error metric emitted %v, expected %v", c.mode, flagged, c.flagged)
+		}
+	}
+}
+
+func TestParseErrorOverrides(t *testing.T) {
+	overrides, err := ParseErrorOverrides("n::cpuUtilization=omit,diskUtilization=nan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vp, err := newValueParser(ParseErrorZero, overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := vp.modeFor("cpuUtilization"); mode != ParseErrorOmit {
+		t.Errorf("Unexpected mode for cpuUtilization: %s", mode)
+	}
+	if mode := vp.modeFor("compactions"); mode != ParseErrorZero {
+		t.Errorf("Unexpected mode for compactions: %s", mode)
+	}
+	if _, err := newValueParser(ParseErrorZero, map[string]string{"cpuUtilization": "ignore"}); err == nil {
+		t.Errorf("newValueParser should fail for unknown modes")
+	}
+	if _, err := ParseErrorOverrides("cpuUtilization"); err == nil {
+		t.Errorf("ParseErrorOverrides should fail without a mode")
+	}
+}
@@ -0,0 +1,98 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time. Code depending on the current time, or waiting for
+// some to elapse, takes a Clock so tests can replace it with a FakeClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+// FakeClock is a Clock that only moves when told to
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+// fakeWaiter is a channel returned by FakeClock.After, waiting for the clock
+// to reach at
+type fakeWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// NewFakeClock creates a FakeClock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time the clock is stopped at
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel the time is sent on once the clock is moved d
+// forward, right away if d isn't positive
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := fakeWaiter{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w.c
+	}
+	c.waiters = append(c.waiters, w)
+	return w.c
+}
+
+// Waiters returns how many channels returned by After are still waiting
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(now)
+}
+
+// set moves the clock to now, firing the waiters it reaches
+func (c *FakeClock) set(now time.Time) {
+	c.now = now
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if now.Before(w.at) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- now
+	}
+	c.waiters = waiting
+}
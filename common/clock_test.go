@@ -0,0 +1,28 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClockAfter(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	if now := <-clock.After(0); !now.Equal(start) {
+		t.Errorf("Zero delay fired at %s, want %s", now, start)
+	}
+	c := clock.After(time.Minute)
+	clock.Advance(30 * time.Second)
+	select {
+	case <-c:
+		t.Fatal("Fired before its delay")
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	if now := <-c; !now.Equal(start.Add(time.Minute)) {
+		t.Errorf("Fired at %s, want %s", now, start.Add(time.Minute))
+	}
+	if n := clock.Waiters(); n != 0 {
+		t.Errorf("%d waiters left", n)
+	}
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// HealthCheck checks a subsystem of the server on every health-check
+// request, e.g. the reachability of an API
+type HealthCheck struct {
+	Name string
+	// Check returns why the subsystem is unhealthy, nil when it's healthy
+	Check func() error
+}
+
+// runChecks runs checks but the excluded ones, following the Kubernetes
+// /healthz and /readyz conventions: a line per check, [+] when it passed and
+// [-] when it failed, then the overall outcome of the name probe
+func runChecks(name string, checks []HealthCheck, exclude map[string]bool) (report string, healthy bool) {
+	var b bytes.Buffer
+	healthy = true
+	for _, c := range checks {
+		if exclude[c.Name] {
+			fmt.Fprintf(&b, "[+]%s excluded: ok\n", c.Name)
+			continue
+		}
+		if err := c.Check(); err != nil {
+			healthy = false
+			fmt.Fprintf(&b, "[-]%s failed: %v\n", c.Name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "[+]%s ok\n", c.Name)
+	}
+	if healthy {
+		fmt.Fprintf(&b, "%s check passed\n", name)
+	} else {
+		fmt.Fprintf(&b, "%s check failed\n", name)
+	}
+	return b.String(), healthy
+}
@@ -0,0 +1,31 @@
+//go:build go1.11 && (linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+// +build go1.11
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package common
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenReusePort listens with SO_REUSEPORT set, so several processes can
+// bind the same address and the kernel balances connections between them
+func listenReusePort(network, addr string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+	return lc.Listen(context.Background(), network, addr)
+}
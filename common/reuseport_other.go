@@ -0,0 +1,13 @@
+//go:build !go1.11 || (!linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd)
+// +build !go1.11 !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package common
+
+import (
+	"errors"
+	"net"
+)
+
+func listenReusePort(network, addr string) (net.Listener, error) {
+	return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -2,12 +2,20 @@ package common
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -15,33 +23,248 @@ import (
 	"github.com/prometheus/common/log"
 )
 
+// Networks the server can listen on
+var Networks = []string{"tcp", "tcp4", "tcp6"}
+
 // ServerOptions defines the server configuration
 type ServerOptions struct {
-	ListenAddress    string
-	LivenessProbeURL string
-	ShutdownURL      string
-	ReadTimeOut      time.Duration
-	WriteTimeOut     time.Duration
+	ListenAddress     string
+	LivenessProbeURL  string
+	ReadinessProbeURL string
+	ShutdownURL       string
+	ReadTimeOut       time.Duration
+	WriteTimeOut      time.Duration
+	// Network is one of Networks, tcp (the default) listens on both IPv4 and IPv6
+	Network string
+	// ReusePort sets SO_REUSEPORT on the listening socket
+	ReusePort bool
+	// ShutdownAllowRemote accepts shutdown requests from any address, only
+	// loopback ones are accepted otherwise
+	ShutdownAllowRemote bool
+	// ShutdownConfirm requires two shutdown requests: the first one gets a
+	// token the second one must pass as the token query parameter
+	ShutdownConfirm bool
+	// TLSCertFile and TLSKeyFile, when set, serve HTTPS instead of HTTP
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile requires client certificates signed by one of its CAs
+	TLSClientCAFile string
+	// RunDuration shuts the server down once elapsed, it runs until asked
+	// to if 0
+	RunDuration time.Duration
 }
 
+// How long a shutdown confirmation token is valid
+const shutdownTokenTTL = time.Minute
+
 // Server represents a server type
 type Server struct {
-	Name             string
-	HTTPServer       http.Server
-	LivenessProbeURL string
-	ShutdownURL      string
-	ShutdownReq      chan bool
-	ShutdownReqCount uint32
+	Name              string
+	HTTPServer        http.Server
+	Network           string
+	ReusePort         bool
+	LivenessProbeURL  string
+	ReadinessProbeURL string
+	ShutdownURL       string
+	ShutdownReq       chan bool
+	ShutdownReqCount  uint32
+	// ShutdownAllowRemote and ShutdownConfirm protect ShutDownHandler, see ServerOptions
+	ShutdownAllowRemote bool
+	ShutdownConfirm     bool
+	// HealthChecks are run on every request to LivenessProbeURL and
+	// ReadinessProbeURL, they must only fail when the process itself is
+	// unhealthy
+	HealthChecks []HealthCheck
+	// ReadinessChecks are only run on requests to ReadinessProbeURL, e.g.
+	// the reachability of an API restarting the process doesn't fix
+	ReadinessChecks []HealthCheck
+	// DrainStatus, if set, describes the state of the work done by the
+	// server, e.g. its last collection, in the drain statistics
+	DrainStatus func() string
+	// RunDuration, see ServerOptions
+	RunDuration time.Duration
+	// ExitCode, if set, tells the code the process exits with once the
+	// server stopped, e.g. after RunDuration
+	ExitCode func() int
+	// TLSCertFile, TLSKeyFile and TLSClientCAFile, see ServerOptions
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	// Clock expires the shutdown confirmation tokens, SystemClock if nil
+	Clock Clock
+
+	mu            sync.Mutex
+	tls           *tls.Config
+	listener      net.Listener
+	inFlight      int64
+	shutdownToken string
+	tokenExpiry   time.Time
+}
+
+// DrainStats describes how the server drained its requests on shutdown
+type DrainStats struct {
+	// InFlight are the requests being served when the shutdown started
+	InFlight int64
+	// Duration is how long they took to finish
+	Duration time.Duration
+	// Status is the DrainStatus of the server once drained
+	Status string
+	// Err is why the server couldn't drain, e.g. requests still in flight
+	// after the shutdown timeout
+	Err error
 }
 
-// LivenessProbeHandler handles healt-check requests to LivenessProbeURL
+// Track counts the requests to h being served, the ones the server waits for
+// on shutdown
+func (s *Server) Track(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&s.inFlight, 1)
+		defer atomic.AddInt64(&s.inFlight, -1)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// InFlight returns the number of tracked requests being served
+func (s *Server) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// LivenessProbeHandler handles healt-check requests to LivenessProbeURL. It
+// answers OK when every health check passes, 500 and the checks otherwise.
+// As Kubernetes /healthz, verbose lists the checks even when they pass and
+// exclude, which can be repeated, leaves a check out.
 func (s *Server) LivenessProbeHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, r, "healthz", s.HealthChecks)
+}
+
+// ReadinessProbeHandler handles readiness requests to ReadinessProbeURL as
+// LivenessProbeHandler does, running the readiness checks too
+func (s *Server) ReadinessProbeHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, r, "readyz", append(append([]HealthCheck{}, s.HealthChecks...), s.ReadinessChecks...))
+}
+
+func probe(w http.ResponseWriter, r *http.Request, name string, checks []HealthCheck) {
+	q := r.URL.Query()
+	exclude := map[string]bool{}
+	for _, name := range q["exclude"] {
+		exclude[name] = true
+	}
+	report, healthy := runChecks(name, checks, exclude)
+	if !healthy {
+		http.Error(w, report, http.StatusInternalServerError)
+		return
+	}
+	if _, verbose := q["verbose"]; verbose {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(report))
+		return
+	}
 	w.Write([]byte("OK"))
 }
 
-// ShutDownHandler provides a graceful shutdown via API
+// AddrHandler returns the address the server is bound to, useful when
+// listening on port 0
+func (s *Server) AddrHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(s.Addr()))
+}
+
+// Headers reverse proxies tell the client a request is forwarded for in
+var forwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-Ip"}
+
+// IsLoopback tells whether r comes from the host itself. Requests forwarded
+// by a reverse proxy, even from the host, aren't: their client may be anywhere
+// and the headers telling it can be forged, so they're never trusted.
+func IsLoopback(r *http.Request) bool {
+	for _, h := range forwardedHeaders {
+		if r.Header.Get(h) != "" {
+			return false
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// clock returns the Clock of the server
+func (s *Server) clock() Clock {
+	if s.Clock == nil {
+		return SystemClock
+	}
+	return s.Clock
+}
+
+// checkShutdownToken tells whether token is the pending confirmation token,
+// which can only be used once
+func (s *Server) checkShutdownToken(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdownToken == "" || s.clock().Now().After(s.tokenExpiry) ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(s.shutdownToken)) != 1 {
+		return false
+	}
+	s.shutdownToken = ""
+	return true
+}
+
+// errShutdownPending is returned when a confirmation token is still pending
+var errShutdownPending = errors.New("a shutdown is already waiting for its confirmation")
+
+// newShutdownToken returns a new confirmation token, unless one is still
+// pending: requests of other clients don't replace it until it expires
+func (s *Server) newShutdownToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdownToken != "" && s.clock().Now().Before(s.tokenExpiry) {
+		return "", errShutdownPending
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s.shutdownToken = hex.EncodeToString(b)
+	s.tokenExpiry = s.clock().Now().Add(shutdownTokenTTL)
+	return s.shutdownToken, nil
+}
+
+// ShutDownHandler provides a graceful shutdown via API. Only loopback requests
+// not forwarded by a reverse proxy are accepted unless ShutdownAllowRemote is
+// set. With ShutdownConfirm, a request without a token gets a new one, with
+// 202 Accepted, and doesn't shut the server down. While that token is pending
+// requests without it get 409 Conflict, and the ones with a wrong token 403.
 func (s *Server) ShutDownHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.ShutdownAllowRemote && !IsLoopback(r) {
+		log.Warnf("[%s] Rejected shutdown request from %s", s.Name, r.RemoteAddr)
+		http.Error(w, "Shutdown is only accepted from loopback addresses, not through a reverse proxy", http.StatusForbidden)
+		return
+	}
+	if token := r.URL.Query().Get("token"); s.ShutdownConfirm && !s.checkShutdownToken(token) {
+		if token != "" {
+			http.Error(w, "Invalid or expired confirmation token", http.StatusForbidden)
+			return
+		}
+		token, err := s.newShutdownToken()
+		if err == errShutdownPending {
+			http.Error(w, "A shutdown is already waiting for its confirmation", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Could not generate a confirmation token", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(token))
+		return
+	}
 	w.Write([]byte("Shutting Down... bye! :)"))
+	inFlight := s.InFlight()
+	// This request is one of them when tracked
+	if inFlight > 0 {
+		inFlight--
+	}
+	fmt.Fprintf(w, " Draining %d requests in flight", inFlight)
 	//Do nothing if shutdown request already issued
 	//if s.reqCount == 0 then set to 1, return true otherwise false
 	if !atomic.CompareAndSwapUint32(&s.ShutdownReqCount, 0, 1) {
@@ -58,13 +281,19 @@ func (s *Server) ShutDownHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) WaitForShutDown() {
 	irqSig := make(chan os.Signal, 1)
 	signal.Notify(irqSig, syscall.SIGINT, syscall.SIGTERM)
+	var elapsed <-chan time.Time
+	if s.RunDuration > 0 {
+		elapsed = time.After(s.RunDuration)
+	}
 
-	//Wait interrupt or shutdown request through /shutdown
+	//Wait interrupt, shutdown request through /shutdown or the end of the run
 	select {
 	case sig := <-irqSig:
 		log.Infof("[%s] Shutdown request (signal: %v)", s.Name, sig)
 	case sig := <-s.ShutdownReq:
 		log.Infof("[%s] Shutdown HTTP request (http: %v)", s.Name, sig)
+	case <-elapsed:
+		log.Infof("[%s] Run duration of %s elapsed", s.Name, s.RunDuration)
 	}
 
 	log.Infof("[%s] Stopping server...", s.Name)
@@ -74,12 +303,29 @@ func (s *Server) WaitForShutDown() {
 	defer cancel()
 
 	//shutdown the server
-	err := s.HTTPServer.Shutdown(ctx)
-	if err != nil {
-		log.Errorf("[%s] Shutdown request error: %v", s.Name, err)
+	stats := DrainStats{InFlight: s.InFlight()}
+	start := time.Now()
+	stats.Err = s.HTTPServer.Shutdown(ctx)
+	stats.Duration = time.Since(start)
+	if s.DrainStatus != nil {
+		stats.Status = s.DrainStatus()
+	}
+	if stats.Err != nil {
+		log.Errorf("[%s] Shutdown request error: %v", s.Name, stats.Err)
 	} else {
 		log.Infof("[%s] Server stopped", s.Name)
 	}
+	stats.log(s.Name)
+}
+
+// log writes the drain statistics as a single structured line
+func (d DrainStats) log(name string) {
+	l := log.With("in_flight", d.InFlight).With("duration", d.Duration).With("status", d.Status)
+	if d.Err != nil {
+		l.With("error", d.Err).Errorf("[%s] Drain failed", name)
+		return
+	}
+	l.Infof("[%s] Drained", name)
 }
 
 // WaitForLiveness blocks un till the server is alive
@@ -93,12 +339,12 @@ func (s *Server) WaitForLiveness() bool {
 	}
 	// TODO Implement exponential back-off, in every loop we increment the wait Interval
 	for !live && retries > 0 {
-		req, err := http.NewRequest("GET", fmt.Sprintf("http://"+"%s/%s", s.HTTPServer.Addr, strings.Trim(s.LivenessProbeURL, "/")), nil)
+		req, err := http.NewRequest("GET", s.URL(strings.Trim(s.LivenessProbeURL, "/")), nil)
 		if err != nil {
 			wait()
 			continue
 		}
-		resp, err := new(http.Client).Do(req)
+		resp, err := s.selfClient().Do(req)
 		if err != nil {
 			wait()
 			continue
@@ -117,35 +363,90 @@ func (s *Server) WaitForLiveness() bool {
 	return live
 }
 
+// Listen binds the listen address, a port 0 picks any free port. Start calls
+// it unless it was called before, calling it first tells the actual address
+// through Addr before the server starts.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return nil
+	}
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	cfg, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+	var l net.Listener
+	if s.ReusePort {
+		l, err = listenReusePort(network, s.HTTPServer.Addr)
+	} else {
+		l, err = net.Listen(network, s.HTTPServer.Addr)
+	}
+	if err != nil {
+		return fmt.Errorf("could not listen on %s (%s): %v", s.HTTPServer.Addr, network, err)
+	}
+	if cfg != nil {
+		l = tls.NewListener(l, cfg)
+	}
+	s.tls = cfg
+	s.listener = l
+	return nil
+}
+
+// Addr returns the address the server is bound to, or the configured listen
+// address if it isn't listening yet
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return s.HTTPServer.Addr
+	}
+	return s.listener.Addr().String()
+}
+
 // Start starts the server and blocks until it's shut down
 func (s *Server) Start() {
+	if err := s.Listen(); err != nil {
+		log.Fatalf("[%s] %v", s.Name, err)
+	}
 	go func() {
-		if err := s.HTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.HTTPServer.Serve(s.listener); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("[%s] Could not start server", s.Name)
 		}
 	}()
-	log.Infof("[%s] started on %s", s.Name, s.HTTPServer.Addr)
+	log.Infof("[%s] started on %s", s.Name, s.Addr())
 	s.WaitForShutDown()
 }
 
-// GracefulShutdown shut down provides a safe mechanism tu shut the server down
+// GracefulShutdown shut down provides a safe mechanism tu shut the server down.
+// It confirms the shutdown when the server asks for it.
 func (s *Server) GracefulShutdown() {
 	log.Infof("Shutting down %s", s.Name)
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://"+"%s/%s", s.HTTPServer.Addr, strings.Trim(s.ShutdownURL, "/")), nil)
+	client := s.selfClient()
+	shutdownURL := s.URL(strings.Trim(s.ShutdownURL, "/"))
+	status, body, err := getBody(client, shutdownURL)
+	if err == nil && status == http.StatusAccepted {
+		status, body, err = getBody(client, shutdownURL+"?token="+url.QueryEscape(body))
+	}
 	if err != nil {
 		log.Errorf("Could not send shutdown request to %s Server: %v", s.Name, err)
+		return
 	}
-	client := http.Client{}
-	resp, err := client.Do(req)
+	log.Infof("Server status: %s", body)
+}
+
+func getBody(client *http.Client, url string) (int, string, error) {
+	resp, err := client.Get(url)
 	if err != nil {
-		log.Errorf("Error sending request: %v", err)
+		return 0, "", err
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Warnf("Could not read shutdown response: %v", body)
-	}
-	log.Infof("Server status: %s", string(body))
+	return resp.StatusCode, string(body), err
 }
 
 // NewServer Builds a new server
@@ -157,8 +458,18 @@ func NewServer(name string, opts ServerOptions) *Server {
 			ReadTimeout:  opts.ReadTimeOut,
 			WriteTimeout: opts.WriteTimeOut,
 		},
-		LivenessProbeURL: opts.LivenessProbeURL,
-		ShutdownURL:      opts.ShutdownURL,
-		ShutdownReq:      make(chan bool),
+		Network:             opts.Network,
+		ReusePort:           opts.ReusePort,
+		LivenessProbeURL:    opts.LivenessProbeURL,
+		ReadinessProbeURL:   opts.ReadinessProbeURL,
+		ShutdownURL:         opts.ShutdownURL,
+		ShutdownReq:         make(chan bool),
+		ShutdownAllowRemote: opts.ShutdownAllowRemote,
+		ShutdownConfirm:     opts.ShutdownConfirm,
+		RunDuration:         opts.RunDuration,
+		TLSCertFile:         opts.TLSCertFile,
+		TLSKeyFile:          opts.TLSKeyFile,
+		TLSClientCAFile:     opts.TLSClientCAFile,
+		Clock:               SystemClock,
 	}
 }
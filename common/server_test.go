@@ -1,8 +1,11 @@
 package common
 
 import (
-	"fmt"
-	"strconv"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
 	"testing"
 	"time"
 
@@ -16,22 +19,23 @@ func newTestServer(serverOpts ServerOptions) *Server {
 	router := mux.NewRouter()
 	router.HandleFunc(serverOpts.ShutdownURL, s.ShutDownHandler).Methods("GET")
 	router.HandleFunc(serverOpts.LivenessProbeURL, s.LivenessProbeHandler).Methods("GET")
-	s.HTTPServer.Handler = router
+	router.HandleFunc("/status/addr", s.AddrHandler).Methods("GET")
+	s.HTTPServer.Handler = s.Track(router)
 	return s
 }
 
 func setup(up chan bool) {
-	testServerPort := strconv.Itoa(PickRandomTCPPort())
-	testServerListenAddress := fmt.Sprintf("127.0.0.1:%s", testServerPort)
-
 	sOpts := ServerOptions{
-		ListenAddress:    testServerListenAddress,
+		ListenAddress:    "127.0.0.1:0",
 		LivenessProbeURL: "/health",
 		ShutdownURL:      "/shutdown",
 		ReadTimeOut:      10 * time.Second,
 		WriteTimeOut:     10 * time.Second,
 	}
 	testServer = newTestServer(sOpts)
+	if err := testServer.Listen(); err != nil {
+		panic(err)
+	}
 
 	go func() {
 		testServer.Start()
@@ -52,6 +56,127 @@ func TestWaitForLiveness(t *testing.T) {
 	}
 }
 
+func TestAddrHandler(t *testing.T) {
+	if testServer.Addr() == "127.0.0.1:0" {
+		t.Fatalf("Port 0 wasn't resolved")
+	}
+	rr := httptest.NewRecorder()
+	testServer.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/status/addr", nil))
+	body, _ := ioutil.ReadAll(rr.Body)
+	if rr.Code != http.StatusOK || string(body) != testServer.Addr() {
+		t.Errorf("Got %d %q, want %q", rr.Code, body, testServer.Addr())
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	s := newTestServer(ServerOptions{ListenAddress: "127.0.0.1:0", RunDuration: 50 * time.Millisecond})
+	stopped := make(chan struct{})
+	go func() {
+		s.Start()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Server still running after its run duration")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	s := NewServer("tracked", ServerOptions{})
+	var during int64
+	h := s.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		during = s.InFlight()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if during != 1 || s.InFlight() != 0 {
+		t.Errorf("Got %d requests in flight while serving and %d after, want 1 and 0", during, s.InFlight())
+	}
+}
+
+func TestReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not supported on windows")
+	}
+	first := NewServer("first", ServerOptions{ListenAddress: "127.0.0.1:0", ReusePort: true})
+	if err := first.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer first.listener.Close()
+	second := NewServer("second", ServerOptions{ListenAddress: first.Addr(), ReusePort: true})
+	if err := second.Listen(); err != nil {
+		t.Fatalf("Could not share %s: %v", first.Addr(), err)
+	}
+	second.listener.Close()
+
+	third := NewServer("third", ServerOptions{ListenAddress: first.Addr()})
+	if err := third.Listen(); err == nil {
+		third.listener.Close()
+		t.Errorf("Listening without SO_REUSEPORT on %s should fail", first.Addr())
+	}
+}
+
+func TestShutDownProtection(t *testing.T) {
+	shutdown := func(s *Server, remoteAddr, target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		s.ShutDownHandler(rr, r)
+		return rr
+	}
+
+	s := NewServer("loopback", ServerOptions{})
+	if rr := shutdown(s, "192.0.2.1:1234", "/shutdown"); rr.Code != http.StatusForbidden || s.ShutdownReqCount != 0 {
+		t.Errorf("Remote shutdown: got %d, %d requests, want 403 and none", rr.Code, s.ShutdownReqCount)
+	}
+	proxied := httptest.NewRequest("GET", "/shutdown", nil)
+	proxied.RemoteAddr = "127.0.0.1:1234"
+	proxied.Header.Set("X-Forwarded-For", "192.0.2.1")
+	rr := httptest.NewRecorder()
+	s.ShutDownHandler(rr, proxied)
+	if rr.Code != http.StatusForbidden || s.ShutdownReqCount != 0 {
+		t.Errorf("Proxied shutdown: got %d, %d requests, want 403 and none", rr.Code, s.ShutdownReqCount)
+	}
+	if rr := shutdown(s, "[::1]:1234", "/shutdown"); rr.Code != http.StatusOK || s.ShutdownReqCount != 1 {
+		t.Errorf("Loopback shutdown: got %d, %d requests, want 200 and one", rr.Code, s.ShutdownReqCount)
+	}
+	<-s.ShutdownReq
+
+	s = NewServer("confirm", ServerOptions{ShutdownAllowRemote: true, ShutdownConfirm: true})
+	rr = shutdown(s, "192.0.2.1:1234", "/shutdown")
+	token := rr.Body.String()
+	if rr.Code != http.StatusAccepted || token == "" || s.ShutdownReqCount != 0 {
+		t.Fatalf("First step: got %d %q, %d requests, want 202, a token and none", rr.Code, token, s.ShutdownReqCount)
+	}
+	if rr := shutdown(s, "192.0.2.1:1234", "/shutdown?token=wrong"); rr.Code != http.StatusForbidden {
+		t.Errorf("Wrong token: got %d %q, want 403", rr.Code, rr.Body.String())
+	}
+	// Another client doesn't replace the pending token
+	if rr := shutdown(s, "192.0.2.2:1234", "/shutdown"); rr.Code != http.StatusConflict {
+		t.Errorf("Second request: got %d %q, want 409", rr.Code, rr.Body.String())
+	}
+	if rr := shutdown(s, "192.0.2.1:1234", "/shutdown?token="+token); rr.Code != http.StatusOK || s.ShutdownReqCount != 1 {
+		t.Errorf("Confirmed shutdown: got %d, %d requests, want 200 and one", rr.Code, s.ShutdownReqCount)
+	}
+	<-s.ShutdownReq
+	if rr := shutdown(s, "192.0.2.1:1234", "/shutdown?token="+token); rr.Code != http.StatusForbidden {
+		t.Errorf("Replayed token: got %d, want 403", rr.Code)
+	}
+
+	// Expired tokens neither confirm the shutdown nor block new ones
+	clock := NewFakeClock(time.Now())
+	s = NewServer("expiry", ServerOptions{ShutdownAllowRemote: true, ShutdownConfirm: true})
+	s.Clock = clock
+	token = shutdown(s, "192.0.2.1:1234", "/shutdown").Body.String()
+	clock.Advance(shutdownTokenTTL + time.Second)
+	if rr := shutdown(s, "192.0.2.1:1234", "/shutdown?token="+token); rr.Code != http.StatusForbidden || s.ShutdownReqCount != 0 {
+		t.Errorf("Expired token: got %d, %d requests, want 403 and none", rr.Code, s.ShutdownReqCount)
+	}
+	if rr := shutdown(s, "192.0.2.2:1234", "/shutdown"); rr.Code != http.StatusAccepted {
+		t.Errorf("Request after the expiry: got %d, want 202", rr.Code)
+	}
+}
+
 func TestMain(m *testing.M) {
 	up := make(chan bool)
 	setup(up)
@@ -59,3 +184,78 @@ func TestMain(m *testing.M) {
 	m.Run()
 	tearDown()
 }
+
+func TestLivenessProbeHandler(t *testing.T) {
+	s := NewServer("checked", ServerOptions{})
+	var apiErr error
+	s.HealthChecks = []HealthCheck{
+		{Name: "api", Check: func() error { return apiErr }},
+		{Name: "cache", Check: func() error { return nil }},
+	}
+	cases := []struct {
+		query, apiErr string
+		code          int
+		body          string
+	}{
+		{"", "", http.StatusOK, "OK"},
+		{"?verbose=1", "", http.StatusOK, "[+]api ok\n[+]cache ok\nhealthz check passed\n"},
+		{"", "unreachable", http.StatusInternalServerError, "[-]api failed: unreachable\n[+]cache ok\nhealthz check failed\n\n"},
+		{"?exclude=api", "unreachable", http.StatusOK, "OK"},
+		{"?exclude=api&verbose", "unreachable", http.StatusOK, "[+]api excluded: ok\n[+]cache ok\nhealthz check passed\n"},
+	}
+	for _, c := range cases {
+		apiErr = nil
+		if c.apiErr != "" {
+			apiErr = errors.New(c.apiErr)
+		}
+		rr := httptest.NewRecorder()
+		s.LivenessProbeHandler(rr, httptest.NewRequest("GET", "/health"+c.query, nil))
+		if rr.Code != c.code || rr.Body.String() != c.body {
+			t.Errorf("%q with %q: got %d %q, want %d %q", c.query, c.apiErr, rr.Code, rr.Body.String(), c.code, c.body)
+		}
+	}
+}
+
+func TestReadinessProbeHandler(t *testing.T) {
+	s := NewServer("checked", ServerOptions{})
+	s.HealthChecks = []HealthCheck{{Name: "cache", Check: func() error { return nil }}}
+	s.ReadinessChecks = []HealthCheck{{Name: "api", Check: func() error { return errors.New("unreachable") }}}
+
+	rr := httptest.NewRecorder()
+	s.LivenessProbeHandler(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Liveness failed on a readiness check: %d %q", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	s.ReadinessProbeHandler(rr, httptest.NewRequest("GET", "/ready", nil))
+	if expected := "[+]cache ok\n[-]api failed: unreachable\nreadyz check failed\n\n"; rr.Code != http.StatusInternalServerError || rr.Body.String() != expected {
+		t.Errorf("Got %d %q, want %d %q", rr.Code, rr.Body.String(), http.StatusInternalServerError, expected)
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	cases := []struct {
+		network string
+		address string
+		listens bool
+	}{
+		{"tcp4", "127.0.0.1:0", true},
+		{"tcp4", "[::1]:0", false},
+		{"tcp6", "127.0.0.1:0", false},
+		{"tcp6", "[::1]:0", true},
+	}
+	for _, c := range cases {
+		s := NewServer("network", ServerOptions{ListenAddress: c.address, Network: c.network})
+		err := s.Listen()
+		if err == nil {
+			s.listener.Close()
+		}
+		if c.network == "tcp6" && c.listens && err != nil {
+			t.Logf("Skipping %s on %s, IPv6 unavailable: %v", c.network, c.address, err)
+			continue
+		}
+		if (err == nil) != c.listens {
+			t.Errorf("%s on %s: got %v, want listening %v", c.network, c.address, err, c.listens)
+		}
+	}
+}
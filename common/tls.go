@@ -0,0 +1,75 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// tlsConfig builds the TLS configuration of the server out of its
+// certificate files, nil when it serves plain HTTP
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if s.TLSCertFile == "" && s.TLSKeyFile == "" {
+		if s.TLSClientCAFile != "" {
+			return nil, errors.New("a TLS client CA requires a TLS certificate and key")
+		}
+		return nil, nil
+	}
+	if s.TLSCertFile == "" || s.TLSKeyFile == "" {
+		return nil, errors.New("both a TLS certificate and key are required")
+	}
+	cert, err := tls.LoadX509KeyPair(s.TLSCertFile, s.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load the TLS certificate: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if s.TLSClientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := ioutil.ReadFile(s.TLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the TLS client CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", s.TLSClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// URL returns the URL of path on the address the server is bound to
+func (s *Server) URL(path string) string {
+	scheme := "http"
+	if s.TLSCertFile != "" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, s.Addr(), strings.TrimLeft(path, "/"))
+}
+
+// selfClient is the client the server calls itself with, e.g. to check its
+// liveness. As it calls its own address, the server certificate isn't
+// verified, and it's presented as client certificate, so mutual TLS only
+// accepts these calls when it's signed by the client CA.
+func (s *Server) selfClient() *http.Client {
+	s.mu.Lock()
+	cfg := s.tls
+	s.mu.Unlock()
+	if cfg == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			Certificates:       cfg.Certificates,
+			InsecureSkipVerify: true,
+		},
+	}}
+}
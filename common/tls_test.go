@@ -0,0 +1,120 @@
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1, usable as
+// CA, server and client certificate, returning the certificate and key files
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "instaclustr_exporter"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeCertificate(t, dir)
+
+	cases := []struct {
+		name     string
+		clientCA string
+		// plainOK tells whether a client without certificate is served
+		plainOK bool
+	}{
+		{"tls", "", true},
+		{"mtls", certFile, false},
+	}
+	for _, c := range cases {
+		s := NewServer(c.name, ServerOptions{
+			ListenAddress:    "127.0.0.1:0",
+			LivenessProbeURL: "/health",
+			TLSCertFile:      certFile,
+			TLSKeyFile:       keyFile,
+			TLSClientCAFile:  c.clientCA,
+		})
+		router := mux.NewRouter()
+		router.HandleFunc("/health", s.LivenessProbeHandler).Methods("GET")
+		s.HTTPServer.Handler = router
+		if err := s.Listen(); err != nil {
+			t.Fatal(err)
+		}
+		go s.HTTPServer.Serve(s.listener)
+
+		if !s.WaitForLiveness() {
+			t.Errorf("%s: not live over HTTPS", c.name)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		resp, err := client.Get(s.URL("/health"))
+		if err == nil {
+			resp.Body.Close()
+		}
+		if ok := err == nil; ok != c.plainOK {
+			t.Errorf("%s: client without certificate served %v, expected %v (%v)", c.name, ok, c.plainOK, err)
+		}
+		if _, err := http.Get(s.URL("/health")); err == nil {
+			t.Errorf("%s: certificate not checked by the default client", c.name)
+		}
+		s.HTTPServer.Close()
+	}
+
+	for _, opts := range []ServerOptions{
+		{TLSCertFile: certFile},
+		{TLSClientCAFile: certFile},
+		{TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "missing.pem")},
+		{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: keyFile},
+	} {
+		opts.ListenAddress = "127.0.0.1:0"
+		if err := NewServer("invalid", opts).Listen(); err == nil {
+			t.Errorf("%+v should be invalid", opts)
+		}
+	}
+}
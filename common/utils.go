@@ -6,7 +6,9 @@ import (
 	"github.com/prometheus/common/log"
 )
 
-// PickRandomTCPPort picks free TCP Port from localhost
+// PickRandomTCPPort picks free TCP Port from localhost. The port is released
+// before returning, so it may be taken by someone else before it's used;
+// prefer listening on port 0 with Server.Listen.
 func PickRandomTCPPort() int {
 	addr, err := net.ResolveTCPAddr("tcp", "localhost:0")
 	if err != nil {
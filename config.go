@@ -0,0 +1,340 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fcgravalos/instaclustr_exporter/archive"
+	"github.com/fcgravalos/instaclustr_exporter/cmdb"
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/fcgravalos/instaclustr_exporter/kubernetes"
+	"github.com/fcgravalos/instaclustr_exporter/webhook"
+)
+
+const redactedSecret = "<secret>"
+
+// config holds the whole exporter configuration
+type config struct {
+	TelemetryPath string
+	Server        common.ServerOptions
+	Instaclustr   instaclustr.Config
+	Collector     collector.ExporterOptions
+	Archive       archive.Config
+	CMDB          cmdb.Config
+	Webhook       webhook.Config
+	Kubernetes    kubernetes.Config
+	Compare       collector.CompareOptions
+	// Peers are the base URLs of the replicas whose configuration should match this one
+	Peers []string
+	// InstanceIDFile persists the ID of this instance, a new one is generated on every start if empty
+	InstanceIDFile string
+	// Shard names the part of the estate this instance collects
+	Shard string
+	// ExternalURL is the URL the exporter is reachable at, e.g. through a reverse proxy
+	ExternalURL string
+	// RoutePrefix prefixes every route, the path of ExternalURL if empty
+	RoutePrefix string
+	// ReloadAllowRemote accepts reload requests from any address, only
+	// loopback ones otherwise
+	ReloadAllowRemote bool
+	// CORSOrigins are the browser origins allowed to read the JSON endpoints
+	CORSOrigins []string
+	// KeyRotationDue are the dates the API keys are due for rotation by
+	KeyRotationDue map[string]time.Time
+	// ProvisioningAPIKeyFile and MonitoringAPIKeyFile hold the API keys,
+	// e.g. mounted Kubernetes or Docker secrets
+	ProvisioningAPIKeyFile string
+	MonitoringAPIKeyFile   string
+}
+
+// cleanPrefix turns a path into a route prefix: a leading slash, no trailing
+// one, empty for the root
+func cleanPrefix(p string) string {
+	return strings.TrimRight("/"+strings.Trim(p, "/"), "/")
+}
+
+// externalPath is the path prefix of the links, as seen by browsers
+func (c config) externalPath() string {
+	if c.ExternalURL == "" {
+		return c.routePrefix()
+	}
+	u, err := url.Parse(c.ExternalURL)
+	if err != nil {
+		return c.routePrefix()
+	}
+	return cleanPrefix(u.Path)
+}
+
+// routePrefix is the path prefix every route is served under
+func (c config) routePrefix() string {
+	if c.RoutePrefix != "" {
+		return cleanPrefix(c.RoutePrefix)
+	}
+	if c.ExternalURL == "" {
+		return ""
+	}
+	u, err := url.Parse(c.ExternalURL)
+	if err != nil {
+		return ""
+	}
+	return cleanPrefix(u.Path)
+}
+
+// redacted returns a copy of the configuration with its secrets masked
+func (c config) redacted() config {
+	if c.Instaclustr.ProvisioningAPIKey != "" {
+		c.Instaclustr.ProvisioningAPIKey = redactedSecret
+	}
+	if c.Instaclustr.MonitoringAPIKey != "" {
+		c.Instaclustr.MonitoringAPIKey = redactedSecret
+	}
+	if c.Compare.Other.ProvisioningAPIKey != "" {
+		c.Compare.Other.ProvisioningAPIKey = redactedSecret
+	}
+	if c.Archive.SecretKey != "" {
+		c.Archive.SecretKey = redactedSecret
+	}
+	if c.CMDB.Header != "" {
+		c.CMDB.Header = redactedSecret
+	}
+	if c.Webhook.Header != "" {
+		c.Webhook.Header = redactedSecret
+	}
+	// API headers may carry credentials, e.g. of a gateway in front of the API
+	for _, h := range []*string{
+		&c.Instaclustr.ProvisioningHeader, &c.Instaclustr.MonitoringHeader,
+		&c.Compare.Other.ProvisioningHeader, &c.Compare.Other.MonitoringHeader,
+	} {
+		if *h != "" {
+			*h = redactedSecret
+		}
+	}
+	c.Instaclustr.Proxy = redactedURL(c.Instaclustr.Proxy)
+	c.Compare.Other.Proxy = redactedURL(c.Compare.Other.Proxy)
+	return c
+}
+
+// redactedURL returns u with its password, e.g. the one of a proxy, redacted
+func redactedURL(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.User == nil {
+		return u
+	}
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), redactedSecret)
+	}
+	return parsed.String()
+}
+
+// hash fingerprints the redacted configuration so replicas can be compared.
+// Peers and the instance identity are left out, they differ between replicas.
+func (c config) hash() string {
+	r := c.redacted()
+	r.Peers = nil
+	r.InstanceIDFile = ""
+	r.Shard = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		// config only holds plain types, it always marshals
+		panic(err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// applyEnvironment makes the environment variables take precedence over the
+// flags and the configuration file
+func (c *config) applyEnvironment() {
+	if os.Getenv("INSTACLUSTR_USER") != "" {
+		c.Instaclustr.User = os.Getenv("INSTACLUSTR_USER")
+	}
+
+	if os.Getenv("PROVISIONING_API_KEY_FILE") != "" {
+		c.ProvisioningAPIKeyFile = os.Getenv("PROVISIONING_API_KEY_FILE")
+	}
+
+	if os.Getenv("MONITORING_API_KEY_FILE") != "" {
+		c.MonitoringAPIKeyFile = os.Getenv("MONITORING_API_KEY_FILE")
+	}
+
+	if os.Getenv("PROVISIONING_API_KEY") != "" {
+		c.Instaclustr.ProvisioningAPIKey = os.Getenv("PROVISIONING_API_KEY")
+	}
+
+	if os.Getenv("MONITORING_API_KEY") != "" {
+		c.Instaclustr.MonitoringAPIKey = os.Getenv("MONITORING_API_KEY")
+	}
+
+	if os.Getenv("COMPARE_PROVISIONING_API_KEY") != "" {
+		c.Compare.Other.ProvisioningAPIKey = os.Getenv("COMPARE_PROVISIONING_API_KEY")
+	}
+
+	// The compared account is reached like the collected one
+	c.Compare.Other.Url = c.Instaclustr.Url
+	c.Compare.Other.Network = c.Instaclustr.Network
+	c.Compare.Other.Proxy = c.Instaclustr.Proxy
+	c.Compare.Other.CAFile = c.Instaclustr.CAFile
+	c.Compare.Other.InsecureSkipVerify = c.Instaclustr.InsecureSkipVerify
+	c.Compare.Other.MaxIdleConnsPerHost = c.Instaclustr.MaxIdleConnsPerHost
+	c.Compare.Other.IdleConnTimeout = c.Instaclustr.IdleConnTimeout
+	c.Compare.Other.RequestTimeout = c.Instaclustr.RequestTimeout
+	c.Compare.Other.MaxResponseSize = c.Instaclustr.MaxResponseSize
+	c.Compare.Other.MonitoringPeriod = c.Instaclustr.MonitoringPeriod
+	c.Compare.Other.MonitoringAPIVersion = c.Instaclustr.MonitoringAPIVersion
+	c.Compare.Other.MonitoringHeader = c.Instaclustr.MonitoringHeader
+	c.Compare.Other.ProvisioningHeader = c.Instaclustr.ProvisioningHeader
+	c.Compare.Other.MaxRetries = c.Instaclustr.MaxRetries
+	c.Compare.Other.RetryBackoff = c.Instaclustr.RetryBackoff
+	c.Compare.Other.RateLimit = c.Instaclustr.RateLimit
+	c.Compare.Other.RateBurst = c.Instaclustr.RateBurst
+	c.Compare.Other.ProvisioningPolicy = c.Instaclustr.ProvisioningPolicy
+	c.Compare.Other.MonitoringPolicy = c.Instaclustr.MonitoringPolicy
+
+	if os.Getenv("ARCHIVE_ACCESS_KEY") != "" {
+		c.Archive.AccessKey = os.Getenv("ARCHIVE_ACCESS_KEY")
+	}
+
+	if os.Getenv("ARCHIVE_SECRET_KEY") != "" {
+		c.Archive.SecretKey = os.Getenv("ARCHIVE_SECRET_KEY")
+	}
+
+	if os.Getenv("CMDB_HEADER") != "" {
+		c.CMDB.Header = os.Getenv("CMDB_HEADER")
+	}
+
+	if os.Getenv("WEBHOOK_HEADER") != "" {
+		c.Webhook.Header = os.Getenv("WEBHOOK_HEADER")
+	}
+}
+
+// readKeyFiles reads the API keys out of their files, unless the environment
+// gives them. The files are read on every reload, so keys rotated in the
+// mounted secrets are picked up without restarting.
+func (c *config) readKeyFiles() error {
+	for _, k := range []struct {
+		path, env string
+		key       *string
+	}{
+		{c.ProvisioningAPIKeyFile, "PROVISIONING_API_KEY", &c.Instaclustr.ProvisioningAPIKey},
+		{c.MonitoringAPIKeyFile, "MONITORING_API_KEY", &c.Instaclustr.MonitoringAPIKey},
+	} {
+		if k.path == "" || os.Getenv(k.env) != "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(k.path)
+		if err != nil {
+			return fmt.Errorf("could not read the API key: %v", err)
+		}
+		if *k.key = strings.TrimSpace(string(data)); *k.key == "" {
+			return fmt.Errorf("API key file %s is empty", k.path)
+		}
+	}
+	return nil
+}
+
+// validate checks the settings the exporter can't run with
+func (c config) validate() error {
+	if c.Instaclustr.MonitoringPeriod != "" {
+		if _, err := time.ParseDuration(c.Instaclustr.MonitoringPeriod); err != nil {
+			return fmt.Errorf("invalid monitoring period %q: %v", c.Instaclustr.MonitoringPeriod, err)
+		}
+	}
+
+	if c.Instaclustr.Proxy != "" {
+		if u, err := url.Parse(c.Instaclustr.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid instaclustr.proxy-url %q, expected an absolute URL", redactedURL(c.Instaclustr.Proxy))
+		}
+	}
+
+	if c.Instaclustr.CAFile != "" {
+		if _, err := instaclustr.LoadCAFile(c.Instaclustr.CAFile); err != nil {
+			return fmt.Errorf("invalid instaclustr.ca-file: %v", err)
+		}
+	}
+
+	if c.Instaclustr.MaxIdleConnsPerHost < 0 || c.Instaclustr.IdleConnTimeout < 0 || c.Instaclustr.RequestTimeout < 0 {
+		return fmt.Errorf("invalid InstaClustr connection settings, expected instaclustr.max-idle-conns-per-host, instaclustr.idle-conn-timeout and instaclustr.request-timeout of 0 or more")
+	}
+
+	if c.Collector.MaxLabelLength < 0 {
+		return fmt.Errorf("invalid collector.max-label-length %d, expected 0 or more", c.Collector.MaxLabelLength)
+	}
+
+	if !utf8.ValidString(c.Instaclustr.Alias) {
+		return fmt.Errorf("invalid instaclustr.alias %q, expected UTF-8", c.Instaclustr.Alias)
+	}
+
+	if v := c.Instaclustr.MonitoringAPIVersion; v != "v1" && v != instaclustr.MonitoringAPIV2 {
+		return fmt.Errorf("invalid monitoring API version %q, expected v1 or v2", v)
+	}
+
+	for _, h := range []string{c.Instaclustr.MonitoringHeader, c.Instaclustr.ProvisioningHeader, c.CMDB.Header, c.Webhook.Header} {
+		if h == "" {
+			continue
+		}
+		if _, _, err := instaclustr.ParseHeader(h); err != nil {
+			return err
+		}
+	}
+	// The API headers would replace the basic authentication of the API keys
+	for _, h := range []string{c.Instaclustr.MonitoringHeader, c.Instaclustr.ProvisioningHeader} {
+		if name, _, _ := instaclustr.ParseHeader(h); strings.EqualFold(name, "Authorization") {
+			return fmt.Errorf("invalid API header %s, the API is authenticated with the API keys", name)
+		}
+	}
+
+	for field, source := range c.CMDB.Fields {
+		if !inventoryField(source) {
+			return fmt.Errorf("invalid cmdb.fields %s=%s, expected one of the inventory fields %v", field, source, collector.InventoryFields())
+		}
+	}
+
+	for _, hook := range c.Webhook.URLs {
+		if u, err := url.Parse(hook); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid webhook.urls %q, expected absolute URLs", hook)
+		}
+	}
+
+	if c.Webhook.CAFile != "" {
+		if _, err := instaclustr.LoadCAFile(c.Webhook.CAFile); err != nil {
+			return fmt.Errorf("invalid webhook.ca-file: %v", err)
+		}
+	}
+
+	if c.ExternalURL != "" {
+		if u, err := url.Parse(c.ExternalURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid web.external-url %q, expected an absolute URL", c.ExternalURL)
+		}
+	}
+
+	for _, percent := range []float64{c.Instaclustr.FaultFailurePercent, c.Instaclustr.FaultDelayPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("invalid fault percentage %g, expected 0 to 100", percent)
+		}
+	}
+
+	for _, network := range []string{c.Server.Network, c.Instaclustr.Network} {
+		if !validNetwork(network) {
+			return fmt.Errorf("invalid network %q, expected one of %v", network, common.Networks)
+		}
+	}
+	return nil
+}
+
+// inventoryField tells whether field is one of the node inventory fields
+func inventoryField(field string) bool {
+	for _, f := range collector.InventoryFields() {
+		if field == f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const jsonContentType = "application/json; charset=utf-8"
+
+// corsOrigins are the browser origins allowed to read the JSON endpoints, *
+// allows any
+type corsOrigins []string
+
+func parseCORSOrigins(s string) corsOrigins {
+	if s == "" {
+		return nil
+	}
+	origins := corsOrigins{}
+	for _, o := range strings.Split(s, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+func (c corsOrigins) allowed(origin string) bool {
+	for _, o := range c {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonEndpoint serves h with a strict JSON content type and, for the allowed
+// origins, the CORS headers browsers need to read it. Preflight requests are
+// answered without calling h.
+func (c corsOrigins) jsonEndpoint(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if origin := r.Header.Get("Origin"); origin != "" {
+			header.Add("Vary", "Origin")
+			if c.allowed(origin) {
+				header.Set("Access-Control-Allow-Origin", origin)
+				header.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			}
+		}
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONEndpoint(t *testing.T) {
+	origins := parseCORSOrigins("https://dashboards.example.com/, https://grafana.example.com")
+	called := false
+	h := origins.jsonEndpoint(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Header().Set("Content-Type", jsonContentType)
+		w.Write([]byte("{}"))
+	})
+
+	cases := []struct {
+		method  string
+		origin  string
+		allowed string
+		called  bool
+	}{
+		{"GET", "", "", true},
+		{"GET", "https://dashboards.example.com", "https://dashboards.example.com", true},
+		{"GET", "https://evil.example.com", "", true},
+		{"OPTIONS", "https://grafana.example.com", "https://grafana.example.com", false},
+	}
+	for _, c := range cases {
+		called = false
+		req := httptest.NewRequest(c.method, configURL, nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != c.allowed {
+			t.Errorf("%s from %q: got allowed origin %q want %q", c.method, c.origin, got, c.allowed)
+		}
+		if called != c.called {
+			t.Errorf("%s from %q: handler called %v, want %v", c.method, c.origin, called, c.called)
+		}
+		if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s from %q: content type sniffing not disabled", c.method, c.origin)
+		}
+	}
+
+	if !parseCORSOrigins("*").allowed("https://any.example.com") {
+		t.Errorf("* should allow any origin")
+	}
+	if parseCORSOrigins("").allowed("https://any.example.com") {
+		t.Errorf("No origin should be allowed by default")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// rotationDateLayout is the layout of the key rotation due dates
+const rotationDateLayout = "2006-01-02"
+
+// rotatedKeys are the API keys a rotation due date can be set for
+var rotatedKeys = []string{"provisioning", "monitoring"}
+
+var credentialRotationDue = prometheus.NewDesc(
+	"instaclustr_credential_rotation_due_timestamp_seconds",
+	"Date the InstaClustr API key is due for rotation by, in unixtime, as configured.",
+	[]string{"key"}, nil,
+)
+
+// parseKeyRotationDue parses key=YYYY-MM-DD pairs, keyed by provisioning or
+// monitoring
+func parseKeyRotationDue(pairs map[string]string) (map[string]time.Time, error) {
+	due := map[string]time.Time{}
+	for key, date := range pairs {
+		key = strings.ToLower(strings.TrimSpace(key))
+		known := false
+		for _, k := range rotatedKeys {
+			known = known || k == key
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown API key %q, expected one of %v", key, rotatedKeys)
+		}
+		t, err := time.Parse(rotationDateLayout, strings.TrimSpace(date))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotation date of the %s key: %v", key, err)
+		}
+		due[key] = t
+	}
+	return due, nil
+}
+
+// splitPairs splits a comma separated list of key=value pairs
+func splitPairs(s string) (map[string]string, error) {
+	pairs := map[string]string{}
+	if s == "" {
+		return pairs, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid pair %q, expected key=value", pair)
+		}
+		pairs[kv[0]] = kv[1]
+	}
+	return pairs, nil
+}
+
+// credentialsCollector exports the configured key rotation due dates. The
+// InstaClustr API doesn't tell when its keys were created nor when they
+// expire, so a rotation policy can only be alerted on through these dates.
+type credentialsCollector struct {
+	cfg func() config
+}
+
+// Describe implements prometheus.Collector
+func (c credentialsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- credentialRotationDue
+}
+
+// Collect implements prometheus.Collector
+func (c credentialsCollector) Collect(ch chan<- prometheus.Metric) {
+	due := c.cfg().KeyRotationDue
+	keys := make([]string, 0, len(due))
+	for key := range due {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ch <- prometheus.MustNewConstMetric(credentialRotationDue, prometheus.GaugeValue, float64(due[key].Unix()), key)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const metricDocsURL = "/docs/metrics"
+
+var metricDocsTemplate = template.Must(template.New("docs").Funcs(template.FuncMap{"join": strings.Join}).Parse(`<html>
+<head><title>InstaClustr Exporter metrics</title></head>
+<body>
+<h1>InstaClustr Exporter metrics</h1>
+<p>Metrics this exporter can emit with its current configuration.</p>
+<table border="1">
+<tr><th>Metric</th><th>Type</th><th>Labels</th><th>Unit</th><th>Instaclustr metric</th><th>Meaning</th></tr>
+{{- range .}}
+<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{join .Labels ", "}}</td><td>{{.Unit}}</td><td>{{.Source}}</td><td>{{.Help}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// metricDocsHandler renders the documentation of the metrics described by
+// collectors, without collecting them
+func metricDocsHandler(collectors ...prometheus.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := metricDocsTemplate.Execute(w, collector.Docs(collectors...)); err != nil {
+			log.Errorf("Could not render the metrics documentation: %v", err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/kubernetes"
+)
+
+// transitionEvent describes a cluster or node status transition as a
+// Kubernetes Event, e.g. a Warning NodeDown or a Normal ClusterRunning
+func transitionEvent(t collector.Transition) kubernetes.Event {
+	e := kubernetes.Event{Type: kubernetes.EventTypeNormal}
+	kind := reasonOf(t.Kind)
+	if t.Down() {
+		e.Type = kubernetes.EventTypeWarning
+		e.Reason = kind + "Down"
+	} else {
+		e.Reason = kind + reasonOf(t.To)
+	}
+	if t.Kind == "cluster" {
+		e.Message = fmt.Sprintf("Instaclustr cluster %s went from %s to %s", t.ID, t.From, t.To)
+	} else {
+		e.Message = fmt.Sprintf("Instaclustr node %s of cluster %s went from %s to %s", t.ID, t.ClusterID, t.From, t.To)
+	}
+	return e
+}
+
+// reasonOf turns a kind or status into a CamelCase Event reason word, e.g.
+// PARTIALLY_RUNNING into PartiallyRunning
+func reasonOf(s string) string {
+	parts := strings.Split(strings.ToLower(s), "_")
+	for i, p := range parts {
+		r, size := utf8.DecodeRuneInString(p)
+		parts[i] = string(unicode.ToUpper(r)) + p[size:]
+	}
+	return strings.Join(parts, "")
+}
+
+// nodeChangesPayload is the JSON the webhooks are notified of node changes with
+type nodeChangesPayload struct {
+	Changes []collector.NodeChange `json:"changes"`
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/kubernetes"
+)
+
+func TestTransitionEvent(t *testing.T) {
+	cases := []struct {
+		t      collector.Transition
+		typ    string
+		reason string
+	}{
+		{collector.Transition{Kind: "node", From: "RUNNING", To: "FAILED"}, kubernetes.EventTypeWarning, "NodeDown"},
+		{collector.Transition{Kind: "cluster", From: "PROVISIONING", To: "RUNNING"}, kubernetes.EventTypeNormal, "ClusterRunning"},
+		{collector.Transition{Kind: "cluster", From: "PROVISIONING", To: "PARTIALLY_RUNNING"}, kubernetes.EventTypeNormal, "ClusterPartiallyRunning"},
+		{collector.Transition{Kind: "node", From: "FAILED", To: "PROVISIONING"}, kubernetes.EventTypeNormal, "NodeProvisioning"},
+	}
+	for _, c := range cases {
+		e := transitionEvent(c.t)
+		if e.Type != c.typ || e.Reason != c.reason {
+			t.Errorf("%+v: got %s %s want %s %s", c.t, e.Type, e.Reason, c.typ, c.reason)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"gopkg.in/yaml.v2"
+)
+
+// fileConfig is the YAML configuration file, with a setting per flag but
+// version and config.file. Settings it has override the flags, settings it
+// lacks keep the flag values.
+type fileConfig struct {
+	// RunDuration shuts the exporter down once elapsed
+	RunDuration *time.Duration `yaml:"run_duration"`
+	Web         struct {
+		ListenAddress   *string        `yaml:"listen_address"`
+		ListenNetwork   *string        `yaml:"listen_network"`
+		ReusePort       *bool          `yaml:"reuse_port"`
+		TelemetryPath   *string        `yaml:"telemetry_path"`
+		TLSCertFile     *string        `yaml:"tls_cert_file"`
+		TLSKeyFile      *string        `yaml:"tls_key_file"`
+		TLSClientCAFile *string        `yaml:"tls_client_ca_file"`
+		ReadTimeout     *time.Duration `yaml:"read_timeout"`
+		WriteTimeout    *time.Duration `yaml:"write_timeout"`
+		// Routes and the URL the exporter is reached at
+		ExternalURL       *string `yaml:"external_url"`
+		RoutePrefix       *string `yaml:"route_prefix"`
+		LivenessProbeURL  *string `yaml:"liveness_probe_url"`
+		ReadinessProbeURL *string `yaml:"readiness_probe_url"`
+		ShutdownURL       *string `yaml:"shutdown_url"`
+		// Who may shut the exporter down or reload it
+		ShutdownAllowRemote *bool    `yaml:"shutdown_allow_remote"`
+		ShutdownConfirm     *bool    `yaml:"shutdown_confirm"`
+		ReloadAllowRemote   *bool    `yaml:"reload_allow_remote"`
+		CORSOrigins         []string `yaml:"cors_origins"`
+		Peers               []string `yaml:"peers"`
+	} `yaml:"web"`
+	Instaclustr struct {
+		User                 *string `yaml:"user"`
+		Alias                *string `yaml:"alias"`
+		ProvisioningAPIKey   *string `yaml:"provisioning_api_key"`
+		MonitoringAPIKey     *string `yaml:"monitoring_api_key"`
+		MonitoringPeriod     *string `yaml:"monitoring_period"`
+		MonitoringAPIVersion *string `yaml:"monitoring_api_version"`
+		// "Name: value" headers of the requests of each API
+		ProvisioningAPIHeader *string `yaml:"provisioning_api_header"`
+		MonitoringAPIHeader   *string `yaml:"monitoring_api_header"`
+		// The files holding the API keys, e.g. mounted secrets
+		ProvisioningAPIKeyFile *string `yaml:"provisioning_api_key_file"`
+		MonitoringAPIKeyFile   *string `yaml:"monitoring_api_key_file"`
+		// KeyRotationDue are key: YYYY-MM-DD dates
+		KeyRotationDue map[string]string `yaml:"key_rotation_due"`
+		// MaxRetries and RetryBackoff of the failing requests
+		MaxRetries   *int           `yaml:"max_retries"`
+		RetryBackoff *time.Duration `yaml:"retry_backoff"`
+		// RateLimit in requests per second, RateBurst requests at once
+		RateLimit *float64 `yaml:"rate_limit"`
+		RateBurst *int     `yaml:"rate_burst"`
+		// Policies of the requests of each API
+		ProvisioningPolicy *instaclustr.APIPolicy `yaml:"provisioning_policy"`
+		MonitoringPolicy   *instaclustr.APIPolicy `yaml:"monitoring_policy"`
+		// Proxy and CAs the API is reached through
+		ProxyURL           *string `yaml:"proxy_url"`
+		CAFile             *string `yaml:"ca_file"`
+		InsecureSkipVerify *bool   `yaml:"insecure_skip_verify"`
+		// Connection pool and timeout of the requests
+		MaxIdleConnsPerHost *int           `yaml:"max_idle_conns_per_host"`
+		IdleConnTimeout     *time.Duration `yaml:"idle_conn_timeout"`
+		RequestTimeout      *time.Duration `yaml:"request_timeout"`
+		Network             *string        `yaml:"network"`
+		MaxResponseSize     *int64         `yaml:"max_response_size"`
+		// Faults injected in staging
+		FaultFailurePercent *float64       `yaml:"fault_failure_percent"`
+		FaultDelayPercent   *float64       `yaml:"fault_delay_percent"`
+		FaultDelay          *time.Duration `yaml:"fault_delay"`
+	} `yaml:"instaclustr"`
+	Collector struct {
+		Profile             *string            `yaml:"profile"`
+		DisableNodeMetrics  *bool              `yaml:"disable_node_metrics"`
+		RepairStatus        *bool              `yaml:"repair_status"`
+		NodeOperations      *bool              `yaml:"node_operations"`
+		KafkaConsumerLag    *bool              `yaml:"kafka_consumer_lag"`
+		CadenceMetrics      *bool              `yaml:"cadence_metrics"`
+		MaintenanceCache    *bool              `yaml:"maintenance_cache"`
+		NodeStatus          *bool              `yaml:"node_status"`
+		NodeStatusValues    map[string]float64 `yaml:"node_status_values"`
+		AggregateNodes      *bool              `yaml:"aggregate_nodes"`
+		TopologyLabels      *bool              `yaml:"topology_labels"`
+		LegacyTopologyNames *bool              `yaml:"legacy_topology_names"`
+		Interval            *time.Duration     `yaml:"interval"`
+		LatencyThreshold    *time.Duration     `yaml:"latency_threshold"`
+		SampleTimestamps    *bool              `yaml:"sample_timestamps"`
+		SampleMaxAge        *time.Duration     `yaml:"sample_max_age"`
+		ParseErrorMode      *string            `yaml:"parse_error_mode"`
+		ParseErrorOverrides map[string]string  `yaml:"parse_error_overrides"`
+		ExtraLabelsFile     *string            `yaml:"extra_labels_file"`
+		DCInclude           []string           `yaml:"dc_include"`
+		ProviderInclude     []string           `yaml:"provider_include"`
+		PinnedClusters      []string           `yaml:"pinned_clusters"`
+		PinnedNodes         []string           `yaml:"pinned_nodes"`
+		NodeMetrics         []string           `yaml:"node_metrics"`
+		TableMetrics        []string           `yaml:"table_metrics"`
+		FederationTargets   map[string]string  `yaml:"federation_targets"`
+		// Units are validated by the collector
+		Units *collector.Units `yaml:"units"`
+		// Concurrency is how many nodes are fetched at the same time
+		Concurrency *int           `yaml:"concurrency"`
+		Timeout     *time.Duration `yaml:"timeout"`
+		// MaxLabelLength in characters, 0 for no limit
+		MaxLabelLength *int `yaml:"max_label_length"`
+		// SanitizeRules are metric: mode[:min:max] rules
+		SanitizeMode       *string           `yaml:"sanitize_mode"`
+		SanitizeRules      map[string]string `yaml:"sanitize_rules"`
+		NotFoundTTL        *time.Duration    `yaml:"not_found_ttl"`
+		QuietWindows       []string          `yaml:"quiet_windows"`
+		MemoryLimit        *uint64           `yaml:"memory_limit"`
+		ClusterConcurrency *int              `yaml:"cluster_concurrency"`
+	} `yaml:"collector"`
+	Archive struct {
+		Endpoint  *string        `yaml:"endpoint"`
+		Bucket    *string        `yaml:"bucket"`
+		Prefix    *string        `yaml:"prefix"`
+		Region    *string        `yaml:"region"`
+		AccessKey *string        `yaml:"access_key"`
+		SecretKey *string        `yaml:"secret_key"`
+		Retention *time.Duration `yaml:"retention"`
+	} `yaml:"archive"`
+	CMDB struct {
+		URL    *string `yaml:"url"`
+		Header *string `yaml:"header"`
+		// Fields are cmdbField: inventoryField pairs
+		Fields   map[string]string `yaml:"fields"`
+		Interval *time.Duration    `yaml:"interval"`
+	} `yaml:"cmdb"`
+	Webhook struct {
+		URLs         []string       `yaml:"urls"`
+		Header       *string        `yaml:"header"`
+		RetryBackoff *time.Duration `yaml:"retry_backoff"`
+		CAFile       *string        `yaml:"ca_file"`
+	} `yaml:"webhook"`
+	Kubernetes struct {
+		Events      *bool   `yaml:"events"`
+		EventObject *string `yaml:"event_object"`
+	} `yaml:"kubernetes"`
+	Instance struct {
+		IDFile *string `yaml:"id_file"`
+		Shard  *string `yaml:"shard"`
+	} `yaml:"instance"`
+	Compare struct {
+		Name               *string `yaml:"name"`
+		OtherName          *string `yaml:"other_name"`
+		User               *string `yaml:"user"`
+		ProvisioningAPIKey *string `yaml:"provisioning_api_key"`
+	} `yaml:"compare"`
+}
+
+func setString(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setDuration(dst *time.Duration, v *time.Duration) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// applyConfigFile returns cfg with the settings of the configuration file at
+// path applied. Unknown settings are rejected, so typos don't go unnoticed.
+func applyConfigFile(path string, cfg config) (config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	var f fileConfig
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return cfg, fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+
+	setDuration(&cfg.Server.RunDuration, f.RunDuration)
+
+	setString(&cfg.Server.ListenAddress, f.Web.ListenAddress)
+	setString(&cfg.Server.Network, f.Web.ListenNetwork)
+	setBool(&cfg.Server.ReusePort, f.Web.ReusePort)
+	setString(&cfg.TelemetryPath, f.Web.TelemetryPath)
+	setString(&cfg.Server.TLSCertFile, f.Web.TLSCertFile)
+	setString(&cfg.Server.TLSKeyFile, f.Web.TLSKeyFile)
+	setString(&cfg.Server.TLSClientCAFile, f.Web.TLSClientCAFile)
+	setDuration(&cfg.Server.ReadTimeOut, f.Web.ReadTimeout)
+	setDuration(&cfg.Server.WriteTimeOut, f.Web.WriteTimeout)
+	setString(&cfg.ExternalURL, f.Web.ExternalURL)
+	setString(&cfg.RoutePrefix, f.Web.RoutePrefix)
+	setString(&cfg.Server.LivenessProbeURL, f.Web.LivenessProbeURL)
+	setString(&cfg.Server.ReadinessProbeURL, f.Web.ReadinessProbeURL)
+	setString(&cfg.Server.ShutdownURL, f.Web.ShutdownURL)
+	setBool(&cfg.Server.ShutdownAllowRemote, f.Web.ShutdownAllowRemote)
+	setBool(&cfg.Server.ShutdownConfirm, f.Web.ShutdownConfirm)
+	setBool(&cfg.ReloadAllowRemote, f.Web.ReloadAllowRemote)
+	if f.Web.CORSOrigins != nil {
+		cfg.CORSOrigins = parseCORSOrigins(strings.Join(f.Web.CORSOrigins, ","))
+	}
+	if f.Web.Peers != nil {
+		cfg.Peers = f.Web.Peers
+	}
+
+	setString(&cfg.Instaclustr.User, f.Instaclustr.User)
+	setString(&cfg.Instaclustr.Alias, f.Instaclustr.Alias)
+	setString(&cfg.Instaclustr.ProvisioningAPIKey, f.Instaclustr.ProvisioningAPIKey)
+	setString(&cfg.Instaclustr.MonitoringAPIKey, f.Instaclustr.MonitoringAPIKey)
+	setString(&cfg.ProvisioningAPIKeyFile, f.Instaclustr.ProvisioningAPIKeyFile)
+	setString(&cfg.MonitoringAPIKeyFile, f.Instaclustr.MonitoringAPIKeyFile)
+	setString(&cfg.Instaclustr.MonitoringPeriod, f.Instaclustr.MonitoringPeriod)
+	setString(&cfg.Instaclustr.MonitoringAPIVersion, f.Instaclustr.MonitoringAPIVersion)
+	setString(&cfg.Instaclustr.ProvisioningHeader, f.Instaclustr.ProvisioningAPIHeader)
+	setString(&cfg.Instaclustr.MonitoringHeader, f.Instaclustr.MonitoringAPIHeader)
+	setString(&cfg.Instaclustr.Network, f.Instaclustr.Network)
+	if f.Instaclustr.MaxResponseSize != nil {
+		cfg.Instaclustr.MaxResponseSize = *f.Instaclustr.MaxResponseSize
+	}
+	if f.Instaclustr.FaultFailurePercent != nil {
+		cfg.Instaclustr.FaultFailurePercent = *f.Instaclustr.FaultFailurePercent
+	}
+	if f.Instaclustr.FaultDelayPercent != nil {
+		cfg.Instaclustr.FaultDelayPercent = *f.Instaclustr.FaultDelayPercent
+	}
+	setDuration(&cfg.Instaclustr.FaultDelay, f.Instaclustr.FaultDelay)
+	if f.Instaclustr.MaxRetries != nil {
+		cfg.Instaclustr.MaxRetries = *f.Instaclustr.MaxRetries
+	}
+	setDuration(&cfg.Instaclustr.RetryBackoff, f.Instaclustr.RetryBackoff)
+	setString(&cfg.Instaclustr.Proxy, f.Instaclustr.ProxyURL)
+	setString(&cfg.Instaclustr.CAFile, f.Instaclustr.CAFile)
+	setBool(&cfg.Instaclustr.InsecureSkipVerify, f.Instaclustr.InsecureSkipVerify)
+	if f.Instaclustr.MaxIdleConnsPerHost != nil {
+		cfg.Instaclustr.MaxIdleConnsPerHost = *f.Instaclustr.MaxIdleConnsPerHost
+	}
+	setDuration(&cfg.Instaclustr.IdleConnTimeout, f.Instaclustr.IdleConnTimeout)
+	setDuration(&cfg.Instaclustr.RequestTimeout, f.Instaclustr.RequestTimeout)
+	if f.Instaclustr.RateLimit != nil {
+		cfg.Instaclustr.RateLimit = *f.Instaclustr.RateLimit
+	}
+	if f.Instaclustr.RateBurst != nil {
+		cfg.Instaclustr.RateBurst = *f.Instaclustr.RateBurst
+	}
+	if f.Instaclustr.ProvisioningPolicy != nil {
+		cfg.Instaclustr.ProvisioningPolicy = *f.Instaclustr.ProvisioningPolicy
+	}
+	if f.Instaclustr.MonitoringPolicy != nil {
+		cfg.Instaclustr.MonitoringPolicy = *f.Instaclustr.MonitoringPolicy
+	}
+	if f.Instaclustr.KeyRotationDue != nil {
+		if cfg.KeyRotationDue, err = parseKeyRotationDue(f.Instaclustr.KeyRotationDue); err != nil {
+			return cfg, fmt.Errorf("invalid configuration file %s: %v", path, err)
+		}
+	}
+
+	c := f.Collector
+	setString(&cfg.Collector.Profile, c.Profile)
+	setBool(&cfg.Collector.DisableNodeMetrics, c.DisableNodeMetrics)
+	setBool(&cfg.Collector.RepairStatus, c.RepairStatus)
+	setBool(&cfg.Collector.NodeOperations, c.NodeOperations)
+	setBool(&cfg.Collector.KafkaConsumerLag, c.KafkaConsumerLag)
+	setBool(&cfg.Collector.CadenceMetrics, c.CadenceMetrics)
+	setBool(&cfg.Collector.MaintenanceCache, c.MaintenanceCache)
+	setBool(&cfg.Collector.NodeStatus, c.NodeStatus)
+	setBool(&cfg.Collector.AggregateNodes, c.AggregateNodes)
+	setBool(&cfg.Collector.TopologyLabels, c.TopologyLabels)
+	setBool(&cfg.Collector.LegacyTopologyNames, c.LegacyTopologyNames)
+	setDuration(&cfg.Collector.CollectionInterval, c.Interval)
+	setDuration(&cfg.Collector.LatencyThreshold, c.LatencyThreshold)
+	setBool(&cfg.Collector.SampleTimestamps, c.SampleTimestamps)
+	setDuration(&cfg.Collector.SampleMaxAge, c.SampleMaxAge)
+	setDuration(&cfg.Collector.Timeout, c.Timeout)
+	setString(&cfg.Collector.ParseErrorMode, c.ParseErrorMode)
+	setString(&cfg.Collector.ExtraLabelsFile, c.ExtraLabelsFile)
+	if c.NodeStatusValues != nil {
+		cfg.Collector.NodeStatusValues = c.NodeStatusValues
+	}
+	if c.ParseErrorOverrides != nil {
+		cfg.Collector.ParseErrorOverrides = c.ParseErrorOverrides
+	}
+	if c.DCInclude != nil {
+		cfg.Collector.DataCentreInclude = c.DCInclude
+	}
+	if c.ProviderInclude != nil {
+		cfg.Collector.ProviderInclude = c.ProviderInclude
+	}
+	if c.PinnedClusters != nil {
+		cfg.Collector.PinnedClusters = c.PinnedClusters
+	}
+	if c.PinnedNodes != nil {
+		cfg.Collector.PinnedNodes = c.PinnedNodes
+	}
+	if c.NodeMetrics != nil {
+		cfg.Collector.NodeMetrics = c.NodeMetrics
+	}
+	if c.TableMetrics != nil {
+		cfg.Collector.TableMetrics = c.TableMetrics
+	}
+	if c.FederationTargets != nil {
+		cfg.Collector.FederationTargets = c.FederationTargets
+	}
+	if c.Units != nil {
+		cfg.Collector.Units = *c.Units
+	}
+	if c.Concurrency != nil {
+		cfg.Collector.NodeConcurrency = *c.Concurrency
+	}
+	if c.MaxLabelLength != nil {
+		cfg.Collector.MaxLabelLength = *c.MaxLabelLength
+	}
+	setString(&cfg.Collector.SanitizeMode, c.SanitizeMode)
+	if c.SanitizeRules != nil {
+		// Named with or without n:: like in collector.sanitize-rules
+		cfg.Collector.SanitizeRules = map[string]string{}
+		for metric, rule := range c.SanitizeRules {
+			cfg.Collector.SanitizeRules[strings.TrimPrefix(metric, "n::")] = rule
+		}
+	}
+	setDuration(&cfg.Collector.NotFoundTTL, c.NotFoundTTL)
+	if c.QuietWindows != nil {
+		cfg.Collector.QuietWindows = c.QuietWindows
+	}
+	if c.MemoryLimit != nil {
+		cfg.Collector.MemoryLimit = *c.MemoryLimit
+	}
+	if c.ClusterConcurrency != nil {
+		cfg.Collector.ClusterConcurrency = *c.ClusterConcurrency
+	}
+
+	setString(&cfg.Archive.Endpoint, f.Archive.Endpoint)
+	setString(&cfg.Archive.Bucket, f.Archive.Bucket)
+	setString(&cfg.Archive.Prefix, f.Archive.Prefix)
+	setString(&cfg.Archive.Region, f.Archive.Region)
+	setString(&cfg.Archive.AccessKey, f.Archive.AccessKey)
+	setString(&cfg.Archive.SecretKey, f.Archive.SecretKey)
+	setDuration(&cfg.Archive.Retention, f.Archive.Retention)
+
+	setString(&cfg.CMDB.URL, f.CMDB.URL)
+	setString(&cfg.CMDB.Header, f.CMDB.Header)
+	if f.CMDB.Fields != nil {
+		cfg.CMDB.Fields = f.CMDB.Fields
+	}
+	setDuration(&cfg.CMDB.Interval, f.CMDB.Interval)
+
+	if f.Webhook.URLs != nil {
+		cfg.Webhook.URLs = f.Webhook.URLs
+	}
+	setString(&cfg.Webhook.Header, f.Webhook.Header)
+	setDuration(&cfg.Webhook.RetryBackoff, f.Webhook.RetryBackoff)
+	setString(&cfg.Webhook.CAFile, f.Webhook.CAFile)
+
+	setBool(&cfg.Kubernetes.Enabled, f.Kubernetes.Events)
+	setString(&cfg.Kubernetes.Object, f.Kubernetes.EventObject)
+
+	setString(&cfg.InstanceIDFile, f.Instance.IDFile)
+	setString(&cfg.Shard, f.Instance.Shard)
+
+	setString(&cfg.Compare.Name, f.Compare.Name)
+	setString(&cfg.Compare.OtherName, f.Compare.OtherName)
+	setString(&cfg.Compare.Other.User, f.Compare.User)
+	setString(&cfg.Compare.Other.ProvisioningAPIKey, f.Compare.ProvisioningAPIKey)
+	return cfg, nil
+}
+
+// loadConfig returns the configuration out of the flags with the
+// configuration file at path, if any, and the environment variables applied
+func loadConfig(path string, flags config) (config, error) {
+	cfg := flags
+	if path != "" {
+		var err error
+		if cfg, err = applyConfigFile(path, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	cfg.applyEnvironment()
+	if err := cfg.readKeyFiles(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
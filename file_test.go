@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/archive"
+	"github.com/fcgravalos/instaclustr_exporter/cmdb"
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/fcgravalos/instaclustr_exporter/kubernetes"
+	"github.com/fcgravalos/instaclustr_exporter/webhook"
+	"gopkg.in/yaml.v2"
+)
+
+func writeConfigFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flags := config{TelemetryPath: "/metrics"}
+	flags.Server.Network = "tcp"
+	flags.Instaclustr.Network = "tcp"
+	flags.Instaclustr.User = "flag-user"
+	flags.Instaclustr.MonitoringAPIVersion = "v1"
+	flags.Collector.Profile = "standard"
+	flags.Collector.RepairStatus = true
+	path := writeConfigFile(t, dir, `
+web:
+  telemetry_path: /prometheus
+instaclustr:
+  user: file-user
+  provisioning_api_key: file-key
+  key_rotation_due: {provisioning: 2027-01-31}
+collector:
+  profile: minimal
+  interval: 1m
+  node_status_values: {warn: 0}
+  pinned_clusters: [c1, c2]
+`)
+	os.Setenv("PROVISIONING_API_KEY", "env-key")
+	defer os.Unsetenv("PROVISIONING_API_KEY")
+	cfg, err := loadConfig(path, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TelemetryPath != "/prometheus" || cfg.Instaclustr.User != "file-user" || cfg.Collector.Profile != "minimal" {
+		t.Errorf("File settings not applied: %+v", cfg)
+	}
+	if cfg.Instaclustr.ProvisioningAPIKey != "env-key" {
+		t.Errorf("Got provisioning API key %q, the environment should take precedence", cfg.Instaclustr.ProvisioningAPIKey)
+	}
+	if due := cfg.KeyRotationDue["provisioning"]; !due.Equal(time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Got provisioning key rotation due %s", due)
+	}
+	if !cfg.Collector.RepairStatus {
+		t.Errorf("Flag missing from the file overridden")
+	}
+	if cfg.Collector.CollectionInterval != time.Minute || cfg.Collector.NodeStatusValues["warn"] != 0 || len(cfg.Collector.PinnedClusters) != 2 {
+		t.Errorf("Got collector options %+v", cfg.Collector)
+	}
+
+	for _, content := range []string{
+		"collector:\n  profiles: minimal\n",
+		"instaclustr:\n  monitoring_api_version: v3\n",
+		"collector: [",
+		"instaclustr:\n  key_rotation_due: {archive: 2027-01-31}\n",
+		"instaclustr:\n  key_rotation_due: {monitoring: 31/01/2027}\n",
+	} {
+		if _, err := loadConfig(writeConfigFile(t, dir, content), flags); err == nil {
+			t.Errorf("%q should be invalid", content)
+		}
+	}
+	if _, err := loadConfig(filepath.Join(dir, "missing.yml"), flags); err == nil {
+		t.Errorf("Missing configuration file loaded")
+	}
+}
+
+// fullConfigFile sets every setting of fileConfig
+const fullConfigFile = `
+run_duration: 5m
+web:
+  listen_address: :9280
+  listen_network: tcp6
+  reuse_port: true
+  telemetry_path: /prometheus
+  tls_cert_file: cert.pem
+  tls_key_file: key.pem
+  tls_client_ca_file: clients.pem
+  read_timeout: 20s
+  write_timeout: 30s
+  external_url: https://example.com/instaclustr
+  route_prefix: /instaclustr
+  liveness_probe_url: /live
+  readiness_probe_url: /readyz
+  shutdown_url: /quit
+  shutdown_allow_remote: true
+  shutdown_confirm: true
+  reload_allow_remote: true
+  cors_origins: ["https://grafana.example.com/"]
+  peers: ["http://replica:9279"]
+instaclustr:
+  user: user
+  alias: production
+  provisioning_api_key: provisioning-key
+  monitoring_api_key: monitoring-key
+  monitoring_period: 2m
+  monitoring_api_version: v2
+  provisioning_api_header: "Accept: application/json"
+  monitoring_api_header: "X-Team: storage"
+  provisioning_api_key_file: provisioning-key-file
+  monitoring_api_key_file: monitoring-key-file
+  key_rotation_due: {monitoring: 2027-01-31}
+  max_retries: 4
+  retry_backoff: 2s
+  rate_limit: 5
+  rate_burst: 20
+  provisioning_policy: {budget: 50}
+  monitoring_policy: {max_retries: 1}
+  proxy_url: http://proxy:3128
+  ca_file: ca.pem
+  insecure_skip_verify: true
+  max_idle_conns_per_host: 16
+  idle_conn_timeout: 1m
+  request_timeout: 15s
+  network: tcp4
+  max_response_size: 1024
+  fault_failure_percent: 1.5
+  fault_delay_percent: 2.5
+  fault_delay: 3s
+collector:
+  profile: full
+  disable_node_metrics: true
+  repair_status: true
+  node_operations: true
+  kafka_consumer_lag: true
+  cadence_metrics: true
+  maintenance_cache: true
+  node_status: true
+  node_status_values: {warn: 0}
+  aggregate_nodes: true
+  topology_labels: true
+  legacy_topology_names: true
+  interval: 1m
+  latency_threshold: 50ms
+  sample_timestamps: true
+  sample_max_age: 10m
+  parse_error_mode: omit
+  parse_error_overrides: {cpuUtilization: nan}
+  extra_labels_file: labels.yml
+  dc_include: [AWS_VPC_US_EAST_1]
+  provider_include: [AWS_VPC]
+  pinned_clusters: [c1]
+  pinned_nodes: [n1]
+  node_metrics: [cpuUtilization]
+  table_metrics: [shop.orders]
+  federation_targets: {eu: "http://exporter-eu:9279"}
+  units: {latency: microseconds}
+  concurrency: 8
+  timeout: 45s
+  max_label_length: 64
+  sanitize_mode: clamp
+  sanitize_rules: {"n::clientRequestRead": "drop:0:60000000"}
+  not_found_ttl: 10m
+  quiet_windows: ["0 2 * * 0 4h"]
+  memory_limit: 1073741824
+  cluster_concurrency: 2
+archive:
+  endpoint: https://storage.googleapis.com
+  bucket: snapshots
+  prefix: exporter
+  region: eu
+  access_key: access
+  secret_key: secret
+  retention: 24h
+cmdb:
+  url: https://cmdb.example.com/import
+  header: "Authorization: Basic abc"
+  fields: {u_name: nodeId}
+  interval: 2h
+webhook:
+  urls: ["https://hooks.example.com/nodes"]
+  header: "Authorization: Bearer token"
+  retry_backoff: 5s
+  ca_file: hooks-ca.pem
+kubernetes:
+  events: true
+  event_object: deployment/exporter
+instance:
+  id_file: exporter.id
+  shard: eu
+compare:
+  name: old
+  other_name: new
+  user: other-user
+  provisioning_api_key: other-key
+`
+
+// checkSet fails for every setting of v left unset, named after its path
+func checkSet(t *testing.T, path string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			checkSet(t, path+"."+v.Type().Field(i).Tag.Get("yaml"), v.Field(i))
+		}
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			t.Errorf("%s missing from the test configuration file", path)
+		}
+	}
+}
+
+func TestConfigFileRoundTrip(t *testing.T) {
+	// Every setting is tested
+	var f fileConfig
+	if err := yaml.UnmarshalStrict([]byte(fullConfigFile), &f); err != nil {
+		t.Fatal(err)
+	}
+	checkSet(t, "", reflect.ValueOf(f))
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg, err := applyConfigFile(writeConfigFile(t, dir, fullConfigFile), config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	one := 1
+	expected := config{
+		TelemetryPath:          "/prometheus",
+		ExternalURL:            "https://example.com/instaclustr",
+		RoutePrefix:            "/instaclustr",
+		ReloadAllowRemote:      true,
+		CORSOrigins:            []string{"https://grafana.example.com"},
+		Peers:                  []string{"http://replica:9279"},
+		InstanceIDFile:         "exporter.id",
+		Shard:                  "eu",
+		KeyRotationDue:         map[string]time.Time{"monitoring": time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)},
+		ProvisioningAPIKeyFile: "provisioning-key-file",
+		MonitoringAPIKeyFile:   "monitoring-key-file",
+	}
+	expected.Server = common.ServerOptions{
+		ListenAddress:       ":9280",
+		Network:             "tcp6",
+		ReusePort:           true,
+		TLSCertFile:         "cert.pem",
+		TLSKeyFile:          "key.pem",
+		TLSClientCAFile:     "clients.pem",
+		ReadTimeOut:         20 * time.Second,
+		WriteTimeOut:        30 * time.Second,
+		LivenessProbeURL:    "/live",
+		ReadinessProbeURL:   "/readyz",
+		ShutdownURL:         "/quit",
+		ShutdownAllowRemote: true,
+		ShutdownConfirm:     true,
+		RunDuration:         5 * time.Minute,
+	}
+	expected.Instaclustr = instaclustr.Config{
+		User:                 "user",
+		Alias:                "production",
+		ProvisioningAPIKey:   "provisioning-key",
+		MonitoringAPIKey:     "monitoring-key",
+		MonitoringPeriod:     "2m",
+		MonitoringAPIVersion: "v2",
+		ProvisioningHeader:   "Accept: application/json",
+		MonitoringHeader:     "X-Team: storage",
+		MaxRetries:           4,
+		RetryBackoff:         2 * time.Second,
+		RateLimit:            5,
+		RateBurst:            20,
+		ProvisioningPolicy:   instaclustr.APIPolicy{Budget: 50},
+		MonitoringPolicy:     instaclustr.APIPolicy{MaxRetries: &one},
+		Proxy:                "http://proxy:3128",
+		CAFile:               "ca.pem",
+		InsecureSkipVerify:   true,
+		MaxIdleConnsPerHost:  16,
+		IdleConnTimeout:      time.Minute,
+		RequestTimeout:       15 * time.Second,
+		Network:              "tcp4",
+		MaxResponseSize:      1024,
+		FaultFailurePercent:  1.5,
+		FaultDelayPercent:    2.5,
+		FaultDelay:           3 * time.Second,
+	}
+	expected.Collector = collector.ExporterOptions{
+		Profile:             collector.ProfileFull,
+		DisableNodeMetrics:  true,
+		RepairStatus:        true,
+		NodeOperations:      true,
+		KafkaConsumerLag:    true,
+		CadenceMetrics:      true,
+		MaintenanceCache:    true,
+		NodeStatus:          true,
+		NodeStatusValues:    map[string]float64{"warn": 0},
+		AggregateNodes:      true,
+		TopologyLabels:      true,
+		LegacyTopologyNames: true,
+		CollectionInterval:  time.Minute,
+		LatencyThreshold:    50 * time.Millisecond,
+		SampleTimestamps:    true,
+		SampleMaxAge:        10 * time.Minute,
+		ParseErrorMode:      "omit",
+		ParseErrorOverrides: map[string]string{"cpuUtilization": "nan"},
+		ExtraLabelsFile:     "labels.yml",
+		DataCentreInclude:   []string{"AWS_VPC_US_EAST_1"},
+		ProviderInclude:     []string{"AWS_VPC"},
+		PinnedClusters:      []string{"c1"},
+		PinnedNodes:         []string{"n1"},
+		NodeMetrics:         []string{"cpuUtilization"},
+		TableMetrics:        []string{"shop.orders"},
+		FederationTargets:   map[string]string{"eu": "http://exporter-eu:9279"},
+		Units:               collector.Units{Latency: "microseconds"},
+		NodeConcurrency:     8,
+		Timeout:             45 * time.Second,
+		MaxLabelLength:      64,
+		SanitizeMode:        "clamp",
+		SanitizeRules:       map[string]string{"clientRequestRead": "drop:0:60000000"},
+		NotFoundTTL:         10 * time.Minute,
+		QuietWindows:        []string{"0 2 * * 0 4h"},
+		MemoryLimit:         1 << 30,
+		ClusterConcurrency:  2,
+	}
+	expected.Archive = archive.Config{
+		Endpoint:  "https://storage.googleapis.com",
+		Bucket:    "snapshots",
+		Prefix:    "exporter",
+		Region:    "eu",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Retention: 24 * time.Hour,
+	}
+	expected.CMDB = cmdb.Config{
+		URL:      "https://cmdb.example.com/import",
+		Header:   "Authorization: Basic abc",
+		Fields:   map[string]string{"u_name": "nodeId"},
+		Interval: 2 * time.Hour,
+	}
+	expected.Webhook = webhook.Config{
+		URLs:         []string{"https://hooks.example.com/nodes"},
+		Header:       "Authorization: Bearer token",
+		RetryBackoff: 5 * time.Second,
+		CAFile:       "hooks-ca.pem",
+	}
+	expected.Kubernetes = kubernetes.Config{Enabled: true, Object: "deployment/exporter"}
+	expected.Compare = collector.CompareOptions{
+		Name:      "old",
+		OtherName: "new",
+		Other:     instaclustr.Config{User: "other-user", ProvisioningAPIKey: "other-key"},
+	}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Got configuration\n%+v\nwant\n%+v", cfg, expected)
+	}
+}
+
+func TestLoadConfigKeyFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "monitoring-key")
+	if err := ioutil.WriteFile(keyFile, []byte("secret-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags := config{ProvisioningAPIKeyFile: filepath.Join(dir, "provisioning-key"), MonitoringAPIKeyFile: keyFile}
+	flags.Server.Network = "tcp"
+	flags.Instaclustr.Network = "tcp"
+	flags.Instaclustr.MonitoringAPIVersion = "v1"
+	flags.Instaclustr.MonitoringAPIKey = "flag-key"
+	if _, err := loadConfig("", flags); err == nil {
+		t.Error("Missing provisioning API key file accepted")
+	}
+
+	// The environment takes precedence over the key files
+	os.Setenv("PROVISIONING_API_KEY", "env-key")
+	defer os.Unsetenv("PROVISIONING_API_KEY")
+	cfg, err := loadConfig("", flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Instaclustr.ProvisioningAPIKey != "env-key" || cfg.Instaclustr.MonitoringAPIKey != "secret-key" {
+		t.Errorf("Got provisioning API key %q and monitoring API key %q", cfg.Instaclustr.ProvisioningAPIKey, cfg.Instaclustr.MonitoringAPIKey)
+	}
+
+	// Keys rotated in their files are read again on reload
+	if err := ioutil.WriteFile(keyFile, []byte("rotated-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = loadConfig("", flags); err != nil || cfg.Instaclustr.MonitoringAPIKey != "rotated-key" {
+		t.Errorf("Got monitoring API key %q (%v) after rotation", cfg.Instaclustr.MonitoringAPIKey, err)
+	}
+}
+
+// localReload is a reload request from the host itself
+func localReload() *http.Request {
+	r := httptest.NewRequest("POST", reloadURL, nil)
+	r.RemoteAddr = "127.0.0.1:40000"
+	return r
+}
+
+func TestReload(t *testing.T) {
+	cfg := config{}
+	cfg.Instaclustr.User = "before"
+	cfg.Compare.Other.User = "other"
+	cfg.Compare.Other.ProvisioningAPIKey = "before"
+	var loadErr error
+	load := func() (config, error) {
+		reloaded := cfg
+		reloaded.Instaclustr.User = "after"
+		reloaded.Compare.Other.ProvisioningAPIKey = "after"
+		return reloaded, loadErr
+	}
+	wired := 0
+	l, err := newLiveExporter(cfg, load, func(collection) { wired++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := l.exporter()
+	delta := l.delta
+	var hash string
+	l.onReload = func(cfg config) { hash = cfg.hash() }
+
+	rr := httptest.NewRecorder()
+	l.ReloadHandler(rr, httptest.NewRequest("POST", reloadURL, nil))
+	if rr.Code != http.StatusForbidden || l.config().Instaclustr.User != "before" {
+		t.Errorf("Got status %d reloading from a remote address", rr.Code)
+	}
+	proxied := localReload()
+	proxied.Header.Set("X-Forwarded-For", "192.0.2.1")
+	rr = httptest.NewRecorder()
+	l.ReloadHandler(rr, proxied)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Got status %d reloading through a reverse proxy", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	l.ReloadHandler(rr, localReload())
+	if rr.Code != http.StatusOK {
+		t.Errorf("Got status %d reloading", rr.Code)
+	}
+	if l.config().Instaclustr.User != "after" || l.exporter() == first || wired != 2 {
+		t.Errorf("Configuration not applied on reload")
+	}
+	if hash != l.config().hash() {
+		t.Errorf("Reload not notified")
+	}
+	if l.config().Compare.Other.ProvisioningAPIKey != "after" || l.delta == nil || l.delta == delta {
+		t.Errorf("Compared account not reloaded")
+	}
+
+	loadErr = errors.New("invalid")
+	rr = httptest.NewRecorder()
+	l.ReloadHandler(rr, localReload())
+	if rr.Code != http.StatusInternalServerError || l.ok {
+		t.Errorf("Got status %d reloading an invalid configuration", rr.Code)
+	}
+
+	l.load = nil
+	rr = httptest.NewRecorder()
+	l.ReloadHandler(rr, localReload())
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Got status %d reloading without configuration file", rr.Code)
+	}
+}
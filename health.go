@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+// Background collections that can be missed before the cache and the poller
+// are unhealthy
+const staleIntervals = 2
+
+// healthSource is what the health checks look at, a liveExporter
+type healthSource interface {
+	LastScrape() (collector.ScrapeSummary, bool)
+	LastPoll() (started, finished time.Time)
+	config() config
+}
+
+// healthChecks checks the subsystems of exp the liveness depends on: whether
+// the background collection served is fresh and whether the background poller
+// still starts collections. Both pass when collecting on scrapes.
+func healthChecks(exp healthSource, clock common.Clock) []common.HealthCheck {
+	return []common.HealthCheck{
+		{Name: "cache", Check: func() error {
+			interval := exp.config().Collector.CollectionInterval
+			_, finished := exp.LastPoll()
+			if interval <= 0 || finished.IsZero() {
+				return nil
+			}
+			if age := clock.Now().Sub(finished); age > staleIntervals*interval {
+				return fmt.Errorf("the collection served finished %s ago", age)
+			}
+			return nil
+		}},
+		{Name: "poller", Check: func() error {
+			interval := exp.config().Collector.CollectionInterval
+			started, _ := exp.LastPoll()
+			if interval <= 0 || started.IsZero() {
+				return nil
+			}
+			if age := clock.Now().Sub(started); age > staleIntervals*interval {
+				return fmt.Errorf("no collection started for %s", age)
+			}
+			return nil
+		}},
+	}
+}
+
+// readinessChecks checks whether the last collection of exp reached the API.
+// Restarting the exporter doesn't fix an InstaClustr outage, so it only
+// affects the readiness.
+func readinessChecks(exp healthSource) []common.HealthCheck {
+	return []common.HealthCheck{
+		{Name: "api", Check: func() error {
+			summary, ok := exp.LastScrape()
+			if ok && summary.APICalls > 0 && summary.FailedAPICalls == summary.APICalls {
+				return fmt.Errorf("every API call of the last collection failed")
+			}
+			return nil
+		}},
+	}
+}
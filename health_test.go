@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+type fakeHealthSource struct {
+	summary           *collector.ScrapeSummary
+	started, finished time.Time
+	cfg               config
+}
+
+func (f fakeHealthSource) LastScrape() (collector.ScrapeSummary, bool) {
+	if f.summary == nil {
+		return collector.ScrapeSummary{}, false
+	}
+	return *f.summary, true
+}
+
+func (f fakeHealthSource) LastPoll() (started, finished time.Time) { return f.started, f.finished }
+func (f fakeHealthSource) config() config                          { return f.cfg }
+
+func TestHealthChecks(t *testing.T) {
+	now := time.Now()
+	clock := common.NewFakeClock(now)
+	background := config{}
+	background.Collector.CollectionInterval = time.Minute
+	cases := []struct {
+		name   string
+		source fakeHealthSource
+		failed []string
+	}{
+		{"no collection", fakeHealthSource{}, nil},
+		{"api down", fakeHealthSource{summary: &collector.ScrapeSummary{APICalls: 2, FailedAPICalls: 2}}, []string{"api"}},
+		{"api flaky", fakeHealthSource{summary: &collector.ScrapeSummary{APICalls: 2, FailedAPICalls: 1}}, nil},
+		{"api down in the background", fakeHealthSource{cfg: background, started: now, finished: now, summary: &collector.ScrapeSummary{APICalls: 2, FailedAPICalls: 2}}, []string{"api"}},
+		{"fresh", fakeHealthSource{cfg: background, started: now.Add(-time.Minute), finished: now.Add(-time.Minute)}, nil},
+		{"stuck", fakeHealthSource{cfg: background, started: now.Add(-3 * time.Minute), finished: now.Add(-4 * time.Minute)}, []string{"cache", "poller"}},
+		{"slow", fakeHealthSource{cfg: background, started: now.Add(-time.Minute), finished: now.Add(-3 * time.Minute)}, []string{"cache"}},
+		{"on scrape", fakeHealthSource{started: now.Add(-time.Hour), finished: now.Add(-time.Hour)}, nil},
+	}
+	for _, c := range cases {
+		var failed []string
+		for _, check := range append(healthChecks(c.source, clock), readinessChecks(c.source)...) {
+			if check.Check() != nil {
+				failed = append(failed, check.Name)
+			}
+		}
+		if len(failed) != len(c.failed) {
+			t.Errorf("%s: got %v failing, want %v", c.name, failed, c.failed)
+			continue
+		}
+		for i := range failed {
+			if failed[i] != c.failed[i] {
+				t.Errorf("%s: got %v failing, want %v", c.name, failed, c.failed)
+			}
+		}
+	}
+}
+
+func TestLivenessIgnoresAPI(t *testing.T) {
+	down := fakeHealthSource{summary: &collector.ScrapeSummary{APICalls: 2, FailedAPICalls: 2}}
+	for _, check := range healthChecks(down, common.NewFakeClock(time.Now())) {
+		if err := check.Check(); err != nil {
+			t.Errorf("Liveness check %s failed on an API outage: %v", check.Name, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// newInstanceID generates a random instance ID
+func newInstanceID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// loadInstanceID reads the instance ID persisted at path, generating and
+// persisting a new one the first time. An empty path generates an ID for this
+// process only.
+func loadInstanceID(path string) (string, error) {
+	if path == "" {
+		return newInstanceID()
+	}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	id, err := newInstanceID()
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// newInstanceInfo creates the metric identifying this exporter instance
+func newInstanceInfo(id, shard string) prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "instaclustr_exporter",
+		Name:      "instance_info",
+		Help:      "Identity of the exporter instance: its persistent ID, shard and version.",
+		ConstLabels: prometheus.Labels{
+			"instance_id": id,
+			"shard":       shard,
+			"version":     version.Version,
+		},
+	})
+	g.Set(1)
+	return g
+}
@@ -1,11 +1,23 @@
 package instaclustr
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/fcgravalos/instaclustr_exporter/common"
 	"github.com/prometheus/common/log"
 )
 
@@ -15,8 +27,15 @@ const (
 	monitoringAPIEndpoint   = "monitoring"
 	provisioningAPIVersion  = "v1"
 	monitoringAPIVersion    = "v1"
+	// MonitoringAPIV2 is the paginated Monitoring API version
+	MonitoringAPIV2 = "v2"
+	// Pages of a single v2 response followed at most
+	maxMonitoringPages = 100
 )
 
+// ErrResponseTooLarge is returned when a response body exceeds Config.MaxResponseSize
+var ErrResponseTooLarge = errors.New("response body exceeds the maximum response size")
+
 var (
 	user               string
 	provisioningAPIKey string
@@ -24,19 +43,167 @@ var (
 )
 
 type Config struct {
-	Url                string
-	User               string
+	Url  string
+	User string
+	// Alias names the account in the account label of every metric
+	// collected from it. No label if empty.
+	Alias              string
 	ProvisioningAPIKey string
 	MonitoringAPIKey   string
+	// MaxResponseSize limits the bytes read from a single response, 0 means no limit
+	MaxResponseSize int64
+	// Network used to dial the API: tcp (default), tcp4 or tcp6
+	Network string
+	// Proxy is the URL of the HTTP(S) proxy the API is reached through, the
+	// one of the HTTPS_PROXY and NO_PROXY environment variables if empty
+	Proxy string
+	// CAFile holds the PEM certificates of the CAs trusted along with the
+	// system ones, e.g. the one of a TLS intercepting proxy
+	CAFile string
+	// InsecureSkipVerify disables the verification of the API certificate,
+	// for testing only
+	InsecureSkipVerify bool
+	// MaxIdleConnsPerHost is how many idle connections to the API are kept
+	// for reuse, 2 if 0, and IdleConnTimeout how long, 90s if 0
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// RequestTimeout bounds every request attempt, response body included,
+	// unbounded if 0. Attempts timing out before the response are retried
+	// like any other failing without one.
+	RequestTimeout time.Duration
+	// MonitoringPeriod is the time range, e.g. 2m, of the node metrics
+	// requested to the Monitoring API, the API default if empty.
+	MonitoringPeriod string
+	// MonitoringAPIVersion is the Monitoring API version, v1 if empty. With
+	// v2, paginated responses are merged and the client falls back to v1 when
+	// the API doesn't serve v2.
+	MonitoringAPIVersion string
+	// ProvisioningHeader and MonitoringHeader are "Name: value" headers, e.g.
+	// an Accept header pinning the API contract, sent with every request of
+	// their client. None if empty.
+	ProvisioningHeader string
+	MonitoringHeader   string
+	// MaxRetries is how many times a request failing without a response or
+	// with a retryable status, e.g. 503, is retried. None if 0.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled on every
+	// further one up to a minute and jittered, or as long as the Retry-After
+	// of the response
+	RetryBackoff time.Duration
+	// RateLimit is how many requests per second are sent to the account,
+	// Provisioning and Monitoring APIs together, unlimited if 0. RateBurst
+	// requests may be sent at once.
+	RateLimit float64
+	RateBurst int
+	// FaultFailurePercent is the percentage of requests answered 503 without
+	// being sent and FaultDelayPercent the one delayed by up to FaultDelay,
+	// to rehearse API outages in staging. No faults are injected if 0.
+	FaultFailurePercent float64
+	FaultDelayPercent   float64
+	FaultDelay          time.Duration
+	// Transport sends the requests of the clients, e.g. through an
+	// authenticating proxy, signing or recording them, or a NewTransport
+	// shared by the Provisioning and Monitoring clients of a collection so
+	// they reuse each other's connections. Every client builds its own
+	// NewTransport if nil.
+	Transport http.RoundTripper `json:"-"`
+	// Clock times the retries, rate limit, maintenance windows and injected
+	// delays of the clients, common.SystemClock if nil
+	Clock common.Clock `json:"-"`
+	// ProvisioningPolicy and MonitoringPolicy override the retries and rate
+	// limit of the requests to their API and set their call budgets
+	ProvisioningPolicy APIPolicy
+	MonitoringPolicy   APIPolicy
+}
+
+// ParseHeader parses a "Name: value" header
+func ParseHeader(s string) (string, string, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 || strings.TrimSpace(s[:i]) == "" {
+		return "", "", fmt.Errorf("invalid header %q, expected Name: value", s)
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), nil
+}
+
+// APIError is the body of the InstaClustr API error responses
+type APIError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("InstaClustr API error %d: %s", e.Status, e.Message)
+}
+
+// ParseAPIError decodes data as an InstaClustr API error response, telling
+// whether it is one
+func ParseAPIError(data []byte) (*APIError, bool) {
+	e := &APIError{}
+	if err := json.Unmarshal(data, e); err != nil || e.Status == 0 {
+		return nil, false
+	}
+	return e, true
 }
 
 type instaclustrClient struct {
-	url         string
-	user        string
-	APIKey      string
-	APIEndpoint string
-	APIVersion  string
-	client      *http.Client
+	url             string
+	user            string
+	APIKey          string
+	APIEndpoint     string
+	APIVersion      string
+	maxResponseSize int64
+	period          string
+	client          *http.Client
+	// v1Fallback is set once the API answered that it doesn't serve v2
+	v1Fallback *uint32
+	// header is sent with every request
+	header       http.Header
+	maxRetries   int
+	retryBackoff time.Duration
+	// limiter is shared by the clients of the account, nil if unlimited
+	limiter *rateLimiter
+	clock   common.Clock
+	// ctx cancels the requests, their retries and waits, nil if never
+	ctx context.Context
+	// budget is how many requests the client may send, counted in calls,
+	// only clients returned by WithContext have one
+	budget int
+	calls  *int64
+	// listing is set on the copy sending the listing of the clusters of the
+	// account, the only request a 503 with a Retry-After puts the whole API
+	// in maintenance on. Other requests may be answered so alone, e.g. by
+	// an overloaded node.
+	listing bool
+	// probe is set once the first request of the copies returned by
+	// WithMaintenanceProbe is sent, which starts a maintenance as the listing
+	// does. nil on other clients.
+	probe *uint32
+}
+
+// limitedReader reads from r until more than remaining bytes have been
+// read, after which it fails with ErrResponseTooLarge
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	endpoint  string
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// Read one byte past the limit so we can tell apart bodies that are
+	// exactly maxResponseSize long from those that are bigger
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		oversizedResponses.WithLabelValues(l.endpoint).Inc()
+		return n - 1, ErrResponseTooLarge
+	}
+	return n, err
 }
 
 // ProvisioningClient is a client for InstaClustr Provisioning API
@@ -45,9 +212,74 @@ type ProvisioningClient instaclustrClient
 // MonitoringClient is a client for InstaClustr Monitoring API
 type MonitoringClient instaclustrClient
 
-func createInstaClustrClient(instaclustrURL string, user string, apiKey string, apiEndpoint string, apiVersion string) instaclustrClient {
+// LoadCAFile returns the system CAs along with the ones of the PEM file at path
+func LoadCAFile(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", path)
+	}
+	return pool, nil
+}
+
+// NewTransport builds a transport like http.DefaultTransport, dialing only on
+// the network of config through its proxy and trusting its CAs. The CA file
+// is read on every call, so a new transport picks up a rotated one.
+func NewTransport(config Config) *http.Transport {
+	network := config.Network
+	if network == "" {
+		network = "tcp"
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if config.MaxIdleConnsPerHost > t.MaxIdleConns {
+		t.MaxIdleConns = config.MaxIdleConnsPerHost
+	}
+	if config.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = config.IdleConnTimeout
+	}
+	if config.Proxy != "" {
+		if proxy, err := url.Parse(config.Proxy); err != nil {
+			log.Errorf("Ignoring the API proxy: %v", err)
+		} else {
+			t.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	if config.CAFile != "" || config.InsecureSkipVerify {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	}
+	if config.CAFile != "" {
+		if pool, err := LoadCAFile(config.CAFile); err != nil {
+			log.Errorf("Ignoring the API CA file: %v", err)
+		} else {
+			t.TLSClientConfig.RootCAs = pool
+		}
+	}
+	return t
+}
+
+func createInstaClustrClient(config Config, apiKey string, apiEndpoint string, apiVersion string, header string) instaclustrClient {
 	var stringURL string
-	parsedURL, err := url.Parse(instaclustrURL)
+	parsedURL, err := url.Parse(config.Url)
 	if err != nil {
 		log.Errorf("Parsing error: %v", err)
 		stringURL = defaultURL
@@ -56,65 +288,317 @@ func createInstaClustrClient(instaclustrURL string, user string, apiKey string,
 	} else {
 		stringURL = parsedURL.String()
 	}
+	h := http.Header{}
+	if header != "" {
+		if name, value, err := ParseHeader(header); err != nil {
+			log.Errorf("Ignoring %s API header: %v", apiEndpoint, err)
+		} else {
+			h.Set(name, value)
+		}
+	}
+	transport := config.Transport
+	if transport == nil {
+		transport = NewTransport(config)
+	}
+	clock := config.Clock
+	if clock == nil {
+		clock = common.SystemClock
+	}
+	p := policyFor(config, apiEndpoint)
 	return instaclustrClient{
-		url:         stringURL,
-		user:        user,
-		APIKey:      apiKey,
-		APIEndpoint: apiEndpoint,
-		APIVersion:  apiVersion,
-		client:      &http.Client{},
+		url:             stringURL,
+		user:            config.User,
+		APIKey:          apiKey,
+		APIEndpoint:     apiEndpoint,
+		APIVersion:      apiVersion,
+		maxResponseSize: config.MaxResponseSize,
+		period:          config.MonitoringPeriod,
+		client:          &http.Client{Transport: newFaultTransport(config, apiEndpoint, transport, clock), Timeout: config.RequestTimeout},
+		v1Fallback:      new(uint32),
+		header:          h,
+		maxRetries:      p.maxRetries,
+		retryBackoff:    p.retryBackoff,
+		limiter:         limiterFor(stringURL, config.User, apiEndpoint, p, clock),
+		clock:           clock,
+		budget:          p.budget,
 	}
 }
 
 // NewProvisioningClient creates a ProvisioningClient
 func NewProvisioningClient(config Config) *ProvisioningClient {
-	ic := createInstaClustrClient(config.Url, config.User, config.ProvisioningAPIKey, provisioningAPIEndpoint, provisioningAPIVersion)
+	ic := createInstaClustrClient(config, config.ProvisioningAPIKey, provisioningAPIEndpoint, provisioningAPIVersion, config.ProvisioningHeader)
 	pc := ProvisioningClient(ic)
 	return &pc
 }
 
 // NewMonitoringClient creates a MonitoringClient
 func NewMonitoringClient(config Config) *MonitoringClient {
-	ic := createInstaClustrClient(config.Url, config.User, config.MonitoringAPIKey, monitoringAPIEndpoint, monitoringAPIVersion)
+	version := monitoringAPIVersion
+	if config.MonitoringAPIVersion != "" {
+		version = config.MonitoringAPIVersion
+	}
+	ic := createInstaClustrClient(config, config.MonitoringAPIKey, monitoringAPIEndpoint, version, config.MonitoringHeader)
 	mc := MonitoringClient(ic)
 	return &mc
 }
 
+// WithContext returns a copy of c for a single collection: its requests are
+// cancelled along with ctx and spend a call budget of their own
+func (c *ProvisioningClient) WithContext(ctx context.Context) *ProvisioningClient {
+	cc := *c
+	cc.ctx, cc.calls = ctx, new(int64)
+	return &cc
+}
+
+// WithContext returns a copy of c for a single collection: its requests are
+// cancelled along with ctx and spend a call budget of their own
+func (c *MonitoringClient) WithContext(ctx context.Context) *MonitoringClient {
+	cc := *c
+	cc.ctx, cc.calls = ctx, new(int64)
+	return &cc
+}
+
+// WithMaintenanceProbe returns a copy of c whose first request starts a
+// maintenance when answered 503 with a Retry-After, as the cluster listing
+// does. Collections of pinned clusters, which are never listed, probe the
+// API so with the status of their first cluster.
+func (c *ProvisioningClient) WithMaintenanceProbe() *ProvisioningClient {
+	cc := *c
+	cc.probe = new(uint32)
+	return &cc
+}
+
+// body wraps the response body so no more than maxResponseSize bytes are read from it
+func (c instaclustrClient) body(resp *http.Response) io.Reader {
+	if c.maxResponseSize <= 0 {
+		return resp.Body
+	}
+	return &limitedReader{r: resp.Body, remaining: c.maxResponseSize, endpoint: c.APIEndpoint}
+}
+
+// sendRequest sends req, failing with an *APIError when the API answers with
+// an error status
 func (c instaclustrClient) sendRequest(req *http.Request) ([]byte, error) {
-	req.SetBasicAuth(c.user, c.APIKey)
-	resp, err := c.client.Do(req)
+	status, data, err := c.send(req)
 	if err != nil {
-		log.Errorf("Error sending request: %v", err)
 		return nil, err
 	}
+	if err := statusError(status, data); err != nil {
+		log.Debugf("Error querying %s: %v", req.URL, err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// statusError returns the *APIError of a response with an error status, nil
+// for successful ones. Bodies not following the API error format are
+// replaced by the status text.
+func statusError(status int, data []byte) error {
+	if status < http.StatusBadRequest {
+		return nil
+	}
+	if e, ok := ParseAPIError(data); ok {
+		return e
+	}
+	return &APIError{Status: status, Message: http.StatusText(status)}
+}
+
+// authorize sets the credentials and configured header of req
+func (c instaclustrClient) authorize(req *http.Request) {
+	req.SetBasicAuth(c.user, c.APIKey)
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+}
+
+// retryable tells whether a request answered with status, 0 when no
+// response was received, may succeed if sent again
+func retryable(status int) bool {
+	switch status {
+	case 0, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// maxRetryBackoff bounds the delays between retries, however many retries
+// are configured. A request answered with a longer Retry-After isn't retried.
+const maxRetryBackoff = time.Minute
+
+// backoff returns the delay before retry, 0 being the first one: retryBackoff
+// doubled on every further retry up to maxRetryBackoff, or retryBackoff if
+// longer, jittered between half and the whole of it so exporters don't retry
+// in lockstep
+func (c instaclustrClient) backoff(retry int) time.Duration {
+	limit := maxRetryBackoff
+	if c.retryBackoff > limit {
+		limit = c.retryBackoff
+	}
+	d := c.retryBackoff
+	for i := 0; i < retry && d > 0 && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryDelay returns the delay before retrying after resp, nil if it failed
+// without one: the backoff of retry, unless resp asks to wait longer with a
+// Retry-After. It tells whether to retry at all, not when the Retry-After is
+// longer than maxRetryBackoff.
+func (c instaclustrClient) retryDelay(retry int, resp *http.Response) (time.Duration, bool) {
+	delay := c.backoff(retry)
+	if resp == nil {
+		return delay, true
+	}
+	after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), c.clock.Now())
+	if !ok || after <= delay {
+		return delay, true
+	}
+	return after, after <= maxRetryBackoff
+}
+
+// wait sleeps for d on the clock of the client, failing with the error of
+// the context if it's done first
+func (c instaclustrClient) wait(d time.Duration) error {
+	if c.ctx == nil {
+		<-c.clock.After(d)
+		return nil
+	}
+	select {
+	case <-c.clock.After(d):
+		return nil
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+}
+
+// throttle waits until the rate limit allows another request
+func (c instaclustrClient) throttle() error {
+	if c.limiter == nil {
+		return nil
+	}
+	if d := c.limiter.reserve(); d > 0 {
+		apiThrottled.WithLabelValues(c.APIEndpoint).Inc()
+		return c.wait(d)
+	}
+	return nil
+}
+
+// do sends req, retrying it up to maxRetries times while it fails without a
+// response or with a retryable status, after the delay of retryDelay. Every
+// attempt is counted. Once the context of the client is done, nothing is
+// sent or retried anymore. While the API is in maintenance, nothing is sent
+// either. Only the cluster listing, or the first request of a maintenance
+// probe, starts a maintenance, see instaclustrClient.listing.
+func (c instaclustrClient) do(req *http.Request) (*http.Response, error) {
+	c.authorize(req)
+	if c.ctx != nil {
+		req = req.WithContext(c.ctx)
+	}
+	startsMaintenance := c.listing || c.probe != nil && atomic.CompareAndSwapUint32(c.probe, 0, 1)
+	for retry := 0; ; retry++ {
+		if until, ok := maintenance.active(c.clock.Now()); ok {
+			return nil, &MaintenanceError{Until: until}
+		}
+		if err := c.spend(); err != nil {
+			return nil, err
+		}
+		if err := c.throttle(); err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req)
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		countRequest(c.APIEndpoint, status)
+		if err == nil && startsMaintenance {
+			if until, ok := maintenance.start(resp, c.clock.Now()); ok {
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				return nil, &MaintenanceError{Until: until}
+			}
+		}
+		if retry >= c.maxRetries || !retryable(status) || c.ctx != nil && c.ctx.Err() != nil {
+			return resp, err
+		}
+		delay, ok := c.retryDelay(retry, resp)
+		if !ok {
+			log.Debugf("Not retrying %s, answered %d with a Retry-After over %s", req.URL, status, maxRetryBackoff)
+			return resp, err
+		}
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", status)
+		}
+		log.Debugf("Retrying %s in %s: %v", req.URL, delay, err)
+		apiRetries.WithLabelValues(c.APIEndpoint).Inc()
+		if err := c.wait(delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send sends req, returning the response status along with its body
+func (c instaclustrClient) send(req *http.Request) (int, []byte, error) {
+	resp, err := c.do(req)
+	if err != nil {
+		log.Debugf("Error sending request: %v", err)
+		return 0, nil, err
+	}
 	defer resp.Body.Close()
-	data, err := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(c.body(resp))
 	if err != nil {
-		log.Errorf("Error reading response body: %v", err)
-		return nil, err
+		log.Debugf("Error reading response body: %v", err)
+		return resp.StatusCode, nil, err
 	}
-	return data, err
+	return resp.StatusCode, data, err
 }
 
-// GetClusters returns the list of Cassandra clusters
-func (c ProvisioningClient) GetClusters() []byte {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s/%s", c.url, c.APIEndpoint, c.APIVersion), nil)
+// decodeRequest sends req and decodes the JSON response into v as it's read,
+// instead of buffering the whole body
+func (c instaclustrClient) decodeRequest(req *http.Request, v interface{}) error {
+	resp, err := c.do(req)
 	if err != nil {
-		log.Errorf("Error building GetClusters request: %v", err)
-		return nil
+		log.Debugf("Error sending request: %v", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		data, _ := ioutil.ReadAll(c.body(resp))
+		err := statusError(resp.StatusCode, data)
+		log.Debugf("Error querying %s: %v", req.URL, err)
+		return err
+	}
+	if err := json.NewDecoder(c.body(resp)).Decode(v); err != nil {
+		log.Debugf("Error decoding response body: %v", err)
+		return err
 	}
+	return nil
+}
 
-	data, err := instaclustrClient(c).sendRequest(req)
+// GetClusters returns the list of Cassandra clusters
+func (c ProvisioningClient) GetClusters() ([]byte, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s/%s", c.url, c.APIEndpoint, c.APIVersion), nil)
 	if err != nil {
-		log.Errorf("Error querying %s: %s", req.RequestURI, err.Error())
-		return nil
+		log.Errorf("Error building GetClusters request: %v", err)
+		return nil, err
 	}
-	return data
+	ic := instaclustrClient(c)
+	ic.listing = true
+	return ic.sendRequest(req)
 }
 
-// GetClusterStatus returns a list of cluster attributes, datacentres and its nodes
-func (c ProvisioningClient) GetClusterStatus(clusterID string) []byte {
-	req, err := http.NewRequest(
+func (c ProvisioningClient) clusterStatusRequest(clusterID string) (*http.Request, error) {
+	return http.NewRequest(
 		"GET",
 		fmt.Sprintf("%s/%s/%s/%s",
 			c.url,
@@ -123,41 +607,201 @@ func (c ProvisioningClient) GetClusterStatus(clusterID string) []byte {
 			clusterID,
 		),
 		nil)
+}
 
+// GetClusterStatus returns a list of cluster attributes, datacentres and its nodes
+func (c ProvisioningClient) GetClusterStatus(clusterID string) ([]byte, error) {
+	req, err := c.clusterStatusRequest(clusterID)
 	if err != nil {
 		log.Errorf("Error building GetClusterStatus request: %v", err)
-		return nil
+		return nil, err
 	}
+	return instaclustrClient(c).sendRequest(req)
+}
 
-	data, err := instaclustrClient(c).sendRequest(req)
+// GetClusterRepairs returns the Instaclustr managed repairs of a cluster, when the account exposes them
+func (c ProvisioningClient) GetClusterRepairs(clusterID string) ([]byte, error) {
+	req, err := http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/%s/%s/%s/repairs",
+			c.url,
+			c.APIEndpoint,
+			c.APIVersion,
+			clusterID,
+		),
+		nil)
 	if err != nil {
-		log.Errorf("Error querying %s: %s", req.RequestURI, err.Error())
-		return nil
+		log.Errorf("Error building GetClusterRepairs request: %v", err)
+		return nil, err
 	}
-	return data
+	return instaclustrClient(c).sendRequest(req)
 }
 
-// GetNodeMetric returns metrics from a node in a specific cluster
-func (c MonitoringClient) GetNodeMetric(nodeID string, metric string) []byte {
+// GetClusterEvents returns the node operations (reboots, replacements...) of a cluster, when the account exposes them
+func (c ProvisioningClient) GetClusterEvents(clusterID string) ([]byte, error) {
 	req, err := http.NewRequest(
 		"GET",
-		fmt.Sprintf("%s/%s/%s/nodes/%s?metrics=%s",
+		fmt.Sprintf("%s/%s/%s/%s/events",
 			c.url,
 			c.APIEndpoint,
 			c.APIVersion,
+			clusterID,
+		),
+		nil)
+	if err != nil {
+		log.Errorf("Error building GetClusterEvents request: %v", err)
+		return nil, err
+	}
+	return instaclustrClient(c).sendRequest(req)
+}
+
+// DecodeClusterStatus decodes the cluster attributes, datacentres and its nodes
+// into v, streaming the response instead of buffering it
+func (c ProvisioningClient) DecodeClusterStatus(clusterID string, v interface{}) error {
+	req, err := c.clusterStatusRequest(clusterID)
+	if err != nil {
+		log.Errorf("Error building GetClusterStatus request: %v", err)
+		return err
+	}
+	return instaclustrClient(c).decodeRequest(req, v)
+}
+
+func (c MonitoringClient) nodeMetricRequest(version, nodeID, metric, pageToken string) (*http.Request, error) {
+	query := fmt.Sprintf("metrics=%s", metric)
+	if c.period != "" {
+		query += "&period=" + url.QueryEscape(c.period)
+	}
+	if pageToken != "" {
+		query += "&pageToken=" + url.QueryEscape(pageToken)
+	}
+	return http.NewRequest(
+		"GET",
+		fmt.Sprintf("%s/%s/%s/nodes/%s?%s",
+			c.url,
+			c.APIEndpoint,
+			version,
 			nodeID,
-			metric,
+			query,
 		),
 		nil)
+}
+
+// GetNodeMetric returns metrics from a node in a specific cluster. The v2
+// pages are merged into a single v1 like response.
+func (c MonitoringClient) GetNodeMetric(nodeID string, metric string) ([]byte, error) {
+	if c.APIVersion == MonitoringAPIV2 && atomic.LoadUint32(c.v1Fallback) == 0 {
+		if data, ok, err := c.getNodeMetricV2(nodeID, metric); ok {
+			return data, err
+		}
+	}
+	version := c.APIVersion
+	if version == MonitoringAPIV2 {
+		version = monitoringAPIVersion
+	}
+	req, err := c.nodeMetricRequest(version, nodeID, metric, "")
 	if err != nil {
 		log.Errorf("Error building GetNodeMetric request: %v", err)
-		return nil
+		return nil, err
 	}
+	return instaclustrClient(c).sendRequest(req)
+}
+
+// clusterMonitoringRequest is a v1 request of the Monitoring API about a
+// cluster, only the node metrics being paginated in v2
+func (c MonitoringClient) clusterMonitoringRequest(clusterID, resource string, query url.Values) (*http.Request, error) {
+	u := fmt.Sprintf("%s/%s/%s/clusters/%s/%s",
+		c.url,
+		c.APIEndpoint,
+		monitoringAPIVersion,
+		clusterID,
+		resource,
+	)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return http.NewRequest("GET", u, nil)
+}
 
-	data, err := instaclustrClient(c).sendRequest(req)
+// GetConsumerGroups returns the consumer groups of a Kafka cluster
+func (c MonitoringClient) GetConsumerGroups(clusterID string) ([]byte, error) {
+	req, err := c.clusterMonitoringRequest(clusterID, "consumer-groups", nil)
 	if err != nil {
-		log.Errorf("Error querying %s: %s", req.RequestURI, err.Error())
-		return nil
+		log.Errorf("Error building GetConsumerGroups request: %v", err)
+		return nil, err
+	}
+	return instaclustrClient(c).sendRequest(req)
+}
+
+// GetConsumerGroupTopics returns the topics a consumer group of a Kafka
+// cluster consumes
+func (c MonitoringClient) GetConsumerGroupTopics(clusterID, group string) ([]byte, error) {
+	req, err := c.clusterMonitoringRequest(clusterID, "consumer-group-topics", url.Values{"consumerGroup": {group}})
+	if err != nil {
+		log.Errorf("Error building GetConsumerGroupTopics request: %v", err)
+		return nil, err
+	}
+	return instaclustrClient(c).sendRequest(req)
+}
+
+// GetConsumerGroupMetrics returns metrics of the consumption of a topic by a
+// consumer group of a Kafka cluster, e.g. consumerLag,consumerCount
+func (c MonitoringClient) GetConsumerGroupMetrics(clusterID, group, topic, metrics string) ([]byte, error) {
+	query := url.Values{"consumerGroup": {group}, "topic": {topic}, "metrics": {metrics}}
+	req, err := c.clusterMonitoringRequest(clusterID, "consumer-group-metrics", query)
+	if err != nil {
+		log.Errorf("Error building GetConsumerGroupMetrics request: %v", err)
+		return nil, err
+	}
+	return instaclustrClient(c).sendRequest(req)
+}
+
+// monitoringPage is a page of a v2 Monitoring API response, its entries are
+// the v1 ones
+type monitoringPage struct {
+	Data          []json.RawMessage `json:"data"`
+	NextPageToken string            `json:"nextPageToken"`
+}
+
+// getNodeMetricV2 follows the pages of a v2 node metrics response, telling
+// whether the API serves v2
+func (c MonitoringClient) getNodeMetricV2(nodeID string, metric string) ([]byte, bool, error) {
+	entries := []json.RawMessage{}
+	token := ""
+	for page := 0; page < maxMonitoringPages; page++ {
+		req, err := c.nodeMetricRequest(MonitoringAPIV2, nodeID, metric, token)
+		if err != nil {
+			log.Errorf("Error building GetNodeMetric request: %v", err)
+			return nil, true, err
+		}
+		status, data, err := instaclustrClient(c).send(req)
+		if err != nil {
+			return nil, true, err
+		}
+		if page == 0 && (status == http.StatusNotFound || status == http.StatusGone) {
+			if _, ok := ParseAPIError(data); !ok {
+				log.Warnf("Monitoring API %s not served, falling back to %s", MonitoringAPIV2, monitoringAPIVersion)
+				atomic.StoreUint32(c.v1Fallback, 1)
+				return nil, false, nil
+			}
+		}
+		if err := statusError(status, data); err != nil {
+			log.Debugf("Error querying %s: %v", req.URL, err)
+			return nil, true, err
+		}
+		p := monitoringPage{}
+		if err := json.Unmarshal(data, &p); err != nil {
+			log.Debugf("Error decoding %s: %v", req.URL, err)
+			return nil, true, err
+		}
+		entries = append(entries, p.Data...)
+		if p.NextPageToken == "" {
+			break
+		}
+		if page == maxMonitoringPages-1 {
+			log.Warnf("Node %s metrics truncated after %d pages", nodeID, maxMonitoringPages)
+		}
+		token = p.NextPageToken
 	}
-	return data
+	data, err := json.Marshal(entries)
+	return data, true, err
 }
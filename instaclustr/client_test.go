@@ -2,14 +2,23 @@ package instaclustr
 
 import (
 	"bytes"
+	"context"
+	"encoding/pem"
 	"fmt"
-	"strconv"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/fcgravalos/instaclustr_exporter/common"
 	"github.com/fcgravalos/instaclustr_exporter/mock"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
 )
 
 var (
@@ -18,25 +27,26 @@ var (
 )
 
 func setup(up chan bool) {
-	// Picking up random port for InstaClustr API mock server
-	mockServerPort := strconv.Itoa(common.PickRandomTCPPort())
-	mockServerListenAddress := fmt.Sprintf("127.0.0.1:%s", mockServerPort)
-
+	// The mock server listens on any free port
 	msOpts := common.ServerOptions{
-		ListenAddress:    mockServerListenAddress,
+		ListenAddress:    "127.0.0.1:0",
 		LivenessProbeURL: "/health",
 		ShutdownURL:      "/shutdown",
 		ReadTimeOut:      10 * time.Second,
 		WriteTimeOut:     10 * time.Second,
 	}
 
+	mockServer = mock.NewMockServer(msOpts)
+	if err := mockServer.Listen(); err != nil {
+		log.Fatalf("Could not start mock server: %v", err)
+	}
+
 	icOpts = Config{
-		Url:                fmt.Sprintf("http://"+"%s", mockServerListenAddress), //InstaClustr API Mock Server
+		Url:                fmt.Sprintf("http://"+"%s", mockServer.Addr()), //InstaClustr API Mock Server
 		User:               "test",
 		ProvisioningAPIKey: "test",
 		MonitoringAPIKey:   "test",
 	}
-	mockServer = mock.NewMockServer(msOpts)
 
 	go func() {
 		mockServer.Start()
@@ -52,8 +62,12 @@ func tearDown() {
 }
 
 func TestGetClusters(t *testing.T) {
-	clustersData := bytes.Trim(NewProvisioningClient(icOpts).GetClusters(), "\n")
-	expected := []byte(`[{"cassandraVersion":"apache-cassandra-2.1.10","derivedStatus":"RUNNING","id":"cluster-uuid-1","name":"MOCKED_CLUSTER_01","nodeCount":1,"runningNodeCount":1}]`)
+	data, err := NewProvisioningClient(icOpts).GetClusters()
+	if err != nil {
+		t.Fatalf("GetClusters returned unexpected error: %v", err)
+	}
+	clustersData := bytes.Trim(data, "\n")
+	expected := []byte(`[{"cassandraVersion":"apache-cassandra-2.1.10","derivedStatus":"RUNNING","id":"cluster-uuid-1","name":"MOCKED_CLUSTER_01","nodeCount":1,"pciCompliantCluster":false,"runningNodeCount":1}]`)
 	if !bytes.Equal(clustersData, expected) {
 		t.Errorf("\nGetClusters returned unexpected data.\nGot:\n%sExpected:\n%s", string(clustersData), string(expected))
 	}
@@ -63,13 +77,16 @@ func TestGetClusterStatus(t *testing.T) {
 	cases := []struct {
 		clusterID string
 		expected  string
+		status    int
 	}{
-		{"cluster-uuid-1", `{"dataCentres":[{"cdcNetwork":{"network":"a.b.0.0","prefixLength":16},"encryptionKeyId":null,"id":"datacentre-uuid-1","name":"MOCKED_DATACENTRE_01","nodeCount":1,"nodes":[{"id":"node-uuid-1","nodeStatus":"RUNNING","privateAddress":"e.f.g.h","publicAddress":"a.b.c.d","rack":"MOCKED_RACK_01","size":"size","sparkJobserver":false,"sparkMaster":false,"zeppelin":false}],"provider":"AWS_VPC","resizeTargetNodeSize":null}]}`},
-		{"unknown-cluster", `{"link":"https://www.w3.org/Protocols/rfc2616/rfc2616-sec10.html","message":"HTTP 404 Not Found","status":404}`},
+		{"cluster-uuid-1", `{"clusterName":"MOCKED_CLUSTER_01","clusterStatus":"RUNNING","dataCentres":[{"cdcNetwork":{"network":"a.b.0.0","prefixLength":16},"encryptionKeyId":null,"id":"datacentre-uuid-1","name":"MOCKED_DATACENTRE_01","nodeCount":1,"nodes":[{"id":"node-uuid-1","nodeStatus":"RUNNING","privateAddress":"e.f.g.h","publicAddress":"a.b.c.d","rack":"MOCKED_RACK_01","size":"size","sparkJobserver":false,"sparkMaster":false,"zeppelin":false}],"provider":"AWS_VPC","region":"US_EAST_1","replicationFactor":3,"resizeTargetNodeSize":null}],"id":"cluster-uuid-1"}`, 0},
+		{"unknown-cluster", ``, 404},
 	}
 	for _, c := range cases {
 		t.Logf("Testing GetClusterStatus with clusterID %s", c.clusterID)
-		clusterStatus := bytes.Trim(NewProvisioningClient(icOpts).GetClusterStatus(c.clusterID), "\n")
+		data, err := NewProvisioningClient(icOpts).GetClusterStatus(c.clusterID)
+		checkStatus(t, err, c.status)
+		clusterStatus := bytes.Trim(data, "\n")
 		expected := []byte(c.expected)
 		if !bytes.Equal(clusterStatus, expected) {
 			t.Errorf("GetClusterStatus returned unexpected data.\n- Got:\n%s\n- Expected:\n%s",
@@ -80,6 +97,69 @@ func TestGetClusterStatus(t *testing.T) {
 	}
 }
 
+// checkStatus checks err is the *APIError of status, or nil when status is 0
+func checkStatus(t *testing.T, err error, status int) {
+	if status == 0 {
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		return
+	}
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Status != status {
+		t.Errorf("Got error %v, expected an API error with status %d", err, status)
+	}
+}
+
+func TestGetClusterRepairs(t *testing.T) {
+	cases := []struct {
+		clusterID string
+		expected  string
+		status    int
+	}{
+		{"cluster-uuid-1", `[{"completedAt":"2017-07-02T03:00:00.000Z","keyspace":"mocked_keyspace","status":"COMPLETED","table":"mocked_table_01"},{"completedAt":"","keyspace":"mocked_keyspace","status":"RUNNING","table":"mocked_table_02"}]`, 0},
+		{"unknown-cluster", ``, 404},
+	}
+	for _, c := range cases {
+		t.Logf("Testing GetClusterRepairs with clusterID %s", c.clusterID)
+		data, err := NewProvisioningClient(icOpts).GetClusterRepairs(c.clusterID)
+		checkStatus(t, err, c.status)
+		repairs := bytes.Trim(data, "\n")
+		expected := []byte(c.expected)
+		if !bytes.Equal(repairs, expected) {
+			t.Errorf("GetClusterRepairs returned unexpected data.\n- Got:\n%s\n- Expected:\n%s",
+				string(repairs),
+				string(expected),
+			)
+		}
+	}
+}
+
+func TestDecodeClusterStatus(t *testing.T) {
+	var status struct {
+		DataCentres []struct {
+			ID string `json:"id"`
+		} `json:"dataCentres"`
+	}
+	if err := NewProvisioningClient(icOpts).DecodeClusterStatus("cluster-uuid-1", &status); err != nil {
+		t.Fatalf("DecodeClusterStatus returned unexpected error: %v", err)
+	}
+	if len(status.DataCentres) != 1 || status.DataCentres[0].ID != "datacentre-uuid-1" {
+		t.Errorf("DecodeClusterStatus returned unexpected data: %+v", status)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	opts := icOpts
+	opts.MaxResponseSize = 16
+	if data, err := NewProvisioningClient(opts).GetClusters(); err != ErrResponseTooLarge {
+		t.Errorf("GetClusters should not return data larger than %d bytes, got %v:\n%s", opts.MaxResponseSize, err, string(data))
+	}
+	var status interface{}
+	if err := NewProvisioningClient(opts).DecodeClusterStatus("cluster-uuid-1", &status); err != ErrResponseTooLarge {
+		t.Errorf("DecodeClusterStatus returned %v, expected %v", err, ErrResponseTooLarge)
+	}
+}
+
 func TestGetNodeMetric(t *testing.T) {
 	allMetrics := strings.Join([]string{
 		"n::cpuUtilization",     //Current CPU utilisation as a percentage of total available. Maximum value is 100%, regardless of the number of cores on the node.
@@ -96,14 +176,17 @@ func TestGetNodeMetric(t *testing.T) {
 		nodeID   string
 		metric   string
 		expected string
+		status   int
 	}{
 		{"node-uuid-1", allMetrics,
-			`[{"id":"node-uuid-1","payload":[{"metric":"clientRequestRead","type":"latency_per_operation","unit":"us/1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1462.5666666666664"}]},{"metric":"clientRequestRead","type":"95thPercentile","unit":"us","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1866.1645999999998"}]},{"metric":"cpuUtilization","type":"percentage","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"2.5884383"}]},{"metric":"repairs","type":"activetasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]},{"metric":"repairs","type":"pendingtasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]},{"metric":"clientRequestWrite","type":"latency_per_operation","unit":"us/1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1293.5333333333335"}]},{"metric":"clientRequestWrite","type":"95thPercentile","unit":"us","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1669.6253"}]},{"metric":"diskUtilization","type":"percentage","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"7.6197357"}]},{"metric":"cassandraReads","type":"count","unit":"1/s","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1.25"}]},{"metric":"cassandraWrites","type":"count","unit":"1/s","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1.25"}]},{"metric":"compactions","type":"pendingtasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]}]}]`},
-		{"unknown-node", allMetrics, `{"link":"https://www.w3.org/Protocols/rfc2616/rfc2616-sec10.html","message":"HTTP 404 Not Found","status":404}`},
+			`[{"id":"node-uuid-1","payload":[{"metric":"clientRequestRead","type":"latency_per_operation","unit":"us/1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1462.5666666666664"}]},{"metric":"clientRequestRead","type":"95thPercentile","unit":"us","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1866.1645999999998"}]},{"metric":"cpuUtilization","type":"percentage","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"2.5884383"}]},{"metric":"repairs","type":"activetasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]},{"metric":"repairs","type":"pendingtasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]},{"metric":"clientRequestWrite","type":"latency_per_operation","unit":"us/1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1293.5333333333335"}]},{"metric":"clientRequestWrite","type":"95thPercentile","unit":"us","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1669.6253"}]},{"metric":"diskUtilization","type":"percentage","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"7.6197357"}]},{"metric":"cassandraReads","type":"count","unit":"1/s","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1.25"}]},{"metric":"cassandraWrites","type":"count","unit":"1/s","values":[{"time":"2017-07-03T09:37:04.000Z","value":"1.25"}]},{"metric":"compactions","type":"pendingtasks","unit":"1","values":[{"time":"2017-07-03T09:37:04.000Z","value":"0.0"}]}]}]`, 0},
+		{"unknown-node", allMetrics, ``, 404},
 	}
 	for _, c := range cases {
 		t.Logf("Testing GetAllNodeMetrics with nodeID %s", c.nodeID)
-		clusterStatus := bytes.Trim(NewMonitoringClient(icOpts).GetNodeMetric(c.nodeID, c.metric), "\n")
+		data, err := NewMonitoringClient(icOpts).GetNodeMetric(c.nodeID, c.metric)
+		checkStatus(t, err, c.status)
+		clusterStatus := bytes.Trim(data, "\n")
 		expected := []byte(c.expected)
 		if !bytes.Equal(clusterStatus, expected) {
 			t.Errorf("GetAllNodeMetrics returned unexpected data.\n- Got:\n%s\n- Expected:\n%s",
@@ -121,3 +204,486 @@ func TestMain(m *testing.M) {
 	m.Run()
 	tearDown()
 }
+
+func TestParseAPIError(t *testing.T) {
+	apiErr, ok := ParseAPIError([]byte(`{"status": 404, "message": "HTTP 404 Not Found"}`))
+	if !ok || apiErr.Status != 404 {
+		t.Errorf("Expected a 404 API error, got %v", apiErr)
+	}
+	data, _ := NewMonitoringClient(icOpts).GetNodeMetric("node-uuid-1", "n::cpuUtilization")
+	if _, ok := ParseAPIError(data); ok {
+		t.Errorf("Node metrics parsed as an API error")
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html>Bad Gateway</html>"))
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	data, err := NewProvisioningClient(opts).GetClusters()
+	if data != nil {
+		t.Errorf("Got data %s from an error response", data)
+	}
+	checkStatus(t, err, http.StatusBadGateway)
+	var v interface{}
+	checkStatus(t, NewProvisioningClient(opts).DecodeClusterStatus("cluster-uuid-1", &v), http.StatusBadGateway)
+}
+
+func TestMonitoringPeriod(t *testing.T) {
+	queries := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		period   string
+		expected string
+	}{
+		{"", "metrics=n::cpuUtilization"},
+		{"2m", "metrics=n::cpuUtilization&period=2m"},
+	}
+	for _, c := range cases {
+		opts := icOpts
+		opts.Url = server.URL
+		opts.MonitoringPeriod = c.period
+		NewMonitoringClient(opts).GetNodeMetric("node-uuid-1", "n::cpuUtilization")
+		if got := <-queries; got != c.expected {
+			t.Errorf("period %q: got query %q want %q", c.period, got, c.expected)
+		}
+	}
+}
+
+func TestConsumerGroupRequests(t *testing.T) {
+	requests := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.RequestURI()
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	opts := icOpts
+	opts.Url = server.URL
+	// Only the node metrics are paginated
+	opts.MonitoringAPIVersion = MonitoringAPIV2
+	c := NewMonitoringClient(opts)
+	cases := []struct {
+		get      func() ([]byte, error)
+		expected string
+	}{
+		{
+			func() ([]byte, error) { return c.GetConsumerGroups("cluster-uuid-1") },
+			"/monitoring/v1/clusters/cluster-uuid-1/consumer-groups",
+		},
+		{
+			func() ([]byte, error) { return c.GetConsumerGroupTopics("cluster-uuid-1", "billing & co") },
+			"/monitoring/v1/clusters/cluster-uuid-1/consumer-group-topics?consumerGroup=billing+%26+co",
+		},
+		{
+			func() ([]byte, error) {
+				return c.GetConsumerGroupMetrics("cluster-uuid-1", "billing", "invoices", "consumerLag,consumerCount")
+			},
+			"/monitoring/v1/clusters/cluster-uuid-1/consumer-group-metrics?consumerGroup=billing&metrics=consumerLag%2CconsumerCount&topic=invoices",
+		},
+	}
+	for _, tc := range cases {
+		if _, err := tc.get(); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-requests; got != tc.expected {
+			t.Errorf("Got request %s, want %s", got, tc.expected)
+		}
+	}
+}
+
+func TestMonitoringAPIV2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path != "/monitoring/v2/nodes/node-uuid-1":
+			http.NotFound(w, r)
+		case r.URL.Query().Get("pageToken") == "":
+			w.Write([]byte(`{"data": [{"id": "node-uuid-1", "payload": [{"metric": "cpuUtilization"}]}], "nextPageToken": "p2"}`))
+		case r.URL.Query().Get("pageToken") == "p2":
+			w.Write([]byte(`{"data": [{"id": "node-uuid-1", "payload": [{"metric": "diskUtilization"}]}]}`))
+		}
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MonitoringAPIVersion = MonitoringAPIV2
+	data, err := NewMonitoringClient(opts).GetNodeMetric("node-uuid-1", "n::cpuUtilization,n::diskUtilization")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := string(data)
+	expected := `[{"id":"node-uuid-1","payload":[{"metric":"cpuUtilization"}]},{"id":"node-uuid-1","payload":[{"metric":"diskUtilization"}]}]`
+	if got != expected {
+		t.Errorf("Got %s want %s", got, expected)
+	}
+}
+
+func TestMonitoringAPIV2Fallback(t *testing.T) {
+	paths := make(chan string, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		if r.URL.Path != "/monitoring/v1/nodes/node-uuid-1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MonitoringAPIVersion = MonitoringAPIV2
+	c := NewMonitoringClient(opts)
+	for i := 0; i < 2; i++ {
+		if data, err := c.GetNodeMetric("node-uuid-1", "n::cpuUtilization"); err != nil || string(data) != "[]" {
+			t.Errorf("Got %s (%v) want the v1 response", data, err)
+		}
+	}
+	close(paths)
+	got := []string{}
+	for p := range paths {
+		got = append(got, p)
+	}
+	expected := []string{"/monitoring/v2/nodes/node-uuid-1", "/monitoring/v1/nodes/node-uuid-1", "/monitoring/v1/nodes/node-uuid-1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got requests to %v want %v", got, expected)
+	}
+}
+
+func TestAPIHeader(t *testing.T) {
+	accepts := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepts <- r.Header.Get("Accept")
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MonitoringHeader = "Accept: application/vnd.instaclustr.v2+json"
+
+	NewMonitoringClient(opts).GetNodeMetric("node-uuid-1", "n::cpuUtilization")
+	if got := <-accepts; got != "application/vnd.instaclustr.v2+json" {
+		t.Errorf("Monitoring request: got Accept %q", got)
+	}
+	NewProvisioningClient(opts).GetClusters()
+	if got := <-accepts; got != "" {
+		t.Errorf("Provisioning request: got Accept %q, want none", got)
+	}
+
+	for _, h := range []string{"Accept", ": value", "  : value"} {
+		if _, _, err := ParseHeader(h); err == nil {
+			t.Errorf("%q should be invalid", h)
+		}
+	}
+}
+
+func TestCountRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"status": 429, "message": "Too many requests"}`))
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	counter := func(c *prometheus.CounterVec, labels ...string) float64 {
+		pb := &dto.Metric{}
+		c.WithLabelValues(labels...).Write(pb)
+		return pb.GetCounter().GetValue()
+	}
+	requests, errors := counter(apiRequests, "monitoring", "429"), counter(apiErrors, "monitoring")
+	NewMonitoringClient(opts).GetNodeMetric("node-uuid-1", "n::cpuUtilization")
+	if got := counter(apiRequests, "monitoring", "429") - requests; got != 1 {
+		t.Errorf("Got %v requests with code 429, want 1", got)
+	}
+	if got := counter(apiErrors, "monitoring") - errors; got != 1 {
+		t.Errorf("Got %v errors, want 1", got)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	statuses := make(chan int, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := <-statuses
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		retries  int
+		statuses []int
+		// status is the one of the returned error, 0 on success
+		status int
+	}{
+		{2, []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, 0},
+		{1, []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, http.StatusServiceUnavailable},
+		{2, []int{http.StatusNotFound}, http.StatusNotFound},
+		{0, []int{http.StatusServiceUnavailable}, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		opts := icOpts
+		opts.Url = server.URL
+		opts.MaxRetries = c.retries
+		opts.RetryBackoff = time.Millisecond
+		for _, s := range c.statuses {
+			statuses <- s
+		}
+		_, err := NewProvisioningClient(opts).GetClusters()
+		checkStatus(t, err, c.status)
+		if len(statuses) != 0 {
+			t.Errorf("%v: %d requests not sent", c.statuses, len(statuses))
+			for len(statuses) > 0 {
+				<-statuses
+			}
+		}
+	}
+
+	c := instaclustrClient{retryBackoff: 100 * time.Millisecond}
+	for retry, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if d := c.backoff(retry); d < max/2 || d > max {
+			t.Errorf("Retry %d after %s, want between %s and %s", retry, d, max/2, max)
+		}
+	}
+	// Capped however many retries, without overflowing
+	for _, retry := range []int{10, 64, 1000} {
+		if d := c.backoff(retry); d < maxRetryBackoff/2 || d > maxRetryBackoff {
+			t.Errorf("Retry %d after %s, want between %s and %s", retry, d, maxRetryBackoff/2, maxRetryBackoff)
+		}
+	}
+	// Unless the first delay is longer
+	c.retryBackoff = 2 * maxRetryBackoff
+	if d := c.backoff(5); d < maxRetryBackoff || d > 2*maxRetryBackoff {
+		t.Errorf("Retry after %s, want between %s and %s", d, maxRetryBackoff, 2*maxRetryBackoff)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	requests := make(chan struct{}, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	clock := common.NewFakeClock(time.Now())
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MaxRetries = 1
+	opts.RetryBackoff = time.Hour
+	opts.Clock = clock
+	done := make(chan error)
+	go func() {
+		_, err := NewProvisioningClient(opts).GetClusterStatus("cluster-uuid-1")
+		done <- err
+	}()
+	<-requests
+	// The retry waits for its backoff on the clock of the client
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-requests:
+		t.Fatal("Retried before the backoff elapsed")
+	default:
+	}
+	clock.Advance(time.Hour)
+	checkStatus(t, <-done, http.StatusServiceUnavailable)
+	if len(requests) != 1 {
+		t.Errorf("Got %d retries, want 1", len(requests))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	c := instaclustrClient{retryBackoff: time.Millisecond, clock: common.SystemClock}
+	cases := []struct {
+		retryAfter string
+		min, max   time.Duration
+		retry      bool
+	}{
+		{"", 0, time.Millisecond, true},
+		{"invalid", 0, time.Millisecond, true},
+		{"30", 30 * time.Second, 30 * time.Second, true},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 0, 0, false},
+	}
+	for _, tc := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if tc.retryAfter != "" {
+			resp.Header.Set("Retry-After", tc.retryAfter)
+		}
+		d, retry := c.retryDelay(0, resp)
+		if retry != tc.retry || retry && (d < tc.min || d > tc.max) {
+			t.Errorf("Retry-After %q: got %s (retry %v), want %s to %s (retry %v)", tc.retryAfter, d, retry, tc.min, tc.max, tc.retry)
+		}
+	}
+	if d, retry := c.retryDelay(0, nil); !retry || d > time.Millisecond {
+		t.Errorf("Got %s (retry %v) without a response, want the backoff", d, retry)
+	}
+
+	// Not retried when asked to wait longer than any backoff
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MaxRetries = 2
+	opts.RetryBackoff = time.Millisecond
+	_, err := NewProvisioningClient(opts).GetClusterStatus("cluster-uuid-1")
+	checkStatus(t, err, http.StatusTooManyRequests)
+	if requests != 1 {
+		t.Errorf("Sent %d requests, want 1", requests)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	opts := icOpts
+	opts.Url = server.URL
+	opts.MaxRetries = 3
+	opts.RetryBackoff = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := NewProvisioningClient(opts).WithContext(ctx).GetClusters(); err == nil {
+		t.Errorf("Request outlived its context")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("Request cancelled after %s", d)
+	}
+}
+
+// recordingTransport records the URLs of the requests it sends
+type recordingTransport struct {
+	urls []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.urls = append(t.urls, req.URL.Path)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTransport(t *testing.T) {
+	transport := &recordingTransport{}
+	opts := icOpts
+	opts.Transport = transport
+	if _, err := NewProvisioningClient(opts).GetClusters(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMonitoringClient(opts).GetNodeMetric("node-uuid-1", "n::cpuUtilization"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/provisioning/v1", "/monitoring/v1/nodes/node-uuid-1"}
+	if !reflect.DeepEqual(transport.urls, expected) {
+		t.Errorf("Got requests %v, want %v", transport.urls, expected)
+	}
+}
+
+func TestProxyAndCAFile(t *testing.T) {
+	api := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[]")
+	}))
+	defer api.Close()
+	opts := icOpts
+	opts.Url = api.URL
+	if _, err := NewProvisioningClient(opts).GetClusters(); err == nil {
+		t.Error("Untrusted certificate accepted")
+	}
+
+	f, err := ioutil.TempFile("", "ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: api.TLS.Certificates[0].Certificate[0]})
+	f.Close()
+	opts.CAFile = f.Name()
+	if _, err := NewProvisioningClient(opts).GetClusters(); err != nil {
+		t.Errorf("Certificate of the CA file rejected: %v", err)
+	}
+	opts.CAFile = ""
+	opts.InsecureSkipVerify = true
+	if _, err := NewProvisioningClient(opts).GetClusters(); err != nil {
+		t.Errorf("Certificate verified despite InsecureSkipVerify: %v", err)
+	}
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, "[]")
+	}))
+	defer proxy.Close()
+	opts = icOpts
+	opts.Url = "http://api.example.com"
+	opts.Proxy = proxy.URL
+	if _, err := NewProvisioningClient(opts).GetClusters(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "http://api.example.com/provisioning/v1"; proxied != expected {
+		t.Errorf("Proxied %q, want %q", proxied, expected)
+	}
+}
+
+func TestSharedTransport(t *testing.T) {
+	opts := icOpts
+	opts.MaxIdleConnsPerHost = 32
+	if NewProvisioningClient(opts).client.Transport == NewMonitoringClient(opts).client.Transport {
+		t.Fatal("Transport shared by clients without one")
+	}
+	transport := NewTransport(opts)
+	if transport.MaxIdleConnsPerHost != 32 {
+		t.Errorf("Got %d idle connections per host, want 32", transport.MaxIdleConnsPerHost)
+	}
+	opts.Transport = transport
+	provisioning, monitoring := NewProvisioningClient(opts), NewMonitoringClient(opts)
+	if provisioning.client.Transport != transport || monitoring.client.Transport != transport {
+		t.Error("The Provisioning and Monitoring clients don't share the given transport")
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	opts := icOpts
+	opts.Url = slow.URL
+	opts.RequestTimeout = 50 * time.Millisecond
+	if _, err := NewProvisioningClient(opts).GetClusters(); err == nil {
+		t.Error("Request not timed out")
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	// The mock server only listens on IPv4
+	opts := icOpts
+	opts.Network = "tcp4"
+	if _, err := NewProvisioningClient(opts).GetClusters(); err != nil {
+		t.Errorf("Couldn't reach the API over tcp4: %v", err)
+	}
+	opts.Network = "tcp6"
+	if _, err := NewProvisioningClient(opts).GetClusters(); err == nil {
+		t.Error("Reached an IPv4 API over tcp6")
+	}
+}
@@ -0,0 +1,104 @@
+package instaclustr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/common/log"
+)
+
+// Faults injected, the fault label of injectedFaults
+const (
+	faultFailure = "failure"
+	faultDelay   = "delay"
+)
+
+// faultTransport fails or delays a percentage of the requests sent through
+// it, so alerting and the retries can be rehearsed in staging without an
+// actual API outage
+type faultTransport struct {
+	next     http.RoundTripper
+	endpoint string
+	// failure and delay are percentages of the requests, delays last up to
+	// maxDelay
+	failure  float64
+	delay    float64
+	maxDelay time.Duration
+	clock    common.Clock
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// newFaultTransport wraps next with the faults of config, next itself when
+// none is configured
+func newFaultTransport(config Config, endpoint string, next http.RoundTripper, clock common.Clock) http.RoundTripper {
+	if config.FaultFailurePercent <= 0 && (config.FaultDelayPercent <= 0 || config.FaultDelay <= 0) {
+		return next
+	}
+	log.Warnf("Injecting faults in the %s API requests: %g%% failed, %g%% delayed by up to %s",
+		endpoint, config.FaultFailurePercent, config.FaultDelayPercent, config.FaultDelay)
+	return &faultTransport{
+		next:     next,
+		endpoint: endpoint,
+		failure:  config.FaultFailurePercent,
+		delay:    config.FaultDelayPercent,
+		maxDelay: config.FaultDelay,
+		clock:    clock,
+		rand:     rand.New(rand.NewSource(clock.Now().UnixNano())),
+	}
+}
+
+// roll draws the faults of a request
+func (t *faultTransport) roll() (fail bool, delay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxDelay > 0 && t.rand.Float64()*100 < t.delay {
+		delay = time.Duration(t.rand.Int63n(int64(t.maxDelay)) + 1)
+	}
+	return t.rand.Float64()*100 < t.failure, delay
+}
+
+// RoundTrip sends req after the injected delay, if any, or answers it with
+// a 503 API error without sending it when failed. The delay ends early with
+// the context of req, so it doesn't outlast the collection timeout.
+func (t *faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	fail, delay := t.roll()
+	if delay > 0 {
+		injectedFaults.WithLabelValues(t.endpoint, faultDelay).Inc()
+		select {
+		case <-t.clock.After(delay):
+		case <-req.Context().Done():
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+	}
+	if !fail {
+		return t.next.RoundTrip(req)
+	}
+	injectedFaults.WithLabelValues(t.endpoint, faultFailure).Inc()
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	status := http.StatusServiceUnavailable
+	body := fmt.Sprintf(`{"status":%d,"message":"fault injected by the exporter"}`, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,68 @@
+package instaclustr
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+// recordingClock records the delays waited for on it, without waiting
+type recordingClock struct {
+	common.Clock
+	waited time.Duration
+}
+
+func (c *recordingClock) After(d time.Duration) <-chan time.Time {
+	c.waited += d
+	return c.Clock.After(0)
+}
+
+func TestFaultInjection(t *testing.T) {
+	sent := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	c := NewProvisioningClient(Config{Url: server.URL, FaultFailurePercent: 100})
+	_, err := c.GetClusters()
+	if e, ok := err.(*APIError); !ok || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("Got %v, want an injected 503", err)
+	}
+	if sent != 0 {
+		t.Errorf("Failed request reached the API")
+	}
+
+	clock := &recordingClock{Clock: common.NewFakeClock(time.Now())}
+	c = NewProvisioningClient(Config{Url: server.URL, FaultDelayPercent: 100, FaultDelay: time.Minute, Clock: clock})
+	ft := c.client.Transport.(*faultTransport)
+	if _, err := c.GetClusters(); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 || clock.waited <= 0 || clock.waited > time.Minute {
+		t.Errorf("Got %d requests sent after %s, want 1 after up to 1m", sent, clock.waited)
+	}
+
+	// Delays end with the request context
+	ft.clock = common.NewFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if _, err := ft.RoundTrip(req.WithContext(ctx)); err != context.Canceled {
+		t.Errorf("Got %v once the request cancelled, want %v", err, context.Canceled)
+	}
+	if sent != 1 {
+		t.Errorf("Cancelled request reached the API")
+	}
+
+	if c := NewProvisioningClient(Config{Url: server.URL}); c.client.Transport == nil {
+		t.Errorf("No transport without faults")
+	} else if _, ok := c.client.Transport.(*faultTransport); ok {
+		t.Errorf("Faults injected without a percentage")
+	}
+}
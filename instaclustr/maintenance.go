@@ -0,0 +1,111 @@
+package instaclustr
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// maxMaintenancePause bounds the pauses asked by Retry-After, so a bogus
+// header doesn't stop the collections for good. The API answers again with
+// a Retry-After if its maintenance lasts longer.
+const maxMaintenancePause = time.Hour
+
+// MaintenanceError is returned, without sending the request, while the API
+// is in maintenance
+type MaintenanceError struct {
+	Until time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	return fmt.Sprintf("InstaClustr API in maintenance until %s", e.Until.Format(time.RFC3339))
+}
+
+// maintenanceWindow is when the API said it's in maintenance, answering the
+// listing of the clusters of the account, or the first request of a
+// maintenance probe, 503 with a Retry-After. Shared by
+// the clients as the Provisioning and Monitoring APIs are served by the
+// same hosts. Its methods take the time from the clock of their caller.
+type maintenanceWindow struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+var maintenance = &maintenanceWindow{}
+
+var apiMaintenance = prometheus.NewGaugeFunc(
+	prometheus.GaugeOpts{
+		Name: "instaclustr_api_maintenance",
+		Help: "Whether the InstaClustr API is in maintenance, having answered the listing of the clusters, or the status of the first pinned one, 503 with a Retry-After, and isn't polled until the time it indicated.",
+	},
+	func() float64 {
+		if InMaintenance(common.SystemClock) {
+			return 1
+		}
+		return 0
+	},
+)
+
+// InMaintenance tells whether the API is in maintenance at the time of
+// clock, the collections serving their last metrics meanwhile
+func InMaintenance(clock common.Clock) bool {
+	_, ok := maintenance.active(clock.Now())
+	return ok
+}
+
+// active returns the end of the maintenance ongoing at now, if any
+func (w *maintenanceWindow) active(now time.Time) (time.Time, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.until, now.Before(w.until)
+}
+
+// start records the maintenance announced at now by resp, a 503 with a
+// Retry-After, telling whether it is one
+func (w *maintenanceWindow) start(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		return time.Time{}, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+	if !ok {
+		return time.Time{}, false
+	}
+	if d > maxMaintenancePause {
+		d = maxMaintenancePause
+	}
+	if until := now.Add(d); until.After(w.until) {
+		log.Warnf("InstaClustr API in maintenance, not polling it until %s", until.Format(time.RFC3339))
+		w.until = until
+	}
+	return w.until, true
+}
+
+// parseRetryAfter parses a Retry-After header, delay in seconds or HTTP
+// date, into the delay from now
+func parseRetryAfter(s string, now time.Time) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(s); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
@@ -0,0 +1,83 @@
+package instaclustr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+func TestMaintenance(t *testing.T) {
+	now := time.Now()
+	clock := common.NewFakeClock(now)
+	defer func() {
+		maintenance.until = time.Time{}
+	}()
+	sent := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent++
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := NewProvisioningClient(Config{Url: server.URL, MaxRetries: 2, Clock: clock})
+	_, err := c.GetClusters()
+	if e, ok := err.(*MaintenanceError); !ok || !e.Until.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("Got %v, want maintenance until %s", err, now.Add(2*time.Minute))
+	}
+	if !InMaintenance(clock) {
+		t.Errorf("API not in maintenance")
+	}
+	// Neither retried nor sent again during the maintenance
+	NewMonitoringClient(Config{Url: server.URL, Clock: clock}).GetNodeMetric("node-uuid-1", "n::cpuUtilization")
+	if sent != 1 {
+		t.Errorf("Sent %d requests, want 1", sent)
+	}
+	now = now.Add(2 * time.Minute)
+	clock.Set(now)
+	if InMaintenance(clock) {
+		t.Errorf("API still in maintenance after the Retry-After")
+	}
+
+	// Only the cluster listing tells the whole API in maintenance
+	if _, err := NewProvisioningClient(Config{Url: server.URL, Clock: clock}).GetClusterStatus("cluster-uuid-1"); err == nil {
+		t.Error("503 not failing the cluster status")
+	}
+	if InMaintenance(clock) {
+		t.Errorf("API in maintenance after a 503 to the status of a cluster")
+	}
+	// Unless it's the first request of a maintenance probe, the clusters
+	// being pinned instead of listed
+	probe := NewProvisioningClient(Config{Url: server.URL, Clock: clock}).WithMaintenanceProbe()
+	if _, err := probe.GetClusterStatus("cluster-uuid-1"); !InMaintenance(clock) {
+		t.Errorf("Got %v, want the first request of the probe to start a maintenance", err)
+	}
+	now = now.Add(2 * time.Minute)
+	clock.Set(now)
+	probe.GetClusterStatus("cluster-uuid-2")
+	if InMaintenance(clock) {
+		t.Errorf("API in maintenance after a 503 to the second request of the probe")
+	}
+
+	cases := []struct {
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"30", 30 * time.Second, true},
+		{now.Add(time.Hour).UTC().Format(http.TimeFormat), time.Hour, true},
+		{now.Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, c := range cases {
+		d, ok := parseRetryAfter(c.header, now.Truncate(time.Second))
+		if d != c.expected || ok != c.ok {
+			t.Errorf("%q: got %s (%v), want %s (%v)", c.header, d, ok, c.expected, c.ok)
+		}
+	}
+}
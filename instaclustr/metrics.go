@@ -0,0 +1,104 @@
+package instaclustr
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "instaclustr_exporter"
+
+var (
+	oversizedResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "oversized_responses_total",
+			Help:      "Number of InstaClustr API responses truncated for exceeding the maximum response size.",
+		},
+		[]string{"endpoint"},
+	)
+	apiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_requests_total",
+			Help:      "Number of InstaClustr API requests by endpoint and HTTP status code, \"error\" when no response was received.",
+		},
+		[]string{"endpoint", "code"},
+	)
+	apiErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_errors_total",
+			Help:      "Number of InstaClustr API requests failing, without a response or with an error status code.",
+		},
+		[]string{"endpoint"},
+	)
+	apiRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_retries_total",
+			Help:      "Number of InstaClustr API requests retried after failing without a response or with a retryable status code.",
+		},
+		[]string{"endpoint"},
+	)
+	apiThrottled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_throttled_requests_total",
+			Help:      "Number of InstaClustr API requests delayed by the client rate limit.",
+		},
+		[]string{"endpoint"},
+	)
+	budgetExceeded = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_budget_exceeded_total",
+			Help:      "Number of InstaClustr API requests not sent as their collection spent the call budget of the API.",
+		},
+		[]string{"endpoint"},
+	)
+	injectedFaults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "api_injected_faults_total",
+			Help:      "Number of faults, failures or delays, injected in the InstaClustr API requests for testing.",
+		},
+		[]string{"endpoint", "fault"},
+	)
+)
+
+// countRequest counts a request to endpoint, status is 0 when no response was received
+func countRequest(endpoint string, status int) {
+	code := "error"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	apiRequests.WithLabelValues(endpoint, code).Inc()
+	if status == 0 || status >= 400 {
+		apiErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// Describe sends the descriptors of the InstaClustr client metrics to ch
+func Describe(ch chan<- *prometheus.Desc) {
+	oversizedResponses.Describe(ch)
+	apiRequests.Describe(ch)
+	apiErrors.Describe(ch)
+	apiRetries.Describe(ch)
+	apiThrottled.Describe(ch)
+	budgetExceeded.Describe(ch)
+	injectedFaults.Describe(ch)
+	apiMaintenance.Describe(ch)
+}
+
+// Collect sends the InstaClustr client metrics to ch
+func Collect(ch chan<- prometheus.Metric) {
+	oversizedResponses.Collect(ch)
+	apiRequests.Collect(ch)
+	apiErrors.Collect(ch)
+	apiRetries.Collect(ch)
+	apiThrottled.Collect(ch)
+	budgetExceeded.Collect(ch)
+	injectedFaults.Collect(ch)
+	apiMaintenance.Collect(ch)
+}
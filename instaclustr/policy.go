@@ -0,0 +1,125 @@
+package instaclustr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBudgetExceeded is returned for the requests over the call budget of
+// their collection, see APIPolicy.Budget
+var ErrBudgetExceeded = errors.New("API call budget of the collection exceeded")
+
+// APIPolicy overrides, for the requests of a single API, the retries and the
+// rate limit of Config, and sets how many requests a collection may send to
+// it. Unset fields keep the Config settings.
+type APIPolicy struct {
+	MaxRetries   *int           `yaml:"max_retries"`
+	RetryBackoff *time.Duration `yaml:"retry_backoff"`
+	// RateLimit gives the API a rate limit of its own, instead of sharing the
+	// account one with the other API
+	RateLimit *float64 `yaml:"rate_limit"`
+	RateBurst *int     `yaml:"rate_burst"`
+	// Budget is how many requests, retries included, a collection may send
+	// to the API, unlimited if 0. Collections are the clients returned by
+	// WithContext.
+	Budget int `yaml:"budget"`
+}
+
+// ParseAPIPolicy parses comma separated key=value pairs, the keys being
+// max-retries, retry-backoff, rate-limit, rate-burst and budget, e.g.
+// rate-limit=2,budget=500
+func ParseAPIPolicy(s string) (APIPolicy, error) {
+	var p APIPolicy
+	if s == "" {
+		return p, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return p, fmt.Errorf("invalid policy setting %q, expected key=value", pair)
+		}
+		var err error
+		switch kv[0] {
+		case "max-retries":
+			var n int
+			n, err = strconv.Atoi(kv[1])
+			p.MaxRetries = &n
+		case "retry-backoff":
+			var d time.Duration
+			d, err = time.ParseDuration(kv[1])
+			p.RetryBackoff = &d
+		case "rate-limit":
+			var rate float64
+			rate, err = strconv.ParseFloat(kv[1], 64)
+			p.RateLimit = &rate
+		case "rate-burst":
+			var n int
+			n, err = strconv.Atoi(kv[1])
+			p.RateBurst = &n
+		case "budget":
+			p.Budget, err = strconv.Atoi(kv[1])
+		default:
+			return p, fmt.Errorf("unknown policy setting %q, expected max-retries, retry-backoff, rate-limit, rate-burst or budget", kv[0])
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid %s %q: %v", kv[0], kv[1], err)
+		}
+	}
+	return p, nil
+}
+
+// policy is the effective policy of the requests of an API
+type policy struct {
+	maxRetries   int
+	retryBackoff time.Duration
+	rateLimit    float64
+	rateBurst    int
+	// ownLimit is set when the API doesn't share the account rate limit
+	ownLimit bool
+	budget   int
+}
+
+// policyFor merges the APIPolicy of endpoint into the settings of config
+func policyFor(config Config, endpoint string) policy {
+	p := policy{
+		maxRetries:   config.MaxRetries,
+		retryBackoff: config.RetryBackoff,
+		rateLimit:    config.RateLimit,
+		rateBurst:    config.RateBurst,
+	}
+	override := config.ProvisioningPolicy
+	if endpoint == monitoringAPIEndpoint {
+		override = config.MonitoringPolicy
+	}
+	if override.MaxRetries != nil {
+		p.maxRetries = *override.MaxRetries
+	}
+	if override.RetryBackoff != nil {
+		p.retryBackoff = *override.RetryBackoff
+	}
+	if override.RateLimit != nil {
+		p.rateLimit, p.ownLimit = *override.RateLimit, true
+	}
+	if override.RateBurst != nil {
+		p.rateBurst, p.ownLimit = *override.RateBurst, true
+	}
+	p.budget = override.Budget
+	return p
+}
+
+// spend takes a request out of the budget of the collection, failing when
+// it's spent. Clients not returned by WithContext have no budget.
+func (c instaclustrClient) spend() error {
+	if c.budget <= 0 || c.calls == nil {
+		return nil
+	}
+	if atomic.AddInt64(c.calls, 1) > int64(c.budget) {
+		budgetExceeded.WithLabelValues(c.APIEndpoint).Inc()
+		return ErrBudgetExceeded
+	}
+	return nil
+}
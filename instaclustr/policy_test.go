@@ -0,0 +1,56 @@
+package instaclustr
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseAPIPolicy(t *testing.T) {
+	p, err := ParseAPIPolicy("max-retries=1,retry-backoff=2s,rate-limit=0.5,rate-burst=3,budget=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p.MaxRetries != 1 || *p.RetryBackoff != 2*time.Second || *p.RateLimit != 0.5 || *p.RateBurst != 3 || p.Budget != 100 {
+		t.Errorf("Got %+v", p)
+	}
+	for _, s := range []string{"budget", "budget=lots", "timeout=1s"} {
+		if _, err := ParseAPIPolicy(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestAPIPolicy(t *testing.T) {
+	retries, rate := 0, 2.0
+	cfg := Config{User: "policy", MaxRetries: 3, RateLimit: 5, RateBurst: 10}
+	cfg.MonitoringPolicy = APIPolicy{MaxRetries: &retries, RateLimit: &rate}
+	p, m := NewProvisioningClient(cfg), NewMonitoringClient(cfg)
+	if p.maxRetries != 3 || m.maxRetries != 0 {
+		t.Errorf("Got %d and %d retries, want 3 and 0", p.maxRetries, m.maxRetries)
+	}
+	if p.limiter == nil || m.limiter == nil || p.limiter == m.limiter || m.limiter.rate != 2 {
+		t.Errorf("Monitoring API doesn't have a rate limit of its own")
+	}
+
+	opts := icOpts
+	opts.ProvisioningPolicy = APIPolicy{Budget: 2}
+	c := NewProvisioningClient(opts)
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetClusters(); err != nil {
+			t.Fatalf("Client without a collection was limited: %v", err)
+		}
+	}
+	collection := c.WithContext(context.Background())
+	for i := 0; i < 2; i++ {
+		if _, err := collection.GetClusters(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := collection.GetClusters(); err != ErrBudgetExceeded {
+		t.Errorf("Got %v over the budget, want %v", err, ErrBudgetExceeded)
+	}
+	if _, err := c.WithContext(context.Background()).GetClusters(); err != nil {
+		t.Errorf("Next collection didn't get a budget of its own: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package instaclustr
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+// rateLimiter is a token bucket: requests take a token, refilled at rate per
+// second up to burst. Requests finding the bucket empty wait for their token,
+// in the order they came.
+type rateLimiter struct {
+	mu    sync.Mutex
+	rate  float64
+	burst float64
+	// tokens goes negative when requests are waiting
+	tokens float64
+	last   time.Time
+	clock  common.Clock
+}
+
+func newRateLimiter(rate float64, burst int, clock common.Clock) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: clock.Now(), clock: clock}
+}
+
+// reserve takes a token, returning how long to wait before sending the request
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// limiterKey identifies the account a limiter is shared by, and the API when
+// it has a limit of its own
+type limiterKey struct {
+	url, user, endpoint string
+	rate                float64
+	burst               int
+}
+
+var (
+	limitersMu sync.Mutex
+	// limiters are shared by the clients of an account, the Provisioning and
+	// Monitoring APIs counting towards the same limits
+	limiters = map[limiterKey]*rateLimiter{}
+)
+
+// limiterFor returns the limiter of the requests of user to endpoint under
+// p, shared with the other API of the account unless p has a limit of its
+// own. nil when they aren't limited. The limiter keeps the clock of the
+// first client sharing it.
+func limiterFor(url, user, endpoint string, p policy, clock common.Clock) *rateLimiter {
+	if p.rateLimit <= 0 {
+		return nil
+	}
+	key := limiterKey{url: url, user: user, rate: p.rateLimit, burst: p.rateBurst}
+	if p.ownLimit {
+		key.endpoint = endpoint
+	}
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[key]
+	if !ok {
+		l = newRateLimiter(p.rateLimit, p.rateBurst, clock)
+		limiters[key] = l
+	}
+	return l
+}
@@ -0,0 +1,44 @@
+package instaclustr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := common.NewFakeClock(time.Now())
+	l := newRateLimiter(2, 2, clock)
+
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, e := range expected {
+		if d := l.reserve(); d != e {
+			t.Errorf("Request %d waits %s, want %s", i, d, e)
+		}
+	}
+	// The waiting requests take the first refilled tokens
+	clock.Advance(2 * time.Second)
+	for i := 0; i < 2; i++ {
+		if d := l.reserve(); d != 0 {
+			t.Errorf("Request after the refill waits %s", d)
+		}
+	}
+	if d := l.reserve(); d != 500*time.Millisecond {
+		t.Errorf("Request over the refill waits %s, want 500ms", d)
+	}
+
+	cfg := Config{User: "user", RateLimit: 5, RateBurst: 10}
+	p, m := NewProvisioningClient(cfg), NewMonitoringClient(cfg)
+	if p.limiter == nil || p.limiter != m.limiter {
+		t.Errorf("Provisioning and Monitoring clients don't share the rate limit")
+	}
+	cfg.User = "other"
+	if NewProvisioningClient(cfg).limiter == p.limiter {
+		t.Errorf("Accounts share the rate limit")
+	}
+	cfg.RateLimit = 0
+	if NewProvisioningClient(cfg).limiter != nil {
+		t.Errorf("Rate limited without a rate")
+	}
+}
@@ -3,60 +3,342 @@ package main
 import (
 	"flag"
 	"fmt"
+	"html"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/fcgravalos/instaclustr_exporter/archive"
+	"github.com/fcgravalos/instaclustr_exporter/cmdb"
 	"github.com/fcgravalos/instaclustr_exporter/collector"
 	"github.com/fcgravalos/instaclustr_exporter/common"
 	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/fcgravalos/instaclustr_exporter/kubernetes"
+	"github.com/fcgravalos/instaclustr_exporter/webhook"
 	"github.com/gorilla/mux"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
 	"github.com/prometheus/common/version"
 )
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte(`<html>
+// homeHandler links to the metrics, at metricsURL as seen by browsers
+func homeHandler(metricsURL, docsURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html>
 					<head><title>InstaClustr Exporter</title></head>
 					<body>
 					<h1>InstaClustr Exporter</h1>
-					<p><a href="/metrics">Metrics</a></p>
+					<p><a href="%s">Metrics</a></p>
+					<p><a href="%s">Metrics documentation</a></p>
 					</body>
-					</html>`))
+					</html>`, html.EscapeString(metricsURL), html.EscapeString(docsURL))
+	}
+}
+
+func validNetwork(network string) bool {
+	for _, n := range common.Networks {
+		if network == n {
+			return true
+		}
+	}
+	return false
 }
 
-// NewExporter creates the InstaClustr Exporter
-func NewExporter(telemetryPath string, serverOpts common.ServerOptions, instaclustrCfg instaclustr.Config) *common.Server {
-	exp := collector.NewExporter(instaclustrCfg)
-	prometheus.MustRegister(exp)
-	// start httpServer
+// NewExporter creates the InstaClustr Exporter out of cfg. reload loads the configuration again on SIGHUP and POST
+// /-/reload, nil when there is no configuration file to reload.
+func NewExporter(cfg config, reload func() (config, error)) (*common.Server, error) {
+	snapshots := &lastSnapshot{}
+	wires := []func(collection){func(exp collection) { exp.OnSnapshot(snapshots.store) }}
+	if cfg.Archive.Enabled() {
+		a := archive.NewArchiver(cfg.Archive)
+		wires = append(wires, func(exp collection) {
+			exp.OnSnapshot(func(snapshot collector.Snapshot) {
+				if err := a.Archive(snapshot.Time, snapshot); err != nil {
+					log.Errorf("Could not archive snapshot: %v", err)
+				}
+			})
+		})
+	}
+	if cfg.CMDB.Enabled() {
+		p := cmdb.NewPusher(cfg.CMDB)
+		wires = append(wires, func(exp collection) {
+			exp.OnSnapshot(func(snapshot collector.Snapshot) {
+				// Clusters missing from partial snapshots would be
+				// missing from the CMDB
+				if snapshot.Partial {
+					log.Warn("Collection incomplete, the inventory isn't pushed to the CMDB")
+					return
+				}
+				if err := p.Push(collector.SnapshotInventory(snapshot)); err != nil {
+					log.Errorf("Could not push the inventory to the CMDB: %v", err)
+				}
+			})
+		})
+	}
+	if cfg.Webhook.Enabled() {
+		// The nodes are tracked across reloads. Snapshots are diffed and
+		// queued one at a time, so the changes are notified in order.
+		n, err := webhook.NewNotifier(cfg.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		memberships := collector.NewMembershipTracker()
+		var mu sync.Mutex
+		wires = append(wires, func(exp collection) {
+			exp.OnSnapshot(func(snapshot collector.Snapshot) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes := memberships.Diff(snapshot)
+				if len(changes) == 0 {
+					return
+				}
+				if err := n.Notify(nodeChangesPayload{changes}); err != nil {
+					log.Errorf("Could not notify the webhooks of the node changes: %v", err)
+				}
+			})
+		})
+	}
+	var run *runSummary
+	if cfg.Server.RunDuration > 0 {
+		run = newRunSummary(time.Now())
+		wires = append(wires, func(exp collection) {
+			exp.OnSnapshot(func(collector.Snapshot) {
+				if summary, ok := exp.LastScrape(); ok {
+					run.record(summary)
+				}
+			})
+		})
+	}
+	if cfg.Kubernetes.Enabled {
+		rec, err := kubernetes.NewEventRecorder(cfg.Kubernetes)
+		if err != nil {
+			return nil, err
+		}
+		wires = append(wires, func(exp collection) {
+			exp.OnTransitions(func(transitions []collector.Transition) {
+				for _, t := range transitions {
+					if err := rec.Record(transitionEvent(t)); err != nil {
+						log.Errorf("Could not create Kubernetes event: %v", err)
+					}
+				}
+			})
+		})
+	}
+	exp, err := newLiveExporter(cfg, reload, func(exp collection) {
+		for _, wire := range wires {
+			wire(exp)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// exp is gathered along with the default registry by scrapeGatherer
+	if reload != nil {
+		go exp.watchSignals()
+	}
+	if run != nil && cfg.Collector.CollectionInterval == 0 {
+		go collectOnce(exp)
+	}
+	// The delta shares the listing of the collected account with exp
+	scoped := []contextCollector{exp}
+	documented := []prometheus.Collector{exp}
+	if cfg.Compare.Enabled() {
+		delta := liveDelta{exp}
+		scoped = append(scoped, delta)
+		documented = append(documented, delta)
+	}
+	instanceID, err := loadInstanceID(cfg.InstanceIDFile)
+	if err != nil {
+		log.Warnf("Could not load the instance ID from %s, it won't survive restarts: %v", cfg.InstanceIDFile, err)
+		if instanceID, err = newInstanceID(); err != nil {
+			return nil, err
+		}
+	}
+	log.Infof("Exporter instance ID %s, shard %q", instanceID, cfg.Shard)
+	instanceInfo := newInstanceInfo(instanceID, cfg.Shard)
+	prometheus.MustRegister(instanceInfo)
+	peers := newPeerChecker(cfg)
+	prometheus.MustRegister(peers)
+	go peers.run(peerCheckInterval, nil)
+	exp.onReload = func(cfg config) { peers.setHash(cfg.hash()) }
+	schemaVersion := newSchemaVersion()
+	prometheus.MustRegister(schemaVersion)
+	credentials := credentialsCollector{exp.config}
+	prometheus.MustRegister(credentials)
+	documented = append(documented, instanceInfo, peers, schemaVersion, credentials)
+	// start httpServer, every route is served under the route prefix
+	prefix := cfg.routePrefix()
+	serverOpts := cfg.Server
+	serverOpts.ShutdownURL = prefix + serverOpts.ShutdownURL
+	serverOpts.LivenessProbeURL = prefix + serverOpts.LivenessProbeURL
+	serverOpts.ReadinessProbeURL = prefix + serverOpts.ReadinessProbeURL
 	s := common.NewServer("instaclustr_exporter", serverOpts)
+	s.HealthChecks = healthChecks(exp, common.SystemClock)
+	s.ReadinessChecks = readinessChecks(exp)
 	router := mux.NewRouter()
-	router.HandleFunc("/", homeHandler).Methods("GET")
+	router.HandleFunc(prefix+"/", homeHandler(cfg.externalPath()+cfg.TelemetryPath, cfg.externalPath()+metricDocsURL)).Methods("GET")
+	if prefix != "" {
+		router.Handle(prefix, http.RedirectHandler(cfg.externalPath()+"/", http.StatusFound)).Methods("GET")
+	}
 	router.HandleFunc(serverOpts.ShutdownURL, s.ShutDownHandler).Methods("GET")
 	router.HandleFunc(serverOpts.LivenessProbeURL, s.LivenessProbeHandler).Methods("GET")
-	router.Handle(telemetryPath, prometheus.Handler()).Methods("GET")
-	s.HTTPServer.Handler = router
-	return s
+	router.HandleFunc(serverOpts.ReadinessProbeURL, s.ReadinessProbeHandler).Methods("GET")
+	router.HandleFunc(prefix+addrURL, s.AddrHandler).Methods("GET")
+	cors := corsOrigins(cfg.CORSOrigins)
+	router.HandleFunc(prefix+configURL, cors.jsonEndpoint(configHandler(exp.config))).Methods("GET", "OPTIONS")
+	router.HandleFunc(prefix+reloadURL, exp.ReloadHandler).Methods("POST")
+	// Federations of federations aren't supported, snapshots are per origin
+	if len(cfg.Collector.FederationTargets) == 0 {
+		router.HandleFunc(prefix+collector.SnapshotPath, snapshots.Handler).Methods("GET")
+	}
+	router.HandleFunc(prefix+lastScrapeURL, lastScrapeHandler(exp)).Methods("GET")
+	router.HandleFunc(prefix+errorsURL, cors.jsonEndpoint(errorsHandler(exp))).Methods("GET", "OPTIONS")
+	router.HandleFunc(prefix+scrapeConfigURL, scrapeConfigHandler(cfg, s)).Methods("GET")
+	router.HandleFunc(prefix+configHashURL, cors.jsonEndpoint(peers.ConfigHashHandler)).Methods("GET", "OPTIONS")
+	router.HandleFunc(prefix+peersURL, cors.jsonEndpoint(peers.PeersHandler)).Methods("GET", "OPTIONS")
+	router.HandleFunc(prefix+schemaChangesURL, cors.jsonEndpoint(schemaChangesHandler)).Methods("GET", "OPTIONS")
+	router.HandleFunc(prefix+metricSetURL, cors.jsonEndpoint(metricSetHandler(exp, documented...))).Methods("GET", "OPTIONS")
+	router.Handle(prefix+cfg.TelemetryPath, metricsHandler(scoped...)).Methods("GET")
+	router.HandleFunc(prefix+metricDocsURL, metricDocsHandler(documented...)).Methods("GET")
+	s.HTTPServer.Handler = s.Track(router)
+	s.DrainStatus = func() string {
+		summary, ok := exp.LastScrape()
+		if !ok {
+			return "no collection finished"
+		}
+		return fmt.Sprintf("last collection at %s: %d clusters, %d nodes, %d errors",
+			summary.Start.Format(time.RFC3339), summary.Clusters, summary.Nodes, summary.Errors)
+	}
+	if run != nil {
+		s.ExitCode = func() int { return run.report(time.Now()) }
+	}
+	return s, nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inventory" {
+		if err := runInventory(os.Args[2:]); err != nil {
+			log.Fatalf("Could not write the inventory: %v", err)
+		}
+		return
+	}
+
 	var (
-		serverOpts     common.ServerOptions
-		instaclustrCfg instaclustr.Config
-		showVersion    = flag.Bool("version", false, "Print version information.")
-		telemetryPath  = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		cfg                 config
+		showVersion         = flag.Bool("version", false, "Print version information.")
+		configFile          = flag.String("config.file", "", "YAML configuration file overriding the flags, reloaded on SIGHUP and POST /-/reload")
+		parseErrorOverrides = flag.String("collector.parse-error-overrides", "", "Comma separated metric=mode pairs overriding collector.parse-error-mode per metric, e.g. cpuUtilization=omit")
+		keyRotationDue      = flag.String("instaclustr.key-rotation-due", "", "Comma separated key=YYYY-MM-DD dates the provisioning and monitoring API keys are due for rotation by, exported in instaclustr_credential_rotation_due_timestamp_seconds, e.g. provisioning=2027-01-31")
+		federationTargets   = flag.String("federation.targets", "", "Comma separated origin=URL pairs of the exporters to federate, collecting their snapshots instead of the InstaClustr API and exporting their metrics with an origin label, e.g. eu=http://exporter-eu:9279")
+		provisioningPolicy  = flag.String("instaclustr.provisioning-policy", "", "Comma separated key=value settings of the Provisioning API requests overriding the account ones: max-retries, retry-backoff, rate-limit and rate-burst (a rate limit of its own), and budget, the requests a collection may send. E.g. rate-limit=1,budget=50")
+		monitoringPolicy    = flag.String("instaclustr.monitoring-policy", "", "Comma separated key=value settings of the Monitoring API requests overriding the account ones, see instaclustr.provisioning-policy")
+		units               = flag.String("collector.units", "", "Comma separated family=unit pairs: latency=seconds|microseconds and utilization=percent|ratio|both, for dashboards expecting legacy units. Seconds and percent by default")
+		nodeStatusValues    = flag.String("collector.node-status-values", "", "Comma separated state=value pairs exported in cassandra_node_status for the node states, e.g. warn=0. Numeric states are named up (1) and down (0), unmapped states are exported as 1, up as 1 and down as 0")
+		sanitizeRules       = flag.String("collector.sanitize-rules", "", "Comma separated metric=mode[:min:max] rules overriding collector.sanitize-mode and the default bounds per metric, e.g. clientRequestRead=drop:0:60000000")
+		corsOrigins         = flag.String("web.cors-origins", "", "Comma separated browser origins allowed to read the JSON status endpoints, * for any. None by default")
+		peers               = flag.String("web.peers", "", "Comma separated base URLs of replicas whose configuration should match this one")
+		dcInclude           = flag.String("collector.dc-include", "", "Comma separated names or ids of the datacentres to collect, e.g. EU_WEST_1. All of them by default")
+		pinnedClusters      = flag.String("collector.pinned-clusters", "", "Comma separated IDs of the clusters to collect, without listing the clusters of the account. Every cluster by default")
+		pinnedNodes         = flag.String("collector.pinned-nodes", "", "Comma separated IDs of the nodes of collector.pinned-clusters to collect. All of them by default")
+		providerInclude     = flag.String("collector.provider-include", "", "Comma separated cloud providers whose datacentres are collected, e.g. AWS_VPC. All of them by default")
+		nodeMetrics         = flag.String("collector.node-metrics", "", "Comma separated n:: Monitoring API metrics to query in place of the ones of collector.profile, e.g. cpuUtilization,commitLogSize. The ones the exporter doesn't know are exported as cassandra_node_<metric in snake case>, unless the exporter already exports a metric under that name")
+		tableMetrics        = flag.String("collector.table-metrics", "", "Comma separated keyspace.table patterns of the Cassandra tables whose metrics are collected, either part may be *, e.g. shop.orders,metrics.*. Patterns with a * only match tables with managed repairs. None by default")
+		cmdbFields          = flag.String("cmdb.fields", "", "Comma separated cmdbField=inventoryField pairs of the records pushed to cmdb.url, e.g. u_name=nodeId,u_cluster=clusterName. Every inventory field under its own name by default")
+		webhookURLs         = flag.String("webhook.urls", "", "Comma separated URLs the nodes added to and removed from the clusters are POSTed to as {\"changes\": [...]} JSON after the collections finding them")
+		quietWindows        = flag.String("collector.quiet-windows", "", "Semicolon separated quiet windows the API isn't polled, each made of 5 cron fields and a duration, e.g. \"0 2 * * 0 4h\"")
 	)
 
-	flag.StringVar(&serverOpts.ListenAddress, "web.listen-address", ":9279", "Address to listen on for web interface and telemetry.")
-	flag.StringVar(&serverOpts.LivenessProbeURL, "web.liveness-probe-url", "/health", "URL for health-checks")
-	flag.StringVar(&serverOpts.ShutdownURL, "web.shutdown-url", "/shutdown", "URL for health-checks")
-	flag.DurationVar(&serverOpts.ReadTimeOut, "web.read-timeout", 10*time.Second, "Read/Write Timeout")
-	flag.DurationVar(&serverOpts.WriteTimeOut, "web.write-timeout", 10*time.Second, "Read/Write Timeout")
-	flag.StringVar(&instaclustrCfg.User, "instaclustr.user", "", "User for InstaClustr API")
-	flag.StringVar(&instaclustrCfg.ProvisioningAPIKey, "instaclustr.provisioning-apikey", "", "Key for the provisioning API")
-	flag.StringVar(&instaclustrCfg.MonitoringAPIKey, "instaclustr.monitoring-apikey", "", "Key for the provisioning API")
+	flag.StringVar(&cfg.TelemetryPath, "web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+	flag.StringVar(&cfg.Server.ListenAddress, "web.listen-address", ":9279", "Address to listen on for web interface and telemetry. Port 0 picks a free port, served at /status/addr.")
+	flag.StringVar(&cfg.Server.Network, "web.listen-network", "tcp", "Network to listen on: tcp, tcp4 (IPv4 only) or tcp6 (IPv6 only)")
+	flag.DurationVar(&cfg.Server.RunDuration, "run-duration", 0, "Shut down once running for this long, e.g. 5m for CI smoke tests, exiting 1 when there was no collection or every one failed. Runs until stopped if 0")
+	flag.BoolVar(&cfg.Server.ReusePort, "web.reuse-port", false, "Set SO_REUSEPORT on the listening socket, so several exporters can share the listen address")
+	flag.BoolVar(&cfg.Server.ShutdownAllowRemote, "web.shutdown-allow-remote", false, "Accept shutdown requests from any address, not only loopback ones")
+	flag.StringVar(&cfg.Server.TLSCertFile, "web.tls-cert-file", "", "PEM certificate to serve HTTPS with, along with web.tls-key-file. Plain HTTP is served without it")
+	flag.StringVar(&cfg.Server.TLSKeyFile, "web.tls-key-file", "", "PEM key of web.tls-cert-file")
+	flag.StringVar(&cfg.Server.TLSClientCAFile, "web.tls-client-ca-file", "", "PEM CA certificates client certificates must be signed by, requiring mutual TLS")
+	flag.BoolVar(&cfg.ReloadAllowRemote, "web.reload-allow-remote", false, "Accept reload requests from any address, not only loopback ones")
+	flag.BoolVar(&cfg.Server.ShutdownConfirm, "web.shutdown-confirm", false, "Require a second shutdown request passing the token returned by the first one")
+	flag.StringVar(&cfg.ExternalURL, "web.external-url", "", "URL the exporter is reachable at, e.g. through a reverse proxy. Its path prefixes the links and, unless web.route-prefix is set, the routes")
+	flag.StringVar(&cfg.RoutePrefix, "web.route-prefix", "", "Prefix of every route, e.g. /exporters/instaclustr. Defaults to the path of web.external-url")
+	flag.StringVar(&cfg.Server.LivenessProbeURL, "web.liveness-probe-url", "/health", "URL for health-checks")
+	flag.StringVar(&cfg.Server.ReadinessProbeURL, "web.readiness-probe-url", "/ready", "URL for readiness checks, which include the reachability of the InstaClustr API")
+	flag.StringVar(&cfg.Server.ShutdownURL, "web.shutdown-url", "/shutdown", "URL for health-checks")
+	flag.DurationVar(&cfg.Server.ReadTimeOut, "web.read-timeout", 10*time.Second, "Read/Write Timeout")
+	flag.DurationVar(&cfg.Server.WriteTimeOut, "web.write-timeout", 10*time.Second, "Read/Write Timeout")
+	flag.StringVar(&cfg.Instaclustr.User, "instaclustr.user", "", "User for InstaClustr API")
+	flag.StringVar(&cfg.Instaclustr.Alias, "instaclustr.alias", "", "Alias of the account, e.g. production, exported in the account label of every metric collected from it. No label if empty")
+	flag.StringVar(&cfg.Instaclustr.ProvisioningAPIKey, "instaclustr.provisioning-apikey", "", "Key for the provisioning API")
+	flag.StringVar(&cfg.Instaclustr.MonitoringAPIKey, "instaclustr.monitoring-apikey", "", "Key for the provisioning API")
+	flag.StringVar(&cfg.ProvisioningAPIKeyFile, "instaclustr.provisioning-apikey-file", "", "File holding the key for the provisioning API, e.g. a mounted Kubernetes or Docker secret. Takes precedence over instaclustr.provisioning-apikey")
+	flag.StringVar(&cfg.MonitoringAPIKeyFile, "instaclustr.monitoring-apikey-file", "", "File holding the key for the monitoring API, e.g. a mounted Kubernetes or Docker secret. Takes precedence over instaclustr.monitoring-apikey")
+	flag.StringVar(&cfg.Instaclustr.Proxy, "instaclustr.proxy-url", "", "URL of the HTTP(S) proxy the InstaClustr API is reached through, e.g. http://proxy.example.com:3128. The one of the HTTPS_PROXY and NO_PROXY environment variables by default")
+	flag.StringVar(&cfg.Instaclustr.CAFile, "instaclustr.ca-file", "", "PEM CA certificates trusted along with the system ones for the InstaClustr API, e.g. the CA of a TLS intercepting proxy")
+	flag.BoolVar(&cfg.Instaclustr.InsecureSkipVerify, "instaclustr.insecure-skip-verify", false, "Don't verify the certificate of the InstaClustr API. For testing only")
+	flag.IntVar(&cfg.Instaclustr.MaxIdleConnsPerHost, "instaclustr.max-idle-conns-per-host", 32, "Idle connections to each InstaClustr API host kept for reuse, shared by the Provisioning and Monitoring API clients. Keep it around collector.concurrency so concurrent node requests don't open new connections")
+	flag.DurationVar(&cfg.Instaclustr.IdleConnTimeout, "instaclustr.idle-conn-timeout", 90*time.Second, "How long idle connections to the InstaClustr API are kept for reuse")
+	flag.DurationVar(&cfg.Instaclustr.RequestTimeout, "instaclustr.request-timeout", 0, "Timeout of every InstaClustr API request attempt, response included, e.g. 30s. Attempts timing out before the response are retried. 0 bounds them by the scrape timeout only")
+	flag.StringVar(&cfg.Instaclustr.Network, "instaclustr.network", "tcp", "Network used to reach the InstaClustr API: tcp, tcp4 (IPv4 only) or tcp6 (IPv6 only)")
+	flag.Int64Var(&cfg.Instaclustr.MaxResponseSize, "instaclustr.max-response-size", 32<<20, "Maximum size in bytes of an InstaClustr API response, 0 for no limit")
+	flag.IntVar(&cfg.Instaclustr.MaxRetries, "instaclustr.max-retries", 2, "Times an InstaClustr API request failing without a response or with status 429, 500, 502, 503 or 504 is retried, 0 disables retries")
+	flag.Float64Var(&cfg.Instaclustr.RateLimit, "instaclustr.rate-limit", 0, "Requests per second sent to the InstaClustr account, Provisioning and Monitoring APIs together, 0 for no limit. Requests over it wait")
+	flag.IntVar(&cfg.Instaclustr.RateBurst, "instaclustr.rate-burst", 10, "Requests sent at once before instaclustr.rate-limit applies")
+	flag.Float64Var(&cfg.Instaclustr.FaultFailurePercent, "instaclustr.fault-failure-percent", 0, "Percentage of InstaClustr API requests answered 503 without being sent, to test alerting and retries in staging. Never set it in production")
+	flag.Float64Var(&cfg.Instaclustr.FaultDelayPercent, "instaclustr.fault-delay-percent", 0, "Percentage of InstaClustr API requests delayed by up to instaclustr.fault-delay, to test timeouts in staging. Never set it in production")
+	flag.DurationVar(&cfg.Instaclustr.FaultDelay, "instaclustr.fault-delay", time.Second, "Longest delay injected by instaclustr.fault-delay-percent")
+	flag.DurationVar(&cfg.Instaclustr.RetryBackoff, "instaclustr.retry-backoff", 500*time.Millisecond, "Delay before the first retry of an InstaClustr API request, doubled on every further retry up to 1m and jittered. Longer when the API answers with a Retry-After, requests asked to wait over 1m aren't retried")
+	flag.StringVar(&cfg.Instaclustr.MonitoringAPIVersion, "instaclustr.monitoring-api-version", "v1", "Monitoring API version: v1, or v2 for paginated responses, falling back to v1 when the API doesn't serve it")
+	flag.StringVar(&cfg.Instaclustr.MonitoringHeader, "instaclustr.monitoring-api-header", "", "Header sent with every Monitoring API request, e.g. \"Accept: application/vnd.instaclustr.v2+json\" to pin the API contract. Authorization is refused, the API keys authenticate the requests")
+	flag.StringVar(&cfg.Instaclustr.ProvisioningHeader, "instaclustr.provisioning-api-header", "", "Header sent with every Provisioning API request, e.g. \"Accept: application/vnd.instaclustr.v1+json\" to pin the API contract. Authorization is refused, the API keys authenticate the requests")
+	flag.StringVar(&cfg.Instaclustr.MonitoringPeriod, "instaclustr.monitoring-period", "", "Time range of the node metrics requested to the Monitoring API, e.g. 2m. Empty for the API default")
+	flag.Uint64Var(&cfg.Collector.MemoryLimit, "collector.memory-limit", 0, "Heap bytes a collection may peak at before node metrics are aggregated per cluster, 0 for no limit")
+	flag.DurationVar(&cfg.Collector.CollectionInterval, "collector.interval", 0, "Collect in the background every interval and serve the last collection on scrapes, 0 collects on every scrape")
+	flag.BoolVar(&cfg.Collector.TopologyLabels, "collector.topology-labels", false, "Add the datacentre and rack labels to the latency and throughput node metrics")
+	flag.BoolVar(&cfg.Collector.LegacyTopologyNames, "collector.legacy-topology-names", true, "Export the cluster and node info and health metrics under their former cassandra_ names too, along with the instaclustr_ ones")
+	flag.IntVar(&cfg.Collector.ClusterConcurrency, "collector.cluster-concurrency", 4, "Number of cluster topologies fetched from the Provisioning API at the same time")
+	flag.DurationVar(&cfg.Collector.Timeout, "collector.timeout", 0, "Longest a collection from the InstaClustr API may take, its requests in flight are cancelled after it. Scrapes are also bounded by the Prometheus scrape timeout. 0 for no limit")
+	flag.IntVar(&cfg.Collector.NodeConcurrency, "collector.concurrency", 10, "Number of nodes whose metrics are fetched from the Monitoring API at the same time")
+	flag.BoolVar(&cfg.Collector.AggregateNodes, "collector.aggregate-nodes", false, "Export min, avg, max and p95 of the node metrics across the nodes of every cluster instead of per node series")
+	flag.BoolVar(&cfg.Collector.DisableNodeMetrics, "collector.disable-node-metrics", false, "Don't call the Monitoring API, exporting the topology only. Implied when no Monitoring API key is configured")
+	flag.BoolVar(&cfg.Collector.SampleTimestamps, "collector.sample-timestamps", false, "Export the node metrics with the time the Monitoring API sampled them at instead of the scrape time")
+	flag.IntVar(&cfg.Collector.MaxLabelLength, "collector.max-label-length", 256, "Truncate the label values longer than this many characters. 0 doesn't")
+	flag.DurationVar(&cfg.Collector.SampleMaxAge, "collector.sample-max-age", 0, "Drop the node metric values the Monitoring API sampled longer ago than this, e.g. 10m. 0 keeps them all")
+	flag.DurationVar(&cfg.Collector.LatencyThreshold, "collector.latency-threshold", 0, "Export the latency metrics of a node only when any of them is at least this long, e.g. 50ms. 0 exports them all")
+	flag.BoolVar(&cfg.Collector.NodeStatus, "collector.node-status", false, "Query the nodeStatus Monitoring API metric, exported by state in cassandra_node_status")
+	flag.BoolVar(&cfg.Collector.MaintenanceCache, "collector.maintenance-cache", false, "Serve the metrics of the last collection while the InstaClustr API is in maintenance, instead of collections failing meanwhile")
+	flag.BoolVar(&cfg.Collector.KafkaConsumerLag, "collector.kafka-consumer-lag", false, "Collect the lag and consumers of the consumer groups of the Kafka clusters by topic, a Monitoring API request per consumer group and per topic of every group")
+	flag.BoolVar(&cfg.Collector.CadenceMetrics, "collector.cadence-metrics", false, "Query the Cadence metrics of the nodes of Cadence clusters, not part of the documented Monitoring API")
+	flag.BoolVar(&cfg.Collector.NodeOperations, "collector.node-operations", false, "Count node operations (reboots and replacements) from the Instaclustr events API, when exposed")
+	flag.DurationVar(&cfg.Collector.NotFoundTTL, "collector.not-found-ttl", 5*time.Minute, "How long nodes the Monitoring API didn't find are not queried again, 0 disables it")
+	flag.StringVar(&cfg.Collector.ParseErrorMode, "collector.parse-error-mode", collector.ParseErrorZero, "What to export when a metric value can't be parsed: zero, nan, omit or flag")
+	flag.StringVar(&cfg.Collector.SanitizeMode, "collector.sanitize-mode", collector.SanitizeKeep, "What to do with node metric values out of their bounds, e.g. negative latencies: keep, clamp or drop")
+	flag.StringVar(&cfg.Collector.Profile, "collector.profile", collector.ProfileStandard, fmt.Sprintf("Metric profile to export, one of %v", collector.Profiles()))
+	flag.BoolVar(&cfg.Collector.RepairStatus, "collector.repair-status", false, "Collect Instaclustr managed repairs status, when exposed by the API")
+	flag.StringVar(&cfg.Archive.Endpoint, "archive.endpoint", "", "S3 compatible object store URL to archive collection snapshots to, e.g. https://s3.eu-west-1.amazonaws.com or https://storage.googleapis.com")
+	flag.StringVar(&cfg.Archive.Bucket, "archive.bucket", "", "Bucket to archive collection snapshots to")
+	flag.StringVar(&cfg.Archive.Prefix, "archive.prefix", "instaclustr_exporter", "Object key prefix of the archived snapshots")
+	flag.StringVar(&cfg.Archive.Region, "archive.region", "us-east-1", "Region of the archive bucket")
+	flag.StringVar(&cfg.Archive.AccessKey, "archive.access-key", "", "Access key of the archive bucket (HMAC key for Google Cloud Storage)")
+	flag.StringVar(&cfg.Archive.SecretKey, "archive.secret-key", "", "Secret key of the archive bucket")
+	flag.DurationVar(&cfg.Archive.Retention, "archive.retention", 30*24*time.Hour, "How long archived snapshots are kept, 0 keeps them forever")
+	flag.StringVar(&cfg.CMDB.URL, "cmdb.url", "", "URL the node inventory is POSTed to as {\"records\": [...]} JSON after collections, e.g. a ServiceNow import set API")
+	flag.StringVar(&cfg.CMDB.Header, "cmdb.header", "", "Header sent with the CMDB pushes, e.g. \"Authorization: Basic ...\"")
+	flag.DurationVar(&cfg.CMDB.Interval, "cmdb.interval", time.Hour, "Least time between two CMDB pushes")
+	flag.StringVar(&cfg.Webhook.Header, "webhook.header", "", "Header sent with the webhook notifications, e.g. \"Authorization: Bearer ...\"")
+	flag.DurationVar(&cfg.Webhook.RetryBackoff, "webhook.retry-backoff", time.Second, "First wait before a failed webhook notification is sent again, doubling up to 5m")
+	flag.StringVar(&cfg.Webhook.CAFile, "webhook.ca-file", "", "PEM CA certificates trusted along with the system ones for the webhooks")
+	flag.StringVar(&cfg.InstanceIDFile, "instance.id-file", "instaclustr_exporter.id", "File persisting the ID of this exporter instance, generated on first start. An empty value generates a new ID on every start")
+	flag.StringVar(&cfg.Shard, "instance.shard", "", "Shard this exporter instance collects, exported in instaclustr_exporter_instance_info")
+	flag.StringVar(&cfg.Compare.Name, "compare.name", "primary", "Name of the collected account in the delta label of the account comparison metrics")
+	flag.StringVar(&cfg.Compare.OtherName, "compare.other-name", "secondary", "Name of the compared account in the delta label of the account comparison metrics")
+	flag.StringVar(&cfg.Compare.Other.User, "compare.user", "", "User of the InstaClustr account to compare clusters with, e.g. the new account of a migration")
+	flag.StringVar(&cfg.Compare.Other.ProvisioningAPIKey, "compare.provisioning-apikey", "", "Key for the provisioning API of the compared account")
+	flag.BoolVar(&cfg.Kubernetes.Enabled, "kubernetes.events", false, "Create Kubernetes events on cluster and node status transitions, using the Pod service account")
+	flag.StringVar(&cfg.Kubernetes.Object, "kubernetes.event-object", "", "kind/name of the object, in the exporter namespace, the Kubernetes events are attached to. The exporter Pod by default")
+	flag.StringVar(&cfg.Collector.ExtraLabelsFile, "collector.extra-labels-file", "", "YAML file mapping clusterIds and nodeIds to extra labels for the info metrics")
 
 	flag.Parse()
 
@@ -65,19 +347,110 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Make environment variables to take precedence over configuration flags
-	if os.Getenv("INSTACLUSTR_USER") != "" {
-		instaclustrCfg.User = os.Getenv("INSTACLUSTR_USER")
+	overrides, err := collector.ParseErrorOverrides(*parseErrorOverrides)
+	if err != nil {
+		log.Fatalf("Invalid collector.parse-error-overrides: %v", err)
+	}
+	cfg.Collector.ParseErrorOverrides = overrides
+
+	statusValues, err := collector.ParseNodeStatusValues(*nodeStatusValues)
+	if err != nil {
+		log.Fatalf("Invalid collector.node-status-values: %v", err)
+	}
+	cfg.Collector.NodeStatusValues = statusValues
+
+	targets, err := collector.ParseFederationTargets(*federationTargets)
+	if err != nil {
+		log.Fatalf("Invalid federation.targets: %v", err)
 	}
+	cfg.Collector.FederationTargets = targets
 
-	if os.Getenv("PROVISIONING_API_KEY") != "" {
-		instaclustrCfg.ProvisioningAPIKey = os.Getenv("PROVISIONING_API_KEY")
+	pairs, err := splitPairs(*keyRotationDue)
+	if err == nil {
+		cfg.KeyRotationDue, err = parseKeyRotationDue(pairs)
+	}
+	if err != nil {
+		log.Fatalf("Invalid instaclustr.key-rotation-due: %v", err)
+	}
+
+	cfg.Instaclustr.ProvisioningPolicy, err = instaclustr.ParseAPIPolicy(*provisioningPolicy)
+	if err != nil {
+		log.Fatalf("Invalid instaclustr.provisioning-policy: %v", err)
+	}
+	cfg.Instaclustr.MonitoringPolicy, err = instaclustr.ParseAPIPolicy(*monitoringPolicy)
+	if err != nil {
+		log.Fatalf("Invalid instaclustr.monitoring-policy: %v", err)
 	}
 
-	if os.Getenv("MONITORING_API_KEY") != "" {
-		instaclustrCfg.MonitoringAPIKey = os.Getenv("MONITORING_API_KEY")
+	cfg.Collector.Units, err = collector.ParseUnits(*units)
+	if err != nil {
+		log.Fatalf("Invalid collector.units: %v", err)
 	}
 
-	s := NewExporter(*telemetryPath, serverOpts, instaclustrCfg)
+	rules, err := collector.ParseSanitizeRules(*sanitizeRules)
+	if err != nil {
+		log.Fatalf("Invalid collector.sanitize-rules: %v", err)
+	}
+	cfg.Collector.SanitizeRules = rules
+
+	if *cmdbFields != "" {
+		if cfg.CMDB.Fields, err = cmdb.ParseFields(*cmdbFields); err != nil {
+			log.Fatalf("Invalid cmdb.fields: %v", err)
+		}
+	}
+
+	cfg.Webhook.URLs = webhook.ParseURLs(*webhookURLs)
+
+	if *peers != "" {
+		cfg.Peers = strings.Split(*peers, ",")
+	}
+
+	cfg.CORSOrigins = parseCORSOrigins(*corsOrigins)
+
+	if *dcInclude != "" {
+		cfg.Collector.DataCentreInclude = strings.Split(*dcInclude, ",")
+	}
+
+	if *pinnedClusters != "" {
+		cfg.Collector.PinnedClusters = strings.Split(*pinnedClusters, ",")
+	}
+
+	if *pinnedNodes != "" {
+		cfg.Collector.PinnedNodes = strings.Split(*pinnedNodes, ",")
+	}
+
+	if *nodeMetrics != "" {
+		cfg.Collector.NodeMetrics = strings.Split(*nodeMetrics, ",")
+	}
+
+	if *tableMetrics != "" {
+		cfg.Collector.TableMetrics = strings.Split(*tableMetrics, ",")
+	}
+
+	if *providerInclude != "" {
+		cfg.Collector.ProviderInclude = strings.Split(*providerInclude, ",")
+	}
+
+	if *quietWindows != "" {
+		cfg.Collector.QuietWindows = strings.Split(*quietWindows, ";")
+	}
+
+	flags := cfg
+	cfg, err = loadConfig(*configFile, flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var reload func() (config, error)
+	if *configFile != "" {
+		reload = func() (config, error) { return loadConfig(*configFile, flags) }
+	}
+
+	s, err := NewExporter(cfg, reload)
+	if err != nil {
+		log.Fatalf("Could not create exporter: %v", err)
+	}
 	s.Start()
+	if s.ExitCode != nil {
+		os.Exit(s.ExitCode())
+	}
 }
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
-	"strconv"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/fcgravalos/instaclustr_exporter/collector"
 	"github.com/fcgravalos/instaclustr_exporter/common"
 	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
 	"github.com/fcgravalos/instaclustr_exporter/mock"
-	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -21,15 +27,9 @@ var (
 )
 
 func setup(up chan bool) {
-	// Picking up random port for InstaClustr API mock server
-	mockServerPort := strconv.Itoa(common.PickRandomTCPPort())
-	mockServerListenAddress := fmt.Sprintf("127.0.0.1:%s", mockServerPort)
-
-	exporterServerPort := strconv.Itoa(common.PickRandomTCPPort())
-	exporterServerListenAddress := fmt.Sprintf("127.0.0.1:%s", exporterServerPort)
-
+	// Both servers listen on any free port
 	msOpts := common.ServerOptions{
-		ListenAddress:    mockServerListenAddress,
+		ListenAddress:    "127.0.0.1:0",
 		LivenessProbeURL: "/health",
 		ShutdownURL:      "/shutdown",
 		ReadTimeOut:      10 * time.Second,
@@ -37,21 +37,38 @@ func setup(up chan bool) {
 	}
 
 	sOpts := common.ServerOptions{
-		ListenAddress:    exporterServerListenAddress, //InstaClustr Exporter Server,
+		ListenAddress:    "127.0.0.1:0", //InstaClustr Exporter Server,
 		LivenessProbeURL: "/health",
 		ShutdownURL:      "/shutdown",
 		ReadTimeOut:      10 * time.Second,
 		WriteTimeOut:     10 * time.Second,
 	}
 
+	mockServer = mock.NewMockServer(msOpts)
+	if err := mockServer.Listen(); err != nil {
+		log.Fatalf("Could not start mock server: %v", err)
+	}
+
 	icOpts := instaclustr.Config{
-		Url:                fmt.Sprintf("http://"+"%s", mockServerListenAddress), //InstaClustr API Mock Server
+		Url:                fmt.Sprintf("http://"+"%s", mockServer.Addr()), //InstaClustr API Mock Server
 		User:               "test",
 		ProvisioningAPIKey: "test",
 		MonitoringAPIKey:   "test",
 	}
-	exporterServer = NewExporter("/metrics", sOpts, icOpts)
-	mockServer = mock.NewMockServer(msOpts)
+	var err error
+	exporterServer, err = NewExporter(config{
+		TelemetryPath: "/metrics",
+		Server:        sOpts,
+		Instaclustr:   icOpts,
+		// As by default, see collector.legacy-topology-names
+		Collector: collector.ExporterOptions{LegacyTopologyNames: true},
+	}, nil)
+	if err != nil {
+		log.Fatalf("Could not create exporter: %v", err)
+	}
+	if err := exporterServer.Listen(); err != nil {
+		log.Fatalf("Could not start exporter: %v", err)
+	}
 
 	go func() {
 		exporterServer.Start()
@@ -79,7 +96,7 @@ func TestHomeHandler(t *testing.T) {
 
 	// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 	rr := httptest.NewRecorder()
-	handler := http.HandlerFunc(homeHandler)
+	handler := homeHandler("/metrics", "/docs/metrics")
 
 	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
 	// directly and pass in our Request and ResponseRecorder.
@@ -96,6 +113,7 @@ func TestHomeHandler(t *testing.T) {
 					<body>
 					<h1>InstaClustr Exporter</h1>
 					<p><a href="/metrics">Metrics</a></p>
+					<p><a href="/docs/metrics">Metrics documentation</a></p>
 					</body>
 					</html>`
 	if rr.Body.String() != expected {
@@ -140,7 +158,7 @@ func TestMetricsHandler(t *testing.T) {
 
 	// We create a ResponseRecorder (which satisfies http.ResponseWriter) to record the response.
 	rr := httptest.NewRecorder()
-	handler := prometheus.Handler()
+	handler := exporterServer.HTTPServer.Handler
 
 	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
 	// directly and pass in our Request and ResponseRecorder.
@@ -161,19 +179,34 @@ cassandra_cluster_nodes{clusterId="cluster-uuid-1"} 1
 # HELP cassandra_cluster_nodes_running Number of nodes running in the cluster
 # TYPE cassandra_cluster_nodes_running gauge
 cassandra_cluster_nodes_running{clusterId="cluster-uuid-1"} 1
+# HELP cassandra_cluster_nodes_running_ratio Ratio of the nodes of the cluster running, from 0 to 1. Not exported for clusters without nodes.
+# TYPE cassandra_cluster_nodes_running_ratio gauge
+cassandra_cluster_nodes_running_ratio{clusterId="cluster-uuid-1"} 1
 # HELP cassandra_cluster_running Whether or not the cassandra cluster is running.
 # TYPE cassandra_cluster_running gauge
 cassandra_cluster_running{clusterId="cluster-uuid-1"} 1
-# HELP cassandra_node_client_request_read_latency Average latency (s/1) per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+# HELP cassandra_cluster_scrape_success Whether the topology of the cluster was fetched by the last collection, the other clusters are collected either way.
+# TYPE cassandra_cluster_scrape_success gauge
+cassandra_cluster_scrape_success{clusterId="cluster-uuid-1"} 1
+# HELP cassandra_datacentre_info A mapping between the dcId and its name, cloud provider and cluster.
+# TYPE cassandra_datacentre_info gauge
+cassandra_datacentre_info{clusterId="cluster-uuid-1",dcId="datacentre-uuid-1",dcName="MOCKED_DATACENTRE_01",provider="AWS_VPC"} 1
+# HELP cassandra_datacentre_nodes Number of nodes the datacentre is composed of.
+# TYPE cassandra_datacentre_nodes gauge
+cassandra_datacentre_nodes{clusterId="cluster-uuid-1",dcId="datacentre-uuid-1"} 1
+# HELP cassandra_datacentre_rack_loss_tolerant Whether losing any single rack of the datacentre keeps a QUORUM of the replicas of every token range. Only exported when the API returns the replication factor.
+# TYPE cassandra_datacentre_rack_loss_tolerant gauge
+cassandra_datacentre_rack_loss_tolerant{clusterId="cluster-uuid-1",dcId="datacentre-uuid-1"} 0
+# HELP cassandra_node_client_request_read_latency Average latency in seconds per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
 # TYPE cassandra_node_client_request_read_latency gauge
 cassandra_node_client_request_read_latency{nodeId="node-uuid-1"} 0.0014625666666666663
-# HELP cassandra_node_client_request_read_percentile95 95th percentile (s) distribution per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+# HELP cassandra_node_client_request_read_percentile95 95th percentile distribution in seconds per client read request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
 # TYPE cassandra_node_client_request_read_percentile95 gauge
 cassandra_node_client_request_read_percentile95{nodeId="node-uuid-1"} 0.0018661645999999998
-# HELP cassandra_node_client_request_write_latency Average latency (s/1) per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+# HELP cassandra_node_client_request_write_latency Average latency in seconds per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
 # TYPE cassandra_node_client_request_write_latency gauge
 cassandra_node_client_request_write_latency{nodeId="node-uuid-1"} 0.0012935333333333335
-# HELP cassandra_node_client_request_write_percentile95 95th percentile (s) distribution per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
+# HELP cassandra_node_client_request_write_percentile95 95th percentile distribution in seconds per client write request (i.e. the period from when a node receives a client request, gathers the records and response to the client).
 # TYPE cassandra_node_client_request_write_percentile95 gauge
 cassandra_node_client_request_write_percentile95{nodeId="node-uuid-1"} 0.0016696252999999998
 # HELP cassandra_node_compactions Number of pending compactions.
@@ -185,12 +218,21 @@ cassandra_node_cpu_utilization_percentage{nodeId="node-uuid-1"} 2.5884383
 # HELP cassandra_node_disk_utilization_percentage Total disk space utilisation, by Cassandra, as a percentage of total available.
 # TYPE cassandra_node_disk_utilization_percentage gauge
 cassandra_node_disk_utilization_percentage{nodeId="node-uuid-1"} 7.6197357
-# HELP cassandra_node_info A mapping between nodeId with its IPs, racks and cluster
+# HELP cassandra_node_info A mapping between nodeId with its IPs, rack, size, cloud provider and region, and cluster
 # TYPE cassandra_node_info counter
-cassandra_node_info{clusterId="cluster-uuid-1",clusterName="MOCKED_CLUSTER_01",nodeId="node-uuid-1",nodePrivateIp="e.f.g.h",nodePublicIp="a.b.c.d",rack="MOCKED_RACK_01"} 1
+cassandra_node_info{clusterId="cluster-uuid-1",clusterName="MOCKED_CLUSTER_01",nodeId="node-uuid-1",nodePrivateIp="e.f.g.h",nodePublicIp="a.b.c.d",provider="AWS_VPC",rack="MOCKED_RACK_01",region="US_EAST_1",size="size"} 1
+# HELP cassandra_node_last_sample_timestamp_seconds Unix time of the most recent metric value returned by the Monitoring API for the node.
+# TYPE cassandra_node_last_sample_timestamp_seconds gauge
+cassandra_node_last_sample_timestamp_seconds{nodeId="node-uuid-1"} 1.499074624e+09
+# HELP cassandra_node_monitoring_missing Whether the node, listed by the Provisioning API, has no data in the Monitoring API: not found or without any value, e.g. its agent isn't registered yet. Not exported while its metrics couldn't be fetched.
+# TYPE cassandra_node_monitoring_missing gauge
+cassandra_node_monitoring_missing{nodeId="node-uuid-1"} 0
 # HELP cassandra_node_reads_per_second Reads per second by Cassandra.
 # TYPE cassandra_node_reads_per_second gauge
 cassandra_node_reads_per_second{nodeId="node-uuid-1"} 1.25
+# HELP cassandra_node_reads_total Reads by Cassandra, accumulated from the reads per second rate.
+# TYPE cassandra_node_reads_total counter
+cassandra_node_reads_total{nodeId="node-uuid-1"} 0
 # HELP cassandra_node_repairs_active Number of pending repair tasks.
 # TYPE cassandra_node_repairs_active gauge
 cassandra_node_repairs_active{nodeId="node-uuid-1"} 0
@@ -200,9 +242,15 @@ cassandra_node_repairs_pending{nodeId="node-uuid-1"} 0
 # HELP cassandra_node_running Whether or not a single node is running
 # TYPE cassandra_node_running gauge
 cassandra_node_running{nodeId="node-uuid-1"} 1
+# HELP cassandra_node_scrape_success Whether the metrics of the node were fetched from the Monitoring API by the last collection, once retried if need be. Not exported for the nodes not queried, e.g. recently not found.
+# TYPE cassandra_node_scrape_success gauge
+cassandra_node_scrape_success{nodeId="node-uuid-1"} 1
 # HELP cassandra_node_writes_per_second Writes per second by Cassandra.
 # TYPE cassandra_node_writes_per_second gauge
-cassandra_node_writes_per_second{nodeId="node-uuid-1"} 1.25`
+cassandra_node_writes_per_second{nodeId="node-uuid-1"} 1.25
+# HELP cassandra_node_writes_total Writes by Cassandra, accumulated from the writes per second rate.
+# TYPE cassandra_node_writes_total counter
+cassandra_node_writes_total{nodeId="node-uuid-1"} 0`
 
 	if !strings.Contains(rr.Body.String(), expected) {
 		t.Errorf("handler returned unexpected body: got %v want %v",
@@ -210,6 +258,217 @@ cassandra_node_writes_per_second{nodeId="node-uuid-1"} 1.25`
 	}
 }
 
+func TestMetricsHandlerClusterFilter(t *testing.T) {
+	cases := []struct {
+		query   string
+		matched bool
+	}{
+		{"clusterId=cluster-uuid-1", true},
+		{"clusterId=other-cluster", false},
+		{"clusterName=MOCKED_CLUSTER_.*", true},
+		{"clusterName=MOCKED", false},
+		{"clusterId=cluster-uuid-1&clusterName=other", false},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		exporterServer.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics?"+c.query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", c.query, rr.Code)
+		}
+		body := rr.Body.String()
+		for _, series := range []string{
+			`cassandra_cluster_running{clusterId="cluster-uuid-1"} 1`,
+			`instaclustr_cluster_running{clusterId="cluster-uuid-1"} 1`,
+			`cassandra_node_cpu_utilization_percentage{nodeId="node-uuid-1"}`,
+		} {
+			if strings.Contains(body, series) != c.matched {
+				t.Errorf("%s: %s exported: %v, want %v", c.query, series, !c.matched, c.matched)
+			}
+		}
+		// Metrics unrelated to clusters are always served
+		if !strings.Contains(body, "instaclustr_exporter_config_info") {
+			t.Errorf("%s: exporter metrics filtered out", c.query)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	exporterServer.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics?clusterName=(", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid clusterName: got status %d want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestRoutePrefix(t *testing.T) {
+	cases := []struct {
+		externalURL  string
+		routePrefix  string
+		prefix       string
+		externalPath string
+	}{
+		{"", "", "", ""},
+		{"", "/exporters/instaclustr/", "/exporters/instaclustr", "/exporters/instaclustr"},
+		{"https://example.com/exporters/instaclustr", "", "/exporters/instaclustr", "/exporters/instaclustr"},
+		{"https://example.com/exporters/instaclustr/", "/", "", "/exporters/instaclustr"},
+		{"https://example.com", "", "", ""},
+	}
+	for _, c := range cases {
+		cfg := config{ExternalURL: c.externalURL, RoutePrefix: c.routePrefix}
+		if got := cfg.routePrefix(); got != c.prefix {
+			t.Errorf("%q, %q: got route prefix %q want %q", c.externalURL, c.routePrefix, got, c.prefix)
+		}
+		if got := cfg.externalPath(); got != c.externalPath {
+			t.Errorf("%q, %q: got external path %q want %q", c.externalURL, c.routePrefix, got, c.externalPath)
+		}
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	cfg := config{TelemetryPath: "/metrics"}
+	cfg.Instaclustr.MonitoringAPIKey = "key-1"
+	peer := cfg
+	peer.Instaclustr.MonitoringAPIKey = "key-2"
+	peer.Peers = []string{"http://replica-2:9279"}
+	if cfg.hash() != peer.hash() {
+		t.Errorf("Configurations differing only in secrets and peers should have the same hash")
+	}
+	peer.TelemetryPath = "/other-metrics"
+	if cfg.hash() == peer.hash() {
+		t.Errorf("Different configurations should have different hashes")
+	}
+}
+
+func TestErrorsHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	exporterServer.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", errorsURL, nil))
+	errors := []collector.CollectionError{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &errors); err != nil {
+		t.Fatalf("Could not decode %s: %v", rr.Body.String(), err)
+	}
+	if rr.Header().Get("Content-Type") != jsonContentType || len(errors) != 0 {
+		t.Errorf("Got %s %s, want no errors", rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	cfg := config{TelemetryPath: "/metrics"}
+	cfg.Instaclustr.User = "user"
+	cfg.Instaclustr.ProvisioningAPIKey = "provisioning-key"
+	cfg.Archive.SecretKey = "archive-secret"
+	cfg.Instaclustr.ProvisioningHeader = "X-Gateway-Token: provisioning-token"
+	cfg.Instaclustr.MonitoringHeader = "X-Gateway-Token: monitoring-token"
+	cfg.Compare.Other.MonitoringHeader = cfg.Instaclustr.MonitoringHeader
+	rr := httptest.NewRecorder()
+	configHandler(func() config { return cfg }).ServeHTTP(rr, httptest.NewRequest("GET", configURL, nil))
+
+	got := config{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("Could not decode %s: %v", rr.Body.String(), err)
+	}
+	if got.Instaclustr.User != "user" || got.TelemetryPath != "/metrics" {
+		t.Errorf("Configuration not served: %s", rr.Body.String())
+	}
+	for _, secret := range []string{"provisioning-key", "archive-secret", "provisioning-token", "monitoring-token"} {
+		if strings.Contains(rr.Body.String(), secret) {
+			t.Errorf("Secret %q not redacted: %s", secret, rr.Body.String())
+		}
+	}
+}
+
+func TestLastScrapeHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	lastScrapeHandler(fakeHealthSource{}).ServeHTTP(rr, httptest.NewRequest("GET", lastScrapeURL, nil))
+	if rr.Body.String() != "No scrape has finished yet.\n" {
+		t.Errorf("Got %q before any scrape", rr.Body.String())
+	}
+
+	summary := collector.ScrapeSummary{
+		Start:    time.Date(2017, 7, 3, 9, 37, 4, 0, time.UTC),
+		Duration: 1500 * time.Millisecond,
+		Clusters: 2,
+		Nodes:    6,
+		APICalls: 9,
+		Errors:   1,
+		Series:   120,
+	}
+	rr = httptest.NewRecorder()
+	lastScrapeHandler(fakeHealthSource{summary: &summary}).ServeHTTP(rr, httptest.NewRequest("GET", lastScrapeURL, nil))
+	expected := `Last scrape started at 2017-07-03T09:37:04Z
+
+Duration:         1.5s
+Clusters scanned: 2
+Nodes scanned:    6
+API calls:        9
+Errors:           1
+Series emitted:   120
+`
+	if rr.Body.String() != expected {
+		t.Errorf("Got %q, want %q", rr.Body.String(), expected)
+	}
+}
+
+func TestScrapeConfigHandler(t *testing.T) {
+	cfg := config{TelemetryPath: "/metrics", Peers: []string{"http://replica-2:9279"}}
+	cfg.Server.WriteTimeOut = 10 * time.Second
+	scrape := func(host string) (scrapeConfig, string) {
+		req := httptest.NewRequest("GET", scrapeConfigURL, nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		scrapeConfigHandler(cfg, exporterServer).ServeHTTP(rr, req)
+		var f scrapeConfigFile
+		if err := yaml.UnmarshalStrict(rr.Body.Bytes(), &f); err != nil || len(f.ScrapeConfigs) != 1 {
+			t.Fatalf("Invalid scrape config (%v):\n%s", err, rr.Body.String())
+		}
+		return f.ScrapeConfigs[0], rr.Body.String()
+	}
+
+	got, body := scrape("exporter:9279")
+	expected := scrapeConfig{
+		JobName:        "instaclustr",
+		MetricsPath:    "/metrics",
+		ScrapeInterval: "60s",
+		ScrapeTimeout:  "10s",
+		StaticConfigs:  []staticConfig{{Targets: []string{"exporter:9279"}, Labels: map[string]string{"profile": "standard"}}},
+		RelabelConfigs: []relabelConfig{{TargetLabel: "instance", Replacement: "instaclustr"}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got scrape config %+v, want %+v", got, expected)
+	}
+	if !strings.Contains(body, "#     metric_relabel_configs:\n") {
+		t.Errorf("Scrape config without relabeling examples:\n%s", body)
+	}
+
+	// The Host header is a value, whatever it contains
+	host := "exporter:9279']\n        labels: {team: evil}\n#"
+	if got, _ := scrape(host); !reflect.DeepEqual(got.StaticConfigs[0].Targets, []string{host}) || len(got.StaticConfigs[0].Labels) != 1 {
+		t.Errorf("Host %q injected %+v", host, got.StaticConfigs)
+	}
+
+	cfg.Server.TLSCertFile = "exporter.pem"
+	if got, body := scrape("exporter:9279"); got.Scheme != "https" || !strings.Contains(body, "tls_config") {
+		t.Errorf("Scrape config not over HTTPS with TLS:\n%s", body)
+	}
+}
+
+func TestLoadInstanceID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "instaclustr_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "instaclustr_exporter.id")
+
+	id, err := loadInstanceID(path)
+	if err != nil || len(id) != 32 {
+		t.Fatalf("Expected a new 32 characters ID, got %q (%v)", id, err)
+	}
+	if again, err := loadInstanceID(path); err != nil || again != id {
+		t.Errorf("Expected the persisted ID %q, got %q (%v)", id, again, err)
+	}
+	if ephemeral, err := loadInstanceID(""); err != nil || ephemeral == id {
+		t.Errorf("Expected a new ID without file, got %q (%v)", ephemeral, err)
+	}
+}
+
 func TestMain(m *testing.M) {
 	up := make(chan bool)
 	setup(up)
@@ -217,3 +476,46 @@ func TestMain(m *testing.M) {
 	m.Run()
 	tearDown()
 }
+
+func TestValidateAPIHeaders(t *testing.T) {
+	cases := []struct {
+		header string
+		valid  bool
+	}{
+		{"", true},
+		{"Accept: application/vnd.instaclustr.v2+json", true},
+		{"Accept", false},
+		{"authorization: Basic dXNlcjprZXk=", false},
+	}
+	for _, c := range cases {
+		cfg := config{}
+		cfg.Instaclustr.MonitoringAPIVersion = "v1"
+		cfg.Server.Network, cfg.Instaclustr.Network = "tcp", "tcp"
+		cfg.Instaclustr.MonitoringHeader = c.header
+		if err := cfg.validate(); (err == nil) != c.valid {
+			t.Errorf("%q: got %v, want valid %v", c.header, err, c.valid)
+		}
+	}
+}
+
+func TestValidateNetwork(t *testing.T) {
+	cases := []struct {
+		server, api string
+		valid       bool
+	}{
+		{"tcp", "tcp", true},
+		{"tcp6", "tcp6", true},
+		{"tcp4", "tcp6", true},
+		{"udp", "tcp", false},
+		{"tcp", "ipv6", false},
+		{"", "tcp", false},
+	}
+	for _, c := range cases {
+		cfg := config{}
+		cfg.Instaclustr.MonitoringAPIVersion = "v1"
+		cfg.Server.Network, cfg.Instaclustr.Network = c.server, c.api
+		if err := cfg.validate(); (err == nil) != c.valid {
+			t.Errorf("%q and %q: got %v, want valid %v", c.server, c.api, err, c.valid)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+)
+
+// runInventory implements the inventory subcommand, writing the clusters and
+// nodes of the account for capacity reports. The API is reached with the
+// settings of the exporter, read from the same flags, configuration file and
+// environment variables.
+func runInventory(args []string) (err error) {
+	var cfg config
+	cfg.Server.Network = "tcp"
+	cfg.Instaclustr.MonitoringAPIVersion = "v1"
+	fs := flag.NewFlagSet("inventory", flag.ExitOnError)
+	format := fs.String("format", collector.InventoryCSV, "Output format: csv or parquet")
+	output := fs.String("output", "-", "File to write the inventory to, - for the standard output")
+	configFile := fs.String("config.file", "", "YAML configuration file of the exporter, overriding the flags")
+	fs.StringVar(&cfg.Instaclustr.User, "instaclustr.user", "", "User for InstaClustr API")
+	fs.StringVar(&cfg.Instaclustr.ProvisioningAPIKey, "instaclustr.provisioning-apikey", "", "Key for the provisioning API")
+	fs.StringVar(&cfg.ProvisioningAPIKeyFile, "instaclustr.provisioning-apikey-file", "", "File holding the key for the provisioning API, e.g. a mounted Kubernetes or Docker secret. Takes precedence over instaclustr.provisioning-apikey")
+	fs.StringVar(&cfg.Instaclustr.Proxy, "instaclustr.proxy-url", "", "URL of the HTTP(S) proxy the InstaClustr API is reached through, e.g. http://proxy.example.com:3128. The one of the HTTPS_PROXY and NO_PROXY environment variables by default")
+	fs.StringVar(&cfg.Instaclustr.CAFile, "instaclustr.ca-file", "", "PEM CA certificates trusted along with the system ones for the InstaClustr API, e.g. the CA of a TLS intercepting proxy")
+	fs.BoolVar(&cfg.Instaclustr.InsecureSkipVerify, "instaclustr.insecure-skip-verify", false, "Don't verify the certificate of the InstaClustr API. For testing only")
+	fs.StringVar(&cfg.Instaclustr.ProvisioningHeader, "instaclustr.provisioning-api-header", "", "Header sent with every Provisioning API request, e.g. \"Accept: application/vnd.instaclustr.v1+json\" to pin the API contract. Authorization is refused, the API keys authenticate the requests")
+	fs.DurationVar(&cfg.Instaclustr.RequestTimeout, "instaclustr.request-timeout", 0, "Timeout of every InstaClustr API request attempt, response included, e.g. 30s")
+	fs.IntVar(&cfg.Instaclustr.MaxRetries, "instaclustr.max-retries", 2, "Times an InstaClustr API request failing without a response or with status 429, 500, 502, 503 or 504 is retried, 0 disables retries")
+	fs.DurationVar(&cfg.Instaclustr.RetryBackoff, "instaclustr.retry-backoff", 500*time.Millisecond, "Delay before the first retry of an InstaClustr API request, doubled on every further retry up to 1m and jittered. Longer when the API answers with a Retry-After, requests asked to wait over 1m aren't retried")
+	fs.StringVar(&cfg.Instaclustr.Network, "instaclustr.network", "tcp", "Network used to reach the InstaClustr API: tcp, tcp4 (IPv4 only) or tcp6 (IPv6 only)")
+	fs.Int64Var(&cfg.Instaclustr.MaxResponseSize, "instaclustr.max-response-size", 32<<20, "Maximum size in bytes of an InstaClustr API response, 0 for no limit")
+	fs.Parse(args)
+
+	if err := collector.ValidInventoryFormat(*format); err != nil {
+		return err
+	}
+	cfg, err = loadConfig(*configFile, cfg)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		// A failed close may lose what was written
+		defer func() {
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = f
+	}
+	return collector.WriteInventory(cfg.Instaclustr, *format, w)
+}
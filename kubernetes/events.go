@@ -0,0 +1,193 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	component         = "instaclustr-exporter"
+)
+
+// Event types
+const (
+	EventTypeNormal  = "Normal"
+	EventTypeWarning = "Warning"
+)
+
+// Config defines the Kubernetes events options
+type Config struct {
+	Enabled bool
+	// Object the events are attached to, as kind/name in the exporter
+	// namespace. The exporter Pod, named after POD_NAME or the hostname, by default.
+	Object string
+}
+
+// Event is what happened, the recorder fills in the rest of the Kubernetes Event
+type Event struct {
+	Type    string
+	Reason  string
+	Message string
+}
+
+type objectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+}
+
+type eventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host,omitempty"`
+}
+
+type objectMeta struct {
+	GenerateName string `json:"generateName"`
+	Namespace    string `json:"namespace"`
+}
+
+// event is the core/v1 Event resource
+type event struct {
+	Metadata       objectMeta      `json:"metadata"`
+	InvolvedObject objectReference `json:"involvedObject"`
+	Reason         string          `json:"reason"`
+	Message        string          `json:"message"`
+	Type           string          `json:"type"`
+	Source         eventSource     `json:"source"`
+	FirstTimestamp string          `json:"firstTimestamp"`
+	LastTimestamp  string          `json:"lastTimestamp"`
+	Count          int             `json:"count"`
+}
+
+// EventRecorder creates Kubernetes Events through the API server
+type EventRecorder struct {
+	url string
+	// tokenFile holds the service account token, read for every request:
+	// projected tokens are rotated, expiring within the hour
+	tokenFile string
+	client    *http.Client
+	object    objectReference
+	host      string
+	clock     common.Clock
+}
+
+// NewEventRecorder creates an EventRecorder with the in-cluster configuration:
+// the API server from the environment and the Pod service account credentials
+func NewEventRecorder(cfg Config) (*EventRecorder, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in Kubernetes, KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set")
+	}
+	tokenFile := filepath.Join(serviceAccountDir, "token")
+	if _, err := readToken(tokenFile); err != nil {
+		return nil, err
+	}
+	namespace, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("could not parse the service account CA certificate")
+	}
+
+	hostname, _ := os.Hostname()
+	object, err := parseObject(cfg.Object, strings.TrimSpace(string(namespace)), hostname)
+	if err != nil {
+		return nil, err
+	}
+	return &EventRecorder{
+		url:       "https://" + net.JoinHostPort(host, port),
+		tokenFile: tokenFile,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		object: object,
+		host:   hostname,
+		clock:  common.SystemClock,
+	}, nil
+}
+
+// readToken reads the service account token at path
+func readToken(path string) (string, error) {
+	token, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// parseObject parses a kind/name reference, an empty one is the exporter Pod
+func parseObject(s, namespace, hostname string) (objectReference, error) {
+	if s == "" {
+		name := os.Getenv("POD_NAME")
+		if name == "" {
+			name = hostname
+		}
+		return objectReference{APIVersion: "v1", Kind: "Pod", Name: name, Namespace: namespace}, nil
+	}
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return objectReference{}, fmt.Errorf("invalid object %q, expected kind/name", s)
+	}
+	return objectReference{Kind: parts[0], Name: parts[1], Namespace: namespace}, nil
+}
+
+// Record creates a Kubernetes Event for e on the configured object
+func (r *EventRecorder) Record(e Event) error {
+	now := r.clock.Now().UTC().Format(time.RFC3339)
+	data, err := json.Marshal(event{
+		Metadata:       objectMeta{GenerateName: r.object.Name + ".", Namespace: r.object.Namespace},
+		InvolvedObject: r.object,
+		Reason:         e.Reason,
+		Message:        e.Message,
+		Type:           e.Type,
+		Source:         eventSource{Component: component, Host: r.host},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	})
+	if err != nil {
+		return err
+	}
+	token, err := readToken(r.tokenFile)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/namespaces/%s/events", r.url, r.object.Namespace), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("creating event: unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
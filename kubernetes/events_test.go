@@ -0,0 +1,122 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/common"
+)
+
+// tokenFile writes token to a file of dir, returning its path
+func tokenFile(t *testing.T, dir, token string) string {
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serviceaccount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var got event
+	auth := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/namespaces/monitoring/events" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		auth <- r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	object, err := parseObject("Deployment/instaclustr-exporter", "monitoring", "host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &EventRecorder{
+		url:       server.URL,
+		tokenFile: tokenFile(t, dir, "token"),
+		client:    &http.Client{},
+		object:    object,
+		host:      "host",
+		clock:     common.NewFakeClock(time.Date(2017, 7, 3, 9, 37, 4, 0, time.UTC)),
+	}
+	if err := r.Record(Event{Type: EventTypeWarning, Reason: "ClusterDown", Message: "down"}); err != nil {
+		t.Fatalf("Record returned unexpected error: %v", err)
+	}
+	if a := <-auth; a != "Bearer token" {
+		t.Errorf("Unexpected Authorization header %q", a)
+	}
+
+	expected := event{
+		Metadata:       objectMeta{GenerateName: "instaclustr-exporter.", Namespace: "monitoring"},
+		InvolvedObject: objectReference{Kind: "Deployment", Name: "instaclustr-exporter", Namespace: "monitoring"},
+		Reason:         "ClusterDown",
+		Message:        "down",
+		Type:           EventTypeWarning,
+		Source:         eventSource{Component: component, Host: "host"},
+		FirstTimestamp: "2017-07-03T09:37:04Z",
+		LastTimestamp:  "2017-07-03T09:37:04Z",
+		Count:          1,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected event:\n- Got:\n%+v\n- Expected:\n%+v", got, expected)
+	}
+}
+
+func TestRecordRotatedToken(t *testing.T) {
+	dir, err := ioutil.TempDir("", "serviceaccount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	r := &EventRecorder{url: server.URL, tokenFile: tokenFile(t, dir, "first"), client: &http.Client{}, clock: common.SystemClock}
+	for _, token := range []string{"first", "rotated"} {
+		tokenFile(t, dir, token)
+		if err := r.Record(Event{Type: EventTypeNormal, Reason: "ClusterUp"}); err != nil {
+			t.Fatal(err)
+		}
+		if a := <-auth; a != "Bearer "+token {
+			t.Errorf("Got Authorization header %q, want the %s token", a, token)
+		}
+	}
+
+	os.Remove(r.tokenFile)
+	if err := r.Record(Event{Type: EventTypeNormal, Reason: "ClusterUp"}); err == nil {
+		t.Error("Event recorded without a token")
+	}
+}
+
+func TestParseObject(t *testing.T) {
+	if o, err := parseObject("", "monitoring", "exporter-pod"); err != nil || o.Kind != "Pod" || o.Name != "exporter-pod" {
+		t.Errorf("Expected the exporter Pod by default, got %+v (%v)", o, err)
+	}
+	for _, s := range []string{"Deployment", "/name", "Deployment/"} {
+		if _, err := parseObject(s, "monitoring", "exporter-pod"); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// metricsHandler serves the registered metrics. The clusterId and clusterName
+// (a regular expression) query parameters limit them to the series of the
+// matching clusters: the collectors don't fetch the other clusters, and the
+// series of other clusters and nodes they still export, e.g. from a background
+// collection, are dropped. collectors are collected within the scrape, see
+// scrapeContext.
+func metricsHandler(collectors ...contextCollector) http.Handler {
+	return prometheus.InstrumentHandler("prometheus", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		ids, name := q["clusterId"], q.Get("clusterName")
+		filtered := len(ids) > 0 || name != ""
+		m := clusterMatcher{}
+		if len(ids) > 0 {
+			m.IDs = make(map[string]bool)
+			for _, id := range ids {
+				m.IDs[id] = true
+			}
+		}
+		if name != "" {
+			re, err := regexp.Compile("^(?:" + name + ")$")
+			if err != nil {
+				http.Error(w, "Invalid clusterName: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			m.Name = re
+		}
+
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		if filtered {
+			ctx = collector.WithClusterFilter(ctx, m.ClusterFilter)
+		}
+		mfs, err := scrapeGatherer(ctx, collectors...).Gather()
+		if err != nil {
+			http.Error(w, "An error has occurred during metrics collection:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if filtered {
+			mfs = m.filter(mfs)
+		}
+		contentType := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(contentType))
+		var out io.Writer = w
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		enc := expfmt.NewEncoder(out, contentType)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				log.Errorf("Could not encode %s: %v", mf.GetName(), err)
+				return
+			}
+		}
+	}))
+}
+
+// acceptsGzip tells whether the client of r accepts gzip encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "gzip" || strings.HasPrefix(part, "gzip;") {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterMatcher filters the series of the clusters a ClusterFilter doesn't
+// select out of gathered metrics
+type clusterMatcher struct {
+	collector.ClusterFilter
+}
+
+func labelValue(metric *dto.Metric, name string) (string, bool) {
+	for _, l := range metric.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// filter keeps the series of the matching clusters and their nodes, along
+// with the ones not related to any cluster. Node metrics only carry a nodeId,
+// the info metrics tell which cluster they belong to.
+func (m clusterMatcher) filter(mfs []*dto.MetricFamily) []*dto.MetricFamily {
+	names := map[string]string{}
+	nodeClusters := map[string]string{}
+	for _, mf := range mfs {
+		for _, metric := range mf.GetMetric() {
+			id, ok := labelValue(metric, "clusterId")
+			if !ok {
+				continue
+			}
+			if name, ok := labelValue(metric, "clusterName"); ok {
+				names[id] = name
+			}
+			if nodeID, ok := labelValue(metric, "nodeId"); ok {
+				nodeClusters[nodeID] = id
+			}
+		}
+	}
+	matchedNames := map[string]bool{}
+	for id, name := range names {
+		if m.Match(id, name) {
+			matchedNames[name] = true
+		}
+	}
+
+	keep := func(metric *dto.Metric) bool {
+		if id, ok := labelValue(metric, "clusterId"); ok {
+			return m.Match(id, names[id])
+		}
+		if nodeID, ok := labelValue(metric, "nodeId"); ok {
+			id := nodeClusters[nodeID]
+			return m.Match(id, names[id])
+		}
+		if name, ok := labelValue(metric, "clusterName"); ok {
+			return matchedNames[name]
+		}
+		return true
+	}
+	filtered := make([]*dto.MetricFamily, 0, len(mfs))
+	for _, mf := range mfs {
+		metrics := make([]*dto.Metric, 0, len(mf.GetMetric()))
+		for _, metric := range mf.GetMetric() {
+			if keep(metric) {
+				metrics = append(metrics, metric)
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		mf.Metric = metrics
+		filtered = append(filtered, mf)
+	}
+	return filtered
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricSetURL = "/status/metric-set"
+
+// metricSet is what the exporter asks the Monitoring API for and emits with
+// its current configuration, profile and filters applied
+type metricSet struct {
+	// Queries are the Monitoring API metrics queried per node, by kind of
+	// cluster, see collector.Exporter.MetricQueries
+	Queries map[string][]string `json:"queries"`
+	// Families are the names of the metric families the exporter can emit
+	Families []string `json:"families"`
+}
+
+// metricQuerier tells the Monitoring API queries of the exporter
+type metricQuerier interface {
+	MetricQueries() map[string][]string
+}
+
+// metricSetHandler serves the metric set of exp as JSON, the families
+// described by collectors
+func metricSetHandler(exp metricQuerier, collectors ...prometheus.Collector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set := metricSet{Queries: exp.MetricQueries(), Families: []string{}}
+		for _, doc := range collector.Docs(collectors...) {
+			set.Families = append(set.Families, doc.Name)
+		}
+		w.Header().Set("Content-Type", jsonContentType)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(set)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricSet(t *testing.T) {
+	rr := httptest.NewRecorder()
+	exporterServer.HTTPServer.Handler.ServeHTTP(rr, httptest.NewRequest("GET", metricSetURL, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Got status %d", rr.Code)
+	}
+	var got metricSet
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	contains := func(list []string, s string) bool {
+		for _, item := range list {
+			if item == s {
+				return true
+			}
+		}
+		return false
+	}
+	if !contains(got.Queries["cassandra"], "n::cpuUtilization") {
+		t.Errorf("n::cpuUtilization not queried: %v", got.Queries)
+	}
+	for _, family := range []string{"cassandra_node_info", "cassandra_node_cpu_utilization_percentage"} {
+		if !contains(got.Families, family) {
+			t.Errorf("%s not emitted: %v", family, got.Families)
+		}
+	}
+}
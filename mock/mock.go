@@ -81,14 +81,43 @@ func getClusterStatusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// clusterFileHandler serves the JSON file name stored under the cluster directory
+func clusterFileHandler(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var response interface{}
+		clusterID := mux.Vars(r)["id"]
+		jsonData, err := loadJSONFile(fmt.Sprintf("%s/%s/%s", jsonStoragePath, clusterID, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				w.WriteHeader(http.StatusNotFound)
+				jsonData = []byte(notFoundResponse)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+				jsonData = []byte(internalServerErrorResponse)
+			}
+		}
+		if err := json.Unmarshal(jsonData, &response); err != nil {
+			log.Errorf("Could not unmarshal json %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
 func getAllNodeMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	var response interface{}
 	u, _ := url.Parse(r.URL.RequestURI())
 	nodeID := path.Base(u.Path)
 	jsonData, err := loadJSONFile(fmt.Sprintf("%s/%s/getAllNodeMetrics.json", jsonStoragePath, nodeID))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		jsonData = []byte(notFoundResponse)
+		if os.IsNotExist(err) {
+			w.WriteHeader(http.StatusNotFound)
+			jsonData = []byte(notFoundResponse)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+			jsonData = []byte(internalServerErrorResponse)
+		}
 	}
 	if err := json.Unmarshal(jsonData, &response); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -113,6 +142,8 @@ func NewMockServer(serverOpts common.ServerOptions) *common.Server {
 	//GET Methods
 	provisioningAPIRouter.HandleFunc("", getClustersHandler).Methods("GET")
 	provisioningAPIRouter.HandleFunc("/{id}", getClusterStatusHandler).Methods("GET")
+	provisioningAPIRouter.HandleFunc("/{id}/repairs", clusterFileHandler("getClusterRepairs.json")).Methods("GET")
+	provisioningAPIRouter.HandleFunc("/{id}/events", clusterFileHandler("getClusterEvents.json")).Methods("GET")
 	monitoringAPIRouter.HandleFunc("/nodes/{id}", getAllNodeMetricsHandler).Methods("GET")
 	s.HTTPServer.Handler = router
 	return s
@@ -0,0 +1,282 @@
+// Package parquet writes Parquet files of required string and integer
+// columns, PLAIN encoded and uncompressed in a single row group, which is
+// all the inventory exports need. See
+// https://github.com/apache/parquet-format for the format.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Type is the type of a column
+type Type int
+
+const (
+	// String columns hold UTF-8 strings
+	String Type = iota
+	// Int64 columns hold 64 bits integers, written from their decimal form
+	Int64
+)
+
+// Values of the parquet.thrift enums written
+const (
+	typeInt64          = 2
+	typeByteArray      = 6
+	repetitionRequired = 0
+	convertedUTF8      = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageData           = 0
+)
+
+// createdBy names the writer in the file metadata
+const createdBy = "instaclustr_exporter"
+
+var magic = []byte("PAR1")
+
+// Column is a required column of a Parquet file
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Writer buffers the rows written and writes them as a Parquet file on Close
+type Writer struct {
+	w       io.Writer
+	columns []Column
+	// values are the PLAIN encoded values of every column
+	values []bytes.Buffer
+	rows   int
+}
+
+// NewWriter returns a Writer of a file of columns to w
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	return &Writer{w: w, columns: columns, values: make([]bytes.Buffer, len(columns))}
+}
+
+// Write adds a row, its values in the order of the columns
+func (w *Writer) Write(row []string) error {
+	if len(row) != len(w.columns) {
+		return fmt.Errorf("row of %d values, expected %d", len(row), len(w.columns))
+	}
+	// Parsed first, so that an invalid row isn't partly written
+	ints := make([]int64, len(row))
+	for i, c := range w.columns {
+		if c.Type != Int64 {
+			continue
+		}
+		v, err := strconv.ParseInt(row[i], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", c.Name, err)
+		}
+		ints[i] = v
+	}
+	for i, c := range w.columns {
+		values := &w.values[i]
+		if c.Type == Int64 {
+			binary.Write(values, binary.LittleEndian, ints[i])
+			continue
+		}
+		binary.Write(values, binary.LittleEndian, uint32(len(row[i])))
+		values.WriteString(row[i])
+	}
+	w.rows++
+	return nil
+}
+
+// chunk is where the page of a column was written
+type chunk struct {
+	offset, size int64
+}
+
+// Close writes the file: a data page per column then the metadata
+func (w *Writer) Close() error {
+	var file bytes.Buffer
+	file.Write(magic)
+	chunks := make([]chunk, len(w.columns))
+	for i := range w.columns {
+		values := w.values[i].Bytes()
+		header := w.pageHeader(len(values))
+		chunks[i] = chunk{offset: int64(file.Len()), size: int64(len(header) + len(values))}
+		file.Write(header)
+		file.Write(values)
+	}
+	metadata := w.fileMetaData(chunks)
+	file.Write(metadata)
+	binary.Write(&file, binary.LittleEndian, uint32(len(metadata)))
+	file.Write(magic)
+	_, err := w.w.Write(file.Bytes())
+	return err
+}
+
+// pageHeader is the PageHeader of a data page of size bytes of values
+func (w *Writer) pageHeader(size int) []byte {
+	c := new(compact)
+	c.begin()
+	c.i32(1, pageData)
+	c.i32(2, int32(size))
+	c.i32(3, int32(size))
+	// DataPageHeader, the columns being required there are no levels
+	c.structField(5)
+	c.i32(1, int32(w.rows))
+	c.i32(2, encodingPlain)
+	c.i32(3, encodingRLE)
+	c.i32(4, encodingRLE)
+	c.end()
+	c.end()
+	return c.Bytes()
+}
+
+// fileMetaData is the FileMetaData of a single row group of chunks
+func (w *Writer) fileMetaData(chunks []chunk) []byte {
+	c := new(compact)
+	c.begin()
+	c.i32(1, 1)
+	// Schema, the root then the columns
+	c.list(2, compactStruct, len(w.columns)+1)
+	c.begin()
+	c.str(4, "schema")
+	c.i32(5, int32(len(w.columns)))
+	c.end()
+	for _, col := range w.columns {
+		c.begin()
+		c.i32(1, physicalType(col.Type))
+		c.i32(3, repetitionRequired)
+		c.str(4, col.Name)
+		if col.Type == String {
+			c.i32(6, convertedUTF8)
+		}
+		c.end()
+	}
+	c.i64(3, int64(w.rows))
+	// Row groups
+	c.list(4, compactStruct, 1)
+	c.begin()
+	c.list(1, compactStruct, len(chunks))
+	var total int64
+	for i, ch := range chunks {
+		total += ch.size
+		c.begin()
+		c.i64(2, ch.offset)
+		// ColumnMetaData
+		c.structField(3)
+		c.i32(1, physicalType(w.columns[i].Type))
+		c.list(2, compactI32, 1)
+		c.zigzag(encodingPlain)
+		c.list(3, compactBinary, 1)
+		c.binary(w.columns[i].Name)
+		c.i32(4, codecUncompressed)
+		c.i64(5, int64(w.rows))
+		c.i64(6, ch.size)
+		c.i64(7, ch.size)
+		c.i64(9, ch.offset)
+		c.end()
+		c.end()
+	}
+	c.i64(2, total)
+	c.i64(3, int64(w.rows))
+	c.end()
+	c.str(6, createdBy)
+	c.end()
+	return c.Bytes()
+}
+
+func physicalType(t Type) int32 {
+	if t == Int64 {
+		return typeInt64
+	}
+	return typeByteArray
+}
+
+// Thrift compact protocol types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compact encodes the Thrift structures of the metadata with the compact
+// protocol
+type compact struct {
+	bytes.Buffer
+	// last are the ids of the last fields of the structures being written,
+	// field ids being encoded as deltas
+	last []int16
+}
+
+// begin starts a structure, end writes its stop field
+func (c *compact) begin() {
+	c.last = append(c.last, 0)
+}
+
+func (c *compact) end() {
+	c.WriteByte(0)
+	c.last = c.last[:len(c.last)-1]
+}
+
+func (c *compact) varint(v uint64) {
+	for v >= 0x80 {
+		c.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	c.WriteByte(byte(v))
+}
+
+func (c *compact) zigzag(v int64) {
+	c.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (c *compact) binary(s string) {
+	c.varint(uint64(len(s)))
+	c.WriteString(s)
+}
+
+func (c *compact) field(id int16, t byte) {
+	last := &c.last[len(c.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		c.WriteByte(byte(delta)<<4 | t)
+	} else {
+		c.WriteByte(t)
+		c.zigzag(int64(id))
+	}
+	*last = id
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, compactI32)
+	c.zigzag(int64(v))
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, compactI64)
+	c.zigzag(v)
+}
+
+func (c *compact) str(id int16, s string) {
+	c.field(id, compactBinary)
+	c.binary(s)
+}
+
+// list starts a list of n elements of type t, written right after
+func (c *compact) list(id int16, t byte, n int) {
+	c.field(id, compactList)
+	if n < 15 {
+		c.WriteByte(byte(n)<<4 | t)
+		return
+	}
+	c.WriteByte(0xf0 | t)
+	c.varint(uint64(n))
+}
+
+// structField starts a structure field, ended by end
+func (c *compact) structField(id int16) {
+	c.field(id, compactStruct)
+	c.begin()
+}
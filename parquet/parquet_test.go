@@ -0,0 +1,138 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// reader decodes the Thrift compact protocol: structures as maps of their
+// fields by id, lists as slices, integers as int64 and binaries as strings
+type reader struct {
+	b []byte
+}
+
+func (r *reader) byte() byte {
+	b := r.b[0]
+	r.b = r.b[1:]
+	return b
+}
+
+func (r *reader) varint() uint64 {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		b := r.byte()
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v
+		}
+	}
+}
+
+func (r *reader) zigzag() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *reader) value(t byte) interface{} {
+	switch t {
+	case compactI32, compactI64:
+		return r.zigzag()
+	case compactBinary:
+		n := r.varint()
+		s := string(r.b[:n])
+		r.b = r.b[n:]
+		return s
+	case compactList:
+		h := r.byte()
+		n := uint64(h >> 4)
+		if n == 15 {
+			n = r.varint()
+		}
+		var l []interface{}
+		for i := uint64(0); i < n; i++ {
+			l = append(l, r.value(h&0x0f))
+		}
+		return l
+	case compactStruct:
+		s := map[int16]interface{}{}
+		var last int16
+		for {
+			h := r.byte()
+			if h == 0 {
+				return s
+			}
+			if delta := int16(h >> 4); delta != 0 {
+				last += delta
+			} else {
+				last = int16(r.zigzag())
+			}
+			s[last] = r.value(h & 0x0f)
+		}
+	}
+	panic("unexpected type")
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, []Column{{"name", String}, {"nodes", Int64}})
+	for _, row := range [][]string{{"prod", "3"}, {"", "-1"}} {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write([]string{"test", "three"}); err == nil {
+		t.Error("Invalid integer written")
+	}
+	if err := w.Write([]string{"test"}); err == nil {
+		t.Error("Incomplete row written")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, magic) || !bytes.HasSuffix(file, magic) {
+		t.Fatal("Magic missing")
+	}
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	r := &reader{file[len(file)-8-int(size) : len(file)-8]}
+	metadata := r.value(compactStruct).(map[int16]interface{})
+	if rows := metadata[3]; rows != int64(2) {
+		t.Errorf("Got %v rows, want 2", rows)
+	}
+	var names []string
+	for _, s := range metadata[2].([]interface{}) {
+		names = append(names, s.(map[int16]interface{})[4].(string))
+	}
+	if expected := []string{"schema", "name", "nodes"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Got schema %v, want %v", names, expected)
+	}
+
+	chunks := metadata[4].([]interface{})[0].(map[int16]interface{})[1].([]interface{})
+	var values [][]byte
+	for _, c := range chunks {
+		meta := c.(map[int16]interface{})[3].(map[int16]interface{})
+		offset := meta[9].(int64)
+		r := &reader{file[offset:]}
+		header := r.value(compactStruct).(map[int16]interface{})
+		if n := header[5].(map[int16]interface{})[1]; n != int64(2) {
+			t.Errorf("Got a page of %v values, want 2", n)
+		}
+		values = append(values, r.b[:header[3].(int64)])
+	}
+	var name bytes.Buffer
+	for _, s := range []string{"prod", ""} {
+		binary.Write(&name, binary.LittleEndian, uint32(len(s)))
+		name.WriteString(s)
+	}
+	if !bytes.Equal(values[0], name.Bytes()) {
+		t.Errorf("Got names %q, want %q", values[0], name.Bytes())
+	}
+	var nodes bytes.Buffer
+	binary.Write(&nodes, binary.LittleEndian, []int64{3, -1})
+	if !bytes.Equal(values[1], nodes.Bytes()) {
+		t.Errorf("Got nodes %v, want %v", values[1], nodes.Bytes())
+	}
+}
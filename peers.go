@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	configHashURL      = "/status/config-hash"
+	peersURL           = "/status/peers"
+	peerRequestTimeout = 5 * time.Second
+	peerCheckInterval  = time.Minute
+)
+
+var (
+	configInfo = prometheus.NewDesc(
+		prometheus.BuildFQName("instaclustr_exporter", "config", "info"),
+		"Hash of the effective exporter configuration, secrets redacted.",
+		[]string{"hash"},
+		nil,
+	)
+	configDriftPeers = prometheus.NewDesc(
+		prometheus.BuildFQName("instaclustr_exporter", "config", "drift_peers"),
+		"Number of peers whose configuration hash doesn't match this exporter's, unreachable peers included.",
+		nil,
+		nil,
+	)
+)
+
+type configHashResponse struct {
+	Hash string `json:"hash"`
+}
+
+type peerStatus struct {
+	Peer  string `json:"peer"`
+	Hash  string `json:"hash,omitempty"`
+	Match bool   `json:"match"`
+	Error string `json:"error,omitempty"`
+}
+
+// peerChecker compares this exporter's configuration hash with the ones of
+// its peers, checked in the background so scrapes don't wait for them
+type peerChecker struct {
+	mu     sync.Mutex
+	hash   string
+	peers  []string
+	client *http.Client
+	// checked are the hashes the peers served at the last check, along with
+	// the errors of the ones that couldn't be reached, nil before the first
+	checked []peerStatus
+}
+
+func newPeerChecker(cfg config) *peerChecker {
+	return &peerChecker{
+		hash:   cfg.hash(),
+		peers:  cfg.Peers,
+		client: &http.Client{Timeout: peerRequestTimeout},
+	}
+}
+
+// setHash updates the configuration hash after a reload
+func (p *peerChecker) setHash(hash string) {
+	p.mu.Lock()
+	p.hash = hash
+	p.mu.Unlock()
+}
+
+func (p *peerChecker) configHash() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hash
+}
+
+func (p *peerChecker) fetchHash(peer string) (string, error) {
+	resp, err := p.client.Get(strings.TrimRight(peer, "/") + configHashURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	var h configHashResponse
+	if err := json.NewDecoder(resp.Body).Decode(&h); err != nil {
+		return "", err
+	}
+	return h.Hash, nil
+}
+
+// run checks the peers every interval until stop is closed, nothing when
+// there are none
+func (p *peerChecker) run(interval time.Duration, stop <-chan struct{}) {
+	if len(p.peers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.check()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check queries every peer concurrently, each within peerRequestTimeout,
+// results keep the peers order
+func (p *peerChecker) check() {
+	checked := make([]peerStatus, len(p.peers))
+	done := make(chan struct{})
+	for i, peer := range p.peers {
+		go func(i int, peer string) {
+			defer func() { done <- struct{}{} }()
+			st := peerStatus{Peer: peer}
+			hash, err := p.fetchHash(peer)
+			if err != nil {
+				st.Error = err.Error()
+			} else {
+				st.Hash = hash
+			}
+			checked[i] = st
+		}(i, peer)
+	}
+	for range p.peers {
+		<-done
+	}
+	p.mu.Lock()
+	p.checked = checked
+	p.mu.Unlock()
+}
+
+// statuses returns the peers of the last check, matched against the current
+// configuration hash, nil before the first check
+func (p *peerChecker) statuses() []peerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.checked == nil {
+		return nil
+	}
+	statuses := make([]peerStatus, len(p.checked))
+	for i, st := range p.checked {
+		st.Match = st.Error == "" && st.Hash == p.hash
+		statuses[i] = st
+	}
+	return statuses
+}
+
+// ConfigHashHandler returns the configuration hash of this exporter
+func (p *peerChecker) ConfigHashHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(configHashResponse{Hash: p.configHash()})
+}
+
+// PeersHandler lists the configuration hash of every peer at the last check
+// and whether it matches, none before the first check
+func (p *peerChecker) PeersHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := p.statuses()
+	if statuses == nil {
+		statuses = []peerStatus{}
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// Describe implements prometheus.Collector
+func (p *peerChecker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- configInfo
+	ch <- configDriftPeers
+}
+
+// Collect implements prometheus.Collector. The drift is only exported once
+// the peers have been checked, if any.
+func (p *peerChecker) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(configInfo, prometheus.GaugeValue, 1, p.configHash())
+	statuses := p.statuses()
+	if statuses == nil && len(p.peers) > 0 {
+		return
+	}
+	drift := 0
+	for _, st := range statuses {
+		if !st.Match {
+			drift++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(configDriftPeers, prometheus.GaugeValue, float64(drift))
+}
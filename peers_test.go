@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// hashServer serves hash as its configuration hash, after delay
+func hashServer(hash string, delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		json.NewEncoder(w).Encode(configHashResponse{Hash: hash})
+	}))
+}
+
+// gatherDrift returns the drift exported by p, false when it isn't
+func gatherDrift(t *testing.T, p *peerChecker) (float64, bool) {
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(p); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "instaclustr_exporter_config_drift_peers" {
+			return mf.GetMetric()[0].GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func TestPeerChecker(t *testing.T) {
+	same := hashServer("h1", 0)
+	defer same.Close()
+	other := hashServer("h2", 0)
+	defer other.Close()
+	slow := hashServer("h1", time.Second)
+	defer slow.Close()
+	gone := hashServer("h1", 0)
+	gone.Close()
+
+	p := newPeerChecker(config{Peers: []string{same.URL, other.URL, slow.URL, gone.URL}})
+	p.setHash("h1")
+	p.client.Timeout = 100 * time.Millisecond
+	if _, ok := gatherDrift(t, p); ok {
+		t.Error("Drift exported before the peers were checked")
+	}
+	rr := httptest.NewRecorder()
+	p.PeersHandler(rr, httptest.NewRequest("GET", peersURL, nil))
+	if body := rr.Body.String(); body != "[]\n" {
+		t.Errorf("Got peers %s before they were checked, want none", body)
+	}
+
+	start := time.Now()
+	p.check()
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Check waited %s for the slow peer", elapsed)
+	}
+	var matches []bool
+	for _, st := range p.statuses() {
+		matches = append(matches, st.Match)
+	}
+	if expected := []bool{true, false, false, false}; !reflect.DeepEqual(matches, expected) {
+		t.Errorf("Got matches %v, want %v", matches, expected)
+	}
+	if drift, _ := gatherDrift(t, p); drift != 3 {
+		t.Errorf("Got %v drifting peers, want the other, slow and gone ones", drift)
+	}
+	// Matched against the reloaded configuration without checking again
+	p.setHash("h2")
+	if drift, _ := gatherDrift(t, p); drift != 3 {
+		t.Errorf("Got %v drifting peers once reloaded, want all but the other one", drift)
+	}
+}
+
+func TestPeerCheckerRun(t *testing.T) {
+	peer := hashServer("h1", 0)
+	defer peer.Close()
+	p := newPeerChecker(config{Peers: []string{peer.URL}})
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		p.run(time.Hour, stop)
+		close(done)
+	}()
+	for p.statuses() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Checks not stopped")
+	}
+
+	// Nothing to check without peers, no drift either
+	p = newPeerChecker(config{})
+	p.run(time.Hour, nil)
+	if drift, ok := gatherDrift(t, p); !ok || drift != 0 {
+		t.Errorf("Got drift %v (%v) without peers, want 0", drift, ok)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+const reloadURL = "/-/reload"
+
+var (
+	configReloadSuccess = prometheus.NewDesc(
+		"instaclustr_exporter_config_last_reload_successful",
+		"Whether the last reload of the configuration file succeeded.",
+		nil, nil,
+	)
+	configReloadTime = prometheus.NewDesc(
+		"instaclustr_exporter_config_last_reload_success_timestamp_seconds",
+		"Time of the last successful load of the configuration, in unixtime.",
+		nil, nil,
+	)
+)
+
+// collection collects from the Instaclustr API, a collector.Exporter, or
+// from other exporters, a collector.Federation
+type collection interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+	LastScrape() (collector.ScrapeSummary, bool)
+	LastPoll() (started, finished time.Time)
+	RecentErrors() []collector.CollectionError
+	RunBackground(stop <-chan struct{})
+	OnSnapshot(func(collector.Snapshot))
+	OnTransitions(func([]collector.Transition))
+	MetricQueries() map[string][]string
+}
+
+// newCollection creates the collection of cfg, a federation when it has
+// federation targets. Every collection gets a new transport, so a reload
+// picks up the rotated CA file and the transport of the previous collection
+// is dropped with it.
+func newCollection(cfg config) (collection, error) {
+	if len(cfg.Collector.FederationTargets) > 0 {
+		return collector.NewFederation(cfg.Collector)
+	}
+	if cfg.Instaclustr.Transport == nil {
+		cfg.Instaclustr.Transport = instaclustr.NewTransport(cfg.Instaclustr)
+	}
+	return collector.NewExporter(cfg.Instaclustr, cfg.Collector)
+}
+
+// liveExporter collects with the exporter of the current configuration,
+// replacing it when the configuration file is reloaded. Only the Instaclustr,
+// collector and compare settings, key rotation dates included, are reloaded,
+// the exporter state, e.g. the status transitions and rates, starts over.
+type liveExporter struct {
+	mu   sync.Mutex
+	cfg  config
+	exp  collection
+	stop chan struct{}
+	// delta compares the account with cfg.Compare.Other, nil when disabled
+	delta *collector.DeltaCollector
+	// wire attaches the snapshot, transition and node change handlers to a
+	// new exporter
+	wire func(collection)
+	// load reads the configuration again, nil without configuration file
+	load func() (config, error)
+	// onReload is called with every configuration applied
+	onReload func(config)
+	ok       bool
+	loaded   time.Time
+}
+
+func newLiveExporter(cfg config, load func() (config, error), wire func(collection)) (*liveExporter, error) {
+	l := &liveExporter{cfg: cfg, wire: wire, load: load, onReload: func(config) {}}
+	exp, err := newCollection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	l.start(exp)
+	l.delta = newDelta(cfg)
+	l.ok, l.loaded = true, time.Now()
+	return l, nil
+}
+
+// start makes exp the exporter collecting, stopping the background
+// collection of the previous one
+func (l *liveExporter) start(exp collection) {
+	if l.stop != nil {
+		close(l.stop)
+	}
+	l.exp, l.stop = exp, make(chan struct{})
+	l.wire(exp)
+	go exp.RunBackground(l.stop)
+}
+
+// newDelta creates the comparison of the accounts of cfg, nil when disabled
+func newDelta(cfg config) *collector.DeltaCollector {
+	if !cfg.Compare.Enabled() {
+		return nil
+	}
+	return collector.NewDeltaCollector(cfg.Instaclustr, cfg.Compare)
+}
+
+func (l *liveExporter) exporter() collection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.exp
+}
+
+func (l *liveExporter) config() config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// reload loads the configuration again and applies it
+func (l *liveExporter) reload() error {
+	cfg, err := l.load()
+	if err == nil {
+		err = l.apply(cfg)
+	}
+	l.mu.Lock()
+	l.ok = err == nil
+	if l.ok {
+		l.loaded = time.Now()
+	}
+	l.mu.Unlock()
+	return err
+}
+
+func (l *liveExporter) apply(cfg config) error {
+	exp, err := newCollection(cfg)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	// settings other than the reloaded ones need a restart to apply, so
+	// does enabling or disabling the comparison, which adds or removes metrics
+	kept := cfg
+	kept.Instaclustr, kept.Collector = l.cfg.Instaclustr, l.cfg.Collector
+	kept.KeyRotationDue = l.cfg.KeyRotationDue
+	reloadCompare := cfg.Compare.Enabled() == l.cfg.Compare.Enabled()
+	if reloadCompare {
+		kept.Compare = l.cfg.Compare
+	}
+	if !reflect.DeepEqual(kept, l.cfg) {
+		log.Warnf("Only the instaclustr, collector and compare settings are reloaded, restart the exporter to apply the others or to enable or disable the comparison")
+	}
+	l.cfg.Instaclustr, l.cfg.Collector = cfg.Instaclustr, cfg.Collector
+	l.cfg.KeyRotationDue = cfg.KeyRotationDue
+	if reloadCompare {
+		l.cfg.Compare = cfg.Compare
+	}
+	l.delta = newDelta(l.cfg)
+	applied := l.cfg
+	l.start(exp)
+	l.mu.Unlock()
+	l.onReload(applied)
+	log.Infof("Configuration reloaded")
+	return nil
+}
+
+// watchSignals reloads the configuration on every SIGHUP
+func (l *liveExporter) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := l.reload(); err != nil {
+			log.Errorf("Could not reload the configuration: %v", err)
+		}
+	}
+}
+
+// ReloadHandler reloads the configuration on POST /-/reload. Like shutdowns,
+// only requests from loopback addresses not forwarded by a reverse proxy are
+// accepted unless ReloadAllowRemote is set.
+func (l *liveExporter) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if !l.config().ReloadAllowRemote && !common.IsLoopback(r) {
+		log.Warnf("Rejected reload request from %s", r.RemoteAddr)
+		http.Error(w, "Reload is only accepted from loopback addresses, not through a reverse proxy", http.StatusForbidden)
+		return
+	}
+	if l.load == nil {
+		http.Error(w, "no configuration file to reload, see -config.file", http.StatusBadRequest)
+		return
+	}
+	if err := l.reload(); err != nil {
+		log.Errorf("Could not reload the configuration: %v", err)
+		http.Error(w, fmt.Sprintf("Could not reload the configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(w, "Configuration reloaded.")
+}
+
+// LastPoll returns the background collection times of the current exporter
+func (l *liveExporter) LastPoll() (started, finished time.Time) {
+	return l.exporter().LastPoll()
+}
+
+// RecentErrors returns the latest collection errors of the current exporter
+func (l *liveExporter) RecentErrors() []collector.CollectionError {
+	return l.exporter().RecentErrors()
+}
+
+// MetricQueries returns the Monitoring API queries of the current exporter
+func (l *liveExporter) MetricQueries() map[string][]string {
+	return l.exporter().MetricQueries()
+}
+
+// LastScrape returns the summary of the last collection of the current exporter
+func (l *liveExporter) LastScrape() (collector.ScrapeSummary, bool) {
+	return l.exporter().LastScrape()
+}
+
+// Describe implements prometheus.Collector
+func (l *liveExporter) Describe(ch chan<- *prometheus.Desc) {
+	l.exporter().Describe(ch)
+	ch <- configReloadSuccess
+	ch <- configReloadTime
+}
+
+// Collect implements prometheus.Collector
+func (l *liveExporter) Collect(ch chan<- prometheus.Metric) {
+	l.CollectContext(context.Background(), ch)
+}
+
+// CollectContext collects with the current exporter within ctx
+func (l *liveExporter) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	l.exporter().CollectContext(ctx, ch)
+	l.mu.Lock()
+	ok, loaded := l.ok, l.loaded
+	l.mu.Unlock()
+	success := 0.0
+	if ok {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(configReloadSuccess, prometheus.GaugeValue, success)
+	ch <- prometheus.MustNewConstMetric(configReloadTime, prometheus.GaugeValue, float64(loaded.Unix()))
+}
+
+// liveDelta compares the accounts with the DeltaCollector of the current
+// configuration of a liveExporter
+type liveDelta struct {
+	l *liveExporter
+}
+
+func (d liveDelta) current() *collector.DeltaCollector {
+	d.l.mu.Lock()
+	defer d.l.mu.Unlock()
+	return d.l.delta
+}
+
+// Describe implements prometheus.Collector
+func (d liveDelta) Describe(ch chan<- *prometheus.Desc) {
+	if delta := d.current(); delta != nil {
+		delta.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (d liveDelta) Collect(ch chan<- prometheus.Metric) {
+	d.CollectContext(context.Background(), ch)
+}
+
+// CollectContext compares the accounts within ctx
+func (d liveDelta) CollectContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	if delta := d.current(); delta != nil {
+		delta.CollectContext(ctx, ch)
+	}
+}
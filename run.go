@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// runSummary counts the collections of a run bounded by run-duration, so
+// CI and load tests can tell from the exit code whether collecting worked.
+// A collection failed when its instaclustr_exporter_last_scrape_success is 0.
+type runSummary struct {
+	start time.Time
+
+	mu sync.Mutex
+	// last is the start of the last collection counted
+	last        time.Time
+	collections int
+	failed      int
+	apiCalls    int64
+}
+
+func newRunSummary(start time.Time) *runSummary {
+	return &runSummary{start: start}
+}
+
+// record counts the collection summary is of, once
+func (r *runSummary) record(summary collector.ScrapeSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !summary.Start.After(r.last) {
+		return
+	}
+	r.last = summary.Start
+	r.collections++
+	if !summary.Success {
+		r.failed++
+	}
+	r.apiCalls += summary.APICalls
+}
+
+// report logs the summary of the run and returns its exit code: 1 when
+// there was no collection or every one failed, 0 otherwise
+func (r *runSummary) report(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	code := 0
+	if r.failed == r.collections {
+		code = 1
+	}
+	log.With("duration", now.Sub(r.start)).
+		With("collections", r.collections).
+		With("failed", r.failed).
+		With("api_calls", r.apiCalls).
+		With("exit_code", code).
+		Infof("Run finished")
+	return code
+}
+
+// collectOnce runs a collection of c whose metrics are dropped, so a run
+// without collector.interval has a collection even if nobody scrapes it
+func collectOnce(c prometheus.Collector) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+		}
+		close(done)
+	}()
+	c.Collect(ch)
+	close(ch)
+	<-done
+}
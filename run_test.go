@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+)
+
+func TestRunSummary(t *testing.T) {
+	start := time.Date(2017, 7, 3, 9, 0, 0, 0, time.UTC)
+	run := newRunSummary(start)
+	if code := run.report(start); code != 1 {
+		t.Errorf("Run without collections exits %d, want 1", code)
+	}
+
+	failed := collector.ScrapeSummary{Start: start.Add(time.Minute), Errors: 1}
+	run.record(failed)
+	// Seen again by another snapshot handler
+	run.record(failed)
+	if run.collections != 1 {
+		t.Errorf("Counted %d collections, want 1", run.collections)
+	}
+	if code := run.report(start.Add(time.Minute)); code != 1 {
+		t.Errorf("Run whose collections all failed exits %d, want 1", code)
+	}
+
+	run.record(collector.ScrapeSummary{Start: start.Add(2 * time.Minute), Success: true})
+	if code := run.report(start.Add(2 * time.Minute)); code != 0 {
+		t.Errorf("Run with a successful collection exits %d, want 0", code)
+	}
+}
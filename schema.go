@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const schemaChangesURL = "/status/schema-changes"
+
+// metricsSchemaVersion is bumped, along with a schemaChanges entry, whenever
+// the exported metric names or labels change
+const metricsSchemaVersion = 60
+
+// schemaChange is an addition, rename, removal or label change of a metric
+type schemaChange struct {
+	Version int    `json:"version"`
+	Change  string `json:"change"`
+	Metric  string `json:"metric"`
+	// Previous is the name of a renamed metric
+	Previous string `json:"previous,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// schemaChanges are the metric changes since the first schema version, oldest first
+var schemaChanges = []schemaChange{
+	{1, "added", "cassandra_cluster_info", "", "Along with the cluster, node status, utilization, throughput, compaction, repair and latency metrics"},
+	{2, "added", "cassandra_node_reads_total", "", ""},
+	{2, "added", "cassandra_node_writes_total", "", ""},
+	{3, "added", "instaclustr_exporter_oversized_responses_total", "", ""},
+	{4, "added", "cassandra_cluster_last_repair_timestamp_seconds", "", "collector.repair-status"},
+	{4, "added", "cassandra_table_last_repair_timestamp_seconds", "", "collector.repair-status"},
+	{4, "added", "cassandra_table_repair_status", "", "collector.repair-status"},
+	{5, "added", "instaclustr_exporter_config_info", "", ""},
+	{5, "added", "instaclustr_exporter_config_drift_peers", "", ""},
+	{6, "added", "instaclustr_node_operations_total", "", "collector.node-operations"},
+	{7, "added", "cassandra_node_metric_parse_error", "", "collector.parse-error-mode=flag"},
+	{8, "added", "cassandra_node_last_sample_timestamp_seconds", "", ""},
+	{9, "added", "instaclustr_exporter_suppressed_node_requests_total", "", ""},
+	{10, "added", "cassandra_cluster_cpu_utilization_percentage", "", "Along with the other cluster level aggregates of node metrics, collector.aggregate-nodes"},
+	{11, "added", "cassandra_cluster_nodes_delta", "", "Along with cassandra_cluster_nodes_running_delta and cassandra_cluster_status_match, compare.user"},
+	{12, "added", "instaclustr_exporter_instance_info", "", ""},
+	{13, "added", "instaclustr_exporter_quiet_mode", "", "collector.quiet-windows"},
+	{14, "added", "cassandra_datacentre_rack_loss_tolerant", "", ""},
+	{15, "added", "instaclustr_exporter_api_calls_last_scrape", "", ""},
+	{16, "added", "instaclustr_exporter_latency_coverage_ratio", "", "collector.latency-threshold"},
+	{17, "added", "instaclustr_exporter_sanitized_samples_total", "", ""},
+	{18, "added", "instaclustr_exporter_monitoring_disabled", "", ""},
+	{19, "added", "cassandra_node_provisioning_duration_seconds", "", ""},
+	{20, "added", "instaclustr_cluster_compliance_info", "", ""},
+	{21, "added", "kafka_node_bytes_in_per_second", "", "Along with the other kafka_node metrics of Kafka clusters"},
+	{22, "added", "instaclustr_exporter_node_retries_total", "", ""},
+	{23, "added", "instaclustr_exporter_scrape_peak_heap_bytes", "", "Along with instaclustr_exporter_scrape_peak_goroutines and instaclustr_exporter_memory_limit_exceeded"},
+	{24, "added", "instaclustr_exporter_last_collection_timestamp_seconds", "", "collector.interval"},
+	{24, "labels", "cassandra_node_reads_per_second", "", "datacentre and rack labels on the latency and throughput node metrics, collector.topology-labels"},
+	{25, "added", "instaclustr_exporter_metrics_schema_version", "", ""},
+	{26, "added", "instaclustr_exporter_api_requests_total", "", "Along with instaclustr_exporter_api_errors_total"},
+	{26, "added", "instaclustr_exporter_scrape_duration_seconds", "", "Along with instaclustr_exporter_last_scrape_success"},
+	{27, "added", "instaclustr_exporter_api_up", "", ""},
+	{28, "added", "cassandra_node_status", "", "collector.node-status"},
+	{29, "added", "instaclustr_exporter_config_last_reload_successful", "", "Along with instaclustr_exporter_config_last_reload_success_timestamp_seconds"},
+	{30, "added", "instaclustr_credential_rotation_due_timestamp_seconds", "", "instaclustr.key-rotation-due"},
+	{31, "added", "instaclustr_exporter_api_retries_total", "", "instaclustr.max-retries"},
+	{32, "added", "instaclustr_exporter_api_throttled_requests_total", "", "instaclustr.rate-limit"},
+	{33, "added", "cassandra_node_cpu_utilization_ratio", "", "Along with cassandra_node_disk_utilization_ratio and their cluster aggregates, collector.units=utilization=ratio"},
+	{34, "added", "instaclustr_exporter_api_injected_faults_total", "", "instaclustr.fault-failure-percent and instaclustr.fault-delay-percent"},
+	{35, "added", "instaclustr_exporter_api_budget_exceeded_total", "", "budget of instaclustr.provisioning-policy and instaclustr.monitoring-policy"},
+	{36, "added", "cassandra_cluster_nodes_running_ratio", "", ""},
+	{37, "added", "redis_node_memory_used_bytes", "", "Along with the other redis_node metrics of Redis and Valkey clusters"},
+	{38, "added", "instaclustr_api_maintenance", "", ""},
+	{39, "added", "postgresql_node_connections", "", "Along with the other postgresql_node metrics of PostgreSQL clusters"},
+	{40, "added", "cadence_node_workflow_starts_per_second", "", "Along with the other cadence_node metrics of Cadence clusters"},
+	{41, "renamed", "instaclustr_cluster_info", "cassandra_cluster_info", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_cluster_running", "cassandra_cluster_running", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_cluster_nodes", "cassandra_cluster_nodes", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_cluster_nodes_running", "cassandra_cluster_nodes_running", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_cluster_nodes_running_ratio", "cassandra_cluster_nodes_running_ratio", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_node_info", "cassandra_node_info", "Exported under both names while collector.legacy-topology-names is set"},
+	{41, "renamed", "instaclustr_node_running", "cassandra_node_running", "Exported under both names while collector.legacy-topology-names is set"},
+	{42, "added", "cassandra_table_read_latency", "", "Along with the other cassandra_table metrics of collector.table-metrics"},
+	{43, "added", "spark_node_role_info", "", "Along with the spark_cluster metrics of clusters with the Spark add-on"},
+	{44, "added", "cassandra_node_<metric>", "", "n:: metrics of collector.node-metrics the exporter doesn't know, e.g. cassandra_node_commit_log_size"},
+	{45, "added", "instaclustr_topology_last_refresh_timestamp_seconds", "", "Along with instaclustr_topology_last_change_timestamp_seconds"},
+	{46, "added", "cassandra_node_os_load", "", "Along with the memory, network and swap node metrics of the full profile, without the type label n::osLoad had through collector.node-metrics"},
+	{47, "added", "cassandra_node_monitoring_missing", "", ""},
+	{48, "added", "cassandra_node_thread_pool_pending_tasks", "", "Along with the blocked tasks, dropped mutations and reads, and hints node metrics"},
+	{49, "added", "instaclustr_exporter_stale_samples_total", "", "collector.sample-max-age"},
+	{50, "added", "cassandra_cluster_scrape_success", "", ""},
+	{51, "added", "instaclustr_monitoring_request_duration_seconds", "", ""},
+	{52, "added", "cassandra_node_scrape_success", "", ""},
+	{53, "added", "cassandra_datacentre_info", "", ""},
+	{53, "added", "cassandra_datacentre_nodes", "", ""},
+	{54, "labels", "cassandra_node_info", "", "size, provider and region labels"},
+	{55, "added", "instaclustr_exporter_sanitized_label_values_total", "", "collector.max-label-length"},
+	{56, "labels", "cassandra_cluster_info", "", "account constant label on every metric of an account with instaclustr.alias, declared in the descriptors"},
+	{57, "labels", "kafka_node_partitions", "", "clusterId label on the Kafka, PostgreSQL and Cadence node metrics, as on the Redis ones. The Cadence ones are only queried with collector.cadence-metrics"},
+	{58, "labels", "spark_node_role_info", "", "No worker role, only the roles the Provisioning API reports, for the clusters with the SPARK add-on bundle"},
+	{59, "labels", "cassandra_node_status", "", "state is up or down for the numeric statuses 1 and 0, instead of the number, and other numbers aren't exported"},
+	{60, "added", "kafka_consumer_group_lag", "", "collector.kafka-consumer-lag"},
+	{60, "added", "kafka_consumer_group_consumers", "", "collector.kafka-consumer-lag"},
+}
+
+func newSchemaVersion() prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "instaclustr_exporter",
+		Name:      "metrics_schema_version",
+		Help:      "Version of the exported metric names and labels, see /status/schema-changes.",
+	})
+	g.Set(metricsSchemaVersion)
+	return g
+}
+
+// schemaChangesHandler serves the metric changes as JSON, the ones after the
+// since query parameter version only if given
+func schemaChangesHandler(w http.ResponseWriter, r *http.Request) {
+	since := 0
+	if s := r.URL.Query().Get("since"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid since version: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+	changes := []schemaChange{}
+	for _, c := range schemaChanges {
+		if c.Version > since {
+			changes = append(changes, c)
+		}
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		Version int            `json:"version"`
+		Changes []schemaChange `json:"changes"`
+	}{metricsSchemaVersion, changes})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSchemaChanges(t *testing.T) {
+	last := 0
+	for _, c := range schemaChanges {
+		if c.Version < last || c.Version > metricsSchemaVersion {
+			t.Errorf("%s: version %d out of order", c.Metric, c.Version)
+		}
+		last = c.Version
+	}
+	if last != metricsSchemaVersion {
+		t.Errorf("Last change is version %d, the schema %d", last, metricsSchemaVersion)
+	}
+
+	rr := httptest.NewRecorder()
+	schemaChangesHandler(rr, httptest.NewRequest("GET", "/status/schema-changes?since=24", nil))
+	var got struct {
+		Version int
+		Changes []schemaChange
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	since := 0
+	for _, c := range schemaChanges {
+		if c.Version > 24 {
+			since++
+		}
+	}
+	if got.Version != metricsSchemaVersion || len(got.Changes) != since {
+		t.Errorf("Got version %d with %d changes, want %d with %d", got.Version, len(got.Changes), metricsSchemaVersion, since)
+	}
+
+	rr = httptest.NewRecorder()
+	schemaChangesHandler(rr, httptest.NewRequest("GET", "/status/schema-changes?since=x", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Invalid since: got %d", rr.Code)
+	}
+}
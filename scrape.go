@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// scrapeTimeoutHeader is the header Prometheus tells its scrape timeout in
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// scrapeTimeoutOffset is left out of the Prometheus scrape timeout for the
+// response to make it in time
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// contextCollector is a collector whose collections can be bounded by a
+// context, a liveExporter
+type contextCollector interface {
+	prometheus.Collector
+	CollectContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+// boundCollector collects within ctx
+type boundCollector struct {
+	contextCollector
+	ctx context.Context
+}
+
+func (c boundCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectContext(c.ctx, ch)
+}
+
+// scrapeGatherer gathers the default registry along with collectors
+// collected within ctx. They aren't in the default registry so every scrape
+// can bound their collection, and they share the topology they fetch.
+func scrapeGatherer(ctx context.Context, collectors ...contextCollector) prometheus.Gatherer {
+	ctx = collector.WithSharedTopology(ctx)
+	r := prometheus.NewRegistry()
+	for _, c := range collectors {
+		r.MustRegister(boundCollector{c, ctx})
+	}
+	return prometheus.Gatherers{prometheus.DefaultGatherer, r}
+}
+
+// scrapeContext returns the context of the scrape r, done when the client
+// goes away or, when Prometheus tells its scrape timeout, before it's over
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	header := r.Header.Get(scrapeTimeoutHeader)
+	if header == "" {
+		return context.WithCancel(r.Context())
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		log.Debugf("Ignoring invalid %s %q", scrapeTimeoutHeader, header)
+		return context.WithCancel(r.Context())
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScrapeContext(t *testing.T) {
+	cases := []struct {
+		header  string
+		timeout time.Duration
+	}{
+		{"", 0},
+		{"10", 9500 * time.Millisecond},
+		{"0.5", 500 * time.Millisecond},
+		{"soon", 0},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if c.header != "" {
+			r.Header.Set(scrapeTimeoutHeader, c.header)
+		}
+		before := time.Now()
+		ctx, cancel := scrapeContext(r)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if ok != (c.timeout > 0) {
+			t.Errorf("%q: deadline set %v, want %v", c.header, ok, c.timeout > 0)
+			continue
+		}
+		if ok && (deadline.Before(before.Add(c.timeout)) || deadline.After(time.Now().Add(c.timeout))) {
+			t.Errorf("%q: got deadline in %s, want %s", c.header, deadline.Sub(before), c.timeout)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/collector"
+	"github.com/fcgravalos/instaclustr_exporter/common"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	addrURL         = "/status/addr"
+	configURL       = "/status/config"
+	lastScrapeURL   = "/status/last-scrape"
+	errorsURL       = "/status/errors"
+	scrapeConfigURL = "/status/scrape-config"
+
+	// The Monitoring API refreshes node metrics every 20 seconds, scraping
+	// more often than this only costs API calls
+	recommendedScrapeInterval = time.Minute
+)
+
+// Comments of the generated scrape config, which YAML marshaling doesn't keep
+const (
+	scrapeConfigHeader = "# Generated by instaclustr_exporter from its live configuration\n"
+	scrapeConfigTLS    = `# Over HTTPS, Prometheus needs the CA of the exporter certificate:
+#     tls_config:
+#       ca_file: CA of the exporter certificate
+`
+	scrapeConfigClientCerts = `#       cert_file: client certificate signed by the exporter client CA
+#       key_file: key of the client certificate
+`
+	scrapeConfigReplicas = `# Every replica exports the same series, relabel_configs keeps a single
+# instance label so they don't show up as different targets
+`
+	scrapeConfigExamples = `# Examples: drop series you don't need before they are stored
+#     metric_relabel_configs:
+#       - source_labels: [__name__]
+#         regex: cassandra_node_client_request_(read|write)_percentile95
+#         action: drop
+#       - source_labels: [__name__, clusterId]
+#         regex: cassandra_.+;cluster-to-ignore
+#         action: drop
+`
+)
+
+// scrapeConfigFile is the part of a Prometheus configuration file holding
+// the scrape config of this exporter
+type scrapeConfigFile struct {
+	ScrapeConfigs []scrapeConfig `yaml:"scrape_configs"`
+}
+
+type scrapeConfig struct {
+	JobName        string          `yaml:"job_name"`
+	MetricsPath    string          `yaml:"metrics_path"`
+	Scheme         string          `yaml:"scheme,omitempty"`
+	ScrapeInterval string          `yaml:"scrape_interval"`
+	ScrapeTimeout  string          `yaml:"scrape_timeout"`
+	StaticConfigs  []staticConfig  `yaml:"static_configs"`
+	RelabelConfigs []relabelConfig `yaml:"relabel_configs,omitempty"`
+}
+
+type staticConfig struct {
+	Targets []string          `yaml:"targets"`
+	Labels  map[string]string `yaml:"labels"`
+}
+
+type relabelConfig struct {
+	TargetLabel string `yaml:"target_label"`
+	Replacement string `yaml:"replacement"`
+}
+
+// promDuration formats d the way Prometheus configuration expects it
+func promDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
+
+// scrapeConfigHandler renders a Prometheus scrape config for this exporter.
+// The target is the address it was reached through, so it works behind
+// Services and port forwards.
+func scrapeConfigHandler(cfg config, s *common.Server) http.HandlerFunc {
+	timeout := recommendedScrapeInterval
+	// Prometheus gives up earlier than the exporter would
+	if cfg.Server.WriteTimeOut > 0 && cfg.Server.WriteTimeOut < timeout {
+		timeout = cfg.Server.WriteTimeOut
+	}
+	profile := cfg.Collector.Profile
+	if profile == "" {
+		profile = collector.ProfileStandard
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := r.Host
+		if target == "" {
+			target = s.Addr()
+		}
+		sc := scrapeConfig{
+			JobName:        "instaclustr",
+			MetricsPath:    cfg.externalPath() + cfg.TelemetryPath,
+			ScrapeInterval: promDuration(recommendedScrapeInterval),
+			ScrapeTimeout:  promDuration(timeout),
+			StaticConfigs: []staticConfig{{
+				Targets: []string{target},
+				Labels:  map[string]string{"profile": profile},
+			}},
+		}
+		comments := scrapeConfigHeader
+		if cfg.Server.TLSCertFile != "" {
+			sc.Scheme = "https"
+			comments += scrapeConfigTLS
+			if cfg.Server.TLSClientCAFile != "" {
+				comments += scrapeConfigClientCerts
+			}
+		}
+		if len(cfg.Peers) > 0 {
+			sc.RelabelConfigs = []relabelConfig{{TargetLabel: "instance", Replacement: "instaclustr"}}
+			comments += scrapeConfigReplicas
+		}
+		// Marshaled, so the Host header can't inject anything
+		data, err := yaml.Marshal(scrapeConfigFile{ScrapeConfigs: []scrapeConfig{sc}})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, comments)
+		w.Write(data)
+		fmt.Fprint(w, scrapeConfigExamples)
+	}
+}
+
+// configHandler returns the effective configuration, flags and environment
+// variables merged, with its secrets redacted
+func configHandler(cfg func() config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(cfg().redacted())
+	}
+}
+
+// lastScraper tells the summary of the last collection
+type lastScraper interface {
+	LastScrape() (collector.ScrapeSummary, bool)
+}
+
+// lastScrapeHandler renders a human readable summary of the last collection
+func lastScrapeHandler(exp lastScraper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		summary, ok := exp.LastScrape()
+		if !ok {
+			fmt.Fprintln(w, "No scrape has finished yet.")
+			return
+		}
+		fmt.Fprintf(w, "Last scrape started at %s\n\n", summary.Start.Format(time.RFC3339))
+		fmt.Fprintf(w, "%-18s%s\n", "Duration:", summary.Duration)
+		fmt.Fprintf(w, "%-18s%d\n", "Clusters scanned:", summary.Clusters)
+		fmt.Fprintf(w, "%-18s%d\n", "Nodes scanned:", summary.Nodes)
+		fmt.Fprintf(w, "%-18s%d\n", "API calls:", summary.APICalls)
+		fmt.Fprintf(w, "%-18s%d\n", "Errors:", summary.Errors)
+		fmt.Fprintf(w, "%-18s%d\n", "Series emitted:", summary.Series)
+	}
+}
+
+// errorsReporter tells the latest collection errors
+type errorsReporter interface {
+	RecentErrors() []collector.CollectionError
+}
+
+// errorsHandler serves the latest collection errors as JSON, oldest first
+func errorsHandler(exp errorsReporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", jsonContentType)
+		errors := exp.RecentErrors()
+		if errors == nil {
+			errors = []collector.CollectionError{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(errors)
+	}
+}
+
+// lastSnapshot keeps the snapshot of the last collection, served to the
+// exporters federating this one
+type lastSnapshot struct {
+	mu       sync.Mutex
+	snapshot *collector.Snapshot
+}
+
+func (l *lastSnapshot) store(snapshot collector.Snapshot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.snapshot == nil || !snapshot.Time.Before(l.snapshot.Time) {
+		l.snapshot = &snapshot
+	}
+}
+
+// Handler serves the last snapshot as JSON, 503 until a collection finished
+func (l *lastSnapshot) Handler(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	snapshot := l.snapshot
+	l.mu.Unlock()
+	if snapshot == nil {
+		http.Error(w, "No collection has finished yet.", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", jsonContentType)
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/instaclustr_exporter/instaclustr"
+	"github.com/prometheus/common/log"
+)
+
+// Config defines the webhooks notified of the nodes added to and removed
+// from the clusters
+type Config struct {
+	// URLs the changes are POSTed to
+	URLs []string
+	// Header sent with every notification, e.g. "Authorization: Bearer ..."
+	Header string
+	// RetryBackoff is the first wait before a failed notification is sent
+	// again, doubling up to 5m. 1s if 0.
+	RetryBackoff time.Duration
+	// CAFile holds the PEM certificates of the CAs trusted along with the
+	// system ones for the webhooks, read once when the Notifier is created
+	CAFile string
+}
+
+// Enabled tells whether webhooks have been configured
+func (c Config) Enabled() bool {
+	return len(c.URLs) > 0
+}
+
+// ParseURLs parses comma separated webhook URLs
+func ParseURLs(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+const (
+	// maxPending is the most notifications queued per webhook, the oldest
+	// ones are dropped past it
+	maxPending = 1000
+	// maxRetryBackoff bounds the wait between two deliveries of a
+	// notification
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// Notifier posts payloads as JSON to every webhook. Every webhook has its own
+// queue, delivered in order: a notification failing is retried, with an
+// exponential backoff, before the next ones are sent.
+type Notifier struct {
+	cfg    Config
+	client *http.Client
+	queues []*queue
+}
+
+// notification is a payload marshalled as JSON
+type notification struct {
+	data []byte
+}
+
+// queue are the notifications pending for a webhook
+type queue struct {
+	url     string
+	mu      sync.Mutex
+	pending []*notification
+	wake    chan struct{}
+}
+
+// NewTransport builds a transport like http.DefaultTransport, verifying the
+// webhook certificates against the system CAs and the ones of cfg. The
+// webhooks carry their own credentials, so they share neither the proxy nor
+// the TLS settings of the InstaClustr API.
+func NewTransport(cfg Config) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile == "" {
+		return t, nil
+	}
+	pool, err := instaclustr.LoadCAFile(cfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return t, nil
+}
+
+// NewNotifier creates a Notifier sending through NewTransport and starts
+// delivering
+func NewNotifier(cfg Config) (*Notifier, error) {
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = time.Second
+	}
+	transport, err := NewTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	n := &Notifier{
+		cfg:    cfg,
+		client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+	for _, u := range cfg.URLs {
+		q := &queue{url: u, wake: make(chan struct{}, 1)}
+		n.queues = append(n.queues, q)
+		go n.deliver(q)
+	}
+	return n, nil
+}
+
+// Notify queues payload for every webhook
+func (n *Notifier) Notify(payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	notif := &notification{data}
+	for _, q := range n.queues {
+		q.mu.Lock()
+		if len(q.pending) == maxPending {
+			log.Errorf("Webhook %s is %d notifications behind, dropping the oldest one", q.url, maxPending)
+			q.pending = q.pending[1:]
+		}
+		q.pending = append(q.pending, notif)
+		q.mu.Unlock()
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of notifications not delivered yet to every
+// webhook, in the webhooks order
+func (n *Notifier) Pending() []int {
+	pending := make([]int, len(n.queues))
+	for i, q := range n.queues {
+		q.mu.Lock()
+		pending[i] = len(q.pending)
+		q.mu.Unlock()
+	}
+	return pending
+}
+
+// deliver posts the notifications of q in order, retrying the failing one
+func (n *Notifier) deliver(q *queue) {
+	backoff := n.cfg.RetryBackoff
+	for range q.wake {
+		for {
+			q.mu.Lock()
+			if len(q.pending) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			notif := q.pending[0]
+			q.mu.Unlock()
+			if err := n.post(q.url, notif.data); err != nil {
+				log.Errorf("Could not notify webhook %s, retrying in %s: %v", q.url, backoff, err)
+				time.Sleep(backoff)
+				if backoff *= 2; backoff > maxRetryBackoff {
+					backoff = maxRetryBackoff
+				}
+				continue
+			}
+			backoff = n.cfg.RetryBackoff
+			q.mu.Lock()
+			// The notification may have been dropped meanwhile
+			if len(q.pending) > 0 && q.pending[0] == notif {
+				q.pending = q.pending[1:]
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+func (n *Notifier) post(url string, data []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.cfg.Header != "" {
+		name, value, err := instaclustr.ParseHeader(n.cfg.Header)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("POST %s: unexpected status code %d: %s", req.URL.Host+req.URL.Path, resp.StatusCode, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package webhook
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a webhook failing its first requests, then recording the
+// bodies posted
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	bodies   []string
+	auth     string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures > 0 {
+		r.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	data, _ := ioutil.ReadAll(req.Body)
+	r.bodies = append(r.bodies, string(data))
+	r.auth = req.Header.Get("Authorization")
+}
+
+func (r *recorder) posted() ([]string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.bodies...), r.auth
+}
+
+// waitDelivered waits for every notification of n to be delivered
+func waitDelivered(t *testing.T, n *Notifier) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		done := true
+		for _, p := range n.Pending() {
+			done = done && p == 0
+		}
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Notifications still pending: %v", n.Pending())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ok := &recorder{}
+	okServer := httptest.NewServer(ok)
+	defer okServer.Close()
+	failing := &recorder{failures: 2}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+
+	n, err := NewNotifier(Config{
+		URLs:         []string{failingServer.URL, okServer.URL},
+		Header:       "Authorization: Bearer token",
+		RetryBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"n1", "n2", "n3"} {
+		if err := n.Notify(map[string]string{"nodeId": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitDelivered(t, n)
+
+	expected := []string{`{"nodeId":"n1"}`, `{"nodeId":"n2"}`, `{"nodeId":"n3"}`}
+	for name, r := range map[string]*recorder{"available": ok, "failing": failing} {
+		bodies, auth := r.posted()
+		if !reflect.DeepEqual(bodies, expected) {
+			t.Errorf("Posted %v to the %s webhook, want %v", bodies, name, expected)
+		}
+		if auth != "Bearer token" {
+			t.Errorf("Authorization header %q sent to the %s webhook", auth, name)
+		}
+	}
+}
+
+func TestNotifyDropsOldest(t *testing.T) {
+	// Nothing is listening, the notifications stay queued
+	n, err := NewNotifier(Config{URLs: []string{"http://127.0.0.1:1/hook"}, RetryBackoff: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxPending+10; i++ {
+		if err := n.Notify(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending := n.Pending(); !reflect.DeepEqual(pending, []int{maxPending}) {
+		t.Errorf("%v notifications pending, want %d", pending, maxPending)
+	}
+}
+
+func TestParseURLs(t *testing.T) {
+	if got, expected := ParseURLs("http://a/hook, http://b/hook,"), []string{"http://a/hook", "http://b/hook"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %v, want %v", got, expected)
+	}
+	if got := ParseURLs(""); got != nil {
+		t.Errorf("Got %v for no URL", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	post := func(cfg Config) error {
+		transport, err := NewTransport(cfg)
+		if err != nil {
+			return err
+		}
+		resp, err := (&http.Client{Transport: transport}).Post(server.URL, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := post(Config{}); err == nil {
+		t.Errorf("Webhook certificate not verified")
+	}
+
+	f, err := ioutil.TempFile("", "webhook-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	f.Close()
+	if err := post(Config{CAFile: f.Name()}); err != nil {
+		t.Errorf("Webhook signed by the CA file: %v", err)
+	}
+	if _, err := NewNotifier(Config{CAFile: f.Name() + ".missing"}); err == nil {
+		t.Errorf("Notifier created without its CA file")
+	}
+}